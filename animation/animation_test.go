@@ -0,0 +1,236 @@
+package animation
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/file"
+	"github.com/jevans40/Ruthenium/render"
+	"github.com/jevans40/Ruthenium/world"
+	"github.com/stretchr/testify/assert"
+)
+
+const asepriteSheet = `{
+	"frames": {
+		"hero 2.aseprite": {"frame": {"x": 16, "y": 0, "w": 8, "h": 8}, "rotated": false, "duration": 50},
+		"hero 0.aseprite": {"frame": {"x": 0, "y": 0, "w": 8, "h": 8}, "rotated": false, "duration": 100},
+		"hero 1.aseprite": {"frame": {"x": 8, "y": 0, "w": 8, "h": 8}, "rotated": false, "duration": 100}
+	},
+	"meta": {
+		"app": "http://www.aseprite.org/",
+		"image": "hero.png",
+		"frameTags": [
+			{"name": "walk", "from": 0, "to": 2, "direction": "pingpong"},
+			{"name": "hit", "from": 1, "to": 2, "direction": "reverse", "repeat": "2"}
+		]
+	}
+}`
+
+const texturePackerSheet = `{
+	"frames": {
+		"run_10.png": {"frame": {"x": 0, "y": 8, "w": 4, "h": 8}, "rotated": true},
+		"run_2.png": {"frame": {"x": 0, "y": 0, "w": 8, "h": 8}, "rotated": false},
+		"idle.png": {"frame": {"x": 8, "y": 0, "w": 8, "h": 8}, "rotated": false}
+	},
+	"meta": {"app": "https://www.codeandweb.com/texturepacker", "image": "sheet.png"}
+}`
+
+func TestParseSheets(t *testing.T) {
+	sheet, err := ParseSheet([]byte(asepriteSheet))
+	assert.NoError(t, err)
+	assert.Equal(t, "hero.png", sheet.Image)
+	//Hash frames keep the order of the file
+	assert.Equal(t, "hero 2.aseprite", sheet.Frames[0].Name)
+	assert.Equal(t, 50*time.Millisecond, sheet.Frames[0].Duration)
+	assert.Equal(t, Clip{Name: "walk", Frames: []int{0, 1, 2}, Direction: PingPong}, sheet.Clips["walk"])
+	assert.Equal(t, Clip{Name: "hit", Frames: []int{1, 2}, Direction: Reverse, Repeat: 2}, sheet.Clips["hit"])
+
+	sheet, err = ParseSheet([]byte(texturePackerSheet))
+	assert.NoError(t, err)
+	assert.Len(t, sheet.Frames, 3)
+	assert.True(t, sheet.Frames[0].Rotated)
+	assert.Equal(t, DefaultFrameDuration, sheet.Frames[1].Duration)
+	//Numbered frames are grouped by number, not by name
+	assert.Equal(t, Clip{Name: "run", Frames: []int{1, 0}}, sheet.Clips["run"])
+	assert.Len(t, sheet.Clips, 1)
+
+	sheet, err = ParseTexturePacker([]byte(`{"frames": [
+		{"filename": "a", "frame": {"x": 0, "y": 0, "w": 1, "h": 1}},
+		{"filename": "b", "frame": {"x": 1, "y": 0, "w": 1, "h": 1}}
+	], "animations": {"blink": ["b", "a", "b"]}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 0, 1}, sheet.Clips["blink"].Frames)
+
+	_, err = ParseAseprite([]byte(`{"frames": [{"filename": "a", "frame": {"x": 0, "y": 0, "w": 1, "h": 1}}],
+		"meta": {"frameTags": [{"name": "bad", "from": 0, "to": 3}]}}`))
+	assert.Error(t, err)
+	_, err = ParseSheet([]byte(`{"frames": {"a": {"frame": {"x": 0, "y": 0, "w": 0, "h": 1}}}}`))
+	assert.Error(t, err)
+	_, err = ParseAseprite([]byte(`{"frames": [{"filename": "a", "frame": {"x": 0, "y": 0, "w": 1, "h": 1}}],
+		"meta": {"frameTags": [{"name": "bad", "from": 0, "to": 0, "direction": "sideways"}]}}`))
+	assert.Error(t, err)
+}
+
+func TestSheetAtlas(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	var encoded bytes.Buffer
+	assert.NoError(t, png.Encode(&encoded, img))
+	fsys := fstest.MapFS{
+		"sprites/sheet.json": {Data: []byte(texturePackerSheet)},
+	}
+	_, _, err := LoadSheet(fsys, "sprites/sheet.json")
+	assert.ErrorIs(t, err, file.NotFoundError)
+	fsys["sprites/sheet.png"] = &fstest.MapFile{Data: encoded.Bytes()}
+	sheet, loaded, err := LoadSheet(fsys, "sprites/sheet.json")
+	assert.NoError(t, err)
+	assert.Equal(t, "sprites/sheet.json", sheet.Name)
+	assert.Equal(t, img.Bounds(), loaded.Bounds())
+
+	sheet, err = ParseSheet([]byte(texturePackerSheet))
+	assert.NoError(t, err)
+	sheet.Name = "sheet"
+	atlas := render.ImageAtlasFactory(64, 1)
+	assert.NoError(t, sheet.AddToAtlas(&atlas, img))
+	assert.NoError(t, atlas.Pack())
+	region, ok := atlas.GetRegion("sheet:run_10.png")
+	assert.True(t, ok)
+	assert.Equal(t, int32(4), region.W)
+	assert.Equal(t, int32(8), region.H)
+
+	animations, err := sheet.Animations(&atlas)
+	assert.NoError(t, err)
+	assert.Len(t, animations, 1)
+	assert.Equal(t, "sheet:run", animations[0].Name)
+	assert.Len(t, animations[0].Frames, 2)
+	assert.Equal(t, float32(region.X)/64, animations[0].Frames[1].TexX)
+	assert.Equal(t, float32(4)/64, animations[0].Frames[1].TexW)
+
+	sheet.Frames[0].X = 100
+	other := render.ImageAtlasFactory(64, 1)
+	assert.Error(t, sheet.AddToAtlas(&other, img))
+}
+
+func TestRotateCounterClockwise(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	red := color.RGBA{255, 0, 0, 255}
+	img.SetRGBA(0, 0, red)
+	rotated := rotateCounterClockwise(img)
+	assert.Equal(t, image.Rect(0, 0, 2, 3), rotated.Bounds())
+	assert.Equal(t, red, rotated.RGBAAt(0, 2))
+}
+
+func frames(durations ...time.Duration) []AnimationFrame {
+	result := []AnimationFrame{}
+	for i, duration := range durations {
+		result = append(result, AnimationFrame{TexX: float32(i), Duration: duration})
+	}
+	return result
+}
+
+//Advances the animator one frame duration at a time and returns the frames it showed
+func play(a *Animator, animation *Animation, steps int) []int {
+	shown := []int{}
+	for i := 0; i < steps; i++ {
+		a.Advance(animation, 10*time.Millisecond)
+		shown = append(shown, a.Frame)
+	}
+	return shown
+}
+
+func TestAnimatorDirections(t *testing.T) {
+	step := 10 * time.Millisecond
+	forward := &Animation{Name: "forward", Frames: frames(step, step, step)}
+	a := NewAnimator("forward")
+	assert.Equal(t, []int{1, 2, 0, 1}, play(&a, forward, 4))
+
+	reverse := &Animation{Name: "reverse", Frames: frames(step, step, step), Direction: Reverse, Repeat: 1}
+	a = NewAnimator("reverse")
+	assert.Equal(t, []int{1, 0, 0, 0}, play(&a, reverse, 4))
+	assert.True(t, a.Finished)
+
+	pingPong := &Animation{Name: "pingpong", Frames: frames(step, step, step), Direction: PingPong}
+	a = NewAnimator("pingpong")
+	assert.Equal(t, []int{1, 2, 1, 0, 1, 2}, play(&a, pingPong, 6))
+
+	pingPong.Repeat = 2
+	a.Play("pingpong")
+	assert.Equal(t, []int{1, 2, 1, 0, 0}, play(&a, pingPong, 5))
+	assert.True(t, a.Finished)
+
+	pingPongReverse := &Animation{Name: "back", Frames: frames(step, step, step), Direction: PingPongReverse}
+	a = NewAnimator("back")
+	assert.Equal(t, []int{1, 0, 1, 2}, play(&a, pingPongReverse, 4))
+
+	//Long frames, speed and pausing
+	slow := &Animation{Name: "slow", Frames: frames(3*step, 2*step)}
+	a = Animator{Animation: "slow", Speed: 2}
+	assert.Equal(t, []int{0, 1, 0}, play(&a, slow, 3))
+	a.Paused = true
+	assert.Equal(t, []int{0, 0}, play(&a, slow, 2))
+
+	//A single tick can skip several frames
+	a = NewAnimator("forward")
+	changed, err := a.Advance(forward, 4*step)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, 1, a.Frame)
+
+	//Switching the animation restarts it
+	a.Animation = "reverse"
+	a.Advance(reverse, 0)
+	assert.Equal(t, 2, a.Frame)
+	assert.Equal(t, time.Duration(0), a.Elapsed)
+
+	//Negative speeds are an error and leave the animator where it is
+	a = NewAnimator("forward")
+	a.Speed = -1
+	_, err = a.Advance(forward, 4*step)
+	assert.Error(t, err)
+	assert.Equal(t, Animator{Animation: "forward", Speed: -1}, a)
+}
+
+func TestAnimatorService(t *testing.T) {
+	d := world.NewSimpleDispatcher()
+	d.SetFixedTimestep(time.Second / 10)
+	walk := &Animation{Name: "walk", Frames: []AnimationFrame{
+		{TexX: 0.25, TexY: 0.5, TexW: 0.25, TexH: 0.25, TexM: 1, Duration: 100 * time.Millisecond},
+		{TexX: 0.5, TexY: 0.5, TexW: 0.25, TexH: 0.25, TexM: 1, Duration: 100 * time.Millisecond},
+	}}
+	assert.NoError(t, AddAnimations(d, NewAnimations(walk)))
+
+	renderables := component.NewVectorStorage[world.Renderable]()
+	renderableWrite, _ := component.GetWriteStorage[world.Renderable](renderables)
+	assert.NoError(t, renderableWrite.AddEntity(1, world.Renderable{W: 8, H: 8}))
+	assert.NoError(t, renderableWrite.AddEntity(2, world.Renderable{W: 8, H: 8}))
+	assert.NoError(t, renderableWrite.AddEntity(3, world.Renderable{W: 8, H: 8}))
+	assert.NoError(t, d.AddStorage(renderables))
+	animatorWrite, _ := component.GetWriteStorage[Animator](d.GetStorage(component.ReflectType[Animator]()))
+	assert.NoError(t, animatorWrite.AddEntity(1, NewAnimator("walk")))
+	assert.NoError(t, animatorWrite.AddEntity(2, NewAnimator("missing")))
+	//Skipped without stopping the others
+	assert.NoError(t, animatorWrite.AddEntity(3, Animator{Animation: "walk", Speed: -1}))
+
+	assert.NoError(t, d.Maintain())
+	first := renderableWrite.MustGetComponent(1)
+	assert.Equal(t, float32(0.5), first.TexX)
+	assert.Equal(t, float32(1), first.TexM)
+	assert.Equal(t, float64(8), first.W)
+	assert.Equal(t, float32(0), renderableWrite.MustGetComponent(2).TexX)
+	assert.Equal(t, float32(0), renderableWrite.MustGetComponent(3).TexX)
+	assert.Equal(t, Animator{Animation: "walk", Speed: -1}, animatorWrite.MustGetComponent(3))
+
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, float32(0.25), renderableWrite.MustGetComponent(1).TexX)
+	assert.Equal(t, 0, animatorWrite.MustGetComponent(1).Frame)
+
+	_, ok := NewAnimations(walk).With(&Animation{Name: "run"}).Get("run")
+	assert.True(t, ok)
+	_, ok = NewAnimations(walk).Get("run")
+	assert.False(t, ok)
+}
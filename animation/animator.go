@@ -0,0 +1,275 @@
+package animation
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//One frame of an Animation, the texture coordinates are the ones Renderable uses
+type AnimationFrame struct {
+	TexX, TexY, TexW, TexH float32
+	//The atlas page
+	TexM     float32
+	Duration time.Duration
+}
+
+//A clip that is ready to be played, usually built by Sheet.Animations
+type Animation struct {
+	Name      string
+	Frames    []AnimationFrame
+	Direction Direction
+	//How many times the animation plays, 0 plays it forever. A ping-pong pass in
+	//one direction counts as one play.
+	Repeat int
+}
+
+/***************************/
+/*        Resource         */
+
+//World resource with every animation an Animator can play, by name
+type Animations struct {
+	animations map[string]*Animation
+}
+
+func (a Animations) GetType() reflect.Type { return reflect.TypeOf(a) }
+func (a Animations) IsComponent()          {}
+
+//Creates a library holding the given animations
+func NewAnimations(animations ...*Animation) Animations {
+	return Animations{}.With(animations...)
+}
+
+//Returns the animation with the given name
+func (a Animations) Get(name string) (*Animation, bool) {
+	animation, ok := a.animations[name]
+	return animation, ok
+}
+
+//Returns a copy of the library with the given animations added, ones with the
+//same name are replaced. Write the result back to change the resource, the map
+//is never changed in place since read storages share it.
+func (a Animations) With(animations ...*Animation) Animations {
+	library := make(map[string]*Animation, len(a.animations)+len(animations))
+	for name, animation := range a.animations {
+		library[name] = animation
+	}
+	for _, animation := range animations {
+		library[animation.Name] = animation
+	}
+	return Animations{animations: library}
+}
+
+/***************************/
+/*        Animator         */
+
+//Plays an animation on the Renderable of the same entity. Changing Animation
+//starts the new animation from its first frame on the next tick.
+type Animator struct {
+	//The name of the animation in the Animations resource
+	Animation string
+	//The index of the frame that is shown
+	Frame int
+	//How long the current frame has been shown
+	Elapsed time.Duration
+	//Scales the time the animation advances by, 0 plays it at normal speed. A
+	//negative speed is an error, the animator does not advance then.
+	Speed  float64
+	Paused bool
+	//Set once an animation with a repeat count played through, it stays on its
+	//last frame
+	Finished bool
+
+	playing  string
+	backward bool
+	loops    int
+}
+
+func (a Animator) GetType() reflect.Type { return reflect.TypeOf(a) }
+func (a Animator) IsComponent()          {}
+
+//Creates an animator that plays the named animation
+func NewAnimator(name string) Animator {
+	return Animator{Animation: name}
+}
+
+//Starts the named animation from the beginning, even if it is already playing
+func (a *Animator) Play(name string) {
+	*a = Animator{Animation: name, Speed: a.Speed}
+}
+
+//Moves the animator delta further into the animation. Returns true if the
+//shown frame changed. The animator is not changed if an error is returned.
+func (a *Animator) Advance(animation *Animation, delta time.Duration) (bool, error) {
+	if a.Speed < 0 {
+		return false, fmt.Errorf("animator speed must not be negative, got %v", a.Speed)
+	}
+	frames := len(animation.Frames)
+	if frames == 0 {
+		return false, nil
+	}
+	changed := false
+	if a.playing != a.Animation {
+		a.restart(animation)
+		changed = true
+	}
+	if a.Frame < 0 || a.Frame >= frames {
+		a.Frame = 0
+		changed = true
+	}
+	if a.Paused || a.Finished {
+		return changed, nil
+	}
+	if a.Speed > 0 {
+		delta = time.Duration(float64(delta) * a.Speed)
+	}
+	a.Elapsed += delta
+	for {
+		duration := animation.Frames[a.Frame].Duration
+		if duration <= 0 {
+			duration = DefaultFrameDuration
+		}
+		if a.Elapsed < duration {
+			return changed, nil
+		}
+		a.Elapsed -= duration
+		previous := a.Frame
+		if !a.step(animation) {
+			a.Finished = true
+			a.Elapsed = 0
+			return changed, nil
+		}
+		changed = changed || a.Frame != previous
+	}
+}
+
+func (a *Animator) restart(animation *Animation) {
+	a.playing = a.Animation
+	a.Frame = 0
+	a.Elapsed = 0
+	a.Finished = false
+	a.loops = 0
+	a.backward = animation.Direction == Reverse || animation.Direction == PingPongReverse
+	if a.backward {
+		a.Frame = len(animation.Frames) - 1
+	}
+}
+
+//Moves to the next frame, returns false if the animation finished instead
+func (a *Animator) step(animation *Animation) bool {
+	last := len(animation.Frames) - 1
+	next := a.Frame + 1
+	if a.backward {
+		next = a.Frame - 1
+	}
+	if next >= 0 && next <= last {
+		a.Frame = next
+		return true
+	}
+
+	//The end of a pass
+	a.loops++
+	if animation.Repeat > 0 && a.loops >= animation.Repeat {
+		return false
+	}
+	switch animation.Direction {
+	case PingPong, PingPongReverse:
+		//Turn around without showing the end frame twice
+		a.backward = !a.backward
+		if last > 0 {
+			if a.backward {
+				a.Frame = last - 1
+			} else {
+				a.Frame = 1
+			}
+		}
+	default:
+		if a.backward {
+			a.Frame = last
+		} else {
+			a.Frame = 0
+		}
+	}
+	return true
+}
+
+/***************************/
+/*        Service          */
+
+//Adds the Animator storage, the Animations resource holding library and the
+//animator service
+func AddAnimations(d world.Dispatcher, library Animations) error {
+	if err := d.AddStorage(component.NewVectorStorage[Animator]()); err != nil {
+		return err
+	}
+	if err := d.AddStorage(component.NewResourceStorage(library)); err != nil {
+		return err
+	}
+	return d.AddService(NewAnimatorService())
+}
+
+//Creates the service that advances every Animator by the tick delta and writes
+//the current frame to the texture coordinates of the entities Renderable.
+//Animators naming an animation that is not in the library are left alone, as
+//are animators with a negative Speed, the others still advance and the first
+//error is returned.
+func NewAnimatorService() world.Service {
+	service := world.NewBaseService("animator")
+	service.SetStage(world.UpdateStage)
+	service.AddRequiredAccessComponent(world.NewComponentAccess[world.TickInfo](world.ReadAccess))
+	service.AddRequiredAccessComponent(world.NewComponentAccess[Animations](world.ReadAccess))
+	service.AddRequiredAccessComponent(world.NewComponentAccess[Animator](world.WriteAccess))
+	service.AddRequiredAccessComponent(world.NewComponentAccess[world.Renderable](world.WriteAccess))
+	service.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		ticks, err := world.GetReadStorage[world.TickInfo](service)
+		if err != nil {
+			return err
+		}
+		libraries, err := world.GetReadStorage[Animations](service)
+		if err != nil {
+			return err
+		}
+		animators, err := world.GetWriteStorage[Animator](service)
+		if err != nil {
+			return err
+		}
+		renderables, err := world.GetWriteStorage[world.Renderable](service)
+		if err != nil {
+			return err
+		}
+		delta := ticks.MustGetComponent(0).Delta
+		library := libraries.MustGetComponent(0)
+		var failed error
+		for _, e := range component.Join(animators, renderables) {
+			animator := animators.MustGetComponent(e)
+			animation, ok := library.Get(animator.Animation)
+			if !ok || len(animation.Frames) == 0 {
+				continue
+			}
+			if _, err := animator.Advance(animation, delta); err != nil {
+				if failed == nil {
+					failed = err
+				}
+				continue
+			}
+			if err := animators.Write(e, animator); err != nil {
+				return err
+			}
+			frame := animation.Frames[animator.Frame]
+			renderable := renderables.MustGetComponent(e)
+			if renderable.TexX == frame.TexX && renderable.TexY == frame.TexY && renderable.TexW == frame.TexW &&
+				renderable.TexH == frame.TexH && renderable.TexM == frame.TexM {
+				continue
+			}
+			renderable.TexX, renderable.TexY, renderable.TexW, renderable.TexH, renderable.TexM = frame.TexX, frame.TexY, frame.TexW, frame.TexH, frame.TexM
+			if err := renderables.Write(e, renderable); err != nil {
+				return err
+			}
+		}
+		return failed
+	})
+	return service
+}
@@ -0,0 +1,395 @@
+package animation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jevans40/Ruthenium/file"
+	"github.com/jevans40/Ruthenium/render"
+)
+
+//Frames without a duration of their own, TexturePacker never stores one
+const DefaultFrameDuration = 100 * time.Millisecond
+
+//The order the frames of a clip are played in
+type Direction int
+
+const (
+	Forward Direction = iota
+	Reverse
+	//Plays forward then backward without repeating the end frames
+	PingPong
+	//Like PingPong but starts backward from the last frame
+	PingPongReverse
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Forward:
+		return "forward"
+	case Reverse:
+		return "reverse"
+	case PingPong:
+		return "pingpong"
+	case PingPongReverse:
+		return "pingpong_reverse"
+	}
+	return fmt.Sprintf("Direction(%d)", int(d))
+}
+
+//Parses the direction names Aseprite uses
+func ParseDirection(name string) (Direction, error) {
+	for d := Forward; d <= PingPongReverse; d++ {
+		if d.String() == strings.ToLower(name) {
+			return d, nil
+		}
+	}
+	return Forward, fmt.Errorf("unknown animation direction %q", name)
+}
+
+//One image of a sprite sheet
+type Frame struct {
+	Name string
+	//The rectangle of the frame in the sheet image, in pixels
+	X, Y, W, H int
+	//TexturePacker stores some frames turned 90 degrees clockwise, W and H are
+	//the size of the upright frame
+	Rotated  bool
+	Duration time.Duration
+}
+
+//A named run of frames, an Aseprite tag or a TexturePacker animation
+type Clip struct {
+	Name string
+	//Indexes into Sheet.Frames in play order
+	Frames    []int
+	Direction Direction
+	//How many times the clip plays, 0 plays it forever
+	Repeat int
+}
+
+//A sprite sheet with its frames and clips
+type Sheet struct {
+	//Prefixes the atlas names of the frames, LoadSheet sets it to the file name
+	Name string
+	//The sheet image relative to the sheet file
+	Image  string
+	Frames []Frame
+	Clips  map[string]Clip
+}
+
+/***************************/
+/*         Parsing         */
+
+type sheetRect struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type sheetFrame struct {
+	Filename string    `json:"filename"`
+	Frame    sheetRect `json:"frame"`
+	Rotated  bool      `json:"rotated"`
+	Duration *int      `json:"duration"`
+}
+
+type sheetTag struct {
+	Name      string      `json:"name"`
+	From      int         `json:"from"`
+	To        int         `json:"to"`
+	Direction string      `json:"direction"`
+	Repeat    json.Number `json:"repeat"`
+}
+
+type sheetFile struct {
+	Frames     json.RawMessage     `json:"frames"`
+	Animations map[string][]string `json:"animations"`
+	Meta       struct {
+		App       string     `json:"app"`
+		Image     string     `json:"image"`
+		FrameTags []sheetTag `json:"frameTags"`
+	} `json:"meta"`
+}
+
+//Parses a sheet exported by Aseprite or TexturePacker, picked by meta.app
+func ParseSheet(data []byte) (*Sheet, error) {
+	var sheet sheetFile
+	if err := json.Unmarshal(data, &sheet); err != nil {
+		return nil, err
+	}
+	if strings.Contains(strings.ToLower(sheet.Meta.App), "aseprite") {
+		return parseAseprite(&sheet)
+	}
+	return parseTexturePacker(&sheet)
+}
+
+//Parses Aseprite's JSON export, with the frames as a hash or an array. Every
+//frame tag becomes a clip.
+func ParseAseprite(data []byte) (*Sheet, error) {
+	var sheet sheetFile
+	if err := json.Unmarshal(data, &sheet); err != nil {
+		return nil, err
+	}
+	return parseAseprite(&sheet)
+}
+
+//Parses TexturePacker's JSON-hash format. Clips come from the "animations"
+//object if there is one, otherwise frames named like walk_0.png and walk_1.png
+//are grouped into a clip called walk.
+func ParseTexturePacker(data []byte) (*Sheet, error) {
+	var sheet sheetFile
+	if err := json.Unmarshal(data, &sheet); err != nil {
+		return nil, err
+	}
+	return parseTexturePacker(&sheet)
+}
+
+func parseAseprite(sheet *sheetFile) (*Sheet, error) {
+	parsed, err := parseFrames(sheet)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range sheet.Meta.FrameTags {
+		if tag.From < 0 || tag.To >= len(parsed.Frames) || tag.From > tag.To {
+			return nil, fmt.Errorf("tag %s covers frames %d to %d of %d", tag.Name, tag.From, tag.To, len(parsed.Frames))
+		}
+		clip := Clip{Name: tag.Name}
+		if tag.Direction != "" {
+			if clip.Direction, err = ParseDirection(tag.Direction); err != nil {
+				return nil, err
+			}
+		}
+		if tag.Repeat != "" {
+			repeat, err := strconv.Atoi(tag.Repeat.String())
+			if err != nil || repeat < 0 {
+				return nil, fmt.Errorf("tag %s has an invalid repeat count %q", tag.Name, tag.Repeat)
+			}
+			clip.Repeat = repeat
+		}
+		for i := tag.From; i <= tag.To; i++ {
+			clip.Frames = append(clip.Frames, i)
+		}
+		if _, ok := parsed.Clips[clip.Name]; ok {
+			return nil, fmt.Errorf("duplicate tag %s", clip.Name)
+		}
+		parsed.Clips[clip.Name] = clip
+	}
+	return parsed, nil
+}
+
+func parseTexturePacker(sheet *sheetFile) (*Sheet, error) {
+	parsed, err := parseFrames(sheet)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]int{}
+	for i, frame := range parsed.Frames {
+		byName[frame.Name] = i
+	}
+	if len(sheet.Animations) != 0 {
+		for name, frames := range sheet.Animations {
+			clip := Clip{Name: name}
+			for _, frameName := range frames {
+				index, ok := byName[frameName]
+				if !ok {
+					//Some exporters leave out the extension here
+					if index, ok = byName[frameName+".png"]; !ok {
+						return nil, fmt.Errorf("animation %s uses the unknown frame %s", name, frameName)
+					}
+				}
+				clip.Frames = append(clip.Frames, index)
+			}
+			parsed.Clips[name] = clip
+		}
+		return parsed, nil
+	}
+
+	type numbered struct {
+		index, number int
+	}
+	groups := map[string][]numbered{}
+	for i, frame := range parsed.Frames {
+		base := strings.TrimSuffix(frame.Name, path.Ext(frame.Name))
+		digits := strings.TrimRightFunc(base, unicode.IsDigit)
+		if digits == base {
+			continue
+		}
+		number, err := strconv.Atoi(base[len(digits):])
+		if err != nil {
+			continue
+		}
+		name := strings.TrimRight(digits, "_- .")
+		groups[name] = append(groups[name], numbered{i, number})
+	}
+	for name, frames := range groups {
+		sort.SliceStable(frames, func(i, j int) bool { return frames[i].number < frames[j].number })
+		clip := Clip{Name: name}
+		for _, frame := range frames {
+			clip.Frames = append(clip.Frames, frame.index)
+		}
+		parsed.Clips[name] = clip
+	}
+	return parsed, nil
+}
+
+//Reads the frames in file order, which Go maps would lose for the hash format
+func parseFrames(sheet *sheetFile) (*Sheet, error) {
+	parsed := &Sheet{Image: sheet.Meta.Image, Clips: map[string]Clip{}}
+	var frames []sheetFrame
+	trimmed := bytes.TrimSpace(sheet.Frames)
+	switch {
+	case len(trimmed) == 0:
+		return nil, errors.New("the sheet has no frames")
+	case trimmed[0] == '[':
+		if err := json.Unmarshal(trimmed, &frames); err != nil {
+			return nil, err
+		}
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+			return nil, errors.New("frames have to be an object or an array")
+		}
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			var frame sheetFrame
+			if err := decoder.Decode(&frame); err != nil {
+				return nil, err
+			}
+			frame.Filename = token.(string)
+			frames = append(frames, frame)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, frame := range frames {
+		if names[frame.Filename] {
+			return nil, fmt.Errorf("duplicate frame %s", frame.Filename)
+		}
+		names[frame.Filename] = true
+		r := frame.Frame
+		if r.W <= 0 || r.H <= 0 || r.X < 0 || r.Y < 0 {
+			return nil, fmt.Errorf("frame %s has an invalid rectangle", frame.Filename)
+		}
+		duration := DefaultFrameDuration
+		if frame.Duration != nil && *frame.Duration > 0 {
+			duration = time.Duration(*frame.Duration) * time.Millisecond
+		}
+		parsed.Frames = append(parsed.Frames, Frame{Name: frame.Filename, X: r.X, Y: r.Y, W: r.W, H: r.H, Rotated: frame.Rotated, Duration: duration})
+	}
+	return parsed, nil
+}
+
+//Reads a sheet and its image from fsys. The image path in the sheet is relative
+//to the sheet file.
+func LoadSheet(fsys fs.FS, name string) (*Sheet, *image.RGBA, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	sheet, err := ParseSheet(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	sheet.Name = name
+	img, err := file.ReadImageFS(fsys, path.Join(path.Dir(name), sheet.Image))
+	if err != nil {
+		return nil, nil, err
+	}
+	return sheet, img, nil
+}
+
+/***************************/
+/*          Atlas          */
+
+//Returns the name a frame is stored under in an atlas
+func (s *Sheet) AtlasName(frame int) string {
+	if s.Name == "" {
+		return s.Frames[frame].Name
+	}
+	return s.Name + ":" + s.Frames[frame].Name
+}
+
+//Cuts every frame out of the sheet image and adds it to the atlas, rotated
+//frames are turned upright. The atlas has to be packed afterwards.
+func (s *Sheet) AddToAtlas(atlas *render.ImageAtlas, sheetImage image.Image) error {
+	bounds := sheetImage.Bounds()
+	for i, frame := range s.Frames {
+		w, h := frame.W, frame.H
+		if frame.Rotated {
+			w, h = h, w
+		}
+		area := image.Rect(frame.X, frame.Y, frame.X+w, frame.Y+h).Add(bounds.Min)
+		if !area.In(bounds) {
+			return fmt.Errorf("frame %s is outside of the sheet image", frame.Name)
+		}
+		cut := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(cut, cut.Bounds(), sheetImage, area.Min, draw.Src)
+		if frame.Rotated {
+			cut = rotateCounterClockwise(cut)
+		}
+		atlas.AddImageFromImage(cut, s.AtlasName(i))
+	}
+	return nil
+}
+
+func rotateCounterClockwise(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	rotated := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			rotated.SetRGBA(y, b.Dx()-1-x, img.RGBAAt(x, y))
+		}
+	}
+	return rotated
+}
+
+//Builds an Animation for every clip from where its frames were packed in the
+//atlas. Animations are named after their clip, prefixed like AtlasName.
+func (s *Sheet) Animations(atlas *render.ImageAtlas) ([]*Animation, error) {
+	names := make([]string, 0, len(s.Clips))
+	for name := range s.Clips {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	size := float32(atlas.GetPageSize())
+	animations := []*Animation{}
+	for _, name := range names {
+		clip := s.Clips[name]
+		animation := &Animation{Name: name, Direction: clip.Direction, Repeat: clip.Repeat}
+		if s.Name != "" {
+			animation.Name = s.Name + ":" + name
+		}
+		for _, index := range clip.Frames {
+			region, ok := atlas.GetRegion(s.AtlasName(index))
+			if !ok {
+				return nil, fmt.Errorf("frame %s is not packed in the atlas", s.AtlasName(index))
+			}
+			animation.Frames = append(animation.Frames, AnimationFrame{
+				TexX:     float32(region.X) / size,
+				TexY:     float32(region.Y) / size,
+				TexW:     float32(region.W) / size,
+				TexH:     float32(region.H) / size,
+				TexM:     float32(region.Page),
+				Duration: s.Frames[index].Duration,
+			})
+		}
+		animations = append(animations, animation)
+	}
+	return animations, nil
+}
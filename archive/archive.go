@@ -0,0 +1,356 @@
+package archive
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"sort"
+	"strings"
+)
+
+//An archive bundles a tree of asset files into one file for shipping builds.
+//All integers are little endian, varints are unsigned:
+//
+//	"RARC" version
+//	file data, each entry stored or deflated
+//	index: entryCount, for every entry:
+//	  nameLength name offset storedSize size compression sha256(content)
+//	indexOffset (8 bytes) "RARC"
+//
+//The index sits at the end so archives can be written in one pass. Names are
+//slash separated paths as used by io/fs.
+
+const (
+	archiveMagic   = "RARC"
+	archiveVersion = 1
+	trailerSize    = 8 + len(archiveMagic)
+)
+
+//How the data of an entry is stored
+type Compression uint8
+
+const (
+	Stored Compression = iota
+	Deflated
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Stored:
+		return "stored"
+	case Deflated:
+		return "deflated"
+	}
+	return fmt.Sprintf("Compression(%d)", int(c))
+}
+
+//One file in an archive
+type Entry struct {
+	Name        string
+	Offset      int64
+	StoredSize  int64
+	Size        int64
+	Compression Compression
+	//The sha256 of the uncompressed content
+	Hash [sha256.Size]byte
+}
+
+var NotAnArchiveError = errors.New("not an asset archive")
+
+//Returned when the content of an entry does not match its hash
+type CorruptEntryError struct {
+	Name string
+}
+
+func (e *CorruptEntryError) Error() string {
+	return fmt.Sprintf("archive entry %s is corrupt", e.Name)
+}
+
+/***************************/
+/*         Writer          */
+
+//Writes an archive entry by entry, Close writes the index
+type Writer struct {
+	w       io.Writer
+	offset  int64
+	entries []Entry
+	names   map[string]bool
+	err     error
+}
+
+//Starts a new archive in w
+func NewWriter(w io.Writer) (*Writer, error) {
+	header := append([]byte(archiveMagic), archiveVersion)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, offset: int64(len(header)), names: map[string]bool{}}, nil
+}
+
+//Adds a file. The name has to be a valid io/fs path and unique.
+func (w *Writer) Add(name string, data []byte, compression Compression) error {
+	if w.err != nil {
+		return w.err
+	}
+	if !fs.ValidPath(name) || name == "." {
+		return fmt.Errorf("invalid archive entry name %q", name)
+	}
+	if w.names[name] {
+		return fmt.Errorf("duplicate archive entry %s", name)
+	}
+	stored := data
+	switch compression {
+	case Stored:
+	case Deflated:
+		var buf bytes.Buffer
+		compressor, _ := flate.NewWriter(&buf, flate.BestCompression)
+		compressor.Write(data)
+		compressor.Close()
+		//Data that does not shrink is stored as it is
+		if buf.Len() < len(data) {
+			stored = buf.Bytes()
+		} else {
+			compression = Stored
+		}
+	default:
+		return fmt.Errorf("unknown compression %d", compression)
+	}
+	if _, err := w.w.Write(stored); err != nil {
+		w.err = err
+		return err
+	}
+	w.entries = append(w.entries, Entry{
+		Name:        name,
+		Offset:      w.offset,
+		StoredSize:  int64(len(stored)),
+		Size:        int64(len(data)),
+		Compression: compression,
+		Hash:        sha256.Sum256(data),
+	})
+	w.names[name] = true
+	w.offset += int64(len(stored))
+	return nil
+}
+
+//Writes the index, the underlying writer is not closed
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	var index bytes.Buffer
+	var buf [binary.MaxVarintLen64]byte
+	uvarint := func(v uint64) {
+		index.Write(buf[:binary.PutUvarint(buf[:], v)])
+	}
+	uvarint(uint64(len(w.entries)))
+	for _, e := range w.entries {
+		uvarint(uint64(len(e.Name)))
+		index.WriteString(e.Name)
+		uvarint(uint64(e.Offset))
+		uvarint(uint64(e.StoredSize))
+		uvarint(uint64(e.Size))
+		index.WriteByte(byte(e.Compression))
+		index.Write(e.Hash[:])
+	}
+	binary.LittleEndian.PutUint64(buf[:8], uint64(w.offset))
+	index.Write(buf[:8])
+	index.WriteString(archiveMagic)
+	_, err := w.w.Write(index.Bytes())
+	w.err = errors.New("the archive is closed")
+	return err
+}
+
+//Returns Stored for formats that are compressed already and Deflated otherwise
+func DefaultCompression(name string) Compression {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".gz", ".zip", ".ogg", ".mp3", ".rarc", ".rrec":
+		return Stored
+	}
+	return Deflated
+}
+
+//Writes every file of root into an archive. compression picks how each file is
+//stored, nil uses DefaultCompression.
+func Pack(w io.Writer, root fs.FS, compression func(name string) Compression) error {
+	if compression == nil {
+		compression = DefaultCompression
+	}
+	archive, err := NewWriter(w)
+	if err != nil {
+		return err
+	}
+	err = fs.WalkDir(root, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		data, err := fs.ReadFile(root, name)
+		if err != nil {
+			return err
+		}
+		return archive.Add(name, data, compression(name))
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+/***************************/
+/*         Reader          */
+
+//Reads an index from r, size is the size of the whole archive
+func readIndex(r io.ReaderAt, size int64) ([]Entry, error) {
+	if size < int64(len(archiveMagic)+1+trailerSize) {
+		return nil, NotAnArchiveError
+	}
+	header := make([]byte, len(archiveMagic)+1)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if string(header[:len(archiveMagic)]) != archiveMagic {
+		return nil, NotAnArchiveError
+	}
+	if header[len(archiveMagic)] != archiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", header[len(archiveMagic)])
+	}
+	trailer := make([]byte, trailerSize)
+	if _, err := r.ReadAt(trailer, size-int64(trailerSize)); err != nil {
+		return nil, err
+	}
+	if string(trailer[8:]) != archiveMagic {
+		return nil, NotAnArchiveError
+	}
+	indexOffset := int64(binary.LittleEndian.Uint64(trailer))
+	indexEnd := size - int64(trailerSize)
+	if indexOffset < int64(len(header)) || indexOffset > indexEnd {
+		return nil, errors.New("broken archive index offset")
+	}
+	index := make([]byte, indexEnd-indexOffset)
+	if _, err := r.ReadAt(index, indexOffset); err != nil {
+		return nil, err
+	}
+
+	reader := bytes.NewReader(index)
+	var readErr error
+	uvarint := func() int64 {
+		if readErr != nil {
+			return 0
+		}
+		var v uint64
+		v, readErr = binary.ReadUvarint(reader)
+		if readErr == nil && v > math.MaxInt64 {
+			readErr = errors.New("value out of range")
+		}
+		return int64(v)
+	}
+	count := uvarint()
+	if readErr == nil && count > int64(len(index)) {
+		return nil, errors.New("broken archive index")
+	}
+	entries := make([]Entry, 0, count)
+	for i := int64(0); i < count && readErr == nil; i++ {
+		var e Entry
+		nameLength := uvarint()
+		if readErr == nil && nameLength > int64(reader.Len()) {
+			readErr = io.ErrUnexpectedEOF
+		}
+		if readErr != nil {
+			break
+		}
+		name := make([]byte, nameLength)
+		_, readErr = io.ReadFull(reader, name)
+		e.Name = string(name)
+		e.Offset = uvarint()
+		e.StoredSize = uvarint()
+		e.Size = uvarint()
+		if readErr != nil {
+			break
+		}
+		var compression byte
+		if compression, readErr = reader.ReadByte(); readErr != nil {
+			break
+		}
+		e.Compression = Compression(compression)
+		_, readErr = io.ReadFull(reader, e.Hash[:])
+		if readErr == nil && (e.Offset < int64(len(header)) || e.StoredSize > indexOffset-e.Offset || !fs.ValidPath(e.Name)) {
+			readErr = fmt.Errorf("entry %q is out of range", e.Name)
+		}
+		entries = append(entries, e)
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("broken archive index: %w", readErr)
+	}
+	return entries, nil
+}
+
+//Reads and checks the content of an entry
+func readEntry(r io.ReaderAt, e *Entry) ([]byte, error) {
+	stored := make([]byte, e.StoredSize)
+	if _, err := r.ReadAt(stored, e.Offset); err != nil {
+		return nil, err
+	}
+	data := stored
+	switch e.Compression {
+	case Stored:
+	case Deflated:
+		decompressor := flate.NewReader(bytes.NewReader(stored))
+		defer decompressor.Close()
+		//The size is only trusted as far as the stored data can back it
+		limit := e.Size
+		if limit > e.StoredSize*1032+1024 {
+			return nil, &CorruptEntryError{Name: e.Name}
+		}
+		data = make([]byte, limit)
+		if _, err := io.ReadFull(decompressor, data); err != nil {
+			return nil, &CorruptEntryError{Name: e.Name}
+		}
+	default:
+		return nil, fmt.Errorf("archive entry %s has unknown compression %d", e.Name, e.Compression)
+	}
+	if int64(len(data)) != e.Size || sha256.Sum256(data) != e.Hash {
+		return nil, &CorruptEntryError{Name: e.Name}
+	}
+	return data, nil
+}
+
+//Sorts entries by name and returns the directories they imply, "." included
+func buildDirectories(entries []Entry) (map[string]*Entry, map[string][]fs.DirEntry, error) {
+	files := make(map[string]*Entry, len(entries))
+	dirs := map[string][]fs.DirEntry{".": {}}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	for i := range entries {
+		e := &entries[i]
+		if _, ok := files[e.Name]; ok {
+			return nil, nil, fmt.Errorf("duplicate archive entry %s", e.Name)
+		}
+		files[e.Name] = e
+		child := fs.DirEntry(dirEntry{fileInfo{name: path.Base(e.Name), size: e.Size}})
+		for name := e.Name; name != "."; {
+			parent := path.Dir(name)
+			_, known := dirs[parent]
+			dirs[parent] = append(dirs[parent], child)
+			if known {
+				break
+			}
+			child = dirEntry{fileInfo{name: path.Base(parent), dir: true}}
+			name = parent
+		}
+	}
+	for name := range dirs {
+		if _, ok := files[name]; ok {
+			return nil, nil, fmt.Errorf("archive entry %s is also a directory", name)
+		}
+		sort.Slice(dirs[name], func(i, j int) bool { return dirs[name][i].Name() < dirs[name][j].Name() })
+	}
+	return files, dirs, nil
+}
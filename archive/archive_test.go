@@ -0,0 +1,109 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testTree() fstest.MapFS {
+	return fstest.MapFS{
+		"image/God.png":       {Data: []byte("\x89PNG not really a png")},
+		"image/ui/button.png": {Data: []byte("button")},
+		"shader/sprite.vert":  {Data: []byte(strings.Repeat("void main(){}\n", 100))},
+		"scene/level.json":    {Data: []byte(`{"entities":[]}`)},
+		"empty.txt":           {Data: []byte{}},
+	}
+}
+
+func TestArchive(t *testing.T) {
+	tree := testTree()
+	var buf bytes.Buffer
+	assert.NoError(t, Pack(&buf, tree, nil))
+	a, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+
+	//The archive behaves like the directory it was made from
+	assert.NoError(t, fstest.TestFS(a, "image/God.png", "image/ui/button.png", "shader/sprite.vert", "scene/level.json", "empty.txt"))
+	for name, f := range tree {
+		data, err := fs.ReadFile(a, name)
+		assert.NoError(t, err)
+		assert.Equal(t, f.Data, data)
+	}
+	assert.NoError(t, a.Verify())
+
+	names := []string{}
+	for _, e := range a.Entries() {
+		names = append(names, e.Name)
+		switch e.Name {
+		case "image/God.png":
+			assert.Equal(t, Stored, e.Compression)
+		case "shader/sprite.vert":
+			assert.Equal(t, Deflated, e.Compression)
+			assert.Less(t, e.StoredSize, e.Size)
+		}
+	}
+	assert.Equal(t, []string{"empty.txt", "image/God.png", "image/ui/button.png", "scene/level.json", "shader/sprite.vert"}, names)
+
+	_, err = a.Open("missing.png")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	_, err = a.Open("../escape")
+	assert.True(t, errors.Is(err, fs.ErrInvalid))
+}
+
+func TestArchiveCorruption(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Add("a.txt", []byte("first file"), Stored))
+	assert.NoError(t, w.Add("b.txt", []byte(strings.Repeat("second", 50)), Deflated))
+	assert.Error(t, w.Add("a.txt", []byte("again"), Stored))
+	assert.Error(t, w.Add("/rooted", []byte("bad"), Stored))
+	assert.NoError(t, w.Close())
+	assert.Error(t, w.Add("late.txt", nil, Stored))
+
+	//Flipping a byte of the content fails the hash check
+	data := append([]byte{}, buf.Bytes()...)
+	data[len(archiveMagic)+1] ^= 0xff
+	a, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	_, err = a.ReadFile("a.txt")
+	var corrupt *CorruptEntryError
+	assert.True(t, errors.As(err, &corrupt))
+	assert.Equal(t, "a.txt", corrupt.Name)
+	assert.Error(t, a.Verify())
+	content, err := a.ReadFile("b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("second", 50), string(content))
+
+	_, err = NewReader(bytes.NewReader([]byte("definitely not an archive")), 25)
+	assert.ErrorIs(t, err, NotAnArchiveError)
+	//Truncated archives lose their trailer
+	_, err = NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-3]), int64(buf.Len()-3))
+	assert.Error(t, err)
+}
+
+func TestOpenArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "res.rarc")
+	var buf bytes.Buffer
+	assert.NoError(t, Pack(&buf, testTree(), func(string) Compression { return Deflated }))
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	a, err := Open(path)
+	assert.NoError(t, err)
+	defer a.Close()
+	data, err := fs.ReadFile(a, "scene/level.json")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"entities":[]}`, string(data))
+	entries, err := fs.ReadDir(a, "image")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "God.png", entries[0].Name())
+	assert.True(t, entries[1].IsDir())
+}
@@ -0,0 +1,208 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+)
+
+var _ fs.ReadFileFS = &Archive{}
+var _ fs.ReadDirFS = &Archive{}
+var _ fs.StatFS = &Archive{}
+
+//An opened archive. It implements io/fs.FS so loaders can read from it the same
+//way they read from a directory with os.DirFS. Files are checked against their
+//hash whenever they are read.
+type Archive struct {
+	r       io.ReaderAt
+	closer  io.Closer
+	entries []Entry
+	files   map[string]*Entry
+	dirs    map[string][]fs.DirEntry
+}
+
+//Opens the archive file at filename
+func Open(filename string) (*Archive, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a, err := NewReader(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: filename, Err: err}
+	}
+	a.closer = f
+	return a, nil
+}
+
+//Reads the archive stored in r, size is the size of the archive in bytes
+func NewReader(r io.ReaderAt, size int64) (*Archive, error) {
+	entries, err := readIndex(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files, dirs, err := buildDirectories(entries)
+	if err != nil {
+		return nil, err
+	}
+	return &Archive{r: r, entries: entries, files: files, dirs: dirs}, nil
+}
+
+//Closes the file opened by Open
+func (a *Archive) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+//Returns every entry sorted by name
+func (a *Archive) Entries() []Entry {
+	return append([]Entry{}, a.entries...)
+}
+
+//Reads every entry and returns the first one that does not match its hash
+func (a *Archive) Verify() error {
+	for i := range a.entries {
+		if _, err := readEntry(a.r, &a.entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Archive) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := a.files[name]
+	if !ok {
+		if _, dir := a.dirs[name]; dir {
+			return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+		}
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	data, err := readEntry(a.r, e)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+func (a *Archive) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if entries, ok := a.dirs[name]; ok {
+		return &dirFile{info: fileInfo{name: path.Base(name), dir: true}, entries: entries}, nil
+	}
+	e, ok := a.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	data, err := readEntry(a.r, e)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{Reader: bytes.NewReader(data), info: fileInfo{name: path.Base(name), size: e.Size}}, nil
+}
+
+func (a *Archive) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if _, ok := a.dirs[name]; ok {
+		return fileInfo{name: path.Base(name), dir: true}, nil
+	}
+	if e, ok := a.files[name]; ok {
+		return fileInfo{name: path.Base(name), size: e.Size}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (a *Archive) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, ok := a.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]fs.DirEntry{}, entries...), nil
+}
+
+/***************************/
+/*         Files           */
+
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return i.dir }
+func (i fileInfo) Sys() interface{}   { return nil }
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+type dirEntry struct {
+	info fileInfo
+}
+
+func (d dirEntry) Name() string               { return d.info.name }
+func (d dirEntry) IsDir() bool                { return d.info.dir }
+func (d dirEntry) Type() fs.FileMode          { return d.info.Mode().Type() }
+func (d dirEntry) Info() (fs.FileInfo, error) { return d.info, nil }
+
+type file struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+type dirFile struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	read    int
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error               { return nil }
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *dirFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.read:]
+	if count <= 0 {
+		d.read = len(d.entries)
+		return append([]fs.DirEntry{}, remaining...), nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+	d.read += count
+	return append([]fs.DirEntry{}, remaining[:count]...), nil
+}
@@ -0,0 +1,400 @@
+package asset
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+//The asset server loads files on background goroutines and hands out typed
+//handles right away. Loading the same path as the same type twice returns the
+//same handle, every Load counts as a reference and the asset is dropped once
+//every reference was released.
+
+//The load state of an asset
+type LoadState int
+
+const (
+	Pending LoadState = iota
+	Loaded
+	Failed
+	//The asset was released, or the handle never belonged to the server
+	Unloaded
+)
+
+func (s LoadState) String() string {
+	switch s {
+	case Pending:
+		return "Pending"
+	case Loaded:
+		return "Loaded"
+	case Failed:
+		return "Failed"
+	case Unloaded:
+		return "Unloaded"
+	}
+	return fmt.Sprintf("LoadState(%d)", int(s))
+}
+
+//Identifies an asset of a Server, 0 is never used
+type HandleID uint64
+
+//A typed reference to an asset of a Server. It only holds an ID, so components
+//can store handles and they can be compared. The zero Handle refers to nothing.
+type Handle[T any] struct {
+	id HandleID
+}
+
+func (h Handle[T]) ID() HandleID {
+	return h.id
+}
+
+//Returns false for the zero Handle
+func (h Handle[T]) IsValid() bool {
+	return h.id != 0
+}
+
+var NoLoaderError = errors.New("no loader is registered for the asset type")
+var UnknownHandleError = errors.New("the handle does not refer to an asset of the server")
+
+//Returned by Wait and State for an asset that failed to load
+type LoadError struct {
+	Path string
+	Err  error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("loading %s: %v", e.Path, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+type loadFunc func(path string) (interface{}, error)
+
+type assetKey struct {
+	assetType reflect.Type
+	path      string
+}
+
+type entry struct {
+	key   assetKey
+	refs  int
+	state LoadState
+	value interface{}
+	err   error
+	//Closed once loading finished, even if the asset was released before
+	done chan struct{}
+	//Counts calls to Reload so only the newest reload is kept
+	reloads uint64
+}
+
+type Server struct {
+	//nil reads files from the operating system
+	fsys fs.FS
+
+	lock    sync.Mutex
+	loaders map[reflect.Type]loadFunc
+	ids     map[assetKey]HandleID
+	entries map[HandleID]*entry
+	lastID  HandleID
+
+	//Changes whenever the state of any asset changes
+	version uint64
+
+	reloadListeners []func(Reloaded)
+}
+
+//Creates a server that can load *image.RGBA, *file.Font and ShaderSource assets,
+//more types can be added with AddLoader. Paths are operating system paths.
+func NewServer() *Server {
+	return NewServerFS(nil)
+}
+
+//Creates a server that reads assets from fsys, like a directory from os.DirFS,
+//an archive.Archive or file.Resources. Paths are slash separated fsys paths.
+func NewServerFS(fsys fs.FS) *Server {
+	s := &Server{
+		fsys:    fsys,
+		loaders: map[reflect.Type]loadFunc{},
+		ids:     map[assetKey]HandleID{},
+		entries: map[HandleID]*entry{},
+	}
+	addDefaultLoaders(s)
+	return s
+}
+
+//Registers the function that loads assets of type T, replacing any earlier one.
+//It is called on a background goroutine.
+func AddLoader[T any](s *Server, load func(path string) (T, error)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.loaders[reflect.TypeOf((*T)(nil)).Elem()] = func(path string) (interface{}, error) {
+		return load(path)
+	}
+}
+
+//Starts loading name as a T and returns its handle without waiting. If the path
+//was already loaded as a T the existing handle is returned. Either way the
+//caller holds a reference and has to Release it when done.
+func Load[T any](s *Server, name string) (Handle[T], error) {
+	key := assetKey{assetType: reflect.TypeOf((*T)(nil)).Elem(), path: s.clean(name)}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if id, ok := s.ids[key]; ok {
+		s.entries[id].refs++
+		return Handle[T]{id}, nil
+	}
+	load, ok := s.loaders[key.assetType]
+	if !ok {
+		return Handle[T]{}, fmt.Errorf("%w: %v", NoLoaderError, key.assetType)
+	}
+	s.lastID++
+	id := s.lastID
+	e := &entry{key: key, refs: 1, state: Pending, done: make(chan struct{})}
+	s.ids[key] = id
+	s.entries[id] = e
+	s.version++
+	go s.load(e, load)
+	return Handle[T]{id}, nil
+}
+
+func (s *Server) load(e *entry, load loadFunc) {
+	value, err := load(e.key.path)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	defer close(e.done)
+	if e.state == Unloaded {
+		return
+	}
+	if err != nil {
+		e.state = Failed
+		e.err = &LoadError{Path: e.key.path, Err: err}
+	} else {
+		e.state = Loaded
+		e.value = value
+	}
+	s.version++
+}
+
+//Returns the file system assets are read from, nil for operating system paths
+func (s *Server) FS() fs.FS {
+	return s.fsys
+}
+
+//Reads a whole file the way the server reads assets, for custom loaders
+func (s *Server) ReadFile(name string) ([]byte, error) {
+	if s.fsys == nil {
+		return ioutil.ReadFile(name)
+	}
+	return fs.ReadFile(s.fsys, name)
+}
+
+func (s *Server) stat(name string) (fs.FileInfo, error) {
+	if s.fsys == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(s.fsys, name)
+}
+
+func (s *Server) clean(name string) string {
+	if s.fsys == nil {
+		return filepath.Clean(name)
+	}
+	return path.Clean(name)
+}
+
+//Returns the asset if it finished loading
+func Get[T any](s *Server, h Handle[T]) (T, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var value T
+	e, ok := s.entries[h.id]
+	if !ok || e.state != Loaded {
+		return value, false
+	}
+	value, ok = e.value.(T)
+	return value, ok
+}
+
+//Returns the asset if it finished loading and fallback otherwise, for example
+//file.MissingTexture for images so a missing file stays visible
+func GetOr[T any](s *Server, h Handle[T], fallback T) T {
+	if value, ok := Get(s, h); ok {
+		return value
+	}
+	return fallback
+}
+
+//Blocks until the asset finished loading. Returns a *LoadError if it failed and
+//UnknownHandleError if it was released.
+func Wait[T any](s *Server, h Handle[T]) (T, error) {
+	s.lock.Lock()
+	e, ok := s.entries[h.id]
+	s.lock.Unlock()
+	var value T
+	if !ok {
+		return value, UnknownHandleError
+	}
+	<-e.done
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch e.state {
+	case Loaded:
+		return e.value.(T), nil
+	case Failed:
+		return value, e.err
+	}
+	return value, UnknownHandleError
+}
+
+//Blocks until every asset that is loading right now finished
+func (s *Server) WaitAll() {
+	s.lock.Lock()
+	pending := []chan struct{}{}
+	for _, e := range s.entries {
+		if e.state == Pending {
+			pending = append(pending, e.done)
+		}
+	}
+	s.lock.Unlock()
+	for _, done := range pending {
+		<-done
+	}
+}
+
+//Returns the state of an asset, and the *LoadError if it failed
+func (s *Server) State(id HandleID) (LoadState, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return Unloaded, nil
+	}
+	return e.state, e.err
+}
+
+//Returns the cleaned path an asset was loaded from
+func (s *Server) Path(id HandleID) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return "", UnknownHandleError
+	}
+	return e.key.path, nil
+}
+
+//Adds a reference to an asset, for handles that are copied to a new owner
+func (s *Server) Retain(id HandleID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return UnknownHandleError
+	}
+	e.refs++
+	return nil
+}
+
+//Removes a reference to an asset. The asset is dropped with its last reference,
+//loading it again afterwards returns a new handle.
+func (s *Server) Release(id HandleID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return UnknownHandleError
+	}
+	e.refs--
+	if e.refs > 0 {
+		return nil
+	}
+	e.state = Unloaded
+	e.value = nil
+	delete(s.entries, id)
+	delete(s.ids, e.key)
+	s.version++
+	return nil
+}
+
+//Returns the number of references to an asset, 0 if it is not loaded
+func (s *Server) References(id HandleID) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, ok := s.entries[id]; ok {
+		return e.refs
+	}
+	return 0
+}
+
+/***************************/
+/*        Reloading        */
+
+//Sent after an asset was loaded again
+type Reloaded struct {
+	ID   HandleID
+	Path string
+	//The *LoadError if loading failed, the asset keeps its old value then
+	Err error
+}
+
+//Adds a function that is called after every reload, on the goroutine that
+//loaded the asset
+func (s *Server) OnReload(listener func(Reloaded)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reloadListeners = append(s.reloadListeners, listener)
+}
+
+//Loads an asset again in the background, handles stay the same. The old value
+//is used until the new one is loaded and kept if loading fails. Does nothing
+//for assets that are still loading.
+func (s *Server) Reload(id HandleID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return UnknownHandleError
+	}
+	if e.state == Pending {
+		return nil
+	}
+	e.reloads++
+	go s.reload(id, e, s.loaders[e.key.assetType], e.reloads)
+	return nil
+}
+
+func (s *Server) reload(id HandleID, e *entry, load loadFunc, reload uint64) {
+	value, err := load(e.key.path)
+	s.lock.Lock()
+	//A newer reload replaces this one
+	if e.state == Unloaded || e.reloads != reload {
+		s.lock.Unlock()
+		return
+	}
+	event := Reloaded{ID: id, Path: e.key.path}
+	if err != nil {
+		event.Err = &LoadError{Path: e.key.path, Err: err}
+		if e.state == Failed {
+			e.err = event.Err
+		}
+	} else {
+		e.state = Loaded
+		e.value = value
+		e.err = nil
+	}
+	s.version++
+	listeners := append([]func(Reloaded){}, s.reloadListeners...)
+	s.lock.Unlock()
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
@@ -0,0 +1,280 @@
+package asset
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jevans40/Ruthenium/archive"
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/file"
+	"github.com/jevans40/Ruthenium/render"
+	"github.com/jevans40/Ruthenium/world"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestImage(t *testing.T, path string, width int) {
+	img := image.NewNRGBA(image.Rect(0, 0, width, 2))
+	img.Set(0, 0, color.NRGBA{255, 0, 0, 255})
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(f, img))
+	assert.NoError(t, f.Close())
+}
+
+type testText string
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.png")
+	writeTestImage(t, path, 4)
+	s := NewServer()
+
+	//Loading the same path twice shares the asset
+	first, err := Load[*image.RGBA](s, path)
+	assert.NoError(t, err)
+	second, err := Load[*image.RGBA](s, filepath.Join(dir, ".", "test.png"))
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 2, s.References(first.ID()))
+
+	img, err := Wait(s, first)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, img.Bounds().Dx())
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, img.RGBAAt(0, 0))
+	got, ok := Get(s, second)
+	assert.True(t, ok)
+	assert.Same(t, img, got)
+
+	//The asset is dropped with the last reference
+	assert.NoError(t, s.Release(first.ID()))
+	state, _ := s.State(first.ID())
+	assert.Equal(t, Loaded, state)
+	assert.NoError(t, s.Release(second.ID()))
+	state, _ = s.State(first.ID())
+	assert.Equal(t, Unloaded, state)
+	_, ok = Get(s, first)
+	assert.False(t, ok)
+	assert.ErrorIs(t, s.Release(first.ID()), UnknownHandleError)
+	third, _ := Load[*image.RGBA](s, path)
+	assert.NotEqual(t, first, third)
+
+	//Failures keep their error
+	missing, err := Load[*image.RGBA](s, filepath.Join(dir, "missing.png"))
+	assert.NoError(t, err)
+	_, err = Wait(s, missing)
+	var loadErr *LoadError
+	assert.True(t, errors.As(err, &loadErr))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.True(t, errors.Is(err, file.NotFoundError))
+	assert.Equal(t, 16, GetOr(s, missing, file.MissingTexture()).Bounds().Dx())
+	state, stateErr := s.State(missing.ID())
+	assert.Equal(t, Failed, state)
+	assert.Equal(t, err, stateErr)
+
+	_, err = Load[testText](s, path)
+	assert.ErrorIs(t, err, NoLoaderError)
+}
+
+func TestAssetService(t *testing.T) {
+	s := NewServer()
+	release := make(chan struct{})
+	AddLoader(s, func(path string) (testText, error) {
+		<-release
+		if path == "bad" {
+			return "", errors.New("bad text")
+		}
+		return testText("text of " + path), nil
+	})
+
+	d := world.NewSimpleDispatcher()
+	assert.NoError(t, AddAssets(d, s))
+	var seen []Assets
+	reader := world.NewBaseService("reader")
+	reader.AddRequiredAccessComponent(world.NewComponentAccess[Assets](world.ReadAccess))
+	reader.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		storage, err := world.GetReadStorage[Assets](reader)
+		if err != nil {
+			return err
+		}
+		seen = append(seen, storage.MustGetComponent(0))
+		return nil
+	})
+	assert.NoError(t, d.AddService(reader))
+
+	good, _ := Load[testText](s, "good")
+	bad, _ := Load[testText](s, "bad")
+	assert.NoError(t, d.Maintain())
+	assets := seen[len(seen)-1]
+	assert.Equal(t, 2, assets.Pending())
+	assert.False(t, assets.Ready(good.ID()))
+
+	close(release)
+	s.WaitAll()
+	assert.NoError(t, d.Maintain())
+	assets = seen[len(seen)-1]
+	assert.Equal(t, 0, assets.Pending())
+	assert.True(t, assets.Ready(good.ID()))
+	assert.False(t, assets.Ready(bad.ID()))
+	failed := assets.Failed()
+	assert.Len(t, failed, 1)
+	assert.Equal(t, "bad", failed[0].Path)
+	assert.Error(t, failed[0].Err)
+	text, ok := Get(s, good)
+	assert.True(t, ok)
+	assert.Equal(t, testText("text of good"), text)
+
+	assert.NoError(t, s.Release(good.ID()))
+	assert.NoError(t, d.Maintain())
+	_, ok = seen[len(seen)-1].Status(good.ID())
+	assert.False(t, ok)
+}
+
+type testProgram struct {
+	vertex, fragment string
+	compiles         int
+}
+
+func (p *testProgram) ReloadProgram(vertex, fragment string) error {
+	if strings.Contains(fragment, "broken") {
+		return errors.New("the fragment shader does not compile")
+	}
+	p.vertex, p.fragment = vertex, fragment
+	p.compiles++
+	return nil
+}
+
+func TestHotReload(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "test.png")
+	vertexPath := filepath.Join(dir, "test.vert")
+	fragmentPath := filepath.Join(dir, "test.frag")
+	writeTestImage(t, imagePath, 4)
+	assert.NoError(t, os.WriteFile(vertexPath, []byte("vertex"), 0644))
+	assert.NoError(t, os.WriteFile(fragmentPath, []byte("fragment"), 0644))
+	//Bumps the modification time so the change is seen on any file system
+	touched := time.Now()
+	touch := func(path string) {
+		touched = touched.Add(time.Second)
+		assert.NoError(t, os.Chtimes(path, touched, touched))
+	}
+
+	s := NewServer()
+	img, _ := Load[*image.RGBA](s, imagePath)
+	vertex, _ := Load[ShaderSource](s, vertexPath)
+	fragment, _ := Load[ShaderSource](s, fragmentPath)
+	s.WaitAll()
+
+	atlas := render.ImageAtlasFactory(16, 1)
+	loaded, _ := Get(s, img)
+	atlas.AddImageFromImage(loaded, "test")
+	atlas.Init()
+	program := &testProgram{vertex: "vertex", fragment: "fragment"}
+	reloader := NewRenderReloader(s)
+	reloader.WatchImage(img, &atlas, "test")
+	reloader.WatchProgram(program, vertex, fragment)
+	var moved []RegionsMoved
+	reloader.OnRegionsMoved(func(m RegionsMoved) { moved = append(moved, m) })
+
+	watcher := NewWatcher(s, 0)
+	//Listeners run in the order they were added, so once this one hears about a
+	//reload the reloader and the watcher have seen it too
+	reloads := make(chan Reloaded, 8)
+	s.OnReload(func(r Reloaded) { reloads <- r })
+	d := world.NewSimpleDispatcher()
+	assert.NoError(t, AddWatcher(d, watcher))
+	var events []Reloaded
+	reader := world.NewBaseService("reader")
+	reader.AddRequiredAccessComponent(world.NewEventAccess[Reloaded](world.ReadAccess))
+	reader.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		r, err := world.GetEventReader[Reloaded](reader)
+		if err != nil {
+			return err
+		}
+		events = append(events, r.Read()...)
+		return nil
+	})
+	assert.NoError(t, d.AddService(reader))
+
+	//The first poll only remembers the files
+	assert.NoError(t, d.Maintain())
+	assert.Empty(t, watcher.Poll())
+
+	writeTestImage(t, imagePath, 8)
+	touch(imagePath)
+	assert.Equal(t, []HandleID{img.ID()}, watcher.Poll())
+	assert.Equal(t, imagePath, (<-reloads).Path)
+	assert.NoError(t, d.Maintain())
+	assert.Len(t, events, 1)
+	assert.Equal(t, img.ID(), events[0].ID)
+	assert.NoError(t, events[0].Err)
+	loaded, _ = Get(s, img)
+	assert.Equal(t, 8, loaded.Bounds().Dx())
+	assert.NoError(t, reloader.Apply())
+	assert.Equal(t, 0, program.compiles)
+	assert.Equal(t, []RegionsMoved{{Atlas: &atlas, Names: []string{"test"}}}, moved)
+	region, _ := atlas.GetRegion("test")
+	assert.Equal(t, int32(8), region.W)
+
+	//A shader that does not compile keeps the old program
+	assert.NoError(t, os.WriteFile(fragmentPath, []byte("broken"), 0644))
+	touch(fragmentPath)
+	assert.Equal(t, []HandleID{fragment.ID()}, watcher.Poll())
+	<-reloads
+	assert.Error(t, reloader.Apply())
+	assert.Equal(t, "fragment", program.fragment)
+
+	assert.NoError(t, os.WriteFile(fragmentPath, []byte("fixed"), 0644))
+	touch(fragmentPath)
+	watcher.Poll()
+	<-reloads
+	assert.NoError(t, reloader.Apply())
+	assert.Equal(t, "fixed", program.fragment)
+	assert.Equal(t, "vertex", program.vertex)
+	assert.Len(t, moved, 1)
+
+	//Images that fail to decode keep the old value
+	assert.NoError(t, os.WriteFile(imagePath, []byte("not a png"), 0644))
+	touch(imagePath)
+	watcher.Poll()
+	assert.Error(t, (<-reloads).Err)
+	loaded, _ = Get(s, img)
+	assert.Equal(t, 8, loaded.Bounds().Dx())
+}
+
+func TestServerFS(t *testing.T) {
+	var packedBytes bytes.Buffer
+	dir := t.TempDir()
+	writeTestImage(t, filepath.Join(dir, "God.png"), 3)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "shader"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "shader", "sprite.vert"), []byte("void main(){}"), 0644))
+	assert.NoError(t, archive.Pack(&packedBytes, os.DirFS(dir), nil))
+	packed, err := archive.NewReader(bytes.NewReader(packedBytes.Bytes()), int64(packedBytes.Len()))
+	assert.NoError(t, err)
+
+	//The same paths work for the directory and the archive
+	for _, fsys := range []fs.FS{os.DirFS(dir), packed} {
+		s := NewServerFS(fsys)
+		img, _ := Load[*image.RGBA](s, "God.png")
+		shader, _ := Load[ShaderSource](s, "shader/../shader/sprite.vert")
+		again, _ := Load[ShaderSource](s, "shader/sprite.vert")
+		assert.Equal(t, shader, again)
+		loaded, err := Wait(s, img)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, loaded.Bounds().Dx())
+		source, err := Wait(s, shader)
+		assert.NoError(t, err)
+		assert.Equal(t, ShaderSource("void main(){}"), source)
+		missing, _ := Load[*image.RGBA](s, "missing.png")
+		_, err = Wait(s, missing)
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	}
+}
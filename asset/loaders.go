@@ -0,0 +1,29 @@
+package asset
+
+import (
+	"image"
+
+	"github.com/jevans40/Ruthenium/file"
+)
+
+//The text of a GLSL shader file
+type ShaderSource string
+
+func addDefaultLoaders(s *Server) {
+	AddLoader(s, func(path string) (*image.RGBA, error) {
+		if s.fsys != nil {
+			return file.ReadImageFS(s.fsys, path)
+		}
+		return file.ReadImage(path)
+	})
+	AddLoader(s, func(path string) (*file.Font, error) {
+		if s.fsys != nil {
+			return file.ReadFontFS(s.fsys, path)
+		}
+		return file.ReadFont(path)
+	})
+	AddLoader(s, func(path string) (ShaderSource, error) {
+		source, err := s.ReadFile(path)
+		return ShaderSource(source), err
+	})
+}
@@ -0,0 +1,187 @@
+package asset
+
+import (
+	"image"
+	"sort"
+	"sync"
+
+	"github.com/jevans40/Ruthenium/render"
+	log "github.com/sirupsen/logrus"
+)
+
+//Anything using a shader program that can be compiled again, like
+//render.SpriteRenderer. It has to keep its old program if compiling fails.
+type ProgramReloader interface {
+	ReloadProgram(vertexShaderSource, fragmentShaderSource string) error
+}
+
+//Applies reloaded images and shaders to the renderer. Reloads finish on
+//background goroutines but GL calls have to be made on the thread that owns the
+//context, so they are queued until that thread calls Apply.
+type RenderReloader struct {
+	server *Server
+
+	lock      sync.Mutex
+	images    map[HandleID][]atlasImage
+	programs  []programSources
+	pending   map[HandleID]bool
+	listeners []func(RegionsMoved)
+}
+
+//Passed to the OnRegionsMoved listeners when reloading images changed where
+//images are in an atlas
+type RegionsMoved struct {
+	Atlas *render.ImageAtlas
+	//Every image whose region changed, look them up again with GetRegion
+	Names []string
+}
+
+type atlasImage struct {
+	atlas *render.ImageAtlas
+	name  string
+}
+
+type programSources struct {
+	target           ProgramReloader
+	vertex, fragment Handle[ShaderSource]
+}
+
+func NewRenderReloader(s *Server) *RenderReloader {
+	r := &RenderReloader{server: s, images: map[HandleID][]atlasImage{}, pending: map[HandleID]bool{}}
+	s.OnReload(func(reloaded Reloaded) {
+		if reloaded.Err != nil {
+			return
+		}
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.pending[reloaded.ID] = true
+	})
+	return r
+}
+
+//Replaces the image stored in atlas under name whenever h is reloaded
+func (r *RenderReloader) WatchImage(h Handle[*image.RGBA], atlas *render.ImageAtlas, name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.images[h.id] = append(r.images[h.id], atlasImage{atlas: atlas, name: name})
+}
+
+//Compiles the program of target again whenever one of its shaders is reloaded
+func (r *RenderReloader) WatchProgram(target ProgramReloader, vertex, fragment Handle[ShaderSource]) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.programs = append(r.programs, programSources{target: target, vertex: vertex, fragment: fragment})
+}
+
+//Adds a function that is called by Apply, after the pages are uploaded, for
+//every atlas in which reloaded images changed regions
+func (r *RenderReloader) OnRegionsMoved(listener func(RegionsMoved)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.listeners = append(r.listeners, listener)
+}
+
+//Applies every reload since the last call. Changed images are put back into
+//their atlas, which may move other images of the page if they grew, and the
+//page is uploaded again. Programs whose shaders changed are compiled again. Failures are logged
+//and the first one is returned, everything that failed keeps its old state.
+//Must be called from the thread that owns the GL context.
+func (r *RenderReloader) Apply() error {
+	r.lock.Lock()
+	pending := r.pending
+	r.pending = map[HandleID]bool{}
+	ids := make([]HandleID, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	images := map[HandleID][]atlasImage{}
+	for _, id := range ids {
+		images[id] = r.images[id]
+	}
+	programs := append([]programSources{}, r.programs...)
+	listeners := append([]func(RegionsMoved){}, r.listeners...)
+	r.lock.Unlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var first error
+	fail := func(err error) {
+		log.WithError(err).Error("could not apply a reloaded asset")
+		if first == nil {
+			first = err
+		}
+	}
+
+	type atlasPage struct {
+		atlas *render.ImageAtlas
+		page  int
+	}
+	dirty := []atlasPage{}
+	seen := map[atlasPage]bool{}
+	moved := []RegionsMoved{}
+	for _, id := range ids {
+		for _, target := range images[id] {
+			img, ok := Get(r.server, Handle[*image.RGBA]{id})
+			if !ok {
+				continue
+			}
+			page, names, err := target.atlas.ReplaceImage(target.name, img)
+			if err != nil {
+				fail(err)
+				continue
+			}
+			if len(names) > 0 {
+				moved = addMoved(moved, target.atlas, names)
+			}
+			if key := (atlasPage{target.atlas, page}); page >= 0 && !seen[key] {
+				seen[key] = true
+				dirty = append(dirty, key)
+			}
+		}
+	}
+	for _, program := range programs {
+		if !pending[program.vertex.id] && !pending[program.fragment.id] {
+			continue
+		}
+		vertex, ok := Get(r.server, program.vertex)
+		if !ok {
+			continue
+		}
+		fragment, ok := Get(r.server, program.fragment)
+		if !ok {
+			continue
+		}
+		if err := program.target.ReloadProgram(string(vertex), string(fragment)); err != nil {
+			fail(err)
+		}
+	}
+	for _, page := range dirty {
+		page.atlas.UploadPage(page.page)
+	}
+	for _, event := range moved {
+		for _, listener := range listeners {
+			listener(event)
+		}
+	}
+	return first
+}
+
+//Adds names to the event of atlas, keeping every name once
+func addMoved(moved []RegionsMoved, atlas *render.ImageAtlas, names []string) []RegionsMoved {
+	for k := range moved {
+		if moved[k].Atlas != atlas {
+			continue
+		}
+		for _, name := range names {
+			found := false
+			for _, known := range moved[k].Names {
+				found = found || known == name
+			}
+			if !found {
+				moved[k].Names = append(moved[k].Names, name)
+			}
+		}
+		sort.Strings(moved[k].Names)
+		return moved
+	}
+	return append(moved, RegionsMoved{Atlas: atlas, Names: names})
+}
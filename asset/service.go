@@ -0,0 +1,115 @@
+package asset
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//The load state of one asset as seen by services
+type Status struct {
+	Path  string
+	State LoadState
+	//The *LoadError of a failed asset
+	Err error
+}
+
+//World resource with the state of every asset of a Server, so services can
+//check if an asset is ready instead of waiting for it. It is updated at the
+//start of every tick. Loads finish in the background at any time, worlds that
+//have to be deterministic should call Server.WaitAll before running ticks.
+type Assets struct {
+	statuses map[HandleID]Status
+}
+
+func (a Assets) GetType() reflect.Type { return reflect.TypeOf(a) }
+func (a Assets) IsComponent()          {}
+
+//Returns the status of an asset, false if the server has no such asset
+func (a Assets) Status(id HandleID) (Status, bool) {
+	status, ok := a.statuses[id]
+	return status, ok
+}
+
+//Returns true if the asset finished loading without errors
+func (a Assets) Ready(id HandleID) bool {
+	status, ok := a.statuses[id]
+	return ok && status.State == Loaded
+}
+
+//Returns the number of assets that are still loading
+func (a Assets) Pending() int {
+	count := 0
+	for _, status := range a.statuses {
+		if status.State == Pending {
+			count++
+		}
+	}
+	return count
+}
+
+//Returns every asset that failed to load sorted by path
+func (a Assets) Failed() []Status {
+	failed := []Status{}
+	for _, status := range a.statuses {
+		if status.State == Failed {
+			failed = append(failed, status)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Path < failed[j].Path })
+	return failed
+}
+
+//Returns the status of every asset
+func (s *Server) Statuses() map[HandleID]Status {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.statuses()
+}
+
+func (s *Server) statuses() map[HandleID]Status {
+	statuses := make(map[HandleID]Status, len(s.entries))
+	for id, e := range s.entries {
+		statuses[id] = Status{Path: e.key.path, State: e.state, Err: e.err}
+	}
+	return statuses
+}
+
+/***************************/
+/*        Service          */
+
+//Adds the Assets resource and the service that keeps it up to date with s
+func AddAssets(d world.Dispatcher, s *Server) error {
+	if err := d.AddStorage(component.NewResourceStorage(Assets{statuses: s.Statuses()})); err != nil {
+		return err
+	}
+	return d.AddService(NewAssetService(s))
+}
+
+//Creates the service that copies the state of s into the Assets resource. It
+//runs in the PreUpdateStage and only rewrites the resource when a state changed.
+func NewAssetService(s *Server) world.Service {
+	service := world.NewBaseService("assets")
+	service.SetStage(world.PreUpdateStage)
+	service.AddRequiredAccessComponent(world.NewComponentAccess[Assets](world.WriteAccess))
+	var seen uint64
+	service.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		s.lock.Lock()
+		if s.version == seen {
+			s.lock.Unlock()
+			return nil
+		}
+		seen = s.version
+		//Every update writes a new map since read storages share the old one
+		statuses := s.statuses()
+		s.lock.Unlock()
+		storage, err := world.GetWriteStorage[Assets](service)
+		if err != nil {
+			return err
+		}
+		return storage.Write(0, Assets{statuses: statuses})
+	})
+	return service
+}
@@ -0,0 +1,131 @@
+package asset
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//Watches the files of a Server's assets and reloads the ones that changed.
+//It polls modification times and sizes, so it works on every platform and
+//needs no extra goroutines.
+type Watcher struct {
+	server   *Server
+	interval time.Duration
+
+	lock     sync.Mutex
+	lastPoll time.Time
+	stamps   map[HandleID]fileStamp
+	reloaded []Reloaded
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+//Creates a watcher for s. Update polls the files at most once per interval.
+func NewWatcher(s *Server, interval time.Duration) *Watcher {
+	w := &Watcher{server: s, interval: interval, stamps: map[HandleID]fileStamp{}}
+	s.OnReload(func(r Reloaded) {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		w.reloaded = append(w.reloaded, r)
+	})
+	return w
+}
+
+//Polls the files if the interval passed since the last poll
+func (w *Watcher) Update() []HandleID {
+	w.lock.Lock()
+	due := time.Since(w.lastPoll) >= w.interval
+	w.lock.Unlock()
+	if !due {
+		return nil
+	}
+	return w.Poll()
+}
+
+//Checks every loaded asset for changes and reloads the changed ones. A file is
+//remembered the first time it is seen, so only changes after that count.
+//Returns the changed assets.
+func (w *Watcher) Poll() []HandleID {
+	statuses := w.server.Statuses()
+	w.lock.Lock()
+	w.lastPoll = time.Now()
+	for id := range w.stamps {
+		if _, ok := statuses[id]; !ok {
+			delete(w.stamps, id)
+		}
+	}
+	changed := []HandleID{}
+	for id, status := range statuses {
+		if status.State == Pending {
+			continue
+		}
+		//Files that are being replaced can be missing for a moment
+		info, err := w.server.stat(status.Path)
+		if err != nil {
+			continue
+		}
+		stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+		old, seen := w.stamps[id]
+		w.stamps[id] = stamp
+		if seen && old != stamp {
+			changed = append(changed, id)
+		}
+	}
+	w.lock.Unlock()
+
+	sort.Slice(changed, func(i, j int) bool { return changed[i] < changed[j] })
+	for _, id := range changed {
+		w.server.Reload(id)
+	}
+	return changed
+}
+
+//Returns the reloads that finished since the last call
+func (w *Watcher) TakeReloaded() []Reloaded {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	reloaded := w.reloaded
+	w.reloaded = nil
+	return reloaded
+}
+
+/***************************/
+/*        Service          */
+
+//Adds Events[Reloaded] and a service that updates w every tick and sends an
+//event for every finished reload
+func AddWatcher(d world.Dispatcher, w *Watcher) error {
+	if err := d.AddStorage(world.NewEvents[Reloaded]()); err != nil {
+		return err
+	}
+	return d.AddService(NewWatcherService(w))
+}
+
+//Creates the service that polls w and sends Reloaded events. It runs in the
+//PreUpdateStage so the rest of the tick can react to the reloads.
+func NewWatcherService(w *Watcher) world.Service {
+	service := world.NewBaseService("asset watcher")
+	service.SetStage(world.PreUpdateStage)
+	service.AddRequiredAccessComponent(world.NewEventAccess[Reloaded](world.WriteAccess))
+	service.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		w.Update()
+		reloaded := w.TakeReloaded()
+		if len(reloaded) == 0 {
+			return nil
+		}
+		events, err := world.GetEventWriter[Reloaded](service)
+		if err != nil {
+			return err
+		}
+		events.SendBatch(reloaded)
+		return nil
+	})
+	return service
+}
@@ -0,0 +1,112 @@
+//rupack bundles an asset directory into an archive for shipping builds and
+//inspects existing archives.
+//
+//	rupack pack [-store] <directory> <archive>
+//	rupack list <archive>
+//	rupack verify <archive>
+//	rupack unpack <archive> <directory>
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/jevans40/Ruthenium/archive"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	fmt.Fprintln(os.Stderr, "  rupack pack [-store] <directory> <archive>")
+	fmt.Fprintln(os.Stderr, "  rupack list <archive>")
+	fmt.Fprintln(os.Stderr, "  rupack verify <archive>")
+	fmt.Fprintln(os.Stderr, "  rupack unpack <archive> <directory>")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "pack":
+		err = pack(os.Args[2:])
+	case "list":
+		err = withArchive(os.Args[2:], 1, list)
+	case "verify":
+		err = withArchive(os.Args[2:], 1, func(a *archive.Archive, _ []string) error {
+			return a.Verify()
+		})
+	case "unpack":
+		err = withArchive(os.Args[2:], 2, unpack)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rupack:", err)
+		os.Exit(1)
+	}
+}
+
+func pack(args []string) error {
+	flags := flag.NewFlagSet("pack", flag.ExitOnError)
+	store := flags.Bool("store", false, "store every file without compression")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		usage()
+	}
+	compression := archive.DefaultCompression
+	if *store {
+		compression = func(string) archive.Compression { return archive.Stored }
+	}
+	out, err := os.Create(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	if err := archive.Pack(out, os.DirFS(flags.Arg(0)), compression); err != nil {
+		out.Close()
+		os.Remove(flags.Arg(1))
+		return err
+	}
+	return out.Close()
+}
+
+//Opens the archive named by the first argument and passes the rest on
+func withArchive(args []string, count int, run func(a *archive.Archive, args []string) error) error {
+	if len(args) != count {
+		usage()
+	}
+	a, err := archive.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	return run(a, args[1:])
+}
+
+func list(a *archive.Archive, _ []string) error {
+	for _, e := range a.Entries() {
+		fmt.Printf("%10d %10d %-8s %x %s\n", e.Size, e.StoredSize, e.Compression, e.Hash[:8], e.Name)
+	}
+	return nil
+}
+
+func unpack(a *archive.Archive, args []string) error {
+	return fs.WalkDir(a, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(args[0], filepath.FromSlash(name))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := fs.ReadFile(a, name)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
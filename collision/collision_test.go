@@ -0,0 +1,235 @@
+package collision
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/linmath"
+	"github.com/jevans40/Ruthenium/world"
+	"github.com/stretchr/testify/assert"
+)
+
+func at(c Collider, x, y float64) Shape {
+	shape, err := c.WorldShape(linmath.Mat3f[float64](world.NewTransform().Translate(x, y)))
+	if err != nil {
+		panic(err)
+	}
+	return shape
+}
+
+func assertVec(t *testing.T, expected, actual Vec2) {
+	t.Helper()
+	assert.InDelta(t, expected[0], actual[0], 1e-6, "x of %v", actual)
+	assert.InDelta(t, expected[1], actual[1], 1e-6, "y of %v", actual)
+}
+
+func TestCollide(t *testing.T) {
+	box := NewAABB(Vec2{}, Vec2{1, 1})
+	circle := NewCircle(Vec2{}, 1)
+
+	//Boxes resting on each other touch along the whole overlap
+	m, ok := Collide(at(box, 0, 0), at(box, 1.5, 1.9))
+	assert.True(t, ok)
+	assertVec(t, Vec2{0, 1}, m.Normal)
+	assert.InDelta(t, 0.1, m.Depth, 1e-9)
+	assert.Len(t, m.Points, 2)
+	for _, p := range m.Points {
+		assert.InDelta(t, 0.95, p[1], 1e-9)
+	}
+	_, ok = Collide(at(box, 0, 0), at(box, 2.1, 0))
+	assert.False(t, ok)
+
+	//The normal always points from the first shape to the second
+	m, ok = Collide(at(box, 0, 0), at(box, -1.8, 0))
+	assert.True(t, ok)
+	assertVec(t, Vec2{-1, 0}, m.Normal)
+	assert.InDelta(t, 0.2, m.Depth, 1e-9)
+
+	m, ok = Collide(at(circle, 0, 0), at(circle, 1.5, 0))
+	assert.True(t, ok)
+	assertVec(t, Vec2{1, 0}, m.Normal)
+	assert.InDelta(t, 0.5, m.Depth, 1e-9)
+	assertVec(t, Vec2{0.75, 0}, m.Points[0])
+	_, ok = Collide(at(circle, 0, 0), at(circle, 1.5, 1.5))
+	assert.False(t, ok)
+
+	//Circle near the corner of a box is measured from the corner
+	m, ok = Collide(at(box, 0, 0), at(circle, 1.5, 1.5))
+	assert.True(t, ok)
+	assertVec(t, Vec2{math.Sqrt2 / 2, math.Sqrt2 / 2}, m.Normal)
+	assert.InDelta(t, 1-math.Sqrt2/2, m.Depth, 1e-9)
+	_, ok = Collide(at(box, 0, 0), at(circle, 1.8, 1.8))
+	assert.False(t, ok)
+
+	//A circle with its center inside a box is pushed out the nearest side
+	m, ok = Collide(at(box, 0, 0), at(circle, 0.8, 0.1))
+	assert.True(t, ok)
+	assertVec(t, Vec2{1, 0}, m.Normal)
+	assert.InDelta(t, 1.2, m.Depth, 1e-9)
+
+	//A capsule lying across a box
+	capsule := NewCapsule(Vec2{-3, 0}, Vec2{3, 0}, 0.5)
+	m, ok = Collide(at(box, 0, 0), at(capsule, 0, 1.25))
+	assert.True(t, ok)
+	assertVec(t, Vec2{0, 1}, m.Normal)
+	assert.InDelta(t, 0.25, m.Depth, 1e-9)
+	m, ok = Collide(at(capsule, 0, 0), at(capsule, 0, 0.2))
+	assert.True(t, ok)
+	assert.InDelta(t, 0.8, m.Depth, 1e-9)
+	_, ok = Collide(at(capsule, 0, 0), at(circle, 4, 0))
+	assert.True(t, ok)
+	_, ok = Collide(at(capsule, 0, 0), at(circle, 4.6, 0))
+	assert.False(t, ok)
+
+	//A diamond only touches the box once its point reaches it
+	diamond := NewBox(Vec2{}, Vec2{1, 1}, math.Pi/4)
+	_, ok = Collide(at(box, 0, 0), at(diamond, 2.5, 0))
+	assert.False(t, ok)
+	m, ok = Collide(at(box, 0, 0), at(diamond, 2.3, 0))
+	assert.True(t, ok)
+	assertVec(t, Vec2{1, 0}, m.Normal)
+	assert.InDelta(t, math.Sqrt2-1.3, m.Depth, 1e-9)
+	assert.Len(t, m.Points, 1)
+
+	triangle := NewPolygon(Vec2{0, 0}, Vec2{0, 2}, Vec2{2, 0})
+	_, ok = Collide(at(triangle, 0, 0), at(circle, 2, 2))
+	assert.False(t, ok)
+	_, ok = Collide(at(triangle, 0, 0), at(circle, 1.5, 1.5))
+	assert.True(t, ok)
+}
+
+func TestWorldShape(t *testing.T) {
+	//Scaled and rotated transforms move every kind of shape
+	transform := linmath.Mat3f[float64](world.NewTransform().Translate(10, 0).Rotate(math.Pi/2).Scale(2, 2))
+
+	shape, err := NewCircle(Vec2{1, 0}, 1).WorldShape(transform)
+	assert.NoError(t, err)
+	assertVec(t, Vec2{10, 2}, shape.Points[0])
+	assert.InDelta(t, 2, shape.Radius, 1e-9)
+
+	shape, err = NewAABB(Vec2{1, 0}, Vec2{1, 0.5}).WorldShape(transform)
+	assert.NoError(t, err)
+	assertVec(t, Vec2{9, 0}, shape.Bounds.Min)
+	assertVec(t, Vec2{11, 4}, shape.Bounds.Max)
+
+	//Mirrored polygons keep their winding
+	shape, err = NewPolygon(Vec2{0, 0}, Vec2{1, 0}, Vec2{0, 1}).WorldShape(linmath.Mat3f[float64](world.NewTransform().Scale(-1, 1)))
+	assert.NoError(t, err)
+	assert.Greater(t, signedArea(shape.Points), 0.0)
+
+	_, err = NewPolygon(Vec2{0, 0}, Vec2{2, 0}, Vec2{1, 0.5}, Vec2{2, 2}, Vec2{0, 2}).WorldShape(linmath.Identity[float64]())
+	assert.Error(t, err)
+	_, err = NewPolygon(Vec2{0, 0}, Vec2{1, 0}).WorldShape(linmath.Identity[float64]())
+	assert.Error(t, err)
+}
+
+func TestDistance(t *testing.T) {
+	box := at(NewAABB(Vec2{}, Vec2{1, 1}), 0, 0)
+	a, b, distance := Distance(box, at(NewBox(Vec2{}, Vec2{1, 1}, math.Pi/4), 5, 0))
+	assert.InDelta(t, 4-math.Sqrt2, distance, 1e-9)
+	assert.InDelta(t, 1, a[0], 1e-9)
+	assertVec(t, Vec2{5 - math.Sqrt2, 0}, b)
+
+	_, _, distance = Distance(box, at(NewCapsule(Vec2{0, -4}, Vec2{0, 4}, 0), 3, 0))
+	assert.InDelta(t, 2, distance, 1e-9)
+	_, _, distance = Distance(box, at(NewCircle(Vec2{}, 1), 0.5, 0.5))
+	assert.Equal(t, 0.0, distance)
+}
+
+func TestCollisionService(t *testing.T) {
+	d := world.NewSimpleDispatcher()
+	transforms := component.NewVectorStorage[world.Transform]()
+	assert.NoError(t, d.AddStorage(transforms))
+	assert.NoError(t, AddCollision(d))
+
+	var contacts []Contact
+	reader := world.NewBaseService("reader")
+	reader.SetStage(world.RenderStage)
+	reader.AddRequiredAccessComponent(world.NewEventAccess[Contact](world.ReadAccess))
+	reader.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		r, err := world.GetEventReader[Contact](reader)
+		if err != nil {
+			return err
+		}
+		contacts = r.Read()
+		return nil
+	})
+	assert.NoError(t, d.AddService(reader))
+
+	transformWrite, _ := component.GetWriteStorage[world.Transform](transforms)
+	colliderWrite, _ := component.GetWriteStorage[Collider](d.GetStorage(component.ReflectType[Collider]()))
+	player := NewCircle(Vec2{}, 1)
+	player.Layer, player.Mask = 1, 2
+	wall := NewAABB(Vec2{}, Vec2{1, 4})
+	wall.Layer = 2
+	ghost := NewCircle(Vec2{}, 1)
+	ghost.Layer, ghost.Mask = 4, 4
+	trigger := NewAABB(Vec2{}, Vec2{1, 1})
+	trigger.Layer, trigger.Sensor = 2, true
+	for e, c := range map[component.EntityID]Collider{1: player, 2: wall, 3: ghost, 4: trigger} {
+		assert.NoError(t, colliderWrite.AddEntity(e, c))
+	}
+	assert.NoError(t, transformWrite.AddEntity(1, world.NewTransform()))
+	assert.NoError(t, transformWrite.AddEntity(2, world.NewTransform().Translate(1.5, 0)))
+	assert.NoError(t, transformWrite.AddEntity(4, world.NewTransform().Translate(-10, 0)))
+
+	//The ghost at the origin is on a layer nobody else sees
+	assert.NoError(t, d.Maintain())
+	assert.Len(t, contacts, 1)
+	assert.Equal(t, ContactBegin, contacts[0].State)
+	assert.Equal(t, component.EntityID(1), contacts[0].A)
+	assert.Equal(t, component.EntityID(2), contacts[0].B)
+	assertVec(t, Vec2{1, 0}, contacts[0].Normal)
+	assert.InDelta(t, 0.5, contacts[0].Depth, 1e-9)
+	assert.False(t, contacts[0].Sensor)
+
+	assert.NoError(t, transformWrite.Write(1, world.NewTransform().Translate(0.1, 0)))
+	assert.NoError(t, d.Maintain())
+	assert.Len(t, contacts, 1)
+	assert.Equal(t, ContactStay, contacts[0].State)
+	assert.InDelta(t, 0.6, contacts[0].Depth, 1e-9)
+
+	assert.NoError(t, transformWrite.Write(1, world.NewTransform().Translate(-9, 0)))
+	assert.NoError(t, d.Maintain())
+	assert.Len(t, contacts, 2)
+	assert.Equal(t, Contact{State: ContactEnd, A: 1, B: 2}, contacts[1])
+	assert.Equal(t, ContactBegin, contacts[0].State)
+	assert.Equal(t, component.EntityID(4), contacts[0].B)
+	assert.True(t, contacts[0].Sensor)
+
+	assert.NoError(t, colliderWrite.DeleteEntityMultiple([]component.EntityID{4}))
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, []Contact{{State: ContactEnd, A: 1, B: 4}}, contacts)
+}
+
+func TestCollisionHierarchy(t *testing.T) {
+	d := world.NewSimpleDispatcher()
+	assert.NoError(t, world.AddHierarchy(d))
+	assert.NoError(t, AddCollision(d))
+
+	transformWrite, _ := component.GetWriteStorage[world.Transform](d.GetStorage(component.ReflectType[world.Transform]()))
+	parentWrite, _ := component.GetWriteStorage[world.Parent](d.GetStorage(component.ReflectType[world.Parent]()))
+	colliderWrite, _ := component.GetWriteStorage[Collider](d.GetStorage(component.ReflectType[Collider]()))
+	assert.NoError(t, transformWrite.AddEntity(1, world.NewTransform().Translate(5, 0)))
+	assert.NoError(t, transformWrite.AddEntity(2, world.NewTransform()))
+	assert.NoError(t, parentWrite.AddEntity(2, world.Parent{Entity: 1}))
+	assert.NoError(t, colliderWrite.AddEntity(2, NewCircle(Vec2{}, 1)))
+	assert.NoError(t, colliderWrite.AddEntity(3, NewCircle(Vec2{5, 1.5}, 1)))
+
+	var contacts []Contact
+	reader := world.NewBaseService("reader")
+	reader.SetStage(world.RenderStage)
+	reader.AddRequiredAccessComponent(world.NewEventAccess[Contact](world.ReadAccess))
+	reader.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		r, _ := world.GetEventReader[Contact](reader)
+		contacts = r.Read()
+		return nil
+	})
+	assert.NoError(t, d.AddService(reader))
+
+	//The child collider is moved by its parent in the same tick
+	assert.NoError(t, d.Maintain())
+	assert.Len(t, contacts, 1)
+	assertVec(t, Vec2{0, 1}, contacts[0].Normal)
+}
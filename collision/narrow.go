@@ -0,0 +1,366 @@
+package collision
+
+import "math"
+
+//Distances below this count as touching
+const epsilon = 1e-9
+
+//Describes how two shapes overlap
+type Manifold struct {
+	//Points from the first shape towards the second, moving the second shape
+	//along it by Depth separates them
+	Normal Vec2
+	Depth  float64
+	//Where the shapes touch, one or two points halfway between their surfaces
+	Points []Vec2
+}
+
+//Returns how a and b overlap and true if they touch. Two polygons are tested
+//with the separating axis theorem and clipped for up to two contact points,
+//every other pair is measured with GJK and falls back to the separating axis
+//theorem when their cores overlap.
+func Collide(a, b Shape) (Manifold, bool) {
+	if len(a.Points) == 0 || len(b.Points) == 0 || !a.Bounds.Overlaps(b.Bounds) {
+		return Manifold{}, false
+	}
+	if len(a.Points) > 2 && len(b.Points) > 2 && a.Radius == 0 && b.Radius == 0 {
+		return collidePolygons(a, b)
+	}
+
+	radius := a.Radius + b.Radius
+	closestA, closestB, distance := Distance(a, b)
+	if distance > radius {
+		return Manifold{}, false
+	}
+	if distance > epsilon {
+		normal := closestB.Sub(closestA).Scale(1 / distance)
+		surfaceA := closestA.Add(normal.Scale(a.Radius))
+		surfaceB := closestB.Sub(normal.Scale(b.Radius))
+		return Manifold{
+			Normal: normal,
+			Depth:  radius - distance,
+			Points: []Vec2{surfaceA.Add(surfaceB).Scale(0.5)},
+		}, true
+	}
+
+	//The cores overlap, push them apart along the axis of least overlap. The
+	//contact is halfway between the deepest point of b and the surface of a.
+	normal, depth := separatingAxis(a, b)
+	depth += radius
+	deepest := b.Points[b.support(normal.Neg())].Sub(normal.Scale(b.Radius))
+	return Manifold{
+		Normal: normal,
+		Depth:  depth,
+		Points: []Vec2{deepest.Add(normal.Scale(depth / 2))},
+	}, true
+}
+
+/***************************/
+/*           SAT           */
+
+//Returns the axis of least overlap of the cores of a and b pointing from a to b
+//and the overlap along it
+func separatingAxis(a, b Shape) (Vec2, float64) {
+	best, bestOverlap := Vec2{}, math.Inf(1)
+	for _, axis := range append(a.axes(), b.axes()...) {
+		minA, maxA := a.project(axis)
+		minB, maxB := b.project(axis)
+		forward, backward := maxA-minB, maxB-minA
+		if forward < bestOverlap {
+			best, bestOverlap = axis, forward
+		}
+		if backward < bestOverlap {
+			best, bestOverlap = axis.Neg(), backward
+		}
+	}
+	if best == (Vec2{}) {
+		//Two points on top of each other
+		best, bestOverlap = Vec2{0, 1}, 0
+		if between := b.center().Sub(a.center()); between.LengthSquared() > epsilon*epsilon {
+			best = between.Normalize()
+		}
+	}
+	return best, bestOverlap
+}
+
+//Returns the axes the separating axis theorem has to test for the core
+func (s Shape) axes() []Vec2 {
+	switch len(s.Points) {
+	case 1:
+		return nil
+	case 2:
+		direction := s.Points[1].Sub(s.Points[0]).Normalize()
+		if direction == (Vec2{}) {
+			return nil
+		}
+		return []Vec2{direction, direction.Perp()}
+	}
+	axes := make([]Vec2, len(s.Points))
+	for i := range s.Points {
+		axes[i] = s.normal(i)
+	}
+	return axes
+}
+
+func (s Shape) project(axis Vec2) (float64, float64) {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, p := range s.Points {
+		d := p.Dot(axis)
+		min, max = math.Min(min, d), math.Max(max, d)
+	}
+	return min, max
+}
+
+//Returns the edge of a that b is furthest outside of and how far outside it is,
+//negative if b is inside every edge
+func maxSeparation(a, b Shape) (int, float64) {
+	bestEdge, best := 0, math.Inf(-1)
+	for i, p := range a.Points {
+		normal := a.normal(i)
+		separation := math.Inf(1)
+		for _, q := range b.Points {
+			separation = math.Min(separation, normal.Dot(q.Sub(p)))
+		}
+		if separation > best {
+			bestEdge, best = i, separation
+		}
+	}
+	return bestEdge, best
+}
+
+func collidePolygons(a, b Shape) (Manifold, bool) {
+	edgeA, separationA := maxSeparation(a, b)
+	if separationA > 0 {
+		return Manifold{}, false
+	}
+	edgeB, separationB := maxSeparation(b, a)
+	if separationB > 0 {
+		return Manifold{}, false
+	}
+
+	//The edge that separates the most is the reference, a is preferred so the
+	//reference does not flip between ticks when both are about the same
+	reference, incident, edge, flip := a, b, edgeA, false
+	if separationB > separationA+1e-6 {
+		reference, incident, edge, flip = b, a, edgeB, true
+	}
+	normal := reference.normal(edge)
+
+	//The incident edge faces the reference edge the most
+	incidentEdge, facing := 0, math.Inf(1)
+	for i := range incident.Points {
+		if d := normal.Dot(incident.normal(i)); d < facing {
+			incidentEdge, facing = i, d
+		}
+	}
+	segment := []Vec2{incident.Points[incidentEdge], incident.Points[(incidentEdge+1)%len(incident.Points)]}
+
+	//Clip the incident edge to the sides of the reference edge
+	start := reference.Points[edge]
+	end := reference.Points[(edge+1)%len(reference.Points)]
+	tangent := end.Sub(start).Normalize()
+	segment = clipSegment(segment, tangent.Neg(), -tangent.Dot(start))
+	segment = clipSegment(segment, tangent, tangent.Dot(end))
+
+	manifold := Manifold{Normal: normal}
+	if flip {
+		manifold.Normal = normal.Neg()
+	}
+	for _, p := range segment {
+		separation := normal.Dot(p.Sub(start))
+		if separation > epsilon {
+			continue
+		}
+		manifold.Depth = math.Max(manifold.Depth, -separation)
+		manifold.Points = append(manifold.Points, p.Sub(normal.Scale(separation/2)))
+	}
+	if len(manifold.Points) == 0 {
+		return Manifold{}, false
+	}
+	return manifold, true
+}
+
+//Keeps the part of the segment where normal.Dot(p) <= offset
+func clipSegment(segment []Vec2, normal Vec2, offset float64) []Vec2 {
+	if len(segment) < 2 {
+		return segment
+	}
+	distance0 := normal.Dot(segment[0]) - offset
+	distance1 := normal.Dot(segment[1]) - offset
+	clipped := []Vec2{}
+	if distance0 <= 0 {
+		clipped = append(clipped, segment[0])
+	}
+	if distance1 <= 0 {
+		clipped = append(clipped, segment[1])
+	}
+	if distance0*distance1 < 0 {
+		t := distance0 / (distance0 - distance1)
+		clipped = append(clipped, segment[0].Add(segment[1].Sub(segment[0]).Scale(t)))
+	}
+	return clipped
+}
+
+/***************************/
+/*           GJK           */
+
+type simplexVertex struct {
+	//The support points on a and b and their difference b - a
+	pointA, pointB, point Vec2
+	indexA, indexB        int
+	//The barycentric weight of the vertex
+	weight float64
+}
+
+type simplex struct {
+	vertices [3]simplexVertex
+	count    int
+}
+
+func newSimplexVertex(a, b Shape, indexA, indexB int) simplexVertex {
+	pointA, pointB := a.Points[indexA], b.Points[indexB]
+	return simplexVertex{pointA: pointA, pointB: pointB, point: pointB.Sub(pointA), indexA: indexA, indexB: indexB, weight: 1}
+}
+
+//Returns the closest points of the cores of a and b and the distance between
+//them, ignoring the radii. Overlapping cores have a distance of 0.
+func Distance(a, b Shape) (Vec2, Vec2, float64) {
+	s := simplex{count: 1}
+	s.vertices[0] = newSimplexVertex(a, b, 0, 0)
+
+	for iteration := 0; iteration < 32; iteration++ {
+		var savedA, savedB [3]int
+		saved := s.count
+		for i := 0; i < saved; i++ {
+			savedA[i], savedB[i] = s.vertices[i].indexA, s.vertices[i].indexB
+		}
+
+		switch s.count {
+		case 2:
+			s.solve2()
+		case 3:
+			s.solve3()
+		}
+		if s.count == 3 {
+			break
+		}
+		direction := s.searchDirection()
+		if direction.LengthSquared() < epsilon*epsilon {
+			break
+		}
+
+		vertex := newSimplexVertex(a, b, a.support(direction.Neg()), b.support(direction))
+		duplicate := false
+		for i := 0; i < saved; i++ {
+			if vertex.indexA == savedA[i] && vertex.indexB == savedB[i] {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			break
+		}
+		s.vertices[s.count] = vertex
+		s.count++
+	}
+
+	closestA, closestB := s.witnessPoints()
+	return closestA, closestB, closestB.Sub(closestA).Length()
+}
+
+func (s *simplex) searchDirection() Vec2 {
+	if s.count == 1 {
+		return s.vertices[0].point.Neg()
+	}
+	edge := s.vertices[1].point.Sub(s.vertices[0].point)
+	if edge.Cross(s.vertices[0].point.Neg()) > 0 {
+		return edge.Perp()
+	}
+	return edge.Perp().Neg()
+}
+
+func (s *simplex) witnessPoints() (Vec2, Vec2) {
+	closestA, closestB := Vec2{}, Vec2{}
+	for i := 0; i < s.count; i++ {
+		closestA = closestA.Add(s.vertices[i].pointA.Scale(s.vertices[i].weight))
+		closestB = closestB.Add(s.vertices[i].pointB.Scale(s.vertices[i].weight))
+	}
+	if s.count == 3 {
+		return closestA, closestA
+	}
+	return closestA, closestB
+}
+
+//Reduces a segment to the part closest to the origin
+func (s *simplex) solve2() {
+	w1, w2 := s.vertices[0].point, s.vertices[1].point
+	edge := w2.Sub(w1)
+	d2 := -w1.Dot(edge)
+	if d2 <= 0 {
+		s.vertices[0].weight = 1
+		s.count = 1
+		return
+	}
+	d1 := w2.Dot(edge)
+	if d1 <= 0 {
+		s.vertices[1].weight = 1
+		s.vertices[0] = s.vertices[1]
+		s.count = 1
+		return
+	}
+	s.vertices[0].weight = d1 / (d1 + d2)
+	s.vertices[1].weight = d2 / (d1 + d2)
+	s.count = 2
+}
+
+//Reduces a triangle to the feature closest to the origin, it stays a triangle
+//if it contains the origin
+func (s *simplex) solve3() {
+	w1, w2, w3 := s.vertices[0].point, s.vertices[1].point, s.vertices[2].point
+
+	e12 := w2.Sub(w1)
+	d12_1, d12_2 := w2.Dot(e12), -w1.Dot(e12)
+	e13 := w3.Sub(w1)
+	d13_1, d13_2 := w3.Dot(e13), -w1.Dot(e13)
+	e23 := w3.Sub(w2)
+	d23_1, d23_2 := w3.Dot(e23), -w2.Dot(e23)
+
+	area := e12.Cross(e13)
+	d123_1 := area * w2.Cross(w3)
+	d123_2 := area * w3.Cross(w1)
+	d123_3 := area * w1.Cross(w2)
+
+	switch {
+	case d12_2 <= 0 && d13_2 <= 0:
+		s.vertices[0].weight = 1
+		s.count = 1
+	case d12_1 > 0 && d12_2 > 0 && d123_3 <= 0:
+		s.vertices[0].weight = d12_1 / (d12_1 + d12_2)
+		s.vertices[1].weight = d12_2 / (d12_1 + d12_2)
+		s.count = 2
+	case d13_1 > 0 && d13_2 > 0 && d123_2 <= 0:
+		s.vertices[0].weight = d13_1 / (d13_1 + d13_2)
+		s.vertices[2].weight = d13_2 / (d13_1 + d13_2)
+		s.vertices[1] = s.vertices[2]
+		s.count = 2
+	case d12_1 <= 0 && d23_2 <= 0:
+		s.vertices[1].weight = 1
+		s.vertices[0] = s.vertices[1]
+		s.count = 1
+	case d13_1 <= 0 && d23_1 <= 0:
+		s.vertices[2].weight = 1
+		s.vertices[0] = s.vertices[2]
+		s.count = 1
+	case d23_1 > 0 && d23_2 > 0 && d123_1 <= 0:
+		s.vertices[1].weight = d23_1 / (d23_1 + d23_2)
+		s.vertices[2].weight = d23_2 / (d23_1 + d23_2)
+		s.vertices[0] = s.vertices[2]
+		s.count = 2
+	default:
+		total := d123_1 + d123_2 + d123_3
+		s.vertices[0].weight = d123_1 / total
+		s.vertices[1].weight = d123_2 / total
+		s.vertices[2].weight = d123_3 / total
+		s.count = 3
+	}
+}
@@ -0,0 +1,226 @@
+package collision
+
+import (
+	"sort"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/linmath"
+	"github.com/jevans40/Ruthenium/world"
+	log "github.com/sirupsen/logrus"
+)
+
+//Whether a contact started, continues or ended this tick
+type ContactState int
+
+const (
+	ContactBegin ContactState = iota
+	ContactStay
+	ContactEnd
+)
+
+func (s ContactState) String() string {
+	switch s {
+	case ContactBegin:
+		return "Begin"
+	case ContactStay:
+		return "Stay"
+	case ContactEnd:
+		return "End"
+	}
+	return "Unknown"
+}
+
+//Sent by the collision service for every pair of touching colliders. A is always
+//the entity with the lower id. End events have no manifold, they are also sent
+//when one of the entities lost its collider or was despawned.
+type Contact struct {
+	State ContactState
+	A, B  component.EntityID
+	Manifold
+	//True if either collider is a sensor
+	Sensor bool
+}
+
+//Adds the Collider storage, Events[Contact] and the collision service, along
+//with a Transform storage if the dispatcher does not have one yet. When the
+//dispatcher has a GlobalTransform storage the service collides with global
+//transforms, so AddHierarchy has to be called first for children to move with
+//their parents.
+func AddCollision(d world.Dispatcher) error {
+	if d.GetStorage(component.ReflectType[world.Transform]()) == nil {
+		if err := d.AddStorage(component.NewVectorStorage[world.Transform]()); err != nil {
+			return err
+		}
+	}
+	if err := d.AddStorage(component.NewVectorStorage[Collider]()); err != nil {
+		return err
+	}
+	if err := d.AddStorage(world.NewEvents[Contact]()); err != nil {
+		return err
+	}
+	hierarchy := d.GetStorage(component.ReflectType[world.GlobalTransform]()) != nil
+	return d.AddService(NewCollisionService(hierarchy))
+}
+
+type pair struct {
+	a, b component.EntityID
+}
+
+//A collider in world space
+type body struct {
+	entity   component.EntityID
+	collider Collider
+	shape    Shape
+}
+
+//Finds touching colliders and reports when they start and stop touching
+type detector struct {
+	touching map[pair]bool
+}
+
+//Creates the service that tests every Collider against the others and sends
+//Contact events. It only reads the Collider and transform storages so it runs
+//alongside other readers. It runs in the PostUpdateStage. With hierarchy set it
+//also reads GlobalTransform and runs after transform propagation, entities
+//without a GlobalTransform use their Transform.
+func NewCollisionService(hierarchy bool) world.Service {
+	service := world.NewBaseService("collision")
+	service.SetStage(world.PostUpdateStage)
+	service.AddRequiredAccessComponent(world.NewComponentAccess[Collider](world.ReadAccess))
+	service.AddRequiredAccessComponent(world.NewComponentAccess[world.Transform](world.ReadAccess))
+	if hierarchy {
+		service.AddRequiredAccessComponent(world.NewComponentAccess[world.GlobalTransform](world.ReadAccess))
+		service.AddRequiredService("transform propagation")
+	}
+	service.AddRequiredAccessComponent(world.NewEventAccess[Contact](world.WriteAccess))
+	d := &detector{touching: map[pair]bool{}}
+	service.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		colliders, err := world.GetReadStorage[Collider](service)
+		if err != nil {
+			return err
+		}
+		events, err := world.GetEventWriter[Contact](service)
+		if err != nil {
+			return err
+		}
+		transforms, err := world.GetReadStorage[world.Transform](service)
+		if err != nil {
+			return err
+		}
+		var globals component.ReadOnlyStorage[world.GlobalTransform]
+		if hierarchy {
+			if globals, err = world.GetReadStorage[world.GlobalTransform](service); err != nil {
+				return err
+			}
+		}
+		//Entities without a transform sit at the origin
+		transform := func(e component.EntityID) linmath.Mat3f[float64] {
+			if globals != nil {
+				if global, err := globals.GetComponent(e); err == nil {
+					return linmath.Mat3f[float64](global)
+				}
+			}
+			if local, err := transforms.GetComponent(e); err == nil {
+				return linmath.Mat3f[float64](local)
+			}
+			return linmath.Identity[float64]()
+		}
+		events.SendBatch(d.run(colliders, transform))
+		return nil
+	})
+	return service
+}
+
+func (d *detector) run(colliders component.ReadOnlyStorage[Collider], transform func(component.EntityID) linmath.Mat3f[float64]) []Contact {
+	//Sorted so the broadphase sees the same order every run
+	entities := colliders.GetEntities()
+	sort.Slice(entities, func(i, j int) bool { return entities[i] < entities[j] })
+	bodies := make([]body, 0, len(entities))
+	for _, e := range entities {
+		collider := colliders.MustGetComponent(e)
+		shape, err := collider.WorldShape(transform(e))
+		if err != nil {
+			log.Warnf("Skipping collider of entity %v: %v", e, err)
+			continue
+		}
+		bodies = append(bodies, body{entity: e, collider: collider, shape: shape})
+	}
+
+	bounds := make([]Bounds, len(bodies))
+	for i, b := range bodies {
+		bounds[i] = b.shape.Bounds
+	}
+	contacts := []Contact{}
+	touching := map[pair]bool{}
+	for _, p := range Overlapping(bounds) {
+		a, b := bodies[p[0]], bodies[p[1]]
+		if !a.collider.CanCollide(b.collider) {
+			continue
+		}
+		if b.entity < a.entity {
+			a, b = b, a
+		}
+		manifold, ok := Collide(a.shape, b.shape)
+		if !ok {
+			continue
+		}
+		key := pair{a.entity, b.entity}
+		touching[key] = true
+		state := ContactBegin
+		if d.touching[key] {
+			state = ContactStay
+		}
+		contacts = append(contacts, Contact{State: state, A: a.entity, B: b.entity, Manifold: manifold, Sensor: a.collider.Sensor || b.collider.Sensor})
+	}
+	sortContacts(contacts)
+
+	ended := []Contact{}
+	for key := range d.touching {
+		if !touching[key] {
+			ended = append(ended, Contact{State: ContactEnd, A: key.a, B: key.b})
+		}
+	}
+	sortContacts(ended)
+	d.touching = touching
+	return append(contacts, ended...)
+}
+
+func sortContacts(contacts []Contact) {
+	sort.Slice(contacts, func(i, j int) bool {
+		if contacts[i].A != contacts[j].A {
+			return contacts[i].A < contacts[j].A
+		}
+		return contacts[i].B < contacts[j].B
+	})
+}
+
+//Returns the indices of every pair of overlapping bounds, the lower index first.
+//The bounds are sorted along the x axis and each one is only compared with the
+//bounds that start before it ends, ties keep their order so the result only
+//depends on the order of the bounds.
+func Overlapping(bounds []Bounds) [][2]int {
+	order := make([]int, len(bounds))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return bounds[order[i]].Min[0] < bounds[order[j]].Min[0]
+	})
+
+	pairs := [][2]int{}
+	for i, first := range order {
+		for _, second := range order[i+1:] {
+			if bounds[second].Min[0] > bounds[first].Max[0] {
+				break
+			}
+			if bounds[first].Overlaps(bounds[second]) {
+				if second < first {
+					pairs = append(pairs, [2]int{second, first})
+				} else {
+					pairs = append(pairs, [2]int{first, second})
+				}
+			}
+		}
+	}
+	return pairs
+}
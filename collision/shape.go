@@ -0,0 +1,259 @@
+package collision
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/linmath"
+)
+
+//The kinds of shapes a Collider can have
+type ShapeKind int
+
+const (
+	//An axis aligned box, it stays axis aligned when the entity rotates and
+	//grows to cover the rotated box instead
+	AABBShape ShapeKind = iota
+	CircleShape
+	//An oriented box
+	BoxShape
+	//A convex polygon
+	PolygonShape
+	//A line segment with a radius
+	CapsuleShape
+)
+
+func (k ShapeKind) String() string {
+	switch k {
+	case AABBShape:
+		return "AABB"
+	case CircleShape:
+		return "Circle"
+	case BoxShape:
+		return "Box"
+	case PolygonShape:
+		return "Polygon"
+	case CapsuleShape:
+		return "Capsule"
+	}
+	return fmt.Sprintf("ShapeKind(%d)", int(k))
+}
+
+//Every layer, the default Mask
+const AllLayers = ^uint32(0)
+
+//Gives an entity a shape for the collision service. The shape is in the local
+//space of the entity and moves with its GlobalTransform, or its Transform if it
+//has no GlobalTransform.
+//
+//Two colliders only touch if the Layer of each has a bit in the Mask of the
+//other. Colliders made by the constructors are on layer 1 and collide with
+//every layer.
+type Collider struct {
+	Kind ShapeKind
+	//The center of AABBs, circles and boxes
+	Center Vec2
+	//Half the size of AABBs and boxes
+	HalfExtents Vec2
+	//The radius of circles and capsules
+	Radius float64
+	//The rotation of boxes in radians
+	Angle float64
+	//The corners of polygons and the two ends of capsules
+	Points []Vec2
+
+	Layer uint32
+	Mask  uint32
+	//Sensors report contacts but are not pushed apart by physics
+	Sensor bool
+}
+
+func (c Collider) GetType() reflect.Type { return reflect.TypeOf(c) }
+func (c Collider) IsComponent()          {}
+
+func init() {
+	component.MustRegister("Collider", Collider{Kind: CircleShape, Radius: 1, Layer: 1, Mask: AllLayers})
+}
+
+func NewAABB(center, halfExtents Vec2) Collider {
+	return Collider{Kind: AABBShape, Center: center, HalfExtents: halfExtents, Layer: 1, Mask: AllLayers}
+}
+
+func NewCircle(center Vec2, radius float64) Collider {
+	return Collider{Kind: CircleShape, Center: center, Radius: radius, Layer: 1, Mask: AllLayers}
+}
+
+func NewBox(center, halfExtents Vec2, angle float64) Collider {
+	return Collider{Kind: BoxShape, Center: center, HalfExtents: halfExtents, Angle: angle, Layer: 1, Mask: AllLayers}
+}
+
+//Creates a convex polygon, the points can be in either winding order
+func NewPolygon(points ...Vec2) Collider {
+	return Collider{Kind: PolygonShape, Points: append([]Vec2{}, points...), Layer: 1, Mask: AllLayers}
+}
+
+func NewCapsule(a, b Vec2, radius float64) Collider {
+	return Collider{Kind: CapsuleShape, Points: []Vec2{a, b}, Radius: radius, Layer: 1, Mask: AllLayers}
+}
+
+//Returns true if the layers and masks of the colliders let them touch
+func (c Collider) CanCollide(other Collider) bool {
+	return c.Layer&other.Mask != 0 && other.Layer&c.Mask != 0
+}
+
+//Returns the collider in world space after applying the transform
+func (c Collider) WorldShape(transform linmath.Mat3f[float64]) (Shape, error) {
+	apply := func(p Vec2) Vec2 {
+		moved := transform.VectorMul(p[0], p[1], 1)
+		return Vec2{moved[0], moved[1]}
+	}
+	//Radii grow with the largest scale of the transform
+	scale := math.Max(math.Hypot(transform[0], transform[3]), math.Hypot(transform[1], transform[4]))
+
+	switch c.Kind {
+	case AABBShape:
+		bounds := emptyBounds()
+		for _, corner := range boxCorners(c.Center, c.HalfExtents, 0) {
+			bounds = bounds.extend(apply(corner))
+		}
+		return newShape([]Vec2{bounds.Min, {bounds.Max[0], bounds.Min[1]}, bounds.Max, {bounds.Min[0], bounds.Max[1]}}, 0), nil
+	case CircleShape:
+		return newShape([]Vec2{apply(c.Center)}, c.Radius*scale), nil
+	case BoxShape:
+		corners := boxCorners(c.Center, c.HalfExtents, c.Angle)
+		for i := range corners {
+			corners[i] = apply(corners[i])
+		}
+		return newShape(corners, 0), nil
+	case PolygonShape:
+		if len(c.Points) < 3 {
+			return Shape{}, fmt.Errorf("polygon collider with %d points", len(c.Points))
+		}
+		points := make([]Vec2, len(c.Points))
+		for i, p := range c.Points {
+			points[i] = apply(p)
+		}
+		if !isConvex(points) {
+			return Shape{}, fmt.Errorf("polygon collider is not convex")
+		}
+		return newShape(points, 0), nil
+	case CapsuleShape:
+		if len(c.Points) != 2 {
+			return Shape{}, fmt.Errorf("capsule collider with %d points", len(c.Points))
+		}
+		return newShape([]Vec2{apply(c.Points[0]), apply(c.Points[1])}, c.Radius*scale), nil
+	}
+	return Shape{}, fmt.Errorf("unknown collider shape %v", c.Kind)
+}
+
+func boxCorners(center, halfExtents Vec2, angle float64) []Vec2 {
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	corners := []Vec2{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}}
+	for i, corner := range corners {
+		x, y := corner[0]*halfExtents[0], corner[1]*halfExtents[1]
+		corners[i] = Vec2{center[0] + x*cos - y*sin, center[1] + x*sin + y*cos}
+	}
+	return corners
+}
+
+/***************************/
+/*         Shapes          */
+
+//A convex shape in world space, the points of its core grown by a radius.
+//Circles have one point, capsules two and boxes and polygons at least three.
+type Shape struct {
+	//In counter clockwise order, counting with the y axis up
+	Points []Vec2
+	Radius float64
+	Bounds Bounds
+}
+
+func newShape(points []Vec2, radius float64) Shape {
+	if len(points) > 2 && signedArea(points) < 0 {
+		reversed := make([]Vec2, len(points))
+		for i, p := range points {
+			reversed[len(points)-1-i] = p
+		}
+		points = reversed
+	}
+	bounds := emptyBounds()
+	for _, p := range points {
+		bounds = bounds.extend(p)
+	}
+	bounds.Min = bounds.Min.Sub(Vec2{radius, radius})
+	bounds.Max = bounds.Max.Add(Vec2{radius, radius})
+	return Shape{Points: points, Radius: radius, Bounds: bounds}
+}
+
+//Returns the index of the point furthest in the direction
+func (s Shape) support(direction Vec2) int {
+	best, bestDot := 0, s.Points[0].Dot(direction)
+	for i := 1; i < len(s.Points); i++ {
+		if dot := s.Points[i].Dot(direction); dot > bestDot {
+			best, bestDot = i, dot
+		}
+	}
+	return best
+}
+
+//Returns the outward normal of the edge from point i to the next
+func (s Shape) normal(i int) Vec2 {
+	edge := s.Points[(i+1)%len(s.Points)].Sub(s.Points[i])
+	return Vec2{edge[1], -edge[0]}.Normalize()
+}
+
+func (s Shape) center() Vec2 {
+	sum := Vec2{}
+	for _, p := range s.Points {
+		sum = sum.Add(p)
+	}
+	return sum.Scale(1 / float64(len(s.Points)))
+}
+
+func signedArea(points []Vec2) float64 {
+	area := 0.0
+	for i, p := range points {
+		area += p.Cross(points[(i+1)%len(points)])
+	}
+	return area / 2
+}
+
+func isConvex(points []Vec2) bool {
+	sign := 0.0
+	for i := range points {
+		a, b, c := points[i], points[(i+1)%len(points)], points[(i+2)%len(points)]
+		turn := b.Sub(a).Cross(c.Sub(b))
+		if turn == 0 {
+			continue
+		}
+		if sign == 0 {
+			sign = turn
+		} else if (turn > 0) != (sign > 0) {
+			return false
+		}
+	}
+	return sign != 0
+}
+
+//An axis aligned bounding box
+type Bounds struct {
+	Min, Max Vec2
+}
+
+func emptyBounds() Bounds {
+	return Bounds{Min: Vec2{math.Inf(1), math.Inf(1)}, Max: Vec2{math.Inf(-1), math.Inf(-1)}}
+}
+
+func (b Bounds) extend(p Vec2) Bounds {
+	return Bounds{
+		Min: Vec2{math.Min(b.Min[0], p[0]), math.Min(b.Min[1], p[1])},
+		Max: Vec2{math.Max(b.Max[0], p[0]), math.Max(b.Max[1], p[1])},
+	}
+}
+
+//Returns true if the boxes overlap or touch
+func (b Bounds) Overlaps(o Bounds) bool {
+	return b.Min[0] <= o.Max[0] && o.Min[0] <= b.Max[0] && b.Min[1] <= o.Max[1] && o.Min[1] <= b.Max[1]
+}
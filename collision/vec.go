@@ -0,0 +1,6 @@
+package collision
+
+import "github.com/jevans40/Ruthenium/linmath"
+
+//A 2D point or direction
+type Vec2 = linmath.Vec2[float64]
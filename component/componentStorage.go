@@ -12,14 +12,17 @@ import (
 type entityNotFound string
 type oneOrMoreEntitiesAlreadyExists string
 type notEntityStorage string
+type componentTypeMismatch string
 
 func (e entityNotFound) Error() string                 { return string(e) }
 func (e oneOrMoreEntitiesAlreadyExists) Error() string { return string(e) }
 func (e notEntityStorage) Error() string               { return string(e) }
+func (e componentTypeMismatch) Error() string          { return string(e) }
 
 const EntityNotFoundError = entityNotFound("EntityNotFound")
 const NotEntityStorageError = entityNotFound("NotEntityStorage")
 const OneOrMoreEntitiesAlreadyExists = oneOrMoreEntitiesAlreadyExists("OneOrMoreEntitiesAlreadyExists")
+const ComponentTypeMismatchError = componentTypeMismatch("ComponentTypeMismatch")
 
 //A component storage should only store one type and should always
 //Respect basic database ideas. Entites should be immutable without a
@@ -37,6 +40,8 @@ type ComponentStorage interface {
 	ExistsMultiple([]EntityID) []bool
 
 	//Returns a list of all entities found in the storage.
+	//The order only depends on the operations done on the storage, never on
+	//map iteration or timing, so deterministic worlds can iterate over it.
 	GetEntities() []EntityID
 
 	//Returns the number of components stored here.
@@ -59,6 +64,30 @@ type ComponentStorage interface {
 
 	//calls DeleteEntity on all the entityIDs in the list immediately.
 	DeleteEntityMultiple(entitities []EntityID) error
+
+	//Adds a component without knowing the storages type at compile time.
+	//Returns ComponentTypeMismatchError if value is not of the stored type.
+	//Use WriteStorage[T].AddEntity when the type is known.
+	AddComponent(entity EntityID, value Component) error
+}
+
+//Entity storages that implement ValueStorage can be read and written without
+//knowing their type at compile time, this is used to save and load data files.
+type ValueStorage interface {
+	//Returns the component of entity
+	GetValue(entity EntityID) (Component, error)
+
+	//Overwrites the component of entity, value must be of the stored type
+	SetValue(entity EntityID, value Component) error
+}
+
+//Same as ValueStorage for storages that hold a single resource
+type ResourceValueStorage interface {
+	//Returns the resource
+	GetResource() Component
+
+	//Replaces the resource, value must be of the stored type
+	SetResource(value Component) error
 }
 
 type ReadOnlyStorage[T Component] interface {
@@ -94,3 +94,44 @@ func TestDenseStorage(t *testing.T) {
 	err = writeStorage.DeleteEntity(EntityID(2233))
 	assert.Error(t, err, "Test5.B no error for invalid entity ID")
 }
+
+type removal struct {
+	entity EntityID
+	value  Component
+}
+
+type recordingObserver struct {
+	removed []removal
+}
+
+func (r *recordingObserver) ComponentAdded(reflect.Type, EntityID, Component) {}
+func (r *recordingObserver) ComponentRemoved(_ reflect.Type, entity EntityID, value Component) {
+	r.removed = append(r.removed, removal{entity, value})
+}
+
+func TestDenseStorageObserver(t *testing.T) {
+	testStorage := NewDenseStorage[testComponent]()
+	observer := &recordingObserver{}
+	testStorage.(ObservableStorage).AddObserver(observer)
+	writeStorage, _ := GetWriteStorage[testComponent](testStorage)
+	assert.NoError(t, writeStorage.AddEntityMultiple([]EntityID{5, 7, 9}, []testComponent{{50}, {70}, {90}}))
+
+	//Entities listed twice are only removed once, the rest keep their own IDs
+	assert.NoError(t, writeStorage.DeleteEntityMultiple([]EntityID{5, 5, 9}))
+	assert.Equal(t, []removal{{5, testComponent{50}}, {9, testComponent{90}}}, observer.removed)
+	assert.Equal(t, testComponent{70}, writeStorage.MustGetComponent(7))
+}
+
+func TestDenseStorageOrder(t *testing.T) {
+	storage := NewDenseStorage[testComponent]()
+	for _, e := range []EntityID{7, 3, 9, 1, 5} {
+		assert.NoError(t, storage.AddBlankComponent(e))
+	}
+	assert.Equal(t, []EntityID{7, 3, 9, 1, 5}, storage.GetEntities())
+
+	//Deleting keeps the order of the remaining entities
+	assert.NoError(t, storage.DeleteEntityMultiple([]EntityID{3, 1}))
+	assert.Equal(t, []EntityID{7, 9, 5}, storage.GetEntities())
+	assert.NoError(t, storage.AddBlankComponent(2))
+	assert.Equal(t, []EntityID{7, 9, 5, 2}, storage.GetEntities())
+}
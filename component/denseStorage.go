@@ -9,19 +9,25 @@ import (
 var _ ComponentStorage = &DenseStorage[BaseComponent]{}
 var _ ReadOnlyStorage[BaseComponent] = &DenseStorage[BaseComponent]{}
 var _ WriteStorage[BaseComponent] = &DenseStorage[BaseComponent]{}
+var _ ObservableStorage = &DenseStorage[BaseComponent]{}
+var _ ValueStorage = &DenseStorage[BaseComponent]{}
 
 //The Dense Storage struct:
 //This type of storage stores all components in a dense array.
 //It uses a map from EntityID's to the internal storage map for lookup.
+//Entities are kept in the order they were added, deleting keeps the order of
+//the rest, so the same operations always lead to the same order.
 type DenseStorage[T Component] struct {
+	observerList
 	component   []T
+	entities    []EntityID
 	internalMap map[EntityID]int
 }
 
 //Create a new Dense Storage containing types T.
 //Returns a ComponentStorage interface
 func NewDenseStorage[T Component]() ComponentStorage {
-	return &DenseStorage[T]{component: []T{}, internalMap: map[EntityID]int{}}
+	return &DenseStorage[T]{component: []T{}, entities: []EntityID{}, internalMap: map[EntityID]int{}}
 }
 
 //Returns the type of the contained storage
@@ -44,13 +50,9 @@ func (d *DenseStorage[T]) ExistsMultiple(Entities []EntityID) []bool {
 	return toReturn
 }
 
-//Return all stored entities in this storage
+//Return all stored entities in this storage in storage order
 func (d *DenseStorage[T]) GetEntities() []EntityID {
-	toReturn := []EntityID{}
-	for k, _ := range d.internalMap {
-		toReturn = append(toReturn, k)
-	}
-	return toReturn
+	return append([]EntityID{}, d.entities...)
 }
 
 //Returns the number of components stored in this storage
@@ -65,7 +67,11 @@ func (d *DenseStorage[T]) AddBlankComponent(Entity EntityID) error {
 	}
 	var newComp T
 	d.component = append(d.component, newComp)
-	d.internalMap[Entity] = len(d.component)
+	d.entities = append(d.entities, Entity)
+	d.internalMap[Entity] = len(d.component) - 1
+	if d.isObserved() {
+		d.notifyAdded(d.GetType(), Entity, newComp)
+	}
 	return nil
 }
 
@@ -85,7 +91,11 @@ func (d *DenseStorage[T]) AddBlankComponentMultiple(Entity []EntityID) error {
 		}
 		var newComp T
 		d.component = append(d.component, newComp)
-		d.internalMap[e] = len(d.component)
+		d.entities = append(d.entities, e)
+		d.internalMap[e] = len(d.component) - 1
+		if d.isObserved() {
+			d.notifyAdded(d.GetType(), e, newComp)
+		}
 	}
 	return nil
 }
@@ -99,21 +109,59 @@ func (d *DenseStorage[T]) DeleteEntityMultiple(Entities []EntityID) error {
 		if _, ok := d.internalMap[e]; !ok {
 			return EntityNotFoundError
 		}
+	}
+	observed := d.isObserved()
+	var removed []T
+	var removedIDs []EntityID
+	for _, e := range Entities {
+		if observed && d.internalMap[e] != -1 {
+			removed = append(removed, d.component[d.internalMap[e]])
+			removedIDs = append(removedIDs, e)
+		}
 		d.internalMap[e] = -1
 	}
 	newStorage := []T{}
+	newEntities := []EntityID{}
 	newMap := map[EntityID]int{}
-	for k, v := range d.internalMap {
-		if v != -1 {
-			newStorage = append(newStorage, d.component[v])
-			newMap[k] = len(newStorage) - 1
+	for i, e := range d.entities {
+		if d.internalMap[e] != -1 {
+			newStorage = append(newStorage, d.component[i])
+			newEntities = append(newEntities, e)
+			newMap[e] = len(newStorage) - 1
 		}
 	}
 	d.component = newStorage
+	d.entities = newEntities
 	d.internalMap = newMap
+	for i, v := range removed {
+		d.notifyRemoved(d.GetType(), removedIDs[i], v)
+	}
 	return nil
 }
 
+//Adds value if it is a T, see ComponentStorage.AddComponent
+func (d *DenseStorage[T]) AddComponent(entity EntityID, value Component) error {
+	typed, ok := value.(T)
+	if !ok {
+		return ComponentTypeMismatchError
+	}
+	return d.AddEntity(entity, typed)
+}
+
+//Returns the component of entity, see ValueStorage
+func (d *DenseStorage[T]) GetValue(entity EntityID) (Component, error) {
+	return d.GetComponent(entity)
+}
+
+//Overwrites the component of entity if value is a T, see ValueStorage
+func (d *DenseStorage[T]) SetValue(entity EntityID, value Component) error {
+	typed, ok := value.(T)
+	if !ok {
+		return ComponentTypeMismatchError
+	}
+	return d.Write(entity, typed)
+}
+
 //The singlecase version of DeleteEntities Multiple
 //TODO: Should be avoided for now until fixed
 func (d *DenseStorage[T]) DeleteEntity(entity EntityID) error {
@@ -201,9 +249,12 @@ func (d *DenseStorage[T]) AddEntity(entity EntityID, component T) error {
 	}
 
 	d.component = append(d.component, component)
-
+	d.entities = append(d.entities, entity)
 	d.internalMap[entity] = len(d.component) - 1
 
+	if d.isObserved() {
+		d.notifyAdded(d.GetType(), entity, component)
+	}
 	return nil
 }
 
@@ -222,6 +273,7 @@ func (d *DenseStorage[T]) AddEntityMultiple(Entitylist []EntityID, Components []
 	}
 
 	d.component = append(d.component, Components...)
+	d.entities = append(d.entities, Entitylist...)
 
 	for i, v := range Entitylist {
 		if _, ok := d.internalMap[v]; ok {
@@ -229,5 +281,10 @@ func (d *DenseStorage[T]) AddEntityMultiple(Entitylist []EntityID, Components []
 		}
 		d.internalMap[v] = startingSize + i
 	}
+	if d.isObserved() {
+		for i, v := range Entitylist {
+			d.notifyAdded(d.GetType(), v, Components[i])
+		}
+	}
 	return nil
 }
@@ -0,0 +1,115 @@
+package component
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+	"reflect"
+)
+
+//Writes the contents of value to h, equal values always write the same bytes.
+//Unexported fields are included and pointers are followed, a pointer that was
+//already visited only writes a marker so cycles end. Map entries are combined
+//without depending on their order. Functions, channels and unsafe pointers have
+//no comparable content and only write whether they are nil.
+func HashValue(h hash.Hash64, value interface{}) {
+	hashReflect(h, reflect.ValueOf(value), map[uintptr]bool{})
+}
+
+func hashReflect(h hash.Hash64, v reflect.Value, visited map[uintptr]bool) {
+	var buf [8]byte
+	writeUint := func(u uint64) {
+		binary.LittleEndian.PutUint64(buf[:], u)
+		h.Write(buf[:])
+	}
+	if !v.IsValid() {
+		writeUint(0)
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			writeUint(1)
+		} else {
+			writeUint(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeUint(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeUint(math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		writeUint(math.Float64bits(real(v.Complex())))
+		writeUint(math.Float64bits(imag(v.Complex())))
+	case reflect.String:
+		writeUint(uint64(v.Len()))
+		h.Write([]byte(v.String()))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			hashReflect(h, v.Index(i), visited)
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			writeUint(0)
+			return
+		}
+		writeUint(uint64(v.Len()) + 1)
+		for i := 0; i < v.Len(); i++ {
+			hashReflect(h, v.Index(i), visited)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			hashReflect(h, v.Field(i), visited)
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			writeUint(0)
+			return
+		}
+		if visited[v.Pointer()] {
+			writeUint(1)
+			return
+		}
+		visited[v.Pointer()] = true
+		writeUint(2)
+		hashReflect(h, v.Elem(), visited)
+	case reflect.Interface:
+		if v.IsNil() {
+			writeUint(0)
+			return
+		}
+		writeUint(1)
+		h.Write([]byte(v.Elem().Type().String()))
+		hashReflect(h, v.Elem(), visited)
+	case reflect.Map:
+		if v.IsNil() {
+			writeUint(0)
+			return
+		}
+		writeUint(uint64(v.Len()) + 1)
+		//Entries are hashed on their own and summed so the order does not matter
+		var sum uint64
+		iter := v.MapRange()
+		for iter.Next() {
+			//Every entry starts from the same visited pointers for the same reason
+			entryVisited := make(map[uintptr]bool, len(visited))
+			for k := range visited {
+				entryVisited[k] = true
+			}
+			entry := fnv.New64a()
+			hashReflect(entry, iter.Key(), entryVisited)
+			hashReflect(entry, iter.Value(), entryVisited)
+			sum += entry.Sum64()
+		}
+		writeUint(sum)
+	default:
+		//Func, Chan and UnsafePointer
+		if v.IsNil() {
+			writeUint(0)
+		} else {
+			writeUint(1)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package component
+
+import (
+	"reflect"
+	"sync"
+)
+
+//An Observer is notified whenever a component is added to or removed from a storage.
+//Notifications are sent from whichever goroutine modified the storage while it is
+//being modified, so observers must be thread safe and must not call back into the storage.
+type Observer interface {
+	//Called after value has been added for entity
+	ComponentAdded(storageType reflect.Type, entity EntityID, value Component)
+
+	//Called with the removed value after entity has been removed
+	ComponentRemoved(storageType reflect.Type, entity EntityID, value Component)
+}
+
+//Storages that implement ObservableStorage notify their observers about every
+//added and removed component.
+type ObservableStorage interface {
+	AddObserver(observer Observer)
+	RemoveObserver(observer Observer)
+}
+
+//Keeps the observers of a storage, embedded by the entity storages
+type observerList struct {
+	observerLock sync.RWMutex
+	observers    []Observer
+}
+
+//Adds an observer that will be notified of all future changes
+func (o *observerList) AddObserver(observer Observer) {
+	o.observerLock.Lock()
+	defer o.observerLock.Unlock()
+	o.observers = append(o.observers, observer)
+}
+
+//Removes a previously added observer
+func (o *observerList) RemoveObserver(observer Observer) {
+	o.observerLock.Lock()
+	defer o.observerLock.Unlock()
+	for i, v := range o.observers {
+		if v == observer {
+			o.observers = append(o.observers[:i:i], o.observers[i+1:]...)
+			return
+		}
+	}
+}
+
+//Returns true if anyone is listening, used to skip building notifications
+func (o *observerList) isObserved() bool {
+	o.observerLock.RLock()
+	defer o.observerLock.RUnlock()
+	return len(o.observers) != 0
+}
+
+func (o *observerList) notifyAdded(storageType reflect.Type, entity EntityID, value Component) {
+	o.observerLock.RLock()
+	defer o.observerLock.RUnlock()
+	for _, v := range o.observers {
+		v.ComponentAdded(storageType, entity, value)
+	}
+}
+
+func (o *observerList) notifyRemoved(storageType reflect.Type, entity EntityID, value Component) {
+	o.observerLock.RLock()
+	defer o.observerLock.RUnlock()
+	for _, v := range o.observers {
+		v.ComponentRemoved(storageType, entity, value)
+	}
+}
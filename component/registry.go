@@ -0,0 +1,111 @@
+package component
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+//The registry maps names to component types so components can be described in
+//data files. Each registered type has a default value that data is decoded on top
+//of, so fields that are left out keep their default.
+var registry = struct {
+	lock   sync.RWMutex
+	byName map[string]Component
+	nameOf map[reflect.Type]string
+	typeOf map[string]reflect.Type
+}{byName: map[string]Component{}, nameOf: map[reflect.Type]string{}, typeOf: map[string]reflect.Type{}}
+
+//Registers T under name with its default value.
+//Returns an error if the name or the type is already registered.
+func Register[T Component](name string, defaultValue T) error {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if name == "" {
+		return errors.New("component name can not be empty")
+	}
+	if _, ok := registry.byName[name]; ok {
+		return fmt.Errorf("component name %s is already registered", name)
+	}
+	componentType := ReflectType[T]()
+	if other, ok := registry.nameOf[componentType]; ok {
+		return fmt.Errorf("component type %s is already registered as %s", componentType, other)
+	}
+	registry.byName[name] = defaultValue
+	registry.nameOf[componentType] = name
+	registry.typeOf[name] = componentType
+	return nil
+}
+
+//Calls Register and panics if it fails, meant for init functions
+func MustRegister[T Component](name string, defaultValue T) {
+	if err := Register(name, defaultValue); err != nil {
+		panic(err)
+	}
+}
+
+//Returns the type registered under name
+func LookupType(name string) (reflect.Type, bool) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	componentType, ok := registry.typeOf[name]
+	return componentType, ok
+}
+
+//Returns the name the type is registered under
+func LookupName(componentType reflect.Type) (string, bool) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	name, ok := registry.nameOf[componentType]
+	return name, ok
+}
+
+//Returns the default value of the component registered under name
+func NewByName(name string) (Component, error) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	value, ok := registry.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("component %s is not registered", name)
+	}
+	return value, nil
+}
+
+//Returns all registered names sorted alphabetically
+func RegisteredNames() []string {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	names := make([]string, 0, len(registry.byName))
+	for name := range registry.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//Decodes data on top of a copy of base and returns the result.
+//decode is given a pointer to the copy, json.Unmarshal and yaml.Node.Decode
+//can both be used this way.
+func DecodeComponent(base Component, decode func(target interface{}) error) (Component, error) {
+	target := reflect.New(reflect.TypeOf(base))
+	target.Elem().Set(reflect.ValueOf(base))
+	if err := decode(target.Interface()); err != nil {
+		return nil, err
+	}
+	decoded, ok := target.Elem().Interface().(Component)
+	if !ok {
+		return nil, ComponentTypeMismatchError
+	}
+	return decoded, nil
+}
+
+//Decodes data on top of the default value of the component registered under name
+func DecodeByName(name string, decode func(target interface{}) error) (Component, error) {
+	base, err := NewByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeComponent(base, decode)
+}
@@ -5,6 +5,7 @@ import "reflect"
 var _ ComponentStorage = &ResourceStorage[BaseComponent]{}
 var _ ReadOnlyStorage[BaseComponent] = &ResourceStorage[BaseComponent]{}
 var _ WriteStorage[BaseComponent] = &ResourceStorage[BaseComponent]{}
+var _ ResourceValueStorage = &ResourceStorage[BaseComponent]{}
 
 //Resource Storage struct, stores a single object at entity ID 0
 //This is used for storing global varibles
@@ -51,6 +52,11 @@ func (r *ResourceStorage[T]) AddBlankComponentMultiple(e []EntityID) error {
 	return NotEntityStorageError
 }
 
+//Returns NotEntityStorage error
+func (r *ResourceStorage[T]) AddComponent(entity EntityID, value Component) error {
+	return NotEntityStorageError
+}
+
 //Retursn NotEntityStorage error
 func (r *ResourceStorage[T]) DeleteEntityMultiple(e []EntityID) error {
 	return NotEntityStorageError
@@ -61,6 +67,21 @@ func (r *ResourceStorage[T]) DeleteEntity(entity EntityID) error {
 	return NotEntityStorageError
 }
 
+//Returns the resource, see ResourceValueStorage
+func (r *ResourceStorage[T]) GetResource() Component {
+	return r.resource
+}
+
+//Replaces the resource if value is a T, see ResourceValueStorage
+func (r *ResourceStorage[T]) SetResource(value Component) error {
+	typed, ok := value.(T)
+	if !ok {
+		return ComponentTypeMismatchError
+	}
+	r.resource = typed
+	return nil
+}
+
 //Returns the resource
 func (r *ResourceStorage[T]) MustGetComponent(e EntityID) T {
 	return r.resource
@@ -12,6 +12,8 @@ import (
 var _ ComponentStorage = &VectorStorage[BaseComponent]{}
 var _ ReadOnlyStorage[BaseComponent] = &VectorStorage[BaseComponent]{}
 var _ WriteStorage[BaseComponent] = &VectorStorage[BaseComponent]{}
+var _ ObservableStorage = &VectorStorage[BaseComponent]{}
+var _ ValueStorage = &VectorStorage[BaseComponent]{}
 
 //The Vector Storage struct:
 //This type of storage stores all components in a dense array.
@@ -19,6 +21,7 @@ var _ WriteStorage[BaseComponent] = &VectorStorage[BaseComponent]{}
 //TODO: Evaluate later but this storage type is litterally just a big
 //memory leak, we should look into storage/entity cleaning sometime.
 type VectorStorage[T Component] struct {
+	observerList
 	internalVector []T
 	//Check if the value is allocated
 	allocated []bool
@@ -39,6 +42,11 @@ func (ve *VectorStorage[T]) GetType() reflect.Type {
 	return reflect.TypeOf(ve.internalVector).Elem()
 }
 
+//Returns the type of the contained storage without locking
+func (ve *VectorStorage[T]) getType() reflect.Type {
+	return reflect.TypeOf(ve.internalVector).Elem()
+}
+
 //func (ve *VectorStorage[T]) GetData() []Component {
 //	var newArray := make()
 //}
@@ -76,10 +84,10 @@ func (ve *VectorStorage[T]) ExistsMultiple(Entities []EntityID) []bool {
 func (ve *VectorStorage[T]) GetEntities() []EntityID {
 	ve.RWLOCK.RLock()
 	defer ve.RWLOCK.RUnlock()
-	toReturn := make([]EntityID, ve.numStored)
+	toReturn := make([]EntityID, 0, ve.numStored)
 	for i, k := range ve.allocated {
 		if k {
-			toReturn[i] = EntityID(i)
+			toReturn = append(toReturn, EntityID(i))
 		}
 	}
 	return toReturn
@@ -111,6 +119,9 @@ func (ve *VectorStorage[T]) AddBlankComponent(Entity EntityID) error {
 	ve.allocated[Entity] = true
 	ve.internalVector[Entity] = newComp
 	ve.numStored++
+	if ve.isObserved() {
+		ve.notifyAdded(ve.getType(), Entity, newComp)
+	}
 	return nil
 }
 
@@ -121,10 +132,19 @@ func (ve *VectorStorage[T]) AddBlankComponent(Entity EntityID) error {
 func (ve *VectorStorage[T]) AddBlankComponentMultiple(Entity []EntityID) error {
 	ve.RWLOCK.Lock()
 	defer ve.RWLOCK.Unlock()
+	max := -1
 	for _, e := range Entity {
 		if ve.exists(e) {
 			return OneOrMoreEntitiesAlreadyExists
 		}
+		if int(e) > max {
+			max = int(e)
+		}
+	}
+	if max >= len(ve.internalVector) {
+		togrow := (max + 1) - len(ve.internalVector)
+		ve.internalVector = append(ve.internalVector, make([]T, togrow, togrow)...)
+		ve.allocated = append(ve.allocated, make([]bool, togrow, togrow)...)
 	}
 	for _, e := range Entity {
 		if ve.allocated[e] {
@@ -134,6 +154,9 @@ func (ve *VectorStorage[T]) AddBlankComponentMultiple(Entity []EntityID) error {
 		ve.allocated[e] = true
 		ve.internalVector[e] = newComp
 		ve.numStored++
+		if ve.isObserved() {
+			ve.notifyAdded(ve.getType(), e, newComp)
+		}
 	}
 	return nil
 }
@@ -154,19 +177,43 @@ func (ve *VectorStorage[T]) DeleteEntityMultiple(Entities []EntityID) error {
 	for _, e := range Entities {
 		if ve.allocated[e] {
 			var Deleted T
+			removed := ve.internalVector[e]
 			ve.allocated[e] = false
 			ve.internalVector[e] = Deleted
 			ve.numStored--
+			if ve.isObserved() {
+				ve.notifyRemoved(ve.getType(), e, removed)
+			}
 		}
 	}
 	return nil
 }
 
+//Adds value if it is a T, see ComponentStorage.AddComponent
+func (ve *VectorStorage[T]) AddComponent(entity EntityID, value Component) error {
+	typed, ok := value.(T)
+	if !ok {
+		return ComponentTypeMismatchError
+	}
+	return ve.AddEntity(entity, typed)
+}
+
+//Returns the component of entity, see ValueStorage
+func (ve *VectorStorage[T]) GetValue(entity EntityID) (Component, error) {
+	return ve.GetComponent(entity)
+}
+
+//Overwrites the component of entity if value is a T, see ValueStorage
+func (ve *VectorStorage[T]) SetValue(entity EntityID, value Component) error {
+	typed, ok := value.(T)
+	if !ok {
+		return ComponentTypeMismatchError
+	}
+	return ve.Write(entity, typed)
+}
+
 //The singlecase version of DeleteEntities Multiple
-//TODO: Should be avoided for now until fixed
 func (ve *VectorStorage[T]) DeleteEntity(entity EntityID) error {
-	ve.RWLOCK.Lock()
-	defer ve.RWLOCK.Unlock()
 	return ve.DeleteEntityMultiple([]EntityID{entity})
 }
 
@@ -295,14 +342,17 @@ func (ve *VectorStorage[T]) AddEntity(entity EntityID, component T) error {
 	ve.allocated[entity] = true
 	ve.internalVector[entity] = component
 	ve.numStored++
+	if ve.isObserved() {
+		ve.notifyAdded(ve.getType(), entity, component)
+	}
 	return nil
 }
 
 //Appends components to the end of the list
 //This will panic if the same entityID is listed multiple times
 func (ve *VectorStorage[T]) AddEntityMultiple(Entitylist []EntityID, Components []T) error {
-	ve.RWLOCK.RLock()
-	defer ve.RWLOCK.RUnlock()
+	ve.RWLOCK.Lock()
+	defer ve.RWLOCK.Unlock()
 
 	if len(Entitylist) != len(Components) {
 		return errors.New(fmt.Sprintf("Length of entity list must equal length of components %d != %d", len(Entitylist), len(Components)))
@@ -313,7 +363,7 @@ func (ve *VectorStorage[T]) AddEntityMultiple(Entitylist []EntityID, Components
 		if int(e) > max {
 			max = int(e)
 		}
-		if ve.allocated[e] {
+		if ve.exists(e) {
 			return OneOrMoreEntitiesAlreadyExists
 		}
 	}
@@ -327,8 +377,12 @@ func (ve *VectorStorage[T]) AddEntityMultiple(Entitylist []EntityID, Components
 		if ve.allocated[v] {
 			panic("Attemped to insert a duplicate entity, this shouldnt happen")
 		}
+		ve.allocated[v] = true
 		ve.internalVector[v] = Components[i]
 		ve.numStored++
+		if ve.isObserved() {
+			ve.notifyAdded(ve.getType(), v, Components[i])
+		}
 	}
 	return nil
 }
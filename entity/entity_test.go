@@ -0,0 +1,159 @@
+package entity
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+	"github.com/stretchr/testify/assert"
+)
+
+type testHealth struct {
+	Health int
+	Armor  int
+}
+
+func (t testHealth) GetType() reflect.Type { return reflect.TypeOf(t) }
+func (t testHealth) IsComponent()          {}
+
+type testName struct {
+	Name string
+}
+
+func (t testName) GetType() reflect.Type { return reflect.TypeOf(t) }
+func (t testName) IsComponent()          {}
+
+func init() {
+	component.MustRegister("TestHealth", testHealth{Health: 100, Armor: 1})
+	component.MustRegister("TestName", testName{})
+}
+
+//Returns a dispatcher with the hierarchy and test storages and a service that
+//runs spawn during the next tick
+func newPrefabDispatcher(t *testing.T) (world.Dispatcher, *func(chan world.EntityCreationData)) {
+	d := world.NewSimpleDispatcher()
+	assert.NoError(t, world.AddHierarchy(d))
+	d.AddStorage(component.NewDenseStorage[testHealth]())
+	d.AddStorage(component.NewDenseStorage[testName]())
+	var spawn func(chan world.EntityCreationData)
+	spawner := world.NewBaseService("spawner")
+	spawner.SetRunFunction(func(creation chan world.EntityCreationData, deletion chan component.EntityID) error {
+		if spawn != nil {
+			spawn(creation)
+			spawn = nil
+		}
+		return nil
+	})
+	d.AddService(spawner)
+	return d, &spawn
+}
+
+func getComponent[T component.Component](d world.Dispatcher, entity component.EntityID) (T, error) {
+	storage, _ := component.GetWriteStorage[T](d.GetStorage(component.ReflectType[T]()))
+	return storage.GetComponent(entity)
+}
+
+func TestPrefabs(t *testing.T) {
+	d, spawn := newPrefabDispatcher(t)
+	library := NewPrefabLibrary(d)
+
+	assert.NoError(t, library.Add(NewPrefab("sword", testName{"sword"}, world.NewTransform().Translate(1, 0))))
+	assert.NoError(t, library.Add(NewPrefab("enemy", testName{"enemy"}, testHealth{10, 0}).WithChild("sword")))
+	assert.NoError(t, library.Add(NewPrefab("goblin", testName{"goblin"}).Extends("enemy").WithChild("sword", testName{"dagger"})))
+	assert.Error(t, library.Add(NewPrefab("sword")), "Added a prefab twice")
+
+	components, children, err := library.Resolve("goblin")
+	assert.NoError(t, err)
+	assert.Equal(t, []component.Component{testName{"goblin"}, testHealth{10, 0}}, components)
+	assert.Equal(t, 2, len(children))
+
+	var goblins *Spawned
+	*spawn = func(creation chan world.EntityCreationData) {
+		goblins, err = library.Spawn(creation, "goblin", 2, testHealth{20, 2})
+	}
+	assert.NoError(t, d.Maintain())
+	assert.NoError(t, err)
+
+	ids := goblins.IDs()
+	assert.Equal(t, 2, len(ids))
+	assert.Equal(t, 2, len(goblins.Children))
+	swords := goblins.Children[0].IDs()
+	daggers := goblins.Children[1].IDs()
+	assert.Equal(t, 2, len(swords))
+	assert.Equal(t, 2, len(daggers))
+
+	for i, id := range ids {
+		name, _ := getComponent[testName](d, id)
+		assert.Equal(t, testName{"goblin"}, name)
+		health, _ := getComponent[testHealth](d, id)
+		assert.Equal(t, testHealth{20, 2}, health, "Instance override was not applied")
+
+		sword, _ := getComponent[testName](d, swords[i])
+		assert.Equal(t, testName{"sword"}, sword)
+		dagger, _ := getComponent[testName](d, daggers[i])
+		assert.Equal(t, testName{"dagger"}, dagger, "Child override was not applied")
+		parent, err := getComponent[world.Parent](d, daggers[i])
+		assert.NoError(t, err)
+		assert.Equal(t, id, parent.Entity)
+		_, err = getComponent[world.Transform](d, daggers[i])
+		assert.NoError(t, err, "Child lost the components of its prefab")
+	}
+
+	//Errors are returned before anything is sent
+	assert.NoError(t, library.Add(NewPrefab("loop").WithChild("loop")))
+	assert.NoError(t, library.Add(NewPrefab("orphan").Extends("missing")))
+	assert.NoError(t, library.Add(NewPrefab("unstored", world.NewRenderable())))
+	creation := make(chan world.EntityCreationData, 1)
+	for _, name := range []string{"loop", "orphan", "unstored", "missing"} {
+		_, err := library.Spawn(creation, name, 1)
+		assert.Error(t, err, name)
+	}
+	assert.Equal(t, 0, len(creation))
+}
+
+func TestPrefabFile(t *testing.T) {
+	d, spawn := newPrefabDispatcher(t)
+	library := NewPrefabLibrary(d)
+	assert.NoError(t, library.Add(NewPrefab("tag", testName{"tag"})))
+
+	file := `{"prefabs": [
+		{"name": "boss", "base": "enemy", "components": {"TestHealth": {"Health": 500}},
+		 "children": [{"prefab": "tag", "overrides": {"TestName": {"Name": "crown"}}}]},
+		{"name": "enemy", "components": {"TestHealth": {"Armor": 5}, "TestName": {"Name": "enemy"}}}
+	]}`
+	assert.NoError(t, library.Load(strings.NewReader(file)))
+
+	//Fields left out keep the registered default or the value of the base
+	components, children, err := library.Resolve("enemy")
+	assert.NoError(t, err)
+	assert.Equal(t, []component.Component{testHealth{100, 5}, testName{"enemy"}}, components)
+	components, children, err = library.Resolve("boss")
+	assert.NoError(t, err)
+	assert.Equal(t, []component.Component{testHealth{500, 5}, testName{"enemy"}}, components)
+	assert.Equal(t, []PrefabChild{{"tag", []component.Component{testName{"crown"}}}}, children)
+
+	var boss *Spawned
+	*spawn = func(creation chan world.EntityCreationData) {
+		boss, err = library.Spawn(creation, "boss", 1)
+	}
+	assert.NoError(t, d.Maintain())
+	assert.NoError(t, err)
+	crown, _ := getComponent[testName](d, boss.Children[0].IDs()[0])
+	assert.Equal(t, testName{"crown"}, crown)
+
+	//Broken files do not add anything
+	for _, broken := range []string{
+		`{"prefabs": [{"name": "a", "base": "b"}, {"name": "b", "base": "a"}]}`,
+		`{"prefabs": [{"name": "a", "base": "unknown"}]}`,
+		`{"prefabs": [{"name": "a", "components": {"NotRegistered": {}}}]}`,
+		`{"prefabs": [{"name": "a", "components": {"TestHealth": {"Health": "lots"}}}]}`,
+		`{"prefabs": [{"name": "a"}, {"name": "a"}]}`,
+		`{"prefabs": [{"name": "tag"}]}`,
+	} {
+		assert.Error(t, library.Load(strings.NewReader(broken)), broken)
+		_, ok := library.Get("a")
+		assert.False(t, ok, broken)
+	}
+}
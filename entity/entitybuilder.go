@@ -29,6 +29,6 @@ func (e EntityBuilder) SetNumber(numberOfEntities int) EntityBuilder {
 
 func (e EntityBuilder) Build() chan component.EntityID {
 	callback := make(chan component.EntityID, e.numberOfEntities)
-	e.callback <- world.EntityCreationData{e.numberOfEntities, e.data, callback}
+	e.callback <- world.EntityCreationData{NumEntities: e.numberOfEntities, Components: e.data, CreatedEntitiesCallback: callback}
 	return callback
 }
@@ -0,0 +1,443 @@
+package entity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//Gives prefabs access to the storages their components are added to.
+//A world.Dispatcher can be used directly.
+type StorageProvider interface {
+	GetStorage(storageType reflect.Type) component.ComponentStorage
+}
+
+//A Prefab is a named template of components that can be spawned any number of
+//times. A prefab can extend a base prefab, it then starts with all of the bases
+//components and children and replaces or adds to them.
+type Prefab struct {
+	name       string
+	base       string
+	components []component.Component
+	children   []PrefabChild
+}
+
+//A child prefab that is spawned with every instance of its parent.
+//Overrides replace the child prefabs components of the same type.
+type PrefabChild struct {
+	Prefab    string
+	Overrides []component.Component
+}
+
+func NewPrefab(name string, components ...component.Component) Prefab {
+	return Prefab{name: name}.With(components...)
+}
+
+func (p Prefab) GetName() string {
+	return p.name
+}
+
+//Returns the name of the base prefab, or an empty string if there is none
+func (p Prefab) GetBase() string {
+	return p.base
+}
+
+//Makes this prefab a variant of base
+func (p Prefab) Extends(base string) Prefab {
+	p.base = base
+	return p
+}
+
+//Adds components to the prefab, replacing any of the same type
+func (p Prefab) With(components ...component.Component) Prefab {
+	p.components = withComponents(p.components, components)
+	return p
+}
+
+//Adds a child prefab that is spawned for every instance of this prefab
+func (p Prefab) WithChild(prefab string, overrides ...component.Component) Prefab {
+	p.children = append(append([]PrefabChild{}, p.children...), PrefabChild{Prefab: prefab, Overrides: overrides})
+	return p
+}
+
+//Returns a copy of list with every value of toAdd replacing the value of the same type
+func withComponents(list []component.Component, toAdd []component.Component) []component.Component {
+	list = append([]component.Component{}, list...)
+NextComponent:
+	for _, c := range toAdd {
+		for i, v := range list {
+			if v.GetType() == c.GetType() {
+				list[i] = c
+				continue NextComponent
+			}
+		}
+		list = append(list, c)
+	}
+	return list
+}
+
+/***************************/
+/*     Prefab Library      */
+
+//Keeps the prefabs by name and spawns them.
+//All methods are safe to call from multiple services.
+type PrefabLibrary struct {
+	lock     sync.RWMutex
+	prefabs  map[string]Prefab
+	storages StorageProvider
+
+	loadLock sync.Mutex
+	loaded   map[string]bool
+}
+
+func NewPrefabLibrary(storages StorageProvider) *PrefabLibrary {
+	return &PrefabLibrary{prefabs: make(map[string]Prefab), storages: storages, loaded: make(map[string]bool)}
+}
+
+//Adds a prefab, returns an error if one with the same name already exists.
+//The base and children do not have to exist until the prefab is spawned.
+func (l *PrefabLibrary) Add(prefab Prefab) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.addUnlocked(prefab)
+}
+
+//Returns the prefab with the given name
+func (l *PrefabLibrary) Get(name string) (Prefab, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	prefab, ok := l.prefabs[name]
+	return prefab, ok
+}
+
+//Returns the components and children of the prefab with all of its bases applied
+func (l *PrefabLibrary) Resolve(name string) ([]component.Component, []PrefabChild, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.resolve(name)
+}
+
+//Must hold the read lock
+func (l *PrefabLibrary) resolve(name string) ([]component.Component, []PrefabChild, error) {
+	var chain []Prefab
+	for next := name; next != ""; {
+		prefab, ok := l.prefabs[next]
+		if !ok {
+			if len(chain) == 0 {
+				return nil, nil, fmt.Errorf("prefab %s does not exist", next)
+			}
+			return nil, nil, fmt.Errorf("base prefab %s of %s does not exist", next, chain[len(chain)-1].name)
+		}
+		for _, v := range chain {
+			if v.name == next {
+				return nil, nil, fmt.Errorf("prefab %s extends itself", next)
+			}
+		}
+		chain = append(chain, prefab)
+		next = prefab.base
+	}
+	var components []component.Component
+	var children []PrefabChild
+	for i := len(chain) - 1; i >= 0; i-- {
+		components = withComponents(components, chain[i].components)
+		children = append(children, chain[i].children...)
+	}
+	return components, children, nil
+}
+
+/***************************/
+/*        Spawning         */
+
+//The entities created by a spawn and by each of its child prefabs.
+type Spawned struct {
+	Prefab   string
+	Children []*Spawned
+
+	count    int
+	ids      []component.EntityID
+	entities chan component.EntityID
+}
+
+//Returns the IDs of the spawned entities in creation order. For children these are
+//the children of every parent instance in order. The dispatcher creates entities at
+//the end of the tick, so this blocks until then and must not be called by the
+//service that spawned them in the same tick.
+func (s *Spawned) IDs() []component.EntityID {
+	for len(s.ids) < s.count {
+		s.ids = append(s.ids, <-s.entities)
+	}
+	return s.ids
+}
+
+//Spawns count instances of the prefab through the creation channel of a service.
+//Overrides replace the prefabs components of the same type for these instances.
+//Every component of the prefab and its children must have a storage.
+func (l *PrefabLibrary) Spawn(creation chan world.EntityCreationData, name string, count int, overrides ...component.Component) (*Spawned, error) {
+	data, spawned, err := l.Build(name, count, overrides...)
+	if err != nil {
+		return nil, err
+	}
+	creation <- data
+	return spawned, nil
+}
+
+//Builds the creation data Spawn would send without sending it, so it can be
+//extended or queued with Dispatcher.Spawn.
+func (l *PrefabLibrary) Build(name string, count int, overrides ...component.Component) (world.EntityCreationData, *Spawned, error) {
+	if count <= 0 {
+		return world.EntityCreationData{}, nil, errors.New("prefab spawn count must be at least one")
+	}
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.build(name, count, 1, overrides, nil)
+}
+
+//Builds the creation data of a prefab, parents is the number of parent instances.
+//Must hold the read lock.
+func (l *PrefabLibrary) build(name string, count int, parents int, overrides []component.Component, spawning []string) (world.EntityCreationData, *Spawned, error) {
+	for _, v := range spawning {
+		if v == name {
+			return world.EntityCreationData{}, nil, fmt.Errorf("prefab %s contains itself as a child of %s", name, strings.Join(spawning, " -> "))
+		}
+	}
+	spawning = append(spawning, name)
+
+	components, children, err := l.resolve(name)
+	if err != nil {
+		return world.EntityCreationData{}, nil, err
+	}
+	components = withComponents(components, overrides)
+
+	var writeables []world.StorageWriteable
+	for _, c := range components {
+		storage := l.storages.GetStorage(c.GetType())
+		if storage == nil {
+			return world.EntityCreationData{}, nil, fmt.Errorf("prefab %s has a %s component but there is no storage for it", name, c.GetType())
+		}
+		writeables = append(writeables, world.MakeComponentWriteable(c, storage))
+	}
+
+	total := count * parents
+	spawned := &Spawned{Prefab: name, count: total, entities: make(chan component.EntityID, total)}
+	data := world.EntityCreationData{NumEntities: count, Components: writeables, CreatedEntitiesCallback: spawned.entities}
+	for _, child := range children {
+		childData, childSpawned, err := l.build(child.Prefab, 1, total, child.Overrides, spawning)
+		if err != nil {
+			return world.EntityCreationData{}, nil, err
+		}
+		data.Children = append(data.Children, childData)
+		spawned.Children = append(spawned.Children, childSpawned)
+	}
+	return data, spawned, nil
+}
+
+/***************************/
+/*      Prefab Files       */
+
+//Prefab files are JSON documents of the form
+//	{"prefabs": [{
+//		"name": "goblin",
+//		"base": "enemy",
+//		"components": {"Renderable": {"W": 16, "H": 16}},
+//		"children": [{"prefab": "sword", "overrides": {"Transform": [1, 0, 4, 0, 1, 0, 0, 0, 1]}}]
+//	}]}
+//Components are named by their registered name (see component.Register). Their
+//data is decoded on top of the value they would otherwise have, the bases
+//component for variants or the registered default, so left out fields are kept.
+type prefabFile struct {
+	Prefabs []prefabData `json:"prefabs"`
+}
+
+type prefabData struct {
+	Name       string                     `json:"name"`
+	Base       string                     `json:"base"`
+	Components map[string]json.RawMessage `json:"components"`
+	Children   []prefabChildData          `json:"children"`
+}
+
+type prefabChildData struct {
+	Prefab    string                     `json:"prefab"`
+	Overrides map[string]json.RawMessage `json:"overrides"`
+}
+
+//Loads the prefabs of a prefab file at path.
+//Files that were already loaded by this library are skipped.
+func (l *PrefabLibrary) LoadFile(path string) error {
+	path = filepath.Clean(path)
+	l.loadLock.Lock()
+	defer l.loadLock.Unlock()
+	if l.loaded[path] {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := l.Load(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	l.loaded[path] = true
+	return nil
+}
+
+//Loads all prefabs of a prefab file. Prefabs may extend or contain prefabs that
+//are defined later in the same file or were added to the library before.
+//If an error is returned no prefabs are added.
+func (l *PrefabLibrary) Load(r io.Reader) error {
+	var file prefabFile
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	//Prefabs are decoded on top of their bases and children, so they are added
+	//in dependency order to a copy of the library that replaces it once all succeed.
+	staged := &PrefabLibrary{prefabs: make(map[string]Prefab, len(l.prefabs)), storages: l.storages}
+	for k, v := range l.prefabs {
+		staged.prefabs[k] = v
+	}
+	inFile := map[string]bool{}
+	for _, v := range file.Prefabs {
+		if inFile[v.Name] {
+			return fmt.Errorf("prefab %s is defined twice", v.Name)
+		}
+		inFile[v.Name] = true
+	}
+
+	pending := file.Prefabs
+	for len(pending) != 0 {
+		var waiting []prefabData
+		for _, v := range pending {
+			if !staged.dependenciesLoaded(v, inFile) {
+				waiting = append(waiting, v)
+				continue
+			}
+			prefab, err := staged.decodePrefab(v)
+			if err != nil {
+				return err
+			}
+			if err := staged.addUnlocked(prefab); err != nil {
+				return err
+			}
+		}
+		if len(waiting) == len(pending) {
+			var names []string
+			for _, v := range waiting {
+				names = append(names, v.Name)
+			}
+			return fmt.Errorf("prefabs %s depend on each other or on prefabs that do not exist", strings.Join(names, ", "))
+		}
+		pending = waiting
+	}
+	l.prefabs = staged.prefabs
+	return nil
+}
+
+//Must hold the lock
+func (l *PrefabLibrary) addUnlocked(prefab Prefab) error {
+	if prefab.name == "" {
+		return errors.New("prefab name can not be empty")
+	}
+	if _, ok := l.prefabs[prefab.name]; ok {
+		return fmt.Errorf("prefab %s already exists", prefab.name)
+	}
+	l.prefabs[prefab.name] = prefab
+	return nil
+}
+
+//Returns true once the base and children of a prefab from a file can be resolved
+func (l *PrefabLibrary) dependenciesLoaded(data prefabData, inFile map[string]bool) bool {
+	loaded := func(name string) bool {
+		_, ok := l.prefabs[name]
+		return ok || !inFile[name]
+	}
+	if data.Base != "" && !loaded(data.Base) {
+		return false
+	}
+	for _, v := range data.Children {
+		if !loaded(v.Prefab) {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *PrefabLibrary) decodePrefab(data prefabData) (Prefab, error) {
+	prefab := Prefab{name: data.Name, base: data.Base}
+	var inherited []component.Component
+	if data.Base != "" {
+		var err error
+		inherited, _, err = l.resolve(data.Base)
+		if err != nil {
+			return Prefab{}, fmt.Errorf("prefab %s: %w", data.Name, err)
+		}
+	}
+	components, err := decodeComponents(data.Components, inherited)
+	if err != nil {
+		return Prefab{}, fmt.Errorf("prefab %s: %w", data.Name, err)
+	}
+	prefab.components = components
+
+	for _, child := range data.Children {
+		childComponents, _, err := l.resolve(child.Prefab)
+		if err != nil {
+			return Prefab{}, fmt.Errorf("prefab %s: %w", data.Name, err)
+		}
+		overrides, err := decodeComponents(child.Overrides, childComponents)
+		if err != nil {
+			return Prefab{}, fmt.Errorf("prefab %s child %s: %w", data.Name, child.Prefab, err)
+		}
+		prefab.children = append(prefab.children, PrefabChild{Prefab: child.Prefab, Overrides: overrides})
+	}
+	return prefab, nil
+}
+
+//Decodes named components in name order, each on top of the value of the same
+//type in inherited or on top of its registered default
+func decodeComponents(raw map[string]json.RawMessage, inherited []component.Component) ([]component.Component, error) {
+	var names []string
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var components []component.Component
+	for _, name := range names {
+		componentType, ok := component.LookupType(name)
+		if !ok {
+			return nil, fmt.Errorf("component %s is not registered", name)
+		}
+		base, err := component.NewByName(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range inherited {
+			if v.GetType() == componentType {
+				base = v
+			}
+		}
+		data := raw[name]
+		decoded, err := component.DecodeComponent(base, func(target interface{}) error {
+			return json.Unmarshal(data, target)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %w", name, err)
+		}
+		components = append(components, decoded)
+	}
+	return components, nil
+}
@@ -0,0 +1,96 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io/fs"
+	"strings"
+)
+
+//The kinds of AssetError, check for them with errors.Is
+var (
+	NotFoundError          = errors.New("file not found")
+	DecodeFailedError      = errors.New("decoding failed")
+	UnsupportedFormatError = errors.New("unsupported format")
+)
+
+//Returned when an asset can not be read or decoded. Kind is one of
+//NotFoundError, DecodeFailedError and UnsupportedFormatError, Err is the
+//error that caused it.
+type AssetError struct {
+	Path string
+	Kind error
+	Err  error
+}
+
+func (e *AssetError) Error() string {
+	return fmt.Sprintf("%s: %v: %v", e.Path, e.Kind, e.Err)
+}
+
+func (e *AssetError) Unwrap() error {
+	return e.Err
+}
+
+//Matches the kind as well as the wrapped error
+func (e *AssetError) Is(target error) bool {
+	return target == e.Kind
+}
+
+//Wraps an error from opening a file, missing files become NotFoundError
+func openError(path string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return &AssetError{Path: path, Kind: NotFoundError, Err: err}
+	}
+	return err
+}
+
+func imageDecodeError(path string, err error) error {
+	if errors.Is(err, image.ErrFormat) {
+		return &AssetError{Path: path, Kind: UnsupportedFormatError, Err: err}
+	}
+	return &AssetError{Path: path, Kind: DecodeFailedError, Err: err}
+}
+
+func fontDecodeError(path string, err error) error {
+	//sfnt does not export its unsupported errors, they all share this prefix
+	if strings.HasPrefix(err.Error(), "sfnt: unsupported") {
+		return &AssetError{Path: path, Kind: UnsupportedFormatError, Err: err}
+	}
+	return &AssetError{Path: path, Kind: DecodeFailedError, Err: err}
+}
+
+/***************************/
+/*     Missing texture     */
+
+const missingTextureSize = 16
+
+//Returns the placeholder drawn in place of images that could not be loaded, a
+//magenta and black checkerboard that is hard to miss. Every call returns a new
+//image so it can be changed freely.
+func MissingTexture() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, missingTextureSize, missingTextureSize))
+	magenta := color.RGBA{255, 0, 255, 255}
+	black := color.RGBA{0, 0, 0, 255}
+	for y := 0; y < missingTextureSize; y++ {
+		for x := 0; x < missingTextureSize; x++ {
+			if (x/4+y/4)%2 == 0 {
+				img.SetRGBA(x, y, magenta)
+			} else {
+				img.SetRGBA(x, y, black)
+			}
+		}
+	}
+	return img
+}
+
+//Reads an image like ReadImage and returns MissingTexture with the error if
+//that fails, so callers can log the error and keep going
+func ReadImageOrMissing(filename string) (*image.RGBA, error) {
+	img, err := ReadImage(filename)
+	if err != nil {
+		return MissingTexture(), err
+	}
+	return img, nil
+}
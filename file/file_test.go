@@ -1,12 +1,21 @@
 package file
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"testing"
+	"testing/fstest"
 	"unicode"
 
 	"github.com/jevans40/Ruthenium/linmath"
+	"github.com/stretchr/testify/assert"
 )
 
 //TODO:: more tests
@@ -37,3 +46,65 @@ func TestLoadingFonts(t *testing.T) {
 		}
 	}
 }
+
+func TestReadImageFS(t *testing.T) {
+	var encoded bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(1, 1, color.RGBA{1, 2, 3, 255})
+	assert.NoError(t, png.Encode(&encoded, img))
+	fsys := fstest.MapFS{
+		"image/test.png": {Data: encoded.Bytes()},
+		"image/bad.png":  {Data: []byte("not a png")},
+	}
+	read, err := ReadImageFS(fsys, "image/test.png")
+	assert.NoError(t, err)
+	assert.Equal(t, img.Pix, read.Pix)
+	_, err = ReadImageFS(fsys, "image/missing.png")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	_, err = ReadImageFS(fsys, "image/bad.png")
+	assert.Error(t, err)
+
+	SetResources(fsys)
+	defer SetResources(nil)
+	read, err = ReadImageFS(Resources(), "image/test.png")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, read.Bounds().Dx())
+}
+
+func TestAssetErrors(t *testing.T) {
+	dir := t.TempDir()
+	var encoded bytes.Buffer
+	assert.NoError(t, png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	truncated := filepath.Join(dir, "truncated.png")
+	assert.NoError(t, os.WriteFile(truncated, encoded.Bytes()[:encoded.Len()/2], 0644))
+	text := filepath.Join(dir, "text.png")
+	assert.NoError(t, os.WriteFile(text, []byte("just some text"), 0644))
+
+	_, err := ReadImage(filepath.Join(dir, "missing.png"))
+	assert.ErrorIs(t, err, NotFoundError)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	var assetErr *AssetError
+	assert.True(t, errors.As(err, &assetErr))
+	assert.Equal(t, filepath.Join(dir, "missing.png"), assetErr.Path)
+	_, err = ReadImage(text)
+	assert.ErrorIs(t, err, UnsupportedFormatError)
+	_, err = ReadImage(truncated)
+	assert.ErrorIs(t, err, DecodeFailedError)
+	_, err = ReadFont(text)
+	assert.ErrorIs(t, err, DecodeFailedError)
+	_, err = ReadFont(filepath.Join(dir, "missing.ttf"))
+	assert.ErrorIs(t, err, NotFoundError)
+
+	//The missing texture stands in for images that failed
+	img, err := ReadImageOrMissing(text)
+	assert.Error(t, err)
+	assert.Equal(t, MissingTexture().Pix, img.Pix)
+	assert.Equal(t, color.RGBA{255, 0, 255, 255}, img.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{0, 0, 0, 255}, img.RGBAAt(4, 0))
+
+	assert.NoError(t, WriteImage(filepath.Join(dir, "written.png"), img))
+	read, err := ReadImage(filepath.Join(dir, "written.png"))
+	assert.NoError(t, err)
+	assert.Equal(t, img.Pix, read.Pix)
+	assert.Error(t, WriteImage(filepath.Join(dir, "missing", "written.png"), img))
+}
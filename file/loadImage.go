@@ -1,10 +1,13 @@
 package file
 
 import (
+	"fmt"
 	"image"
 	"image/draw"
 	"image/png"
 	_ "image/png"
+	"io"
+	"io/fs"
 	"os"
 
 	log "github.com/sirupsen/logrus"
@@ -20,36 +23,67 @@ func (i *notOpaqueRGBA) Opaque() bool {
 	return false
 }
 
-//TODO:: Handle errors gracefully; no need to crash if a image is missing.
+//Panics if the image can not be loaded, use ReadImage or ReadImageOrMissing
+//to handle errors instead.
 func LoadImageFromFile(filename string) *image.RGBA {
-	f, err := os.Open(filename)
+	m, err := ReadImage(filename)
 	if err != nil {
 		log.Panic(err)
 	}
+	return m
+}
+
+//Decodes an image file and converts it to RGBA. Errors are *AssetError values
+//except for files that exist but can not be opened.
+func ReadImage(filename string) (*image.RGBA, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, openError(filename, err)
+	}
 	defer f.Close()
+	return decodeImage(f, filename)
+}
 
-	img, fmtName, err := image.Decode(f)
+//Decodes the image name of fsys, like ReadImage
+func ReadImageFS(fsys fs.FS, name string) (*image.RGBA, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, openError(name, err)
+	}
+	defer f.Close()
+	return decodeImage(f, name)
+}
+
+func decodeImage(r io.Reader, filename string) (*image.RGBA, error) {
+	img, fmtName, err := image.Decode(r)
 	log.Debug(fmtName)
 	if err != nil {
-		panic(err)
+		return nil, imageDecodeError(filename, err)
 	}
 	b := img.Bounds()
 	m := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
 	draw.Draw(m, m.Bounds(), img, b.Min, draw.Src)
-	return m
+	return m, nil
 }
 
+//Panics if the image can not be saved, use WriteImage to handle errors instead
 func SaveImageToFile(filename string, img image.Image) {
-	f, err := os.Create(filename)
-	if err != nil {
+	if err := WriteImage(filename, img); err != nil {
 		log.Panic(err)
 	}
-	defer f.Close()
+}
 
-	err = png.Encode(f, img)
+//Encodes img as a png file
+func WriteImage(filename string, img image.Image) error {
+	f, err := os.Create(filename)
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", filename, err)
 	}
+	return f.Close()
 }
 
 func DrawToImage(src, dst image.Image, sp image.Point) *image.RGBA {
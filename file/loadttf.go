@@ -2,6 +2,7 @@ package file
 
 import (
 	"image"
+	"io/fs"
 	"io/ioutil"
 
 	"github.com/jevans40/Ruthenium/linmath"
@@ -21,27 +22,64 @@ type PSFont struct {
 
 //TODO this needs to be individual to each thread, otherwise I think this will clash the threads
 
+//Panics if the font can not be loaded, use ReadFont and Font.NewFace to handle
+//errors instead
 func LoadFont(filename string, fontsize int) PSFont {
-	fontBytes, err := ioutil.ReadFile(filename)
+	parsed, err := ReadFont(filename)
 	if err != nil {
 		log.Panic(err)
 	}
+	fnt, err := parsed.NewFace(fontsize)
+	if err != nil {
+		log.Panic(err)
+	}
+	return fnt
+}
+
+//A parsed font file. It can be shared, every PSFont made from it has its own
+//face and position.
+type Font struct {
+	font *opentype.Font
+}
+
+//Reads and parses a ttf or otf file. Errors are *AssetError values except for
+//files that exist but can not be read.
+func ReadFont(filename string) (*Font, error) {
+	fontBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, openError(filename, err)
+	}
+	return parseFont(fontBytes, filename)
+}
+
+//Reads and parses the font name of fsys, like ReadFont
+func ReadFontFS(fsys fs.FS, name string) (*Font, error) {
+	fontBytes, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, openError(name, err)
+	}
+	return parseFont(fontBytes, name)
+}
 
+func parseFont(fontBytes []byte, filename string) (*Font, error) {
 	utf8Font, err := opentype.Parse(fontBytes)
 	if err != nil {
-		log.Panic(err)
+		return nil, fontDecodeError(filename, err)
 	}
+	return &Font{font: utf8Font}, nil
+}
 
-	face, err := opentype.NewFace(utf8Font, &opentype.FaceOptions{
+//Makes a PSFont drawing this font at the given size
+func (f *Font) NewFace(fontsize int) (PSFont, error) {
+	face, err := opentype.NewFace(f.font, &opentype.FaceOptions{
 		Size:    float64(fontsize),
 		DPI:     72,
 		Hinting: font.HintingNone,
 	})
 	if err != nil {
-		log.Panic(err)
+		return PSFont{}, err
 	}
-
-	return PSFont{face, fixed.Point26_6{}}
+	return PSFont{face, fixed.Point26_6{}}, nil
 }
 
 //Returns where to draw the char
@@ -0,0 +1,55 @@
+package file
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jevans40/Ruthenium/archive"
+	log "github.com/sirupsen/logrus"
+)
+
+//The names Resources looks for next to the executable
+const (
+	ResourceArchiveName   = "res.rarc"
+	ResourceDirectoryName = "res"
+)
+
+var resourcesLock sync.Mutex
+var resources fs.FS
+
+//Returns the file system the games assets are read from, paths in it are slash
+//separated like "image/God.png". Unless SetResources was called it is the first
+//of these that exists: res.rarc next to the executable, the res directory next
+//to the executable and the res directory in the working directory. The last one
+//is used even if it does not exist so errors name a sensible path.
+func Resources() fs.FS {
+	resourcesLock.Lock()
+	defer resourcesLock.Unlock()
+	if resources == nil {
+		resources = findResources()
+	}
+	return resources
+}
+
+//Replaces the file system returned by Resources, nil searches again
+func SetResources(fsys fs.FS) {
+	resourcesLock.Lock()
+	defer resourcesLock.Unlock()
+	resources = fsys
+}
+
+func findResources() fs.FS {
+	if executable, err := os.Executable(); err == nil {
+		dir := filepath.Dir(executable)
+		if packed, err := archive.Open(filepath.Join(dir, ResourceArchiveName)); err == nil {
+			log.WithField("archive", filepath.Join(dir, ResourceArchiveName)).Debug("Reading assets from archive")
+			return packed
+		}
+		if info, err := os.Stat(filepath.Join(dir, ResourceDirectoryName)); err == nil && info.IsDir() {
+			return os.DirFS(filepath.Join(dir, ResourceDirectoryName))
+		}
+	}
+	return os.DirFS(ResourceDirectoryName)
+}
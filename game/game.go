@@ -6,6 +6,8 @@ import (
 
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/jevans40/Ruthenium/asset"
+	"github.com/jevans40/Ruthenium/input"
 	"github.com/jevans40/Ruthenium/render"
 	"github.com/jevans40/Ruthenium/world"
 	log "github.com/sirupsen/logrus"
@@ -35,12 +37,33 @@ type Game interface {
 
 	//Returns the game render channel
 	GetRenderChannel() chan []float32
+
+	//Returns a new source of the windows input events, pass it to input.AddInput
+	//to give a world an Input resource. Each world needs its own source.
+	NewInputSource() input.Source
+
+	//Makes the sprites sample the first page of the packed atlas instead of the
+	//default texture. Must be called before Start.
+	SetAtlas(atlas *render.ImageAtlas)
+
+	//Applies the reloads of the reloader every frame, before drawing, so
+	//reloaded atlas images and shaders show up. Must be called before Start.
+	SetRenderReloader(reloader *asset.RenderReloader)
+
+	//Compiles the sprite program again whenever one of the shaders is reloaded.
+	//Needs a render reloader and must be called before Start.
+	WatchShaders(vertex, fragment asset.Handle[asset.ShaderSource])
 }
 
 type gameECS struct {
 	window     *render.GoWindow
 	worlds     []*world.WorldHandler
 	renderchan chan []float32
+	input      *input.GLFWSource
+
+	atlas    *render.ImageAtlas
+	reloader *asset.RenderReloader
+	shaders  []asset.Handle[asset.ShaderSource]
 }
 
 func NewGameECS() Game {
@@ -51,6 +74,7 @@ func (g *gameECS) Init() error {
 	log.SetFormatter(&log.TextFormatter{})
 	log.SetLevel(log.DebugLevel)
 	g.renderchan = make(chan []float32, runtime.NumCPU())
+	g.input = input.NewGLFWSource()
 	return nil
 }
 
@@ -89,6 +113,7 @@ func (g *gameECS) Start() {
 		log.Panic(err)
 	}
 	g.window = window
+	g.input.Attach(window.GetWindow())
 	go g.render()
 	go g.update()
 
@@ -100,6 +125,22 @@ func (g *gameECS) GetRenderChannel() chan []float32 {
 	return g.renderchan
 }
 
+func (g *gameECS) NewInputSource() input.Source {
+	return g.input.NewSource()
+}
+
+func (g *gameECS) SetAtlas(atlas *render.ImageAtlas) {
+	g.atlas = atlas
+}
+
+func (g *gameECS) SetRenderReloader(reloader *asset.RenderReloader) {
+	g.reloader = reloader
+}
+
+func (g *gameECS) WatchShaders(vertex, fragment asset.Handle[asset.ShaderSource]) {
+	g.shaders = []asset.Handle[asset.ShaderSource]{vertex, fragment}
+}
+
 //NOTE: possibly move this to the systems category.
 
 func (g *gameECS) render() {
@@ -144,10 +185,21 @@ func (g *gameECS) render() {
 	numObjects := 0
 	var sprites []*render.VertexRenderable
 	renderer := render.SpriteRendererFactory()
+	if g.atlas != nil {
+		renderer.SetAtlas(g.atlas)
+	}
+	if g.reloader != nil && len(g.shaders) == 2 {
+		g.reloader.WatchProgram(&renderer, g.shaders[0], g.shaders[1])
+	}
 	for {
 		//Create the renderer
 		Buffer = <-g.renderchan
 
+		//Errors are logged by Apply, whatever failed keeps its old state
+		if g.reloader != nil {
+			g.reloader.Apply()
+		}
+
 		numObjects = len(Buffer) / 28
 		for len(sprites) < numObjects {
 			sprites = append(sprites, render.VertexSpriteFactory(&renderer))
@@ -165,8 +217,10 @@ func (g *gameECS) render() {
 }
 
 func (g *gameECS) EventLoop() {
+	//Gamepads have no events, wake up often enough to poll them every frame
 	for {
-		glfw.WaitEvents()
+		glfw.WaitEventsTimeout(1.0 / 120)
+		g.input.PollGamepads()
 	}
 }
 
@@ -0,0 +1,504 @@
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//What a Control reads from
+type Device uint8
+
+const (
+	Keyboard Device = iota
+	Mouse
+	GamepadButtons
+	GamepadAxes
+)
+
+//A single key, button or axis an action can be bound to. Keys and buttons have
+//the value 1 while held and 0 otherwise, axes have their current value.
+type Control struct {
+	Device Device
+	Code   int
+
+	//Only used by axes. 0 reads the whole axis, 1 and -1 read only the positive
+	//or negative half as a value from 0 to 1, so a stick can act like two buttons.
+	Direction int
+}
+
+func KeyControl(key Key) Control {
+	return Control{Device: Keyboard, Code: int(key)}
+}
+
+func MouseControl(button MouseButton) Control {
+	return Control{Device: Mouse, Code: int(button)}
+}
+
+func GamepadControl(button GamepadButton) Control {
+	return Control{Device: GamepadButtons, Code: int(button)}
+}
+
+func AxisControl(axis GamepadAxis, direction int) Control {
+	return Control{Device: GamepadAxes, Code: int(axis), Direction: direction}
+}
+
+//Controls are named like "Space", "LeftControl", "MouseLeft", "Mouse4",
+//"GamepadA", "GamepadLeftX" and "GamepadLeftX+" in config files
+func (c Control) String() string {
+	switch c.Device {
+	case Keyboard:
+		return Key(c.Code).String()
+	case Mouse:
+		return MouseButton(c.Code).String()
+	case GamepadButtons:
+		return "Gamepad" + GamepadButton(c.Code).String()
+	case GamepadAxes:
+		name := "Gamepad" + GamepadAxis(c.Code).String()
+		if c.Direction > 0 {
+			name += "+"
+		} else if c.Direction < 0 {
+			name += "-"
+		}
+		return name
+	}
+	return fmt.Sprintf("Control(%d, %d)", c.Device, c.Code)
+}
+
+var controlsByName map[string]Control
+
+func init() {
+	controlsByName = map[string]Control{}
+	for key := range keyNames {
+		controlsByName[key.String()] = KeyControl(key)
+	}
+	for button := MouseButton1; button <= MouseButtonLast; button++ {
+		controlsByName[button.String()] = MouseControl(button)
+		controlsByName[fmt.Sprintf("Mouse%d", int(button)+1)] = MouseControl(button)
+	}
+	for button := ButtonA; button <= ButtonLast; button++ {
+		controlsByName[GamepadControl(button).String()] = GamepadControl(button)
+	}
+	for axis := AxisLeftX; axis <= AxisLast; axis++ {
+		for _, direction := range []int{0, 1, -1} {
+			controlsByName[AxisControl(axis, direction).String()] = AxisControl(axis, direction)
+		}
+	}
+}
+
+//Returns the control with the given name, see Control.String
+func ParseControl(name string) (Control, error) {
+	control, ok := controlsByName[name]
+	if !ok {
+		return Control{}, fmt.Errorf("unknown control %s", name)
+	}
+	return control, nil
+}
+
+func (c Control) MarshalText() ([]byte, error) {
+	if _, err := ParseControl(c.String()); err != nil {
+		return nil, err
+	}
+	return []byte(c.String()), nil
+}
+
+func (c *Control) UnmarshalText(text []byte) error {
+	control, err := ParseControl(string(text))
+	if err != nil {
+		return err
+	}
+	*c = control
+	return nil
+}
+
+//Returns the value of the control, gamepad is used for gamepad controls
+func (c Control) value(state Input, gamepad int) float64 {
+	switch c.Device {
+	case Keyboard:
+		return boolValue(state.Pressed(Key(c.Code)))
+	case Mouse:
+		return boolValue(state.MousePressed(MouseButton(c.Code)))
+	case GamepadButtons:
+		return boolValue(state.GamepadPressed(gamepad, GamepadButton(c.Code)))
+	case GamepadAxes:
+		value := state.Axis(gamepad, GamepadAxis(c.Code))
+		if c.Direction != 0 {
+			value = math.Max(0, value*float64(c.Direction))
+		}
+		return value
+	}
+	return 0
+}
+
+/***************************/
+/*        Bindings         */
+
+//Any connected gamepad can trigger a binding with this Gamepad, the one with the
+//largest value is used
+const AnyGamepad = -1
+
+//One way to trigger an action. A binding with more than one control is a chord,
+//it only triggers while all of its controls are held. While a chord triggers,
+//bindings made of only some of its controls do not, so binding LeftControl and S
+//to one action keeps an action bound to S alone from triggering at the same time.
+//
+//The value of a binding is the product of its control values times Scale, axes
+//within DeadZone of 0 count as 0 and the rest of the axis is rescaled to 0-1.
+type Binding struct {
+	Controls []Control `json:"controls"`
+	DeadZone float64   `json:"deadZone,omitempty"`
+
+	//0 is read as 1, use -1 to bind a key to the negative side of an axis action
+	Scale float64 `json:"scale,omitempty"`
+
+	//The gamepad read by gamepad controls, 0 by default or AnyGamepad
+	Gamepad int `json:"gamepad,omitempty"`
+}
+
+//Returns a binding that triggers while all controls are held
+func Chord(controls ...Control) Binding {
+	return Binding{Controls: controls}
+}
+
+func (b Binding) WithDeadZone(deadZone float64) Binding {
+	b.DeadZone = deadZone
+	return b
+}
+
+func (b Binding) WithScale(scale float64) Binding {
+	b.Scale = scale
+	return b
+}
+
+func (b Binding) OnGamepad(gamepad int) Binding {
+	b.Gamepad = gamepad
+	return b
+}
+
+func (b Binding) value(state Input) float64 {
+	if b.Gamepad != AnyGamepad {
+		return b.valueOn(state, b.Gamepad)
+	}
+	best := 0.0
+	for gamepad := 0; gamepad < MaxGamepads; gamepad++ {
+		if value := b.valueOn(state, gamepad); math.Abs(value) > math.Abs(best) {
+			best = value
+		}
+	}
+	return best
+}
+
+func (b Binding) valueOn(state Input, gamepad int) float64 {
+	if len(b.Controls) == 0 {
+		return 0
+	}
+	value := 1.0
+	for _, c := range b.Controls {
+		controlValue := c.value(state, gamepad)
+		if c.Device == GamepadAxes {
+			controlValue = applyDeadZone(controlValue, b.DeadZone)
+		}
+		value *= controlValue
+	}
+	if b.Scale != 0 {
+		value *= b.Scale
+	}
+	return value
+}
+
+//Returns true if chord is larger than b and holds every control of b
+func (b Binding) shadowedBy(chord Binding) bool {
+	if len(chord.Controls) <= len(b.Controls) {
+		return false
+	}
+	for _, c := range b.Controls {
+		found := false
+		for _, v := range chord.Controls {
+			if v == c {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+/***************************/
+/*       Action Map        */
+
+//The bindings of every named action. It is safe to rebind actions while the
+//world is running, changes are used from the next tick on.
+type ActionMap struct {
+	lock     sync.RWMutex
+	bindings map[string][]Binding
+}
+
+func NewActionMap() *ActionMap {
+	return &ActionMap{bindings: map[string][]Binding{}}
+}
+
+//Adds bindings to an action, creating the action if needed
+func (m *ActionMap) Bind(action string, bindings ...Binding) *ActionMap {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.bindings[action] = append(m.bindings[action], bindings...)
+	return m
+}
+
+//Replaces all bindings of an action
+func (m *ActionMap) Rebind(action string, bindings ...Binding) *ActionMap {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.bindings[action] = append([]Binding(nil), bindings...)
+	return m
+}
+
+//Removes an action and its bindings
+func (m *ActionMap) Unbind(action string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.bindings, action)
+}
+
+//Returns a copy of the bindings of an action
+func (m *ActionMap) Bindings(action string) []Binding {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return append([]Binding(nil), m.bindings[action]...)
+}
+
+//Returns the names of all actions, sorted
+func (m *ActionMap) Names() []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	names := make([]string, 0, len(m.bindings))
+	for name := range m.bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type actionFile struct {
+	Actions map[string][]Binding `json:"actions"`
+}
+
+//Replaces every binding with the ones read from r. Files look like:
+//
+//	{"actions": {
+//		"jump": [{"controls": ["Space"]}, {"controls": ["GamepadA"]}],
+//		"save": [{"controls": ["LeftControl", "S"]}],
+//		"move_x": [
+//			{"controls": ["D"]},
+//			{"controls": ["A"], "scale": -1},
+//			{"controls": ["GamepadLeftX"], "deadZone": 0.2}
+//		]
+//	}}
+func (m *ActionMap) Load(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	var file actionFile
+	if err := decoder.Decode(&file); err != nil {
+		return err
+	}
+	for name, bindings := range file.Actions {
+		for _, b := range bindings {
+			if b.DeadZone < 0 || b.DeadZone >= 1 {
+				return fmt.Errorf("action %s has the dead zone %v, it must be at least 0 and below 1", name, b.DeadZone)
+			}
+			if b.Gamepad < AnyGamepad || b.Gamepad >= MaxGamepads {
+				return fmt.Errorf("action %s uses the unknown gamepad %d", name, b.Gamepad)
+			}
+		}
+	}
+	if file.Actions == nil {
+		file.Actions = map[string][]Binding{}
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.bindings = file.Actions
+	return nil
+}
+
+//Writes every binding to w in the format read by Load
+func (m *ActionMap) Save(w io.Writer) error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(actionFile{Actions: m.bindings})
+}
+
+func (m *ActionMap) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := m.Load(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (m *ActionMap) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := m.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+//Returns the state of every action for the next tick
+func (m *ActionMap) evaluate(state Input, last Actions) Actions {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	type activeBinding struct {
+		action  string
+		binding Binding
+		value   float64
+	}
+	var active []activeBinding
+	for name, bindings := range m.bindings {
+		for _, b := range bindings {
+			if value := b.value(state); value != 0 {
+				active = append(active, activeBinding{name, b, value})
+			}
+		}
+	}
+
+	next := Actions{states: make(map[string]actionState, len(m.bindings))}
+	for name := range m.bindings {
+		next.states[name] = actionState{wasPressed: last.states[name].pressed}
+	}
+	for _, a := range active {
+		shadowed := false
+		for _, other := range active {
+			if a.binding.shadowedBy(other.binding) {
+				shadowed = true
+				break
+			}
+		}
+		current := next.states[a.action]
+		if !shadowed && math.Abs(a.value) > math.Abs(current.value) {
+			current.value = a.value
+			current.pressed = true
+			next.states[a.action] = current
+		}
+	}
+	return next
+}
+
+/***************************/
+/*     Actions Resource    */
+
+//The state of every action in an ActionMap for one tick, stored as a resource
+//and written by the action service right after the input service.
+type Actions struct {
+	states map[string]actionState
+}
+
+type actionState struct {
+	value               float64
+	pressed, wasPressed bool
+}
+
+func (a Actions) GetType() reflect.Type { return reflect.TypeOf(a) }
+func (a Actions) IsComponent()          {}
+
+//Returns true while any binding of the action triggers
+func (a Actions) Pressed(action string) bool {
+	return a.states[action].pressed
+}
+
+//Returns true if the action started triggering this tick
+func (a Actions) JustPressed(action string) bool {
+	state := a.states[action]
+	return state.pressed && !state.wasPressed
+}
+
+//Returns true if the action stopped triggering this tick
+func (a Actions) JustReleased(action string) bool {
+	state := a.states[action]
+	return !state.pressed && state.wasPressed
+}
+
+//Returns the value of the binding with the largest magnitude, 0 if none trigger.
+//Use it for axis actions like "move_x".
+func (a Actions) Value(action string) float64 {
+	return a.states[action].value
+}
+
+//Adds the Actions resource and an action service for actions to the dispatcher.
+//The input service has to be added too, see AddInput.
+func AddActions(d world.Dispatcher, actions *ActionMap) error {
+	if err := d.AddStorage(component.NewResourceStorage(Actions{})); err != nil {
+		return err
+	}
+	return d.AddService(NewActionService(actions))
+}
+
+//Creates the service that evaluates actions against the Input resource every tick
+func NewActionService(actions *ActionMap) world.Service {
+	service := world.NewBaseService("actions")
+	service.SetStage(world.PreUpdateStage)
+	service.AddRequiredService("input")
+	service.AddRequiredAccessComponent(world.NewComponentAccess[Input](world.ReadAccess))
+	service.AddRequiredAccessComponent(world.NewComponentAccess[Actions](world.WriteAccess))
+	service.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		inputs, err := world.GetReadStorage[Input](service)
+		if err != nil {
+			return err
+		}
+		state, err := inputs.GetComponent(0)
+		if err != nil {
+			return err
+		}
+		storage, err := world.GetWriteStorage[Actions](service)
+		if err != nil {
+			return err
+		}
+		last, err := storage.GetComponent(0)
+		if err != nil {
+			return err
+		}
+		return storage.Write(0, actions.evaluate(state, last))
+	})
+	return service
+}
+
+/***************************/
+/*        Helpers          */
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+//Maps |value| from deadZone-1 to 0-1 keeping the sign
+func applyDeadZone(value, deadZone float64) float64 {
+	magnitude := math.Abs(value)
+	if magnitude <= deadZone {
+		return 0
+	}
+	magnitude = math.Min(1, (magnitude-deadZone)/(1-deadZone))
+	return math.Copysign(magnitude, value)
+}
@@ -0,0 +1,126 @@
+package input
+
+import (
+	"sync"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+//Collects the input events of a GLFW window and hands a copy of every event to
+//each Source made with NewSource, so every world can poll its own.
+//
+//Keyboard, mouse and character events arrive through window callbacks while
+//glfw.PollEvents or glfw.WaitEvents runs. GLFW has no gamepad callbacks, their
+//state is read by PollGamepads which has to be called on the main thread after
+//the window events were processed.
+type GLFWSource struct {
+	lock    sync.Mutex
+	sources []*SyntheticSource
+
+	gamepads [MaxGamepads]gamepadSnapshot
+}
+
+type gamepadSnapshot struct {
+	connected bool
+	buttons   [ButtonLast + 1]bool
+	axes      [AxisLast + 1]float32
+}
+
+//Creates a source without a window, call Attach once the window exists. Sources
+//can be handed out with NewSource before that.
+func NewGLFWSource() *GLFWSource {
+	return &GLFWSource{}
+}
+
+//Registers the input callbacks of window, this replaces any key, mouse button,
+//cursor, scroll or character callbacks set before.
+func (g *GLFWSource) Attach(window *glfw.Window) {
+	window.SetKeyCallback(g.keyCallback)
+	window.SetMouseButtonCallback(g.mouseButtonCallback)
+	window.SetCursorPosCallback(g.cursorPosCallback)
+	window.SetScrollCallback(g.scrollCallback)
+	window.SetCharCallback(g.charCallback)
+}
+
+//Returns a new Source that receives every event from now on
+func (g *GLFWSource) NewSource() Source {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	source := NewSyntheticSource()
+	g.sources = append(g.sources, source)
+	return source
+}
+
+func (g *GLFWSource) send(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for _, source := range g.sources {
+		source.Send(events...)
+	}
+}
+
+func (g *GLFWSource) keyCallback(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	g.send(Event{Type: KeyEvent, Code: int(key), Action: Action(action)})
+}
+
+func (g *GLFWSource) mouseButtonCallback(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+	g.send(Event{Type: MouseButtonEvent, Code: int(button), Action: Action(action)})
+}
+
+func (g *GLFWSource) cursorPosCallback(w *glfw.Window, x float64, y float64) {
+	g.send(Event{Type: CursorEvent, X: x, Y: y})
+}
+
+func (g *GLFWSource) scrollCallback(w *glfw.Window, x float64, y float64) {
+	g.send(Event{Type: ScrollEvent, X: x, Y: y})
+}
+
+func (g *GLFWSource) charCallback(w *glfw.Window, char rune) {
+	g.send(Event{Type: CharEvent, Char: char})
+}
+
+//Reads the state of the first MaxGamepads joysticks and sends an event for
+//every change since the last call. Must be called on the main thread.
+func (g *GLFWSource) PollGamepads() {
+	var events []Event
+	for i := range g.gamepads {
+		joystick := glfw.Joystick(int(glfw.Joystick1) + i)
+		last := &g.gamepads[i]
+		var state *glfw.GamepadState
+		if joystick.IsGamepad() {
+			state = joystick.GetGamepadState()
+		}
+		if (state != nil) != last.connected {
+			action := Release
+			if state != nil {
+				action = Press
+			}
+			events = append(events, Event{Type: GamepadConnectionEvent, Gamepad: i, Action: action})
+			*last = gamepadSnapshot{connected: state != nil}
+		}
+		if state == nil {
+			continue
+		}
+		for button := range last.buttons {
+			pressed := state.Buttons[button] == glfw.Press
+			if pressed != last.buttons[button] {
+				action := Release
+				if pressed {
+					action = Press
+				}
+				events = append(events, Event{Type: GamepadButtonEvent, Gamepad: i, Code: button, Action: action})
+				last.buttons[button] = pressed
+			}
+		}
+		for axis := range last.axes {
+			if state.Axes[axis] != last.axes[axis] {
+				events = append(events, Event{Type: GamepadAxisEvent, Gamepad: i, Code: axis, X: float64(state.Axes[axis])})
+				last.axes[axis] = state.Axes[axis]
+			}
+		}
+	}
+	g.send(events...)
+}
@@ -0,0 +1,233 @@
+package input
+
+import (
+	"reflect"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//The input state of one tick, stored as a resource and rebuilt every tick by
+//the input service from the events of its Source. Services read it with
+//GetReadStorage[Input] during the Update stage or later.
+//
+//Pressed means held down at the end of the tick, JustPressed and JustReleased
+//mean it went down or up during the tick. A key that is tapped within a single
+//tick is both JustPressed and JustReleased but not Pressed.
+type Input struct {
+	keys, keysPressed, keysReleased keySet
+
+	mouse, mousePressed, mouseReleased buttonSet
+	cursorX, cursorY                   float64
+	cursorDX, cursorDY                 float64
+	cursorKnown                        bool
+	scrollX, scrollY                   float64
+
+	text     string
+	gamepads [MaxGamepads]gamepadInput
+}
+
+type gamepadInput struct {
+	connected                  bool
+	buttons, pressed, released buttonSet
+	axes                       [AxisLast + 1]float64
+}
+
+func (i Input) GetType() reflect.Type { return reflect.TypeOf(i) }
+func (i Input) IsComponent()          {}
+
+//Returns the state of the next tick after events happened, oldest first
+func (i Input) Next(events []Event) Input {
+	i.keysPressed, i.keysReleased = keySet{}, keySet{}
+	i.mousePressed, i.mouseReleased = 0, 0
+	i.cursorDX, i.cursorDY = 0, 0
+	i.scrollX, i.scrollY = 0, 0
+	i.text = ""
+	for pad := range i.gamepads {
+		i.gamepads[pad].pressed, i.gamepads[pad].released = 0, 0
+	}
+
+	var text []rune
+	for _, e := range events {
+		switch e.Type {
+		case KeyEvent:
+			updateButton(&i.keys, &i.keysPressed, &i.keysReleased, e.Code, e.Action)
+		case MouseButtonEvent:
+			updateButton(&i.mouse, &i.mousePressed, &i.mouseReleased, e.Code, e.Action)
+		case CursorEvent:
+			if i.cursorKnown {
+				i.cursorDX += e.X - i.cursorX
+				i.cursorDY += e.Y - i.cursorY
+			}
+			i.cursorX, i.cursorY, i.cursorKnown = e.X, e.Y, true
+		case ScrollEvent:
+			i.scrollX += e.X
+			i.scrollY += e.Y
+		case CharEvent:
+			text = append(text, e.Char)
+		case GamepadConnectionEvent, GamepadButtonEvent, GamepadAxisEvent:
+			if e.Gamepad < 0 || e.Gamepad >= MaxGamepads {
+				continue
+			}
+			pad := &i.gamepads[e.Gamepad]
+			switch e.Type {
+			case GamepadConnectionEvent:
+				pad.connected = e.Action != Release
+				if !pad.connected {
+					//Buttons held on a disconnected gamepad are released
+					pad.released |= pad.buttons
+					pad.buttons = 0
+					pad.axes = [AxisLast + 1]float64{}
+				}
+			case GamepadButtonEvent:
+				pad.connected = true
+				updateButton(&pad.buttons, &pad.pressed, &pad.released, e.Code, e.Action)
+			case GamepadAxisEvent:
+				pad.connected = true
+				if e.Code >= 0 && e.Code <= int(AxisLast) {
+					pad.axes[e.Code] = e.X
+				}
+			}
+		}
+	}
+	i.text = string(text)
+	return i
+}
+
+//Returns true if key is held down
+func (i Input) Pressed(key Key) bool { return i.keys.has(int(key)) }
+
+//Returns true if key went down during this tick
+func (i Input) JustPressed(key Key) bool { return i.keysPressed.has(int(key)) }
+
+//Returns true if key went up during this tick
+func (i Input) JustReleased(key Key) bool { return i.keysReleased.has(int(key)) }
+
+func (i Input) MousePressed(button MouseButton) bool      { return i.mouse.has(int(button)) }
+func (i Input) MouseJustPressed(button MouseButton) bool  { return i.mousePressed.has(int(button)) }
+func (i Input) MouseJustReleased(button MouseButton) bool { return i.mouseReleased.has(int(button)) }
+
+//Returns the cursor position in window coordinates
+func (i Input) Cursor() (x, y float64) { return i.cursorX, i.cursorY }
+
+//Returns how far the cursor moved during this tick
+func (i Input) CursorDelta() (dx, dy float64) { return i.cursorDX, i.cursorDY }
+
+//Returns the scroll offset of this tick
+func (i Input) Scroll() (x, y float64) { return i.scrollX, i.scrollY }
+
+//Returns the text typed during this tick
+func (i Input) Text() string { return i.text }
+
+func (i Input) GamepadConnected(gamepad int) bool {
+	return gamepad >= 0 && gamepad < MaxGamepads && i.gamepads[gamepad].connected
+}
+
+func (i Input) GamepadPressed(gamepad int, button GamepadButton) bool {
+	return gamepad >= 0 && gamepad < MaxGamepads && i.gamepads[gamepad].buttons.has(int(button))
+}
+
+func (i Input) GamepadJustPressed(gamepad int, button GamepadButton) bool {
+	return gamepad >= 0 && gamepad < MaxGamepads && i.gamepads[gamepad].pressed.has(int(button))
+}
+
+func (i Input) GamepadJustReleased(gamepad int, button GamepadButton) bool {
+	return gamepad >= 0 && gamepad < MaxGamepads && i.gamepads[gamepad].released.has(int(button))
+}
+
+//Returns the value of a gamepad axis, 0 for unknown gamepads and axes
+func (i Input) Axis(gamepad int, axis GamepadAxis) float64 {
+	if gamepad < 0 || gamepad >= MaxGamepads || axis < 0 || axis > AxisLast {
+		return 0
+	}
+	return i.gamepads[gamepad].axes[axis]
+}
+
+/***************************/
+/*        Service          */
+
+//Adds the Input resource and an input service reading from source to the dispatcher
+func AddInput(d world.Dispatcher, source Source) error {
+	if err := d.AddStorage(component.NewResourceStorage(Input{})); err != nil {
+		return err
+	}
+	return d.AddService(NewInputService(source))
+}
+
+//Creates the service that polls source and writes the Input resource. It runs
+//in the PreUpdateStage so every other service sees the input of the tick.
+func NewInputService(source Source) world.Service {
+	service := world.NewBaseService("input")
+	service.SetStage(world.PreUpdateStage)
+	service.AddRequiredAccessComponent(world.NewComponentAccess[Input](world.WriteAccess))
+	service.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		storage, err := world.GetWriteStorage[Input](service)
+		if err != nil {
+			return err
+		}
+		current, err := storage.GetComponent(0)
+		if err != nil {
+			return err
+		}
+		return storage.Write(0, current.Next(source.Poll()))
+	})
+	return service
+}
+
+/***************************/
+/*        Helpers          */
+
+type keySet [(KeyLast + 64) / 64]uint64
+
+func (s *keySet) set(i int, value bool) {
+	if i < 0 || i >= len(s)*64 {
+		return
+	}
+	if value {
+		s[i/64] |= 1 << uint(i%64)
+	} else {
+		s[i/64] &^= 1 << uint(i%64)
+	}
+}
+
+func (s keySet) has(i int) bool {
+	return i >= 0 && i < len(s)*64 && s[i/64]&(1<<uint(i%64)) != 0
+}
+
+//Mouse and gamepad buttons
+type buttonSet uint32
+
+func (s *buttonSet) set(i int, value bool) {
+	if i < 0 || i >= 32 {
+		return
+	}
+	if value {
+		*s |= 1 << uint(i)
+	} else {
+		*s &^= 1 << uint(i)
+	}
+}
+
+func (s buttonSet) has(i int) bool {
+	return i >= 0 && i < 32 && s&(1<<uint(i)) != 0
+}
+
+type bitSet interface {
+	set(i int, value bool)
+	has(i int) bool
+}
+
+func updateButton(down, pressed, released bitSet, code int, action Action) {
+	switch action {
+	case Press:
+		if !down.has(code) {
+			pressed.set(code, true)
+		}
+		down.set(code, true)
+	case Release:
+		if down.has(code) {
+			released.set(code, true)
+		}
+		down.set(code, false)
+	}
+}
@@ -0,0 +1,338 @@
+package input
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGLFWValues(t *testing.T) {
+	assert.Equal(t, int(glfw.KeySpace), int(KeySpace))
+	assert.Equal(t, int(glfw.KeyZ), int(KeyZ))
+	assert.Equal(t, int(glfw.KeyEscape), int(KeyEscape))
+	assert.Equal(t, int(glfw.KeyF25), int(KeyF25))
+	assert.Equal(t, int(glfw.KeyKPEqual), int(KeyKPEqual))
+	assert.Equal(t, int(glfw.KeyLast), int(KeyLast))
+	assert.Equal(t, int(glfw.MouseButtonLast), int(MouseButtonLast))
+	assert.Equal(t, int(glfw.ButtonLast), int(ButtonLast))
+	assert.Equal(t, int(glfw.AxisLast), int(AxisLast))
+	assert.Equal(t, int(glfw.Repeat), int(Repeat))
+	assert.Equal(t, "LeftShift", KeyLeftShift.String())
+	assert.Equal(t, "DpadLeft", ButtonDpadLeft.String())
+}
+
+func TestInputState(t *testing.T) {
+	source := NewSyntheticSource()
+	state := Input{}
+
+	source.PressKey(KeyA)
+	source.PressKey(KeySpace)
+	source.ReleaseKey(KeySpace)
+	source.MoveCursor(10, 10)
+	source.Type("hi")
+	state = state.Next(source.Poll())
+	assert.True(t, state.Pressed(KeyA))
+	assert.True(t, state.JustPressed(KeyA))
+	assert.False(t, state.Pressed(KeySpace))
+	assert.True(t, state.JustPressed(KeySpace), "A tap within one tick was lost")
+	assert.True(t, state.JustReleased(KeySpace))
+	assert.Equal(t, "hi", state.Text())
+	dx, dy := state.CursorDelta()
+	assert.Equal(t, [2]float64{0, 0}, [2]float64{dx, dy}, "The first cursor position is not a movement")
+
+	//Repeats and held keys are not pressed again
+	source.Send(Event{Type: KeyEvent, Code: int(KeyA), Action: Repeat})
+	source.MoveCursor(15, 5)
+	source.Scroll(0, 1)
+	source.Scroll(0, 2)
+	state = state.Next(source.Poll())
+	assert.True(t, state.Pressed(KeyA))
+	assert.False(t, state.JustPressed(KeyA))
+	assert.False(t, state.JustReleased(KeySpace))
+	assert.Equal(t, "", state.Text())
+	x, y := state.Cursor()
+	assert.Equal(t, [2]float64{15, 5}, [2]float64{x, y})
+	dx, dy = state.CursorDelta()
+	assert.Equal(t, [2]float64{5, -5}, [2]float64{dx, dy})
+	x, y = state.Scroll()
+	assert.Equal(t, [2]float64{0, 3}, [2]float64{x, y})
+
+	source.ReleaseKey(KeyA)
+	source.PressMouseButton(MouseButtonRight)
+	source.ConnectGamepad(1)
+	source.PressGamepadButton(1, ButtonA)
+	source.MoveGamepadAxis(1, AxisLeftX, -0.5)
+	state = state.Next(source.Poll())
+	assert.True(t, state.JustReleased(KeyA))
+	assert.True(t, state.MouseJustPressed(MouseButtonRight))
+	assert.False(t, state.MousePressed(MouseButtonLeft))
+	assert.True(t, state.GamepadConnected(1))
+	assert.False(t, state.GamepadConnected(0))
+	assert.True(t, state.GamepadJustPressed(1, ButtonA))
+	assert.Equal(t, -0.5, state.Axis(1, AxisLeftX))
+	assert.Equal(t, 0.0, state.Axis(7, AxisLeftX))
+
+	//Disconnecting releases everything held on the gamepad
+	source.DisconnectGamepad(1)
+	state = state.Next(source.Poll())
+	assert.False(t, state.GamepadConnected(1))
+	assert.True(t, state.GamepadJustReleased(1, ButtonA))
+	assert.Equal(t, 0.0, state.Axis(1, AxisLeftX))
+	assert.True(t, state.MousePressed(MouseButtonRight))
+}
+
+func TestInputService(t *testing.T) {
+	d := world.NewSimpleDispatcher()
+	source := NewSyntheticSource()
+	assert.NoError(t, AddInput(d, source))
+
+	var seen []bool
+	reader := world.NewBaseService("reader")
+	reader.AddRequiredAccessComponent(world.NewComponentAccess[Input](world.ReadAccess))
+	reader.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		storage, err := world.GetReadStorage[Input](reader)
+		if err != nil {
+			return err
+		}
+		state, err := storage.GetComponent(0)
+		if err != nil {
+			return err
+		}
+		seen = append(seen, state.JustPressed(KeyEnter))
+		return nil
+	})
+	assert.NoError(t, d.AddService(reader))
+
+	source.PressKey(KeyEnter)
+	assert.NoError(t, d.Maintain())
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, []bool{true, false}, seen, "Services should see input from the same tick")
+}
+
+func TestActions(t *testing.T) {
+	d := world.NewSimpleDispatcher()
+	source := NewSyntheticSource()
+	actions := NewActionMap().
+		Bind("jump", Chord(KeyControl(KeySpace)), Chord(GamepadControl(ButtonA)).OnGamepad(AnyGamepad)).
+		Bind("down", Chord(KeyControl(KeyS))).
+		Bind("save", Chord(KeyControl(KeyLeftControl), KeyControl(KeyS))).
+		Bind("move_x",
+			Chord(KeyControl(KeyD)),
+			Chord(KeyControl(KeyA)).WithScale(-1),
+			Chord(AxisControl(AxisLeftX, 0)).WithDeadZone(0.2))
+	assert.NoError(t, AddInput(d, source))
+	assert.NoError(t, AddActions(d, actions))
+
+	var state Actions
+	reader := world.NewBaseService("reader")
+	reader.AddRequiredAccessComponent(world.NewComponentAccess[Actions](world.ReadAccess))
+	reader.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		storage, err := world.GetReadStorage[Actions](reader)
+		if err != nil {
+			return err
+		}
+		state, err = storage.GetComponent(0)
+		return err
+	})
+	assert.NoError(t, d.AddService(reader))
+
+	source.PressKey(KeySpace)
+	source.PressKey(KeyA)
+	assert.NoError(t, d.Maintain())
+	assert.True(t, state.Pressed("jump"))
+	assert.True(t, state.JustPressed("jump"))
+	assert.Equal(t, -1.0, state.Value("move_x"))
+	assert.False(t, state.Pressed("unknown"))
+
+	source.ReleaseKey(KeySpace)
+	source.ConnectGamepad(2)
+	source.PressGamepadButton(2, ButtonA)
+	source.MoveGamepadAxis(0, AxisLeftX, 0.1)
+	assert.NoError(t, d.Maintain())
+	assert.True(t, state.Pressed("jump"), "Any gamepad should trigger jump")
+	assert.False(t, state.JustPressed("jump"), "Switching bindings is not a new press")
+	assert.Equal(t, -1.0, state.Value("move_x"), "The stick is inside the dead zone")
+
+	source.ReleaseGamepadButton(2, ButtonA)
+	source.ReleaseKey(KeyA)
+	source.MoveGamepadAxis(0, AxisLeftX, 0.6)
+	assert.NoError(t, d.Maintain())
+	assert.True(t, state.JustReleased("jump"))
+	assert.InDelta(t, 0.5, state.Value("move_x"), 1e-9)
+
+	//The chord hides the single key action
+	source.PressKey(KeyLeftControl)
+	source.PressKey(KeyS)
+	assert.NoError(t, d.Maintain())
+	assert.True(t, state.JustPressed("save"))
+	assert.False(t, state.Pressed("down"))
+	source.ReleaseKey(KeyLeftControl)
+	assert.NoError(t, d.Maintain())
+	assert.True(t, state.JustPressed("down"))
+	assert.True(t, state.JustReleased("save"))
+
+	//Rebinding is picked up on the next tick
+	actions.Rebind("jump", Chord(KeyControl(KeyW)))
+	source.PressKey(KeyW)
+	assert.NoError(t, d.Maintain())
+	assert.True(t, state.JustPressed("jump"))
+}
+
+func TestActionFile(t *testing.T) {
+	file := `{"actions": {
+		"jump": [{"controls": ["Space"]}, {"controls": ["GamepadA"], "gamepad": -1}],
+		"save": [{"controls": ["LeftControl", "S"]}],
+		"fire": [{"controls": ["MouseLeft"]}, {"controls": ["GamepadRightTrigger+"], "deadZone": 0.1}],
+		"move_x": [{"controls": ["A"], "scale": -1}, {"controls": ["GamepadLeftX"], "deadZone": 0.2}]
+	}}`
+	actions := NewActionMap()
+	assert.NoError(t, actions.Load(strings.NewReader(file)))
+	assert.Equal(t, []string{"fire", "jump", "move_x", "save"}, actions.Names())
+	assert.Equal(t, []Binding{Chord(KeyControl(KeyLeftControl), KeyControl(KeyS))}, actions.Bindings("save"))
+	assert.Equal(t, Chord(AxisControl(AxisRightTrigger, 1)).WithDeadZone(0.1), actions.Bindings("fire")[1])
+
+	var buf bytes.Buffer
+	assert.NoError(t, actions.Save(&buf))
+	loaded := NewActionMap()
+	assert.NoError(t, loaded.Load(&buf))
+	for _, name := range actions.Names() {
+		assert.Equal(t, actions.Bindings(name), loaded.Bindings(name))
+	}
+
+	for _, broken := range []string{
+		`{"actions": {"jump": [{"controls": ["NotAKey"]}]}}`,
+		`{"actions": {"jump": [{"controls": ["Space"], "deadZone": 1}]}}`,
+		`{"actions": {"jump": [{"controls": ["Space"], "gamepad": 9}]}}`,
+		`{"actions": {"jump": [{"keys": ["Space"]}]}}`,
+	} {
+		assert.Error(t, loaded.Load(strings.NewReader(broken)), broken)
+		assert.Equal(t, actions.Bindings("jump"), loaded.Bindings("jump"), "A broken file changed the bindings")
+	}
+}
+
+type testPosition struct {
+	X, Y float64
+}
+
+func (t testPosition) GetType() reflect.Type { return reflect.TypeOf(t) }
+func (t testPosition) IsComponent()          {}
+
+//Builds a world whose state depends on its input, its random numbers and the
+//order entities from two concurrent services are created in
+func newReplayWorld(t *testing.T) world.World {
+	w := world.NewBaseWorld(make(chan []float32, 1), nil)
+	d := w.GetDispatcher()
+	d.SetFixedTimestep(time.Second / 60)
+	positionStorage := component.NewDenseStorage[testPosition]()
+	assert.NoError(t, d.AddStorage(positionStorage))
+	positions, _ := component.GetWriteStorage[testPosition](positionStorage)
+
+	spawner := world.NewBaseService("spawner")
+	spawner.AddRequiredAccessComponent(world.NewComponentAccess[Input](world.ReadAccess))
+	spawner.AddRequiredAccessComponent(world.NewComponentAccess[world.Random](world.WriteAccess))
+	spawner.SetRunFunction(func(creation chan world.EntityCreationData, deletion chan component.EntityID) error {
+		inputs, _ := world.GetReadStorage[Input](spawner)
+		state, _ := inputs.GetComponent(0)
+		randoms, _ := world.GetWriteStorage[world.Random](spawner)
+		random, _ := randoms.GetComponent(0)
+		if state.JustPressed(KeySpace) {
+			for i := 0; i < 3; i++ {
+				position := testPosition{random.Float64(), random.Float64()}
+				creation <- world.EntityCreationData{NumEntities: 1, Components: []world.StorageWriteable{world.MakeWriteableStorage(position, positions)}}
+			}
+		}
+		return nil
+	})
+	ticker := world.NewBaseService("ticker")
+	ticker.AddRequiredAccessComponent(world.NewComponentAccess[world.TickInfo](world.ReadAccess))
+	ticker.SetRunFunction(func(creation chan world.EntityCreationData, deletion chan component.EntityID) error {
+		ticks, _ := world.GetReadStorage[world.TickInfo](ticker)
+		info, _ := ticks.GetComponent(0)
+		position := testPosition{float64(info.Tick), info.Elapsed.Seconds()}
+		creation <- world.EntityCreationData{NumEntities: 1, Components: []world.StorageWriteable{world.MakeWriteableStorage(position, positions)}}
+		if info.Tick%4 == 3 {
+			deletion <- component.EntityID(info.Tick)
+		}
+		return nil
+	})
+	mover := world.NewBaseService("mover")
+	mover.SetStage(world.PostUpdateStage)
+	mover.AddRequiredAccessComponent(world.NewComponentAccess[Input](world.ReadAccess))
+	mover.AddRequiredAccessComponent(world.NewComponentAccess[world.Random](world.WriteAccess))
+	mover.AddRequiredAccessComponent(world.NewComponentAccess[testPosition](world.WriteAccess))
+	mover.SetRunFunction(func(creation chan world.EntityCreationData, deletion chan component.EntityID) error {
+		inputs, _ := world.GetReadStorage[Input](mover)
+		state, _ := inputs.GetComponent(0)
+		randoms, _ := world.GetWriteStorage[world.Random](mover)
+		random, _ := randoms.GetComponent(0)
+		storage, _ := world.GetWriteStorage[testPosition](mover)
+		x, _ := state.Cursor()
+		for _, e := range d.GetEntities() {
+			if position, err := storage.GetComponent(e); err == nil {
+				position.X += x + random.Float64()
+				storage.Write(e, position)
+			}
+		}
+		return nil
+	})
+	for _, s := range []world.Service{spawner, ticker, mover} {
+		assert.NoError(t, d.AddService(s))
+	}
+	return w
+}
+
+func TestReplay(t *testing.T) {
+	source := NewSyntheticSource()
+	recorded := newReplayWorld(t)
+	recorder, err := NewRecorder(recorded, source, 42)
+	assert.NoError(t, err)
+	for tick := 0; tick < 30; tick++ {
+		if tick%5 == 0 {
+			source.PressKey(KeySpace)
+		}
+		if tick%5 == 2 {
+			source.ReleaseKey(KeySpace)
+			source.MoveCursor(float64(tick), 0)
+		}
+		assert.NoError(t, recorder.Maintain())
+	}
+	recording := recorder.Recording()
+	assert.Equal(t, 30, len(recording.Ticks))
+	assert.Equal(t, time.Second/60, recording.Step)
+
+	var buf bytes.Buffer
+	assert.NoError(t, recording.Encode(&buf))
+	decoded, err := DecodeRecording(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, recording, decoded)
+
+	replayed := newReplayWorld(t)
+	replay, err := NewReplay(replayed, decoded)
+	assert.NoError(t, err)
+	assert.NoError(t, replay.Run())
+	assert.True(t, replay.Done())
+	assert.Equal(t, ReplayFinishedError, replay.Maintain())
+	assert.Equal(t, world.StateHash(recorded.GetDispatcher()), world.StateHash(replayed.GetDispatcher()))
+
+	//Different input is caught on the tick it changes the state
+	decoded.Ticks[13].Events = append(decoded.Ticks[13].Events, Event{Type: KeyEvent, Code: int(KeySpace), Action: Press})
+	replay, err = NewReplay(newReplayWorld(t), decoded)
+	assert.NoError(t, err)
+	err = replay.Run()
+	var desync *DesyncError
+	assert.True(t, errors.As(err, &desync))
+	assert.Equal(t, 13, desync.Tick)
+
+	_, err = DecodeRecording(strings.NewReader("not gzip"))
+	assert.Error(t, err)
+	_, err = NewRecorder(world.NewBaseWorld(make(chan []float32, 1), nil), source, 1)
+	assert.Error(t, err, "Recording without a fixed timestep")
+}
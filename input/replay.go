@@ -0,0 +1,425 @@
+package input
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//The input of a recorded run. Replaying it into a world set up the same way as
+//the recorded one reaches the same state on every tick.
+type Recording struct {
+	//The seed of the worlds Random resource
+	Seed int64
+
+	//The fixed timestep of the world
+	Step time.Duration
+
+	Ticks []TickRecord
+}
+
+//The input events of one tick and the world checksum after the tick
+type TickRecord struct {
+	Events []Event
+	Hash   uint64
+}
+
+//Returned by Replay.Maintain when the world does not reach the recorded state
+type DesyncError struct {
+	Tick     int
+	Expected uint64
+	Actual   uint64
+}
+
+func (e *DesyncError) Error() string {
+	return fmt.Sprintf("replay desynced on tick %d, the state hash is %x instead of %x", e.Tick, e.Actual, e.Expected)
+}
+
+var ReplayFinishedError = errors.New("every tick of the recording was replayed")
+
+/***************************/
+/*        Recording        */
+
+//Recordings are stored gzipped, all integers are varints:
+//
+//	"RREC" version seed step tickCount
+//	for every tick: hash (8 bytes little endian) eventCount events
+//
+//Every event starts with its type byte followed by only the fields its type uses.
+const (
+	recordingMagic   = "RREC"
+	recordingVersion = 1
+)
+
+//Writes the recording to w in the compact recording format
+func (r *Recording) Encode(w io.Writer) error {
+	compressed := gzip.NewWriter(w)
+	e := &recordEncoder{w: bufio.NewWriter(compressed)}
+	e.w.WriteString(recordingMagic)
+	e.uvarint(recordingVersion)
+	e.varint(r.Seed)
+	e.varint(int64(r.Step))
+	e.uvarint(uint64(len(r.Ticks)))
+	for _, tick := range r.Ticks {
+		e.fixed(tick.Hash)
+		e.uvarint(uint64(len(tick.Events)))
+		for _, event := range tick.Events {
+			e.event(event)
+		}
+	}
+	if e.err != nil {
+		return e.err
+	}
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+//Reads a recording written by Encode
+func DecodeRecording(r io.Reader) (*Recording, error) {
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer compressed.Close()
+	d := &recordDecoder{r: bufio.NewReader(compressed)}
+	magic := make([]byte, len(recordingMagic))
+	if _, err := io.ReadFull(d.r, magic); err != nil || string(magic) != recordingMagic {
+		return nil, errors.New("not a recording")
+	}
+	if version := d.uvarint(); d.err == nil && version != recordingVersion {
+		return nil, fmt.Errorf("unsupported recording version %d", version)
+	}
+	recording := &Recording{Seed: d.varint(), Step: time.Duration(d.varint())}
+	ticks := d.count()
+	for i := 0; i < ticks && d.err == nil; i++ {
+		tick := TickRecord{Hash: d.fixed()}
+		events := d.count()
+		for j := 0; j < events && d.err == nil; j++ {
+			tick.Events = append(tick.Events, d.event())
+		}
+		recording.Ticks = append(recording.Ticks, tick)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("broken recording: %w", d.err)
+	}
+	return recording, nil
+}
+
+func (r *Recording) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.Encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func LoadRecording(path string) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	recording, err := DecodeRecording(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return recording, nil
+}
+
+/***************************/
+/*        Recorder         */
+
+//Records the input a world receives. Build the world, create the Recorder
+//instead of calling AddInput and call Recorder.Maintain instead of World.Maintain.
+type Recorder struct {
+	world     world.World
+	source    Source
+	recording Recording
+
+	lock    sync.Mutex
+	pending []Event
+}
+
+//Adds the Input resource and service to w with the events of source recorded
+//on the way. The worlds Random resource is reset to seed and w must have a fixed
+//timestep, both are saved in the recording.
+func NewRecorder(w world.World, source Source, seed int64) (*Recorder, error) {
+	d := w.GetDispatcher()
+	if d.GetFixedTimestep() <= 0 {
+		return nil, errors.New("recorded worlds need a fixed timestep")
+	}
+	if err := resetRandom(d, seed); err != nil {
+		return nil, err
+	}
+	r := &Recorder{world: w, source: source, recording: Recording{Seed: seed, Step: d.GetFixedTimestep()}}
+	if err := AddInput(d, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//Polls the wrapped source, called by the input service
+func (r *Recorder) Poll() []Event {
+	events := r.source.Poll()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.pending = append(r.pending, events...)
+	return events
+}
+
+//Runs one tick of the world and records its input and state hash
+func (r *Recorder) Maintain() error {
+	err := r.world.Maintain()
+	r.lock.Lock()
+	events := r.pending
+	r.pending = nil
+	r.lock.Unlock()
+	r.recording.Ticks = append(r.recording.Ticks, TickRecord{Events: events, Hash: r.world.Checksum()})
+	return err
+}
+
+//Returns the recording of every tick so far
+func (r *Recorder) Recording() *Recording {
+	recording := r.recording
+	recording.Ticks = append([]TickRecord(nil), r.recording.Ticks...)
+	return &recording
+}
+
+/***************************/
+/*         Replay          */
+
+//Feeds a recording into a world. The world has to be set up the same way as the
+//recorded one was before NewRecorder, without an input service of its own.
+type Replay struct {
+	world     world.World
+	recording *Recording
+
+	lock sync.Mutex
+	tick int
+}
+
+//Adds the Input resource and a service replaying the recorded input to w. The
+//worlds Random resource and fixed timestep are set to the recorded ones.
+func NewReplay(w world.World, recording *Recording) (*Replay, error) {
+	d := w.GetDispatcher()
+	if err := resetRandom(d, recording.Seed); err != nil {
+		return nil, err
+	}
+	d.SetFixedTimestep(recording.Step)
+	r := &Replay{world: w, recording: recording}
+	if err := AddInput(d, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//Returns the events of the tick being replayed, called by the input service
+func (r *Replay) Poll() []Event {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.tick >= len(r.recording.Ticks) {
+		return nil
+	}
+	return r.recording.Ticks[r.tick].Events
+}
+
+//Runs the next recorded tick and checks that the world reached the recorded
+//state. Returns a *DesyncError if it did not and ReplayFinishedError once every
+//tick was replayed.
+func (r *Replay) Maintain() error {
+	if r.Done() {
+		return ReplayFinishedError
+	}
+	if err := r.world.Maintain(); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	expected := r.recording.Ticks[r.tick].Hash
+	actual := r.world.Checksum()
+	tick := r.tick
+	r.tick++
+	if actual != expected {
+		return &DesyncError{Tick: tick, Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+//Replays every remaining tick, stopping at the first error
+func (r *Replay) Run() error {
+	for !r.Done() {
+		if err := r.Maintain(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Returns true once every tick was replayed
+func (r *Replay) Done() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.tick >= len(r.recording.Ticks)
+}
+
+/***************************/
+/*        Helpers          */
+
+func resetRandom(d world.Dispatcher, seed int64) error {
+	storage, ok := d.GetStorage(component.ReflectType[world.Random]()).(component.ResourceValueStorage)
+	if !ok {
+		return errors.New("the world has no Random resource")
+	}
+	return storage.SetResource(world.NewRandom(seed))
+}
+
+type recordEncoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *recordEncoder) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *recordEncoder) uvarint(v uint64) {
+	e.write(e.buf[:binary.PutUvarint(e.buf[:], v)])
+}
+
+func (e *recordEncoder) varint(v int64) {
+	e.write(e.buf[:binary.PutVarint(e.buf[:], v)])
+}
+
+func (e *recordEncoder) fixed(v uint64) {
+	binary.LittleEndian.PutUint64(e.buf[:8], v)
+	e.write(e.buf[:8])
+}
+
+func (e *recordEncoder) event(event Event) {
+	e.write([]byte{byte(event.Type)})
+	switch event.Type {
+	case KeyEvent, MouseButtonEvent:
+		e.varint(int64(event.Code))
+		e.write([]byte{byte(event.Action)})
+	case CursorEvent, ScrollEvent:
+		e.fixed(math.Float64bits(event.X))
+		e.fixed(math.Float64bits(event.Y))
+	case CharEvent:
+		e.varint(int64(event.Char))
+	case GamepadButtonEvent:
+		e.uvarint(uint64(event.Gamepad))
+		e.varint(int64(event.Code))
+		e.write([]byte{byte(event.Action)})
+	case GamepadAxisEvent:
+		e.uvarint(uint64(event.Gamepad))
+		e.varint(int64(event.Code))
+		e.fixed(math.Float64bits(event.X))
+	case GamepadConnectionEvent:
+		e.uvarint(uint64(event.Gamepad))
+		e.write([]byte{byte(event.Action)})
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("unknown event type %d", event.Type)
+		}
+	}
+}
+
+type recordDecoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *recordDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	var b byte
+	b, d.err = d.r.ReadByte()
+	return b
+}
+
+func (d *recordDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	var v uint64
+	v, d.err = binary.ReadUvarint(d.r)
+	return v
+}
+
+func (d *recordDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	var v int64
+	v, d.err = binary.ReadVarint(d.r)
+	return v
+}
+
+func (d *recordDecoder) fixed() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	var buf [8]byte
+	_, d.err = io.ReadFull(d.r, buf[:])
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+//Reads a length, broken files can hold values that do not fit an int
+func (d *recordDecoder) count() int {
+	v := d.uvarint()
+	if v > math.MaxInt32 {
+		d.err = fmt.Errorf("length %d is too large", v)
+		return 0
+	}
+	return int(v)
+}
+
+func (d *recordDecoder) event() Event {
+	event := Event{Type: EventType(d.byte())}
+	switch event.Type {
+	case KeyEvent, MouseButtonEvent:
+		event.Code = int(d.varint())
+		event.Action = Action(d.byte())
+	case CursorEvent, ScrollEvent:
+		event.X = math.Float64frombits(d.fixed())
+		event.Y = math.Float64frombits(d.fixed())
+	case CharEvent:
+		event.Char = rune(d.varint())
+	case GamepadButtonEvent:
+		event.Gamepad = int(d.uvarint())
+		event.Code = int(d.varint())
+		event.Action = Action(d.byte())
+	case GamepadAxisEvent:
+		event.Gamepad = int(d.uvarint())
+		event.Code = int(d.varint())
+		event.X = math.Float64frombits(d.fixed())
+	case GamepadConnectionEvent:
+		event.Gamepad = int(d.uvarint())
+		event.Action = Action(d.byte())
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown event type %d", event.Type)
+		}
+	}
+	return event
+}
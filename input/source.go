@@ -0,0 +1,134 @@
+package input
+
+import "sync"
+
+//The kind of an input event
+type EventType uint8
+
+const (
+	KeyEvent EventType = iota
+	MouseButtonEvent
+	CursorEvent
+	ScrollEvent
+	CharEvent
+	GamepadButtonEvent
+	GamepadAxisEvent
+	GamepadConnectionEvent
+)
+
+//What happened to a key or button
+type Action uint8
+
+const (
+	Release Action = iota
+	Press
+	Repeat
+)
+
+//A single input event. Which fields are used depends on the Type:
+//
+//	KeyEvent:               Code is the Key, Action
+//	MouseButtonEvent:       Code is the MouseButton, Action
+//	CursorEvent:            X, Y is the cursor position in window coordinates
+//	ScrollEvent:            X, Y is the scroll offset
+//	CharEvent:              Char is the typed character
+//	GamepadButtonEvent:     Gamepad, Code is the GamepadButton, Action
+//	GamepadAxisEvent:       Gamepad, Code is the GamepadAxis, X is the new value
+//	GamepadConnectionEvent: Gamepad, Action is Press when it connected and Release when it disconnected
+type Event struct {
+	Type    EventType
+	Action  Action
+	Gamepad int
+	Code    int
+	X, Y    float64
+	Char    rune
+}
+
+//A Source produces input events. The input service polls it once per tick,
+//GLFW windows feed one through GLFWSource while tests and headless worlds use a
+//SyntheticSource.
+type Source interface {
+	//Returns every event since the last call, oldest first
+	Poll() []Event
+}
+
+/***************************/
+/*    Synthetic Source     */
+
+var _ Source = &SyntheticSource{}
+
+//A Source that events are pushed into by code, it is safe to use from any goroutine
+type SyntheticSource struct {
+	lock   sync.Mutex
+	events []Event
+}
+
+func NewSyntheticSource() *SyntheticSource {
+	return &SyntheticSource{}
+}
+
+func (s *SyntheticSource) Poll() []Event {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	events := s.events
+	s.events = nil
+	return events
+}
+
+//Queues events for the next poll
+func (s *SyntheticSource) Send(events ...Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = append(s.events, events...)
+}
+
+func (s *SyntheticSource) PressKey(key Key) {
+	s.Send(Event{Type: KeyEvent, Code: int(key), Action: Press})
+}
+
+func (s *SyntheticSource) ReleaseKey(key Key) {
+	s.Send(Event{Type: KeyEvent, Code: int(key), Action: Release})
+}
+
+func (s *SyntheticSource) PressMouseButton(button MouseButton) {
+	s.Send(Event{Type: MouseButtonEvent, Code: int(button), Action: Press})
+}
+
+func (s *SyntheticSource) ReleaseMouseButton(button MouseButton) {
+	s.Send(Event{Type: MouseButtonEvent, Code: int(button), Action: Release})
+}
+
+func (s *SyntheticSource) MoveCursor(x, y float64) {
+	s.Send(Event{Type: CursorEvent, X: x, Y: y})
+}
+
+func (s *SyntheticSource) Scroll(x, y float64) {
+	s.Send(Event{Type: ScrollEvent, X: x, Y: y})
+}
+
+//Sends a CharEvent for every character of text
+func (s *SyntheticSource) Type(text string) {
+	for _, c := range text {
+		s.Send(Event{Type: CharEvent, Char: c})
+	}
+}
+
+func (s *SyntheticSource) ConnectGamepad(gamepad int) {
+	s.Send(Event{Type: GamepadConnectionEvent, Gamepad: gamepad, Action: Press})
+}
+
+func (s *SyntheticSource) DisconnectGamepad(gamepad int) {
+	s.Send(Event{Type: GamepadConnectionEvent, Gamepad: gamepad, Action: Release})
+}
+
+func (s *SyntheticSource) PressGamepadButton(gamepad int, button GamepadButton) {
+	s.Send(Event{Type: GamepadButtonEvent, Gamepad: gamepad, Code: int(button), Action: Press})
+}
+
+func (s *SyntheticSource) ReleaseGamepadButton(gamepad int, button GamepadButton) {
+	s.Send(Event{Type: GamepadButtonEvent, Gamepad: gamepad, Code: int(button), Action: Release})
+}
+
+func (s *SyntheticSource) MoveGamepadAxis(gamepad int, axis GamepadAxis, value float64) {
+	s.Send(Event{Type: GamepadAxisEvent, Gamepad: gamepad, Code: int(axis), X: value})
+}
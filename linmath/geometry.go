@@ -0,0 +1,288 @@
+package linmath
+
+import "math"
+
+//Shapes below use the same axes as Vec2, counterclockwise means from the x axis
+//towards the y axis. Raycasts return how far along the ray the hit is, so the
+//point hit is ray.At(t), and rays starting inside a shape hit it at 0.
+
+/***************************/
+/*           Ray           */
+
+//A half line starting at Origin, the Direction does not need a length of 1
+type Ray[T Float] struct {
+	Origin    Vec2[T]
+	Direction Vec2[T]
+}
+
+//Returns the point t of the way along the ray
+func (r Ray[T]) At(t T) Vec2[T] {
+	return r.Origin.Add(r.Direction.Scale(t))
+}
+
+/***************************/
+/*          Rect           */
+
+//An axis aligned rectangle, Min is the corner with the smallest coordinates
+type Rect[T Float] struct {
+	Min Vec2[T]
+	Max Vec2[T]
+}
+
+//Creates the rectangle with a corner at x, y of the given size, negative sizes
+//extend the other way
+func NewRect[T Float](x, y, w, h T) Rect[T] {
+	return RectFromPoints(Vec2[T]{x, y}, Vec2[T]{x + w, y + h})
+}
+
+//Returns the smallest rectangle that contains every point, no points give the
+//empty rectangle at the origin
+func RectFromPoints[T Float](points ...Vec2[T]) Rect[T] {
+	if len(points) == 0 {
+		return Rect[T]{}
+	}
+	r := Rect[T]{points[0], points[0]}
+	for _, p := range points[1:] {
+		r.Min = Vec2[T]{minFloat(r.Min[0], p[0]), minFloat(r.Min[1], p[1])}
+		r.Max = Vec2[T]{maxFloat(r.Max[0], p[0]), maxFloat(r.Max[1], p[1])}
+	}
+	return r
+}
+
+func (r Rect[T]) Width() T        { return r.Max[0] - r.Min[0] }
+func (r Rect[T]) Height() T       { return r.Max[1] - r.Min[1] }
+func (r Rect[T]) Size() Vec2[T]   { return r.Max.Sub(r.Min) }
+func (r Rect[T]) Center() Vec2[T] { return r.Min.Lerp(r.Max, 0.5) }
+func (r Rect[T]) Area() T         { return r.Width() * r.Height() }
+
+//Returns true if the point is inside or on the edge
+func (r Rect[T]) Contains(p Vec2[T]) bool {
+	return p[0] >= r.Min[0] && p[0] <= r.Max[0] && p[1] >= r.Min[1] && p[1] <= r.Max[1]
+}
+
+func (r Rect[T]) ContainsRect(o Rect[T]) bool {
+	return r.Contains(o.Min) && r.Contains(o.Max)
+}
+
+//Returns true if the rectangles overlap or touch
+func (r Rect[T]) Intersects(o Rect[T]) bool {
+	return r.Min[0] <= o.Max[0] && o.Min[0] <= r.Max[0] && r.Min[1] <= o.Max[1] && o.Min[1] <= r.Max[1]
+}
+
+//Returns the area both rectangles cover and false if they do not intersect
+func (r Rect[T]) Intersection(o Rect[T]) (Rect[T], bool) {
+	if !r.Intersects(o) {
+		return Rect[T]{}, false
+	}
+	return Rect[T]{
+		Vec2[T]{maxFloat(r.Min[0], o.Min[0]), maxFloat(r.Min[1], o.Min[1])},
+		Vec2[T]{minFloat(r.Max[0], o.Max[0]), minFloat(r.Max[1], o.Max[1])},
+	}, true
+}
+
+//Returns the smallest rectangle containing both
+func (r Rect[T]) Union(o Rect[T]) Rect[T] {
+	return RectFromPoints(r.Min, r.Max, o.Min, o.Max)
+}
+
+//Grows the rectangle by margin on every side, a negative margin shrinks it
+func (r Rect[T]) Expand(margin T) Rect[T] {
+	return Rect[T]{r.Min.Sub(Vec2[T]{margin, margin}), r.Max.Add(Vec2[T]{margin, margin})}
+}
+
+//Returns the point of the rectangle closest to p, p itself if it is inside
+func (r Rect[T]) ClosestPoint(p Vec2[T]) Vec2[T] {
+	return Vec2[T]{
+		minFloat(maxFloat(p[0], r.Min[0]), r.Max[0]),
+		minFloat(maxFloat(p[1], r.Min[1]), r.Max[1]),
+	}
+}
+
+func (r Rect[T]) Raycast(ray Ray[T]) (T, bool) {
+	enter, exit := T(0), T(math.Inf(1))
+	for axis := 0; axis < 2; axis++ {
+		origin, direction := ray.Origin[axis], ray.Direction[axis]
+		if direction == 0 {
+			if origin < r.Min[axis] || origin > r.Max[axis] {
+				return 0, false
+			}
+			continue
+		}
+		near, far := (r.Min[axis]-origin)/direction, (r.Max[axis]-origin)/direction
+		if near > far {
+			near, far = far, near
+		}
+		enter, exit = maxFloat(enter, near), minFloat(exit, far)
+		if enter > exit {
+			return 0, false
+		}
+	}
+	return enter, true
+}
+
+//Returns the rectangle of every r point minus every o point. It contains the
+//origin exactly when the rectangles intersect, and sweeping r by a motion hits
+//o where a ray from the origin along the motion hits the difference.
+func (r Rect[T]) MinkowskiDifference(o Rect[T]) Rect[T] {
+	return Rect[T]{r.Min.Sub(o.Max), r.Max.Sub(o.Min)}
+}
+
+//Returns the rectangle as a counterclockwise polygon
+func (r Rect[T]) Polygon() Polygon[T] {
+	return Polygon[T]{r.Min, {r.Max[0], r.Min[1]}, r.Max, {r.Min[0], r.Max[1]}}
+}
+
+/***************************/
+/*         Circle          */
+
+type Circle[T Float] struct {
+	Center Vec2[T]
+	Radius T
+}
+
+//Returns true if the point is inside or on the edge
+func (c Circle[T]) Contains(p Vec2[T]) bool {
+	return p.Sub(c.Center).LengthSquared() <= c.Radius*c.Radius
+}
+
+func (c Circle[T]) Intersects(o Circle[T]) bool {
+	reach := c.Radius + o.Radius
+	return c.Center.Sub(o.Center).LengthSquared() <= reach*reach
+}
+
+func (c Circle[T]) IntersectsRect(r Rect[T]) bool {
+	return c.Contains(r.ClosestPoint(c.Center))
+}
+
+func (c Circle[T]) Bounds() Rect[T] {
+	return Rect[T]{c.Center, c.Center}.Expand(c.Radius)
+}
+
+//Returns the point of the circle closest to p, p itself if it is inside
+func (c Circle[T]) ClosestPoint(p Vec2[T]) Vec2[T] {
+	if c.Contains(p) {
+		return p
+	}
+	return c.Center.Add(p.Sub(c.Center).Normalize().Scale(c.Radius))
+}
+
+func (c Circle[T]) Raycast(ray Ray[T]) (T, bool) {
+	offset := ray.Origin.Sub(c.Center)
+	if offset.LengthSquared() <= c.Radius*c.Radius {
+		return 0, true
+	}
+	//Solve |offset + t*direction| = radius for the smaller t
+	a := ray.Direction.LengthSquared()
+	b := offset.Dot(ray.Direction)
+	discriminant := b*b - a*(offset.LengthSquared()-c.Radius*c.Radius)
+	if a == 0 || b > 0 || discriminant < 0 {
+		return 0, false
+	}
+	return (-b - sqrt(discriminant)) / a, true
+}
+
+/***************************/
+/*         Segment         */
+
+//The straight line between A and B
+type Segment[T Float] struct {
+	A Vec2[T]
+	B Vec2[T]
+}
+
+func (s Segment[T]) Length() T       { return s.A.Distance(s.B) }
+func (s Segment[T]) Bounds() Rect[T] { return RectFromPoints(s.A, s.B) }
+
+//Returns the point of the segment closest to p
+func (s Segment[T]) ClosestPoint(p Vec2[T]) Vec2[T] {
+	direction := s.B.Sub(s.A)
+	lengthSquared := direction.LengthSquared()
+	if lengthSquared == 0 {
+		return s.A
+	}
+	t := minFloat(maxFloat(p.Sub(s.A).Dot(direction)/lengthSquared, 0), 1)
+	return s.A.Lerp(s.B, t)
+}
+
+func (s Segment[T]) Distance(p Vec2[T]) T {
+	return s.ClosestPoint(p).Distance(p)
+}
+
+//Returns the point where the segments cross and false if they do not. Segments
+//lying on the same line that overlap return the first point of o on s.
+func (s Segment[T]) Intersection(o Segment[T]) (Vec2[T], bool) {
+	d, e := s.B.Sub(s.A), o.B.Sub(o.A)
+	denominator := d.Cross(e)
+	offset := o.A.Sub(s.A)
+	if denominator == 0 {
+		if offset.Cross(d) != 0 {
+			return Vec2[T]{}, false
+		}
+		//On the same line, check if any end lies on the other segment
+		for _, p := range []Vec2[T]{o.A, o.B, s.A, s.B} {
+			if s.contains(p) && o.contains(p) {
+				return p, true
+			}
+		}
+		return Vec2[T]{}, false
+	}
+	t := offset.Cross(e) / denominator
+	u := offset.Cross(d) / denominator
+	if t < 0 || t > 1 || u < 0 || u > 1 {
+		return Vec2[T]{}, false
+	}
+	return s.A.Lerp(s.B, t), true
+}
+
+func (s Segment[T]) Intersects(o Segment[T]) bool {
+	_, ok := s.Intersection(o)
+	return ok
+}
+
+//Returns true if a point on the line of the segment is between its ends
+func (s Segment[T]) contains(p Vec2[T]) bool {
+	return s.Bounds().Contains(p)
+}
+
+func (s Segment[T]) Raycast(ray Ray[T]) (T, bool) {
+	e := s.B.Sub(s.A)
+	denominator := ray.Direction.Cross(e)
+	offset := s.A.Sub(ray.Origin)
+	if denominator == 0 {
+		//Parallel, only a ray along the same line can hit an end
+		if offset.Cross(ray.Direction) != 0 || ray.Direction.LengthSquared() == 0 {
+			return 0, false
+		}
+		best, hit := T(0), false
+		for _, p := range []Vec2[T]{s.A, s.B} {
+			t := p.Sub(ray.Origin).Dot(ray.Direction) / ray.Direction.LengthSquared()
+			if t >= 0 && (!hit || t < best) {
+				best, hit = t, true
+			}
+		}
+		if s.contains(ray.Origin) {
+			return 0, true
+		}
+		return best, hit
+	}
+	t := offset.Cross(e) / denominator
+	u := offset.Cross(ray.Direction) / denominator
+	if t < 0 || u < 0 || u > 1 {
+		return 0, false
+	}
+	return t, true
+}
+
+func minFloat[T Float](a, b T) T {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFloat[T Float](a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -1,6 +1,13 @@
 package linmath
 
-import "testing"
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 //Tests for mat4f.go
 //TODO:: More tests
@@ -30,3 +37,420 @@ func TestNewOrthoMat4f(t *testing.T) {
 		searialTriangle = append(searialTriangle, x[:]...)
 	}
 }
+
+/***************************/
+/*   Property Based Tests  */
+
+const propertyRuns = 500
+
+//Calls check with a new random source propertyRuns times, the seed is fixed so
+//failures can be reproduced
+func forAll(t *testing.T, check func(r *rand.Rand)) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < propertyRuns; i++ {
+		check(r)
+	}
+}
+
+func randomFloat(r *rand.Rand) float64 {
+	return r.Float64()*200 - 100
+}
+
+func randomVec2(r *rand.Rand) Vec2[float64] {
+	return Vec2[float64]{randomFloat(r), randomFloat(r)}
+}
+
+func randomVec3(r *rand.Rand) Vec3[float64] {
+	return Vec3[float64]{randomFloat(r), randomFloat(r), randomFloat(r)}
+}
+
+func randomVec4(r *rand.Rand) Vec4[float64] {
+	return Vec4[float64]{randomFloat(r), randomFloat(r), randomFloat(r), randomFloat(r)}
+}
+
+//Returns a random matrix that is far enough from singular to invert precisely
+func randomMat3(r *rand.Rand) Mat3f[float64] {
+	for {
+		var m Mat3f[float64]
+		for i := range m {
+			m[i] = r.Float64()*4 - 2
+		}
+		if math.Abs(m.Det()) > 0.1 {
+			return m
+		}
+	}
+}
+
+func randomMat4(r *rand.Rand) Mat4[float64] {
+	for {
+		var m Mat4[float64]
+		for i := range m {
+			m[i] = r.Float64()*4 - 2
+		}
+		if math.Abs(m.Det()) > 0.1 {
+			return m
+		}
+	}
+}
+
+func randomQuat(r *rand.Rand) Quat[float64] {
+	return QuatFromAxisAngle(randomVec3(r), r.Float64()*2*math.Pi-math.Pi)
+}
+
+//Checks that every element of two float64 arrays or slices is within delta
+func assertSlice(t *testing.T, expected, actual interface{}, delta float64) {
+	e, a := reflect.ValueOf(expected), reflect.ValueOf(actual)
+	assert.Equal(t, e.Len(), a.Len())
+	for i := 0; i < e.Len() && i < a.Len(); i++ {
+		assert.InDelta(t, e.Index(i).Float(), a.Index(i).Float(), delta, "element %d of %v and %v", i, expected, actual)
+	}
+}
+
+func TestVectorProperties(t *testing.T) {
+	forAll(t, func(r *rand.Rand) {
+		a, b, c := randomVec3(r), randomVec3(r), randomVec3(r)
+		assert.InDelta(t, a.Dot(b), b.Dot(a), 1e-9)
+		assert.InDelta(t, a.Dot(b.Add(c)), a.Dot(b)+a.Dot(c), 1e-9)
+		assertSlice(t, a.Cross(b), b.Cross(a).Neg(), 1e-9)
+		assert.InDelta(t, 0, a.Cross(b).Dot(a), 1e-7)
+		assert.InDelta(t, 0, a.Cross(b).Dot(b), 1e-7)
+		assert.InDelta(t, 1, a.Normalize().Length(), 1e-9)
+		assert.LessOrEqual(t, a.Add(b).Length(), a.Length()+b.Length()+1e-9)
+		assert.InDelta(t, a.Sub(b).Length(), a.Distance(b), 1e-9)
+		amount := r.Float64()
+		assertSlice(t, a, a.Lerp(b, 0), 1e-9)
+		assertSlice(t, b, a.Lerp(b, 1), 1e-9)
+		assert.InDelta(t, amount*a.Distance(b), a.Distance(a.Lerp(b, amount)), 1e-9)
+
+		v, w := randomVec2(r), randomVec2(r)
+		assert.InDelta(t, v.Vec3(0).Cross(w.Vec3(0)).Z(), v.Cross(w), 1e-9)
+		assert.InDelta(t, 0, v.Perp().Dot(v), 1e-9)
+		angle := r.Float64()*2*math.Pi - math.Pi
+		rotated := v.Rotate(angle)
+		assert.InDelta(t, v.Length(), rotated.Length(), 1e-9)
+		assert.InDelta(t, math.Cos(angle)*v.LengthSquared(), v.Dot(rotated), 1e-7)
+		assert.InDelta(t, math.Sin(angle)*v.LengthSquared(), v.Cross(rotated), 1e-7)
+
+		x := randomVec4(r)
+		assert.InDelta(t, 1, x.Normalize().Length(), 1e-9)
+		assert.InDelta(t, x.Vec3().Dot(a)+x.W()*2, x.Dot(a.Vec4(2)), 1e-9)
+	})
+	assert.Equal(t, Vec3[float32]{}, Vec3[float32]{}.Normalize())
+	assert.Equal(t, Vec3[float32]{0, 0, 1}, Vec3[float32]{1, 0, 0}.Cross(Vec3[float32]{0, 1, 0}))
+}
+
+func TestMat3Properties(t *testing.T) {
+	identity := Identity[float64]()
+	forAll(t, func(r *rand.Rand) {
+		a, b := randomMat3(r), randomMat3(r)
+		assertSlice(t, identity, a.MatMul(a.Inverse()), 1e-6)
+		assertSlice(t, identity, a.Inverse().MatMul(a), 1e-6)
+		assert.Equal(t, a, a.Transpose().Transpose())
+		assertSlice(t, b.Transpose().MatMul(a.Transpose()), a.MatMul(b).Transpose(), 1e-9)
+		assert.InDelta(t, a.Det()*b.Det(), a.MatMul(b).Det(), 1e-6)
+		assert.InDelta(t, a.Det(), a.Transpose().Det(), 1e-9)
+
+		p := randomVec2(r)
+		assertSlice(t, a.MulVec3(p.Vec3(1)).Vec2(), a.TransformPoint(p), 1e-9)
+		assertSlice(t, a.MulVec3(p.Vec3(0)).Vec2(), a.TransformVector(p), 1e-9)
+	})
+
+	//Rows that depend on each other have no inverse
+	singular := Mat3f[float64]{1, 2, 3, 2, 4, 6, 0, 1, 0}
+	assert.Equal(t, Mat3fFactory[float64](), singular.Inverse())
+	//The inverse used to be scaled by the determinant instead of divided by it
+	assert.Equal(t, Mat3f[float64]{0.5, 0, 0, 0, 0.25, 0, 0, 0, 1}, Mat3f[float64]{2, 0, 0, 0, 4, 0, 0, 0, 1}.Inverse())
+}
+
+func TestAffine2D(t *testing.T) {
+	forAll(t, func(r *rand.Rand) {
+		affine := Affine2D[float64]{
+			Translation: randomVec2(r),
+			Rotation:    r.Float64()*2*math.Pi - math.Pi,
+			Scale:       Vec2[float64]{r.Float64()*10 + 0.1, r.Float64()*20 - 10},
+			Skew:        r.Float64()*4 - 2,
+		}
+		if math.Abs(affine.Scale[1]) < 0.1 {
+			affine.Scale[1] = 1
+		}
+		m := affine.Compose()
+		decomposed := Decompose2D(m)
+		assertSlice(t, affine.Translation, decomposed.Translation, 1e-9)
+		assertSlice(t, affine.Scale, decomposed.Scale, 1e-9)
+		assert.InDelta(t, affine.Rotation, decomposed.Rotation, 1e-9)
+		assert.InDelta(t, affine.Skew, decomposed.Skew, 1e-9)
+
+		//Any affine matrix survives a round trip, even flattened ones
+		var general Mat3f[float64]
+		copy(general[:6], []float64{randomFloat(r), randomFloat(r), randomFloat(r), randomFloat(r), randomFloat(r), randomFloat(r)})
+		general[8] = 1
+		if r.Intn(10) == 0 {
+			general[0], general[3] = 0, 0
+		}
+		assertSlice(t, general, Decompose2D(general).Compose(), 1e-7)
+	})
+
+	//The constructors match the point they move
+	point := Vec2[float64]{1, 0}
+	assertSlice(t, []float64{4, 2}, Translation2D(3.0, 2).TransformPoint(point), 1e-12)
+	assertSlice(t, []float64{0, 1}, Rotation2D(math.Pi/2).TransformPoint(point), 1e-12)
+	assertSlice(t, []float64{2, 0}, Scaling2D(2.0, 3).TransformPoint(point), 1e-12)
+	assertSlice(t, []float64{1, 5}, Shear2D(0.0, 5).TransformPoint(point), 1e-12)
+}
+
+func TestMat4Properties(t *testing.T) {
+	identity := Identity4[float64]()
+	forAll(t, func(r *rand.Rand) {
+		a, b := randomMat4(r), randomMat4(r)
+		assertSlice(t, identity, a.MatMul(a.Inverse()), 1e-6)
+		assertSlice(t, identity, a.Inverse().MatMul(a), 1e-6)
+		assert.Equal(t, a, a.Transpose().Transpose())
+		assertSlice(t, b.Transpose().MatMul(a.Transpose()), a.MatMul(b).Transpose(), 1e-9)
+		assert.InDelta(t, a.Det()*b.Det(), a.MatMul(b).Det(), 1e-6)
+		assert.InDelta(t, a.Det(), a.Transpose().Det(), 1e-9)
+
+		v := randomVec4(r)
+		assertSlice(t, a.MulVec4(b.MulVec4(v)), a.MatMul(b).MulVec4(v), 1e-7)
+		floats := a.ToFloats()
+		for row := 0; row < 4; row++ {
+			for column := 0; column < 4; column++ {
+				assert.Equal(t, float32(a[row*4+column]), floats[column*4+row])
+			}
+		}
+
+		p := randomVec3(r)
+		moved := Translation3D(1.0, 2, 3).MatMul(Scaling3D(2.0, 2, 2)).TransformPoint(p)
+		assertSlice(t, p.Scale(2).Add(Vec3[float64]{1, 2, 3}), moved, 1e-9)
+		assertSlice(t, p, Translation3D(1.0, 2, 3).TransformVector(p), 1e-12)
+	})
+	assert.Equal(t, Mat4[float64]{}, Mat4[float64]{1, 2, 3, 4, 2, 4, 6, 8}.Inverse())
+}
+
+func TestProjections(t *testing.T) {
+	ortho := Ortho(-4.0, 4, -2, 2, 1, 11)
+	assertSlice(t, []float64{-1, -1, -1}, ortho.TransformPoint(Vec3[float64]{-4, -2, -1}), 1e-12)
+	assertSlice(t, []float64{1, 1, 1}, ortho.TransformPoint(Vec3[float64]{4, 2, -11}), 1e-12)
+
+	perspective := Perspective(math.Pi/2, 2.0, 1, 100)
+	assert.InDelta(t, -1, perspective.TransformPoint(Vec3[float64]{0, 0, -1}).Z(), 1e-12)
+	assert.InDelta(t, 1, perspective.TransformPoint(Vec3[float64]{0, 0, -100}).Z(), 1e-12)
+	//With a 90 degree field of view the top edge is as far up as it is away
+	assert.InDelta(t, 1, perspective.TransformPoint(Vec3[float64]{0, 10, -10}).Y(), 1e-12)
+	assert.InDelta(t, 1, perspective.TransformPoint(Vec3[float64]{20, 0, -10}).X(), 1e-12)
+
+	forAll(t, func(r *rand.Rand) {
+		eye, center := randomVec3(r), randomVec3(r)
+		view := LookAt(eye, center, Vec3[float64]{0, 1, 0})
+		assertSlice(t, []float64{0, 0, 0}, view.TransformPoint(eye), 1e-9)
+		assertSlice(t, []float64{0, 0, -eye.Distance(center)}, view.TransformPoint(center), 1e-7)
+		assert.InDelta(t, 1, view.Det(), 1e-9)
+	})
+}
+
+func TestQuatProperties(t *testing.T) {
+	identity := IdentityQuat[float64]()
+	forAll(t, func(r *rand.Rand) {
+		q, o := randomQuat(r), randomQuat(r)
+		v := randomVec3(r)
+		assert.InDelta(t, 1, q.Length(), 1e-9)
+		assert.InDelta(t, v.Length(), q.Rotate(v).Length(), 1e-9)
+		assertSlice(t, q.Mat4().TransformPoint(v), q.Rotate(v), 1e-9)
+		assertSlice(t, q.Rotate(o.Rotate(v)), q.Mul(o).Rotate(v), 1e-9)
+		assertSlice(t, identity, q.Mul(q.Inverse()), 1e-9)
+		assertSlice(t, v, q.Inverse().Rotate(q.Rotate(v)), 1e-9)
+		assert.InDelta(t, 1, q.Mat4().Det(), 1e-9)
+
+		amount := r.Float64()
+		slerped := q.Slerp(o, amount)
+		assert.InDelta(t, 1, slerped.Length(), 1e-9)
+		assert.InDelta(t, 1, math.Abs(q.Slerp(o, 0).Dot(q)), 1e-9)
+		assert.InDelta(t, 1, math.Abs(q.Slerp(o, 1).Dot(o)), 1e-9)
+		//The angle covered grows evenly with the amount
+		total := math.Acos(math.Min(1, math.Abs(q.Dot(o))))
+		assert.InDelta(t, total*amount, math.Acos(math.Min(1, math.Abs(q.Dot(slerped)))), 1e-6)
+	})
+
+	//A quarter turn around z takes x to y, like Rotation2D
+	quarter := QuatFromAxisAngle(Vec3[float64]{0, 0, 2}, math.Pi/2)
+	assertSlice(t, []float64{0, 1, 0}, quarter.Rotate(Vec3[float64]{1, 0, 0}), 1e-12)
+}
+
+func TestVector3Setters(t *testing.T) {
+	v := NewVector3(1, 2, 3)
+	v.SetX(4)
+	v.SetY(5)
+	v.SetZ(6)
+	assert.Equal(t, [3]float32{4, 5, 6}, v.ToFloats())
+}
+
+/***************************/
+/*        Geometry         */
+
+//Returns a polygon that does not cross itself, points at random distances
+//around a center in order of angle. The gaps between the angles stay below half
+//a turn so the center is inside.
+func randomStarPolygon(r *rand.Rand) Polygon[float64] {
+	n := 4 + r.Intn(12)
+	center := randomVec2(r)
+	polygon := make(Polygon[float64], n)
+	for i := range polygon {
+		angle := (float64(i) + r.Float64()*0.9) * 2 * math.Pi / float64(n)
+		polygon[i] = center.Add(Vec2[float64]{1, 0}.Rotate(angle).Scale(1 + r.Float64()*20))
+	}
+	return polygon
+}
+
+func randomConvexPolygon(r *rand.Rand) Polygon[float64] {
+	center := randomVec2(r).Scale(0.2)
+	points := make([]Vec2[float64], 3+r.Intn(8))
+	for i := range points {
+		points[i] = center.Add(randomVec2(r).Scale(0.1))
+	}
+	return ConvexHull(points)
+}
+
+func randomRect(r *rand.Rand) Rect[float64] {
+	return NewRect(randomFloat(r), randomFloat(r), randomFloat(r), randomFloat(r))
+}
+
+func TestRectAndCircle(t *testing.T) {
+	forAll(t, func(r *rand.Rand) {
+		a, b := randomRect(r), randomRect(r)
+		assert.LessOrEqual(t, a.Min.X(), a.Max.X())
+		assert.Equal(t, a.Intersects(b), a.MinkowskiDifference(b).Contains(Vec2[float64]{}))
+		if overlap, ok := a.Intersection(b); ok {
+			assert.True(t, a.ContainsRect(overlap) && b.ContainsRect(overlap))
+		}
+		union := a.Union(b)
+		assert.True(t, union.ContainsRect(a) && union.ContainsRect(b))
+
+		p := randomVec2(r)
+		inside := a.Min.Add(a.Size().Mul(Vec2[float64]{r.Float64(), r.Float64()}))
+		assert.True(t, a.Contains(a.ClosestPoint(p)))
+		assert.LessOrEqual(t, a.ClosestPoint(p).Distance(p), inside.Distance(p)+1e-9)
+
+		//Rays aimed at a point inside hit the rectangle on its edge
+		ray := Ray[float64]{p, inside.Sub(p)}
+		distance, hit := a.Raycast(ray)
+		assert.True(t, hit)
+		assert.LessOrEqual(t, distance, 1+1e-9)
+		if !a.Contains(p) {
+			assert.True(t, a.Expand(1e-9).Contains(ray.At(distance)))
+			assert.False(t, a.Expand(-1e-9).Contains(ray.At(distance)))
+		}
+
+		c := Circle[float64]{randomVec2(r), r.Float64() * 30}
+		assert.Equal(t, c.Intersects(Circle[float64]{p, 0}), c.Contains(p))
+		assert.Equal(t, c.IntersectsRect(a), c.Contains(a.ClosestPoint(c.Center)))
+		assert.True(t, c.Bounds().Contains(c.ClosestPoint(p)))
+		onCircle := c.Center.Add(Vec2[float64]{c.Radius, 0}.Rotate(r.Float64() * 2 * math.Pi))
+		assert.LessOrEqual(t, c.ClosestPoint(p).Distance(p), onCircle.Distance(p)+1e-9)
+		distance, hit = c.Raycast(Ray[float64]{p, c.Center.Sub(p).Scale(2)})
+		assert.True(t, hit)
+		if !c.Contains(p) {
+			assert.InDelta(t, c.Radius, Ray[float64]{p, c.Center.Sub(p).Scale(2)}.At(distance).Distance(c.Center), 1e-9)
+		}
+		_, hit = c.Raycast(Ray[float64]{p, p.Sub(c.Center)})
+		assert.Equal(t, c.Contains(p), hit)
+	})
+}
+
+func TestSegment(t *testing.T) {
+	forAll(t, func(r *rand.Rand) {
+		s, o := Segment[float64]{randomVec2(r), randomVec2(r)}, Segment[float64]{randomVec2(r), randomVec2(r)}
+		if point, ok := s.Intersection(o); ok {
+			assert.InDelta(t, 0, s.Distance(point), 1e-9)
+			assert.InDelta(t, 0, o.Distance(point), 1e-9)
+		} else {
+			//Segments that do not cross have ends on the same side of the other
+			sideA := s.B.Sub(s.A).Cross(o.A.Sub(s.A)) * s.B.Sub(s.A).Cross(o.B.Sub(s.A))
+			sideB := o.B.Sub(o.A).Cross(s.A.Sub(o.A)) * o.B.Sub(o.A).Cross(s.B.Sub(o.A))
+			assert.True(t, sideA > 0 || sideB > 0)
+		}
+
+		p := randomVec2(r)
+		assert.LessOrEqual(t, s.Distance(p), s.A.Lerp(s.B, r.Float64()).Distance(p)+1e-9)
+		target := s.A.Lerp(s.B, r.Float64())
+		ray := Ray[float64]{p, target.Sub(p).Scale(0.5)}
+		distance, hit := s.Raycast(ray)
+		assert.True(t, hit)
+		assert.InDelta(t, 0, s.Distance(ray.At(distance)), 1e-7)
+	})
+	s := Segment[float64]{Vec2[float64]{0, 0}, Vec2[float64]{4, 0}}
+	point, ok := s.Intersection(Segment[float64]{Vec2[float64]{2, 0}, Vec2[float64]{6, 0}})
+	assert.True(t, ok)
+	assert.Equal(t, Vec2[float64]{2, 0}, point)
+	distance, hit := s.Raycast(Ray[float64]{Vec2[float64]{-2, 0}, Vec2[float64]{1, 0}})
+	assert.True(t, hit)
+	assert.Equal(t, 2.0, distance)
+}
+
+func TestPolygon(t *testing.T) {
+	forAll(t, func(r *rand.Rand) {
+		polygon := randomStarPolygon(r)
+		if r.Intn(2) == 0 {
+			polygon = polygon.Reverse()
+		}
+		triangles, err := polygon.Triangulate()
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(triangles), len(polygon)-2)
+		var area float64
+		for _, triangle := range triangles {
+			piece := Polygon[float64]{polygon[triangle[0]], polygon[triangle[1]], polygon[triangle[2]]}
+			assert.Equal(t, polygon.IsCounterClockwise(), piece.IsCounterClockwise())
+			area += piece.Area()
+		}
+		assert.InDelta(t, polygon.Area(), area, 1e-6)
+
+		//A point is inside the polygon when it is inside one of its triangles
+		p := polygon.Bounds().Min.Add(polygon.Bounds().Size().Mul(Vec2[float64]{r.Float64(), r.Float64()}))
+		inTriangle := false
+		for _, triangle := range triangles {
+			inTriangle = inTriangle || Polygon[float64]{polygon[triangle[0]], polygon[triangle[1]], polygon[triangle[2]]}.Contains(p)
+		}
+		assert.Equal(t, inTriangle, polygon.Contains(p))
+		assert.InDelta(t, 0, polygon.Reverse().SignedArea()+polygon.SignedArea(), 1e-9)
+
+		closest := polygon.ClosestPoint(p)
+		for i := range polygon {
+			assert.LessOrEqual(t, closest.Distance(p), polygon.Edge(i).Distance(p)+1e-9)
+		}
+		outside := polygon.Bounds().Max.Add(Vec2[float64]{1, 1})
+		ray := Ray[float64]{outside, polygon[0].Sub(outside)}
+		distance, hit := polygon.Raycast(ray)
+		assert.True(t, hit)
+		assert.InDelta(t, 0, polygon.ClosestPoint(ray.At(distance)).Distance(ray.At(distance)), 1e-7)
+	})
+}
+
+func TestConvexHullAndMinkowski(t *testing.T) {
+	forAll(t, func(r *rand.Rand) {
+		points := make([]Vec2[float64], 3+r.Intn(30))
+		for i := range points {
+			points[i] = randomVec2(r)
+		}
+		hull := ConvexHull(points)
+		assert.True(t, hull.IsConvex())
+		assert.True(t, hull.IsCounterClockwise())
+		for _, p := range points {
+			assert.True(t, hull.Contains(p) || hull.ClosestPoint(p).Distance(p) < 1e-9)
+		}
+		assert.InDelta(t, hull.Area(), ConvexHull(append(points, hull.Centroid())).Area(), 1e-6)
+
+		a, b := randomConvexPolygon(r), randomConvexPolygon(r)
+		difference := MinkowskiDifference(a, b)
+		assert.Equal(t, a.Intersects(b), difference.Contains(Vec2[float64]{}))
+		sum := MinkowskiSum(a, b)
+		assert.True(t, sum.IsConvex())
+		assert.GreaterOrEqual(t, sum.Area()+1e-9, a.Area()+b.Area())
+		inA := a[0].Lerp(a[len(a)-1], r.Float64())
+		inB := b[0].Lerp(b[1], r.Float64())
+		assert.True(t, sum.Contains(inA.Add(inB)) || sum.ClosestPoint(inA.Add(inB)).Distance(inA.Add(inB)) < 1e-9)
+	})
+	line := ConvexHull([]Vec2[float64]{{0, 0}, {1, 1}, {2, 2}, {1, 1}})
+	assert.Equal(t, Polygon[float64]{{0, 0}, {2, 2}}, line)
+	_, err := Polygon[float64]{{0, 0}, {1, 1}}.Triangulate()
+	assert.Error(t, err)
+	_, err = Polygon[float64]{{0, 0}, {2, 2}, {2, 0}, {0, 2}}.Triangulate()
+	assert.Error(t, err)
+}
@@ -65,3 +65,7 @@ func (m Mat3[T]) ScalarMul(Scalar T) Mat3[T] {
 		m[8] * Scalar,
 	}
 }
+
+func (m Mat3[T]) Transpose() Mat3[T] {
+	return [9]T{m[0], m[3], m[6], m[1], m[4], m[7], m[2], m[5], m[8]}
+}
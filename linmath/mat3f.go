@@ -1,5 +1,7 @@
 package linmath
 
+import "math"
+
 //TODO:: Documentation
 
 type Mat3f[T float32 | float64] Mat3[T]
@@ -74,7 +76,13 @@ func (m Mat3f[T]) Det() float64 {
 	return float64(m[0]*(m[4]*m[8]-m[5]*m[7]) - m[1]*(m[3]*m[8]-m[5]*m[6]) + m[2]*(m[3]*m[7]-m[4]*m[6]))
 }
 
+//Returns the inverse of the matrix, a singular matrix has no inverse and gives
+//the zero matrix
 func (m Mat3f[T]) Inverse() Mat3f[T] {
+	det := m.Det()
+	if det == 0 {
+		return Mat3fFactory[T]()
+	}
 	return Mat3f[T]{
 		m[4]*m[8] - m[5]*m[7],
 		m[2]*m[7] - m[1]*m[8],
@@ -85,7 +93,11 @@ func (m Mat3f[T]) Inverse() Mat3f[T] {
 		m[3]*m[7] - m[4]*m[6],
 		m[1]*m[6] - m[0]*m[7],
 		m[0]*m[4] - m[1]*m[3],
-	}.ScalarMul(T(m.Det()))
+	}.ScalarMul(T(1 / det))
+}
+
+func (m Mat3f[T]) Transpose() Mat3f[T] {
+	return [9]T{m[0], m[3], m[6], m[1], m[4], m[7], m[2], m[5], m[8]}
 }
 
 func (m Mat3f[T]) VectorMul(X, Y, Z T) [3]T {
@@ -95,3 +107,85 @@ func (m Mat3f[T]) VectorMul(X, Y, Z T) [3]T {
 		m[6]*X + m[7]*Y + m[8]*Z,
 	}
 }
+
+func (m Mat3f[T]) MulVec3(v Vec3[T]) Vec3[T] {
+	return m.VectorMul(v[0], v[1], v[2])
+}
+
+//Transforms a 2D point, the translation of the matrix applies to it
+func (m Mat3f[T]) TransformPoint(p Vec2[T]) Vec2[T] {
+	return Vec2[T]{m[0]*p[0] + m[1]*p[1] + m[2], m[3]*p[0] + m[4]*p[1] + m[5]}
+}
+
+//Transforms a 2D direction, the translation of the matrix does not apply to it
+func (m Mat3f[T]) TransformVector(v Vec2[T]) Vec2[T] {
+	return Vec2[T]{m[0]*v[0] + m[1]*v[1], m[3]*v[0] + m[4]*v[1]}
+}
+
+/***************************/
+/*       2D Affine         */
+
+//The matrices below are for 2D points as column vectors with a w of 1, so
+//a.MatMul(b) applies b first and then a.
+
+func Translation2D[T float32 | float64](x, y T) Mat3f[T] {
+	return [9]T{1, 0, x, 0, 1, y, 0, 0, 1}
+}
+
+//Rotates by angle radians, from the x axis towards the y axis
+func Rotation2D[T float32 | float64](angle T) Mat3f[T] {
+	sin, cos := math.Sincos(float64(angle))
+	s, c := T(sin), T(cos)
+	return [9]T{c, -s, 0, s, c, 0, 0, 0, 1}
+}
+
+func Scaling2D[T float32 | float64](x, y T) Mat3f[T] {
+	return [9]T{x, 0, 0, 0, y, 0, 0, 0, 1}
+}
+
+//Adds x times the y coordinate to x and y times the x coordinate to y
+func Shear2D[T float32 | float64](x, y T) Mat3f[T] {
+	return [9]T{1, x, 0, y, 1, 0, 0, 0, 1}
+}
+
+//The parts of a 2D affine matrix. Compose builds
+//Translation2D * Rotation2D * Skew * Scaling2D, where the skew moves x by Skew
+//times y.
+type Affine2D[T float32 | float64] struct {
+	Translation Vec2[T]
+	Rotation    T
+	Scale       Vec2[T]
+	Skew        T
+}
+
+func (a Affine2D[T]) Compose() Mat3f[T] {
+	skew := Identity[T]()
+	skew[1] = a.Skew
+	return Translation2D(a.Translation[0], a.Translation[1]).
+		MatMul(Rotation2D(a.Rotation)).
+		MatMul(skew).
+		MatMul(Scaling2D(a.Scale[0], a.Scale[1]))
+}
+
+//Splits a 2D affine matrix into its parts, composing them gives the matrix
+//back. Mirroring shows up as a negative y scale, a matrix that flattens x
+//completely has no skew.
+func Decompose2D[T float32 | float64](m Mat3f[T]) Affine2D[T] {
+	a := Affine2D[T]{Translation: Vec2[T]{m[2], m[5]}}
+	column := Vec2[T]{m[0], m[3]}
+	scaleX := column.Length()
+	if scaleX == 0 {
+		//Only the y axis is left, rotate it into place
+		a.Rotation = Vec2[T]{m[4], -m[1]}.Angle()
+		a.Scale = Vec2[T]{0, Vec2[T]{m[1], m[4]}.Length()}
+		return a
+	}
+	a.Rotation = column.Angle()
+	//Undo the rotation of the second column to find the skew and y scale
+	unrotated := Vec2[T]{m[1], m[4]}.Rotate(-a.Rotation)
+	a.Scale = Vec2[T]{scaleX, unrotated[1]}
+	if unrotated[1] != 0 {
+		a.Skew = unrotated[0] / unrotated[1]
+	}
+	return a
+}
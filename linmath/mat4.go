@@ -0,0 +1,165 @@
+package linmath
+
+import "math"
+
+//A 4x4 matrix stored row by row, for 3D points as column vectors with a w of 1
+//so a.MatMul(b) applies b first and then a. ToFloats gives the column by column
+//layout OpenGL expects.
+type Mat4[T Float] [16]T
+
+func Identity4[T Float]() Mat4[T] {
+	return Mat4[T]{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+}
+
+//Returns the mutliple of this and MatB
+func (m Mat4[T]) MatMul(MatB Mat4[T]) Mat4[T] {
+	var out Mat4[T]
+	for row := 0; row < 4; row++ {
+		for column := 0; column < 4; column++ {
+			out[row*4+column] = m[row*4]*MatB[column] +
+				m[row*4+1]*MatB[4+column] +
+				m[row*4+2]*MatB[8+column] +
+				m[row*4+3]*MatB[12+column]
+		}
+	}
+	return out
+}
+
+func (m Mat4[T]) ScalarMul(Scalar T) Mat4[T] {
+	for i := range m {
+		m[i] *= Scalar
+	}
+	return m
+}
+
+func (m Mat4[T]) Transpose() Mat4[T] {
+	var out Mat4[T]
+	for row := 0; row < 4; row++ {
+		for column := 0; column < 4; column++ {
+			out[column*4+row] = m[row*4+column]
+		}
+	}
+	return out
+}
+
+func (m Mat4[T]) MulVec4(v Vec4[T]) Vec4[T] {
+	return Vec4[T]{
+		m[0]*v[0] + m[1]*v[1] + m[2]*v[2] + m[3]*v[3],
+		m[4]*v[0] + m[5]*v[1] + m[6]*v[2] + m[7]*v[3],
+		m[8]*v[0] + m[9]*v[1] + m[10]*v[2] + m[11]*v[3],
+		m[12]*v[0] + m[13]*v[1] + m[14]*v[2] + m[15]*v[3],
+	}
+}
+
+//Transforms a 3D point and divides by the resulting w, so projections can be
+//applied with it
+func (m Mat4[T]) TransformPoint(p Vec3[T]) Vec3[T] {
+	out := m.MulVec4(p.Vec4(1))
+	if out[3] != 0 && out[3] != 1 {
+		return out.Vec3().Scale(1 / out[3])
+	}
+	return out.Vec3()
+}
+
+//Transforms a 3D direction, the translation of the matrix does not apply to it
+func (m Mat4[T]) TransformVector(v Vec3[T]) Vec3[T] {
+	return m.MulVec4(v.Vec4(0)).Vec3()
+}
+
+//Returns the transposed matrix of cofactors, the inverse times the determinant
+func (m Mat4[T]) adjugate() Mat4[T] {
+	var inv Mat4[T]
+	inv[0] = m[5]*m[10]*m[15] - m[5]*m[11]*m[14] - m[9]*m[6]*m[15] + m[9]*m[7]*m[14] + m[13]*m[6]*m[11] - m[13]*m[7]*m[10]
+	inv[4] = -m[4]*m[10]*m[15] + m[4]*m[11]*m[14] + m[8]*m[6]*m[15] - m[8]*m[7]*m[14] - m[12]*m[6]*m[11] + m[12]*m[7]*m[10]
+	inv[8] = m[4]*m[9]*m[15] - m[4]*m[11]*m[13] - m[8]*m[5]*m[15] + m[8]*m[7]*m[13] + m[12]*m[5]*m[11] - m[12]*m[7]*m[9]
+	inv[12] = -m[4]*m[9]*m[14] + m[4]*m[10]*m[13] + m[8]*m[5]*m[14] - m[8]*m[6]*m[13] - m[12]*m[5]*m[10] + m[12]*m[6]*m[9]
+	inv[1] = -m[1]*m[10]*m[15] + m[1]*m[11]*m[14] + m[9]*m[2]*m[15] - m[9]*m[3]*m[14] - m[13]*m[2]*m[11] + m[13]*m[3]*m[10]
+	inv[5] = m[0]*m[10]*m[15] - m[0]*m[11]*m[14] - m[8]*m[2]*m[15] + m[8]*m[3]*m[14] + m[12]*m[2]*m[11] - m[12]*m[3]*m[10]
+	inv[9] = -m[0]*m[9]*m[15] + m[0]*m[11]*m[13] + m[8]*m[1]*m[15] - m[8]*m[3]*m[13] - m[12]*m[1]*m[11] + m[12]*m[3]*m[9]
+	inv[13] = m[0]*m[9]*m[14] - m[0]*m[10]*m[13] - m[8]*m[1]*m[14] + m[8]*m[2]*m[13] + m[12]*m[1]*m[10] - m[12]*m[2]*m[9]
+	inv[2] = m[1]*m[6]*m[15] - m[1]*m[7]*m[14] - m[5]*m[2]*m[15] + m[5]*m[3]*m[14] + m[13]*m[2]*m[7] - m[13]*m[3]*m[6]
+	inv[6] = -m[0]*m[6]*m[15] + m[0]*m[7]*m[14] + m[4]*m[2]*m[15] - m[4]*m[3]*m[14] - m[12]*m[2]*m[7] + m[12]*m[3]*m[6]
+	inv[10] = m[0]*m[5]*m[15] - m[0]*m[7]*m[13] - m[4]*m[1]*m[15] + m[4]*m[3]*m[13] + m[12]*m[1]*m[7] - m[12]*m[3]*m[5]
+	inv[14] = -m[0]*m[5]*m[14] + m[0]*m[6]*m[13] + m[4]*m[1]*m[14] - m[4]*m[2]*m[13] - m[12]*m[1]*m[6] + m[12]*m[2]*m[5]
+	inv[3] = -m[1]*m[6]*m[11] + m[1]*m[7]*m[10] + m[5]*m[2]*m[11] - m[5]*m[3]*m[10] - m[9]*m[2]*m[7] + m[9]*m[3]*m[6]
+	inv[7] = m[0]*m[6]*m[11] - m[0]*m[7]*m[10] - m[4]*m[2]*m[11] + m[4]*m[3]*m[10] + m[8]*m[2]*m[7] - m[8]*m[3]*m[6]
+	inv[11] = -m[0]*m[5]*m[11] + m[0]*m[7]*m[9] + m[4]*m[1]*m[11] - m[4]*m[3]*m[9] - m[8]*m[1]*m[7] + m[8]*m[3]*m[5]
+	inv[15] = m[0]*m[5]*m[10] - m[0]*m[6]*m[9] - m[4]*m[1]*m[10] + m[4]*m[2]*m[9] + m[8]*m[1]*m[6] - m[8]*m[2]*m[5]
+	return inv
+}
+
+func (m Mat4[T]) Det() T {
+	adjugate := m.adjugate()
+	return m[0]*adjugate[0] + m[1]*adjugate[4] + m[2]*adjugate[8] + m[3]*adjugate[12]
+}
+
+//Returns the inverse of the matrix, a singular matrix has no inverse and gives
+//the zero matrix
+func (m Mat4[T]) Inverse() Mat4[T] {
+	det := m.Det()
+	if det == 0 {
+		return Mat4[T]{}
+	}
+	return m.adjugate().ScalarMul(1 / det)
+}
+
+//Returns the matrix column by column as float32, ready to be uploaded
+func (m Mat4[T]) ToFloats() [16]float32 {
+	var out [16]float32
+	for i, value := range m.Transpose() {
+		out[i] = float32(value)
+	}
+	return out
+}
+
+/***************************/
+/*       Constructors      */
+
+func Translation3D[T Float](x, y, z T) Mat4[T] {
+	return Mat4[T]{1, 0, 0, x, 0, 1, 0, y, 0, 0, 1, z, 0, 0, 0, 1}
+}
+
+func Scaling3D[T Float](x, y, z T) Mat4[T] {
+	return Mat4[T]{x, 0, 0, 0, 0, y, 0, 0, 0, 0, z, 0, 0, 0, 0, 1}
+}
+
+//An orthographic projection of the box onto the -1 to 1 cube, the camera looks
+//down -z like OpenGL. A box without a size gives the zero matrix.
+func Ortho[T Float](left, right, bottom, top, near, far T) Mat4[T] {
+	if right-left == 0 || top-bottom == 0 || far-near == 0 {
+		return Mat4[T]{}
+	}
+	return Mat4[T]{
+		2 / (right - left), 0, 0, -(right + left) / (right - left),
+		0, 2 / (top - bottom), 0, -(top + bottom) / (top - bottom),
+		0, 0, -2 / (far - near), -(far + near) / (far - near),
+		0, 0, 0, 1,
+	}
+}
+
+//A perspective projection with a vertical field of view of fovY radians, the
+//camera looks down -z like OpenGL. Points at near end up at a depth of -1 and
+//points at far at 1.
+func Perspective[T Float](fovY, aspect, near, far T) Mat4[T] {
+	f := T(1 / math.Tan(float64(fovY)/2))
+	return Mat4[T]{
+		f / aspect, 0, 0, 0,
+		0, f, 0, 0,
+		0, 0, (far + near) / (near - far), 2 * far * near / (near - far),
+		0, 0, -1, 0,
+	}
+}
+
+//A view matrix for a camera at eye looking at center, up points roughly up on
+//screen. The camera looks down -z in view space.
+func LookAt[T Float](eye, center, up Vec3[T]) Mat4[T] {
+	forward := center.Sub(eye).Normalize()
+	side := forward.Cross(up).Normalize()
+	up = side.Cross(forward)
+	return Mat4[T]{
+		side[0], side[1], side[2], -side.Dot(eye),
+		up[0], up[1], up[2], -up.Dot(eye),
+		-forward[0], -forward[1], -forward[2], forward.Dot(eye),
+		0, 0, 0, 1,
+	}
+}
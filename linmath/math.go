@@ -1,7 +1,18 @@
 package linmath
 
+import "math"
+
 //TODO:: Documentation
 
 type Numeric interface {
 	~float32 | ~float64 | ~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~complex64 | ~complex128
 }
+
+//The types the vector, matrix and quaternion math works with
+type Float interface {
+	~float32 | ~float64
+}
+
+func sqrt[T Float](x T) T {
+	return T(math.Sqrt(float64(x)))
+}
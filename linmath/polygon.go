@@ -0,0 +1,325 @@
+package linmath
+
+import (
+	"errors"
+	"sort"
+)
+
+//A closed polygon through its points in order, the last point connects back to
+//the first. It can be wound either way but must not cross itself.
+type Polygon[T Float] []Vec2[T]
+
+//Returns the area, positive if the points go counterclockwise
+func (p Polygon[T]) SignedArea() T {
+	var area T
+	for i := range p {
+		area += p[i].Cross(p[(i+1)%len(p)])
+	}
+	return area / 2
+}
+
+func (p Polygon[T]) Area() T {
+	area := p.SignedArea()
+	if area < 0 {
+		return -area
+	}
+	return area
+}
+
+func (p Polygon[T]) IsCounterClockwise() bool {
+	return p.SignedArea() > 0
+}
+
+//Returns a copy with the points in the opposite order
+func (p Polygon[T]) Reverse() Polygon[T] {
+	reversed := make(Polygon[T], len(p))
+	for i, point := range p {
+		reversed[len(p)-1-i] = point
+	}
+	return reversed
+}
+
+func (p Polygon[T]) Bounds() Rect[T] {
+	return RectFromPoints(p...)
+}
+
+//Returns the center of mass, the average of the points for polygons without
+//area
+func (p Polygon[T]) Centroid() Vec2[T] {
+	area := p.SignedArea()
+	var center Vec2[T]
+	if area == 0 {
+		for _, point := range p {
+			center = center.Add(point)
+		}
+		if len(p) != 0 {
+			center = center.Scale(1 / T(len(p)))
+		}
+		return center
+	}
+	for i := range p {
+		a, b := p[i], p[(i+1)%len(p)]
+		center = center.Add(a.Add(b).Scale(a.Cross(b)))
+	}
+	return center.Scale(1 / (6 * area))
+}
+
+//Returns the edge from point i to the point after it
+func (p Polygon[T]) Edge(i int) Segment[T] {
+	return Segment[T]{p[i], p[(i+1)%len(p)]}
+}
+
+//Returns true if every corner turns the same way, points in a straight line do
+//not count as a turn
+func (p Polygon[T]) IsConvex() bool {
+	if len(p) < 3 {
+		return false
+	}
+	var sign T
+	for i := range p {
+		turn := p[(i+1)%len(p)].Sub(p[i]).Cross(p[(i+2)%len(p)].Sub(p[(i+1)%len(p)]))
+		if turn == 0 {
+			continue
+		}
+		if sign != 0 && (turn > 0) != (sign > 0) {
+			return false
+		}
+		sign = turn
+	}
+	return sign != 0
+}
+
+//Returns true if the point is inside or on an edge
+func (p Polygon[T]) Contains(point Vec2[T]) bool {
+	inside := false
+	for i := range p {
+		edge := p.Edge(i)
+		if edge.Distance(point) == 0 {
+			return true
+		}
+		a, b := edge.A, edge.B
+		//Count the edges crossed by a ray going along +x
+		if (a[1] > point[1]) != (b[1] > point[1]) {
+			x := a[0] + (point[1]-a[1])/(b[1]-a[1])*(b[0]-a[0])
+			if point[0] < x {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+//Returns the point on the edges of the polygon closest to point
+func (p Polygon[T]) ClosestPoint(point Vec2[T]) Vec2[T] {
+	if len(p) == 0 {
+		return point
+	}
+	closest := p[0]
+	best := closest.Sub(point).LengthSquared()
+	for i := range p {
+		candidate := p.Edge(i).ClosestPoint(point)
+		if distance := candidate.Sub(point).LengthSquared(); distance < best {
+			closest, best = candidate, distance
+		}
+	}
+	return closest
+}
+
+//Returns true if the polygons overlap or touch
+func (p Polygon[T]) Intersects(o Polygon[T]) bool {
+	if len(p) == 0 || len(o) == 0 || !p.Bounds().Intersects(o.Bounds()) {
+		return false
+	}
+	for i := range p {
+		for j := range o {
+			if p.Edge(i).Intersects(o.Edge(j)) {
+				return true
+			}
+		}
+	}
+	//Without crossing edges one has to be inside the other
+	return p.Contains(o[0]) || o.Contains(p[0])
+}
+
+func (p Polygon[T]) Raycast(ray Ray[T]) (T, bool) {
+	if len(p) == 0 {
+		return 0, false
+	}
+	if p.Contains(ray.Origin) {
+		return 0, true
+	}
+	best, hit := T(0), false
+	for i := range p {
+		if t, ok := p.Edge(i).Raycast(ray); ok && (!hit || t < best) {
+			best, hit = t, true
+		}
+	}
+	return best, hit
+}
+
+//Returns true if no two edges cross, edges next to each other may only share
+//their common point
+func (p Polygon[T]) IsSimple() bool {
+	for i := range p {
+		for j := i + 1; j < len(p); j++ {
+			a, b := p.Edge(i), p.Edge(j)
+			if j == i+1 || (i == 0 && j == len(p)-1) {
+				//Neighbours always touch, they only overlap if one turns back
+				//along the other
+				if j != i+1 {
+					a, b = b, a
+				}
+				first, second := a.B.Sub(a.A), b.B.Sub(b.A)
+				if first.Cross(second) == 0 && first.Dot(second) < 0 {
+					return false
+				}
+				continue
+			}
+			if a.Intersects(b) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+/***************************/
+/*      Triangulation      */
+
+//Splits the polygon into triangles by ear clipping. Each triangle is three
+//indices into the polygon wound the same way it is. Returns an error if the
+//polygon has less than 3 points or crosses itself.
+func (p Polygon[T]) Triangulate() ([][3]int, error) {
+	if len(p) < 3 {
+		return nil, errors.New("polygon needs at least 3 points to triangulate")
+	}
+	if !p.IsSimple() {
+		return nil, errors.New("polygon crosses itself and can not be triangulated")
+	}
+	orientation := T(1)
+	if p.SignedArea() < 0 {
+		orientation = -1
+	}
+	remaining := make([]int, len(p))
+	for i := range remaining {
+		remaining[i] = i
+	}
+	triangles := make([][3]int, 0, len(p)-2)
+	for len(remaining) > 3 {
+		clipped := false
+		for i := range remaining {
+			prev, cur, next := remaining[(i+len(remaining)-1)%len(remaining)], remaining[i], remaining[(i+1)%len(remaining)]
+			if !p.isEar(remaining, prev, cur, next, orientation) {
+				continue
+			}
+			triangles = append(triangles, [3]int{prev, cur, next})
+			remaining = append(remaining[:i], remaining[i+1:]...)
+			clipped = true
+			break
+		}
+		if clipped {
+			continue
+		}
+		//Points in a straight line are never ears, drop one to go on
+		for i := range remaining {
+			prev, cur, next := remaining[(i+len(remaining)-1)%len(remaining)], remaining[i], remaining[(i+1)%len(remaining)]
+			if p[cur].Sub(p[prev]).Cross(p[next].Sub(p[cur])) == 0 {
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				clipped = true
+				break
+			}
+		}
+		if !clipped {
+			return nil, errors.New("polygon could not be triangulated")
+		}
+	}
+	if p[remaining[1]].Sub(p[remaining[0]]).Cross(p[remaining[2]].Sub(p[remaining[1]])) != 0 {
+		triangles = append(triangles, [3]int{remaining[0], remaining[1], remaining[2]})
+	}
+	return triangles, nil
+}
+
+//Returns true if the corner at cur can be cut off, it has to turn the same way
+//as the polygon and have no other point inside it
+func (p Polygon[T]) isEar(remaining []int, prev, cur, next int, orientation T) bool {
+	a, b, c := p[prev], p[cur], p[next]
+	if b.Sub(a).Cross(c.Sub(b))*orientation <= 0 {
+		return false
+	}
+	triangle := Polygon[T]{a, b, c}
+	for _, i := range remaining {
+		if i == prev || i == cur || i == next || p[i] == a || p[i] == b || p[i] == c {
+			continue
+		}
+		if triangle.Contains(p[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+/***************************/
+/*       Convex Hulls      */
+
+//Returns the smallest convex polygon containing every point, counterclockwise
+//and without points in a straight line. Less than 3 distinct points give them
+//back as they are.
+func ConvexHull[T Float](points []Vec2[T]) Polygon[T] {
+	sorted := append([]Vec2[T]{}, points...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i][0] != sorted[j][0] {
+			return sorted[i][0] < sorted[j][0]
+		}
+		return sorted[i][1] < sorted[j][1]
+	})
+	unique := sorted[:0]
+	for i, point := range sorted {
+		if i == 0 || point != sorted[i-1] {
+			unique = append(unique, point)
+		}
+	}
+	if len(unique) < 3 {
+		return Polygon[T](unique)
+	}
+	//Andrew's monotone chain, the lower half and then the upper half
+	hull := make(Polygon[T], 0, 2*len(unique))
+	for pass := 0; pass < 2; pass++ {
+		start := len(hull)
+		for i := range unique {
+			point := unique[i]
+			if pass == 1 {
+				point = unique[len(unique)-1-i]
+			}
+			for len(hull) >= start+2 && hull[len(hull)-1].Sub(hull[len(hull)-2]).Cross(point.Sub(hull[len(hull)-1])) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, point)
+		}
+		//The last point is the first of the other half
+		hull = hull[:len(hull)-1]
+	}
+	return hull
+}
+
+//Returns the Minkowski sum of two convex polygons, every point of a plus every
+//point of b. Concave polygons give the sum of their hulls.
+func MinkowskiSum[T Float](a, b Polygon[T]) Polygon[T] {
+	sums := make([]Vec2[T], 0, len(a)*len(b))
+	for _, p := range a {
+		for _, q := range b {
+			sums = append(sums, p.Add(q))
+		}
+	}
+	return ConvexHull(sums)
+}
+
+//Returns the Minkowski difference of two convex polygons, every point of a minus
+//every point of b. It contains the origin exactly when they intersect and its
+//closest point to the origin is the shortest way to separate them.
+func MinkowskiDifference[T Float](a, b Polygon[T]) Polygon[T] {
+	negated := make(Polygon[T], len(b))
+	for i, q := range b {
+		negated[i] = q.Neg()
+	}
+	return MinkowskiSum(a, negated)
+}
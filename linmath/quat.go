@@ -0,0 +1,87 @@
+package linmath
+
+import "math"
+
+//A quaternion stored as x, y, z, w. Unit quaternions are 3D rotations.
+type Quat[T Float] [4]T
+
+func IdentityQuat[T Float]() Quat[T] {
+	return Quat[T]{0, 0, 0, 1}
+}
+
+//Returns the rotation of angle radians around axis, counterclockwise when
+//looking down the axis towards the origin. The axis does not need a length of 1.
+func QuatFromAxisAngle[T Float](axis Vec3[T], angle T) Quat[T] {
+	sin, cos := math.Sincos(float64(angle) / 2)
+	axis = axis.Normalize().Scale(T(sin))
+	return Quat[T]{axis[0], axis[1], axis[2], T(cos)}
+}
+
+func (q Quat[T]) X() T { return q[0] }
+func (q Quat[T]) Y() T { return q[1] }
+func (q Quat[T]) Z() T { return q[2] }
+func (q Quat[T]) W() T { return q[3] }
+
+func (q Quat[T]) Dot(o Quat[T]) T { return Vec4[T](q).Dot(Vec4[T](o)) }
+func (q Quat[T]) Length() T       { return Vec4[T](q).Length() }
+
+//Returns the quaternion with a length of 1, the zero quaternion stays zero
+func (q Quat[T]) Normalize() Quat[T] { return Quat[T](Vec4[T](q).Normalize()) }
+
+func (q Quat[T]) Conjugate() Quat[T] { return Quat[T]{-q[0], -q[1], -q[2], q[3]} }
+
+//Returns the inverse, for unit quaternions the conjugate. The zero quaternion
+//gives zero.
+func (q Quat[T]) Inverse() Quat[T] {
+	lengthSquared := q.Dot(q)
+	if lengthSquared == 0 {
+		return Quat[T]{}
+	}
+	return Quat[T](Vec4[T](q.Conjugate()).Scale(1 / lengthSquared))
+}
+
+//Returns the Hamilton product, the rotation o followed by the rotation q
+func (q Quat[T]) Mul(o Quat[T]) Quat[T] {
+	return Quat[T]{
+		q[3]*o[0] + q[0]*o[3] + q[1]*o[2] - q[2]*o[1],
+		q[3]*o[1] - q[0]*o[2] + q[1]*o[3] + q[2]*o[0],
+		q[3]*o[2] + q[0]*o[1] - q[1]*o[0] + q[2]*o[3],
+		q[3]*o[3] - q[0]*o[0] - q[1]*o[1] - q[2]*o[2],
+	}
+}
+
+//Rotates the vector by a unit quaternion
+func (q Quat[T]) Rotate(v Vec3[T]) Vec3[T] {
+	axis := Vec3[T]{q[0], q[1], q[2]}
+	t := axis.Cross(v).Scale(2)
+	return v.Add(t.Scale(q[3])).Add(axis.Cross(t))
+}
+
+//Returns the rotation t of the way from q to o along the shortest arc, t is not
+//clamped. Both should have a length of 1.
+func (q Quat[T]) Slerp(o Quat[T], t T) Quat[T] {
+	cos := q.Dot(o)
+	if cos < 0 {
+		o, cos = Quat[T](Vec4[T](o).Neg()), -cos
+	}
+	//Close rotations divide by almost zero, a straight line is just as good there
+	if cos > 0.9995 {
+		return Quat[T](Vec4[T](q).Lerp(Vec4[T](o), t).Normalize())
+	}
+	angle := math.Acos(float64(cos))
+	sin := math.Sin(angle)
+	a := T(math.Sin((1-float64(t))*angle) / sin)
+	b := T(math.Sin(float64(t)*angle) / sin)
+	return Quat[T](Vec4[T](q).Scale(a).Add(Vec4[T](o).Scale(b)))
+}
+
+//Returns the rotation matrix of a unit quaternion
+func (q Quat[T]) Mat4() Mat4[T] {
+	x, y, z, w := q[0], q[1], q[2], q[3]
+	return Mat4[T]{
+		1 - 2*(y*y+z*z), 2 * (x*y - z*w), 2 * (x*z + y*w), 0,
+		2 * (x*y + z*w), 1 - 2*(x*x+z*z), 2 * (y*z - x*w), 0,
+		2 * (x*z - y*w), 2 * (y*z + x*w), 1 - 2*(x*x+y*y), 0,
+		0, 0, 0, 1,
+	}
+}
@@ -0,0 +1,159 @@
+package linmath
+
+import "math"
+
+/***************************/
+/*          Vec2           */
+
+//A 2D point or direction
+type Vec2[T Float] [2]T
+
+func (v Vec2[T]) X() T { return v[0] }
+func (v Vec2[T]) Y() T { return v[1] }
+
+func (v Vec2[T]) Add(o Vec2[T]) Vec2[T] { return Vec2[T]{v[0] + o[0], v[1] + o[1]} }
+func (v Vec2[T]) Sub(o Vec2[T]) Vec2[T] { return Vec2[T]{v[0] - o[0], v[1] - o[1]} }
+func (v Vec2[T]) Scale(s T) Vec2[T]     { return Vec2[T]{v[0] * s, v[1] * s} }
+func (v Vec2[T]) Neg() Vec2[T]          { return Vec2[T]{-v[0], -v[1]} }
+func (v Vec2[T]) Dot(o Vec2[T]) T       { return v[0]*o[0] + v[1]*o[1] }
+func (v Vec2[T]) LengthSquared() T      { return v.Dot(v) }
+func (v Vec2[T]) Length() T             { return sqrt(v.Dot(v)) }
+
+//Multiplies the vectors component by component
+func (v Vec2[T]) Mul(o Vec2[T]) Vec2[T] { return Vec2[T]{v[0] * o[0], v[1] * o[1]} }
+
+//Returns the z component of the 3D cross product, positive if o is
+//counterclockwise from v
+func (v Vec2[T]) Cross(o Vec2[T]) T { return v[0]*o[1] - v[1]*o[0] }
+
+//Returns the vector turned 90 degrees, from the x axis towards the y axis
+func (v Vec2[T]) Perp() Vec2[T] { return Vec2[T]{-v[1], v[0]} }
+
+func (v Vec2[T]) Distance(o Vec2[T]) T { return v.Sub(o).Length() }
+
+//Returns the vector with a length of 1, the zero vector stays zero
+func (v Vec2[T]) Normalize() Vec2[T] {
+	length := v.Length()
+	if length == 0 {
+		return v
+	}
+	return v.Scale(1 / length)
+}
+
+//Returns the point t of the way from v to o, t is not clamped
+func (v Vec2[T]) Lerp(o Vec2[T], t T) Vec2[T] {
+	return v.Add(o.Sub(v).Scale(t))
+}
+
+//Returns the vector turned by angle radians, from the x axis towards the y axis
+func (v Vec2[T]) Rotate(angle T) Vec2[T] {
+	sin, cos := math.Sincos(float64(angle))
+	s, c := T(sin), T(cos)
+	return Vec2[T]{v[0]*c - v[1]*s, v[0]*s + v[1]*c}
+}
+
+//Returns the angle of the vector from the x axis
+func (v Vec2[T]) Angle() T {
+	return T(math.Atan2(float64(v[1]), float64(v[0])))
+}
+
+//Returns the vector as a 3D vector with the given z
+func (v Vec2[T]) Vec3(z T) Vec3[T] { return Vec3[T]{v[0], v[1], z} }
+
+/***************************/
+/*          Vec3           */
+
+//A 3D point or direction
+type Vec3[T Float] [3]T
+
+func (v Vec3[T]) X() T { return v[0] }
+func (v Vec3[T]) Y() T { return v[1] }
+func (v Vec3[T]) Z() T { return v[2] }
+
+func (v Vec3[T]) Add(o Vec3[T]) Vec3[T] { return Vec3[T]{v[0] + o[0], v[1] + o[1], v[2] + o[2]} }
+func (v Vec3[T]) Sub(o Vec3[T]) Vec3[T] { return Vec3[T]{v[0] - o[0], v[1] - o[1], v[2] - o[2]} }
+func (v Vec3[T]) Scale(s T) Vec3[T]     { return Vec3[T]{v[0] * s, v[1] * s, v[2] * s} }
+func (v Vec3[T]) Neg() Vec3[T]          { return Vec3[T]{-v[0], -v[1], -v[2]} }
+func (v Vec3[T]) Dot(o Vec3[T]) T       { return v[0]*o[0] + v[1]*o[1] + v[2]*o[2] }
+func (v Vec3[T]) LengthSquared() T      { return v.Dot(v) }
+func (v Vec3[T]) Length() T             { return sqrt(v.Dot(v)) }
+
+//Multiplies the vectors component by component
+func (v Vec3[T]) Mul(o Vec3[T]) Vec3[T] { return Vec3[T]{v[0] * o[0], v[1] * o[1], v[2] * o[2]} }
+
+//Returns the vector perpendicular to both, following the right hand rule
+func (v Vec3[T]) Cross(o Vec3[T]) Vec3[T] {
+	return Vec3[T]{
+		v[1]*o[2] - v[2]*o[1],
+		v[2]*o[0] - v[0]*o[2],
+		v[0]*o[1] - v[1]*o[0],
+	}
+}
+
+func (v Vec3[T]) Distance(o Vec3[T]) T { return v.Sub(o).Length() }
+
+//Returns the vector with a length of 1, the zero vector stays zero
+func (v Vec3[T]) Normalize() Vec3[T] {
+	length := v.Length()
+	if length == 0 {
+		return v
+	}
+	return v.Scale(1 / length)
+}
+
+//Returns the point t of the way from v to o, t is not clamped
+func (v Vec3[T]) Lerp(o Vec3[T], t T) Vec3[T] {
+	return v.Add(o.Sub(v).Scale(t))
+}
+
+//Drops the z component
+func (v Vec3[T]) Vec2() Vec2[T] { return Vec2[T]{v[0], v[1]} }
+
+//Returns the vector as a 4D vector with the given w
+func (v Vec3[T]) Vec4(w T) Vec4[T] { return Vec4[T]{v[0], v[1], v[2], w} }
+
+/***************************/
+/*          Vec4           */
+
+//A 4D vector, usually a 3D point or direction in homogeneous coordinates
+type Vec4[T Float] [4]T
+
+func (v Vec4[T]) X() T { return v[0] }
+func (v Vec4[T]) Y() T { return v[1] }
+func (v Vec4[T]) Z() T { return v[2] }
+func (v Vec4[T]) W() T { return v[3] }
+
+func (v Vec4[T]) Add(o Vec4[T]) Vec4[T] {
+	return Vec4[T]{v[0] + o[0], v[1] + o[1], v[2] + o[2], v[3] + o[3]}
+}
+func (v Vec4[T]) Sub(o Vec4[T]) Vec4[T] {
+	return Vec4[T]{v[0] - o[0], v[1] - o[1], v[2] - o[2], v[3] - o[3]}
+}
+func (v Vec4[T]) Scale(s T) Vec4[T]    { return Vec4[T]{v[0] * s, v[1] * s, v[2] * s, v[3] * s} }
+func (v Vec4[T]) Neg() Vec4[T]         { return Vec4[T]{-v[0], -v[1], -v[2], -v[3]} }
+func (v Vec4[T]) Dot(o Vec4[T]) T      { return v[0]*o[0] + v[1]*o[1] + v[2]*o[2] + v[3]*o[3] }
+func (v Vec4[T]) LengthSquared() T     { return v.Dot(v) }
+func (v Vec4[T]) Length() T            { return sqrt(v.Dot(v)) }
+func (v Vec4[T]) Distance(o Vec4[T]) T { return v.Sub(o).Length() }
+
+//Multiplies the vectors component by component
+func (v Vec4[T]) Mul(o Vec4[T]) Vec4[T] {
+	return Vec4[T]{v[0] * o[0], v[1] * o[1], v[2] * o[2], v[3] * o[3]}
+}
+
+//Returns the vector with a length of 1, the zero vector stays zero
+func (v Vec4[T]) Normalize() Vec4[T] {
+	length := v.Length()
+	if length == 0 {
+		return v
+	}
+	return v.Scale(1 / length)
+}
+
+//Returns the point t of the way from v to o, t is not clamped
+func (v Vec4[T]) Lerp(o Vec4[T], t T) Vec4[T] {
+	return v.Add(o.Sub(v).Scale(t))
+}
+
+//Drops the w component
+func (v Vec4[T]) Vec3() Vec3[T] { return Vec3[T]{v[0], v[1], v[2]} }
@@ -64,11 +64,11 @@ func (thisVec *vector3) SetX(x float32) {
 }
 
 func (thisVec *vector3) SetY(y float32) {
-	thisVec[0] = y
+	thisVec[1] = y
 }
 
 func (thisVec *vector3) SetZ(z float32) {
-	thisVec[0] = z
+	thisVec[2] = z
 }
 
 func (thisVec *vector3) ToFloats() [3]float32 {
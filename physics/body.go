@@ -0,0 +1,212 @@
+package physics
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/jevans40/Ruthenium/collision"
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+type Vec2 = collision.Vec2
+
+//How a body reacts to the physics service
+type BodyType int
+
+const (
+	//Moved by forces, impulses and contacts
+	Dynamic BodyType = iota
+	//Moved only by its Velocity and AngularVelocity, it pushes dynamic bodies
+	//but is never pushed back
+	Kinematic
+	//Never moves. Colliders on entities without a RigidBody are static as well.
+	Static
+)
+
+func (t BodyType) String() string {
+	switch t {
+	case Dynamic:
+		return "Dynamic"
+	case Kinematic:
+		return "Kinematic"
+	case Static:
+		return "Static"
+	}
+	return fmt.Sprintf("BodyType(%d)", int(t))
+}
+
+//Makes the physics service move an entity. The center of mass is the origin of
+//the entity, so its Collider should be centered on it. The position and angle
+//are read from and written to its Transform, which is treated as a world
+//transform, so bodies should not have a Parent.
+type RigidBody struct {
+	Type BodyType
+	//Mass of dynamic bodies, anything at or below 0 counts as 1
+	Mass float64
+	//Rotational inertia around the center of mass. At 0 it is computed from
+	//the mass and the Collider, bodies without a Collider do not rotate.
+	Inertia       float64
+	FixedRotation bool
+	//How much of the speed is kept in a bounce, 0 to 1
+	Restitution float64
+	//Coulomb friction, the friction of a contact is the geometric mean of both
+	Friction float64
+	//The fraction of velocity lost per second
+	LinearDamping  float64
+	AngularDamping float64
+	//Multiplies Settings.Gravity
+	GravityScale float64
+
+	Velocity        Vec2
+	AngularVelocity float64
+
+	//Applied on the next step and then cleared
+	Force          Vec2
+	Torque         float64
+	Impulse        Vec2
+	AngularImpulse float64
+
+	//Sleeping bodies are not moved until something touches or pushes them
+	Sleeping    bool
+	CannotSleep bool
+	//Seconds the body has been resting
+	RestTime float64
+}
+
+func (b RigidBody) GetType() reflect.Type { return reflect.TypeOf(b) }
+func (b RigidBody) IsComponent()          {}
+
+func init() {
+	component.MustRegister("RigidBody", NewRigidBody(Dynamic))
+	component.MustRegister("Joint", Joint{})
+}
+
+//Creates a body with a mass of 1, a friction of 0.5 and normal gravity
+func NewRigidBody(bodyType BodyType) RigidBody {
+	return RigidBody{Type: bodyType, Mass: 1, Friction: 0.5, GravityScale: 1}
+}
+
+//Adds a force for the next step, offset is the point it acts on relative to
+//the center of mass. Wakes the body.
+func (b *RigidBody) ApplyForce(force, offset Vec2) {
+	b.Force = b.Force.Add(force)
+	b.Torque += offset.Cross(force)
+	b.Wake()
+}
+
+func (b *RigidBody) ApplyTorque(torque float64) {
+	b.Torque += torque
+	b.Wake()
+}
+
+//Adds an instant change of momentum for the next step, offset is the point it
+//acts on relative to the center of mass. Wakes the body.
+func (b *RigidBody) ApplyImpulse(impulse, offset Vec2) {
+	b.Impulse = b.Impulse.Add(impulse)
+	b.AngularImpulse += offset.Cross(impulse)
+	b.Wake()
+}
+
+func (b *RigidBody) ApplyAngularImpulse(impulse float64) {
+	b.AngularImpulse += impulse
+	b.Wake()
+}
+
+func (b *RigidBody) Wake() {
+	b.Sleeping = false
+	b.RestTime = 0
+}
+
+func (b RigidBody) mass() float64 {
+	if b.Mass <= 0 {
+		return 1
+	}
+	return b.Mass
+}
+
+//Returns the inertia of a body of the given mass whose collider has the shape,
+//the shape has to be centered on the center of mass
+func shapeInertia(mass float64, shape collision.Shape) float64 {
+	points, radius := shape.Points, shape.Radius
+	switch len(points) {
+	case 1:
+		return mass * (radius*radius/2 + points[0].LengthSquared())
+	case 2:
+		//A box around the capsule
+		length := points[1].Sub(points[0]).Length() + 2*radius
+		center := points[0].Add(points[1]).Scale(0.5)
+		return mass*(length*length+4*radius*radius)/12 + mass*center.LengthSquared()
+	}
+	numerator, denominator := 0.0, 0.0
+	for i, a := range points {
+		b := points[(i+1)%len(points)]
+		cross := math.Abs(a.Cross(b))
+		numerator += cross * (a.Dot(a) + a.Dot(b) + b.Dot(b))
+		denominator += cross
+	}
+	if denominator == 0 {
+		return 0
+	}
+	return mass * numerator / (6 * denominator)
+}
+
+/***************************/
+/*        Settings         */
+
+//A resource with the settings of the physics service
+type Settings struct {
+	//In units per second squared, the screen has y pointing down
+	Gravity Vec2
+	//Solver passes per step, more makes stacks stiffer
+	Iterations int
+	//Passes per step that move joined bodies back into place
+	PositionIterations int
+	//The fraction of the overlap of contacts that is corrected per step
+	Correction float64
+	//Overlap that is allowed, keeps resting contacts from jittering
+	Slop float64
+	//Contacts closing slower than this do not bounce
+	RestitutionThreshold float64
+	//Bodies slower than these rest, an island of bodies that all rested for
+	//SleepTime seconds falls asleep
+	SleepVelocity        float64
+	SleepAngularVelocity float64
+	SleepTime            float64
+}
+
+func (s Settings) GetType() reflect.Type { return reflect.TypeOf(s) }
+func (s Settings) IsComponent()          {}
+
+//Returns settings for a world measured in pixels
+func DefaultSettings() Settings {
+	return Settings{
+		Gravity:              Vec2{0, 980},
+		Iterations:           8,
+		PositionIterations:   3,
+		Correction:           0.2,
+		Slop:                 0.5,
+		RestitutionThreshold: 50,
+		SleepVelocity:        5,
+		SleepAngularVelocity: 2 * math.Pi / 180,
+		SleepTime:            0.5,
+	}
+}
+
+//Returns the transform moved to the position and turned to the angle, its
+//scale is kept and any shear is dropped
+func placeTransform(t world.Transform, position Vec2, angle float64) world.Transform {
+	scaleX, scaleY := transformScale(t)
+	return world.NewTransform().Translate(position[0], position[1]).Rotate(angle).Scale(scaleX, scaleY)
+}
+
+func transformScale(t world.Transform) (float64, float64) {
+	scale := t.Decompose().Scale
+	return scale[0], scale[1]
+}
+
+func transformPlacement(t world.Transform) (Vec2, float64) {
+	affine := t.Decompose()
+	return affine.Translation, affine.Rotation
+}
@@ -0,0 +1,236 @@
+package physics
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/jevans40/Ruthenium/component"
+)
+
+//The kinds of joints
+type JointKind int
+
+const (
+	//Keeps the anchors at Length from each other
+	DistanceJoint JointKind = iota
+	//Pins the anchors together, the bodies turn freely around them
+	RevoluteJoint
+	//Lets the anchor of B slide along Axis through the anchor of A, the bodies
+	//keep the angle between them
+	PrismaticJoint
+)
+
+func (k JointKind) String() string {
+	switch k {
+	case DistanceJoint:
+		return "Distance"
+	case RevoluteJoint:
+		return "Revolute"
+	case PrismaticJoint:
+		return "Prismatic"
+	}
+	return fmt.Sprintf("JointKind(%d)", int(k))
+}
+
+//Connects the bodies of two entities. Joints are components of their own
+//entity, so a body can have any number of them. Joints to entities without a
+//RigidBody hold on to the world.
+type Joint struct {
+	Kind JointKind
+	A, B component.EntityID
+	//Where the joint holds each body, relative to its center and turning with it
+	AnchorA, AnchorB Vec2
+	//The distance of distance joints
+	Length float64
+	//The direction prismatic joints slide along, in the space of A
+	Axis Vec2
+	//The angle of B minus the angle of A that prismatic joints keep
+	ReferenceAngle float64
+	//Lets the bodies collide with each other
+	CollideConnected bool
+}
+
+func (j Joint) GetType() reflect.Type { return reflect.TypeOf(j) }
+func (j Joint) IsComponent()          {}
+
+func NewDistanceJoint(a, b component.EntityID, anchorA, anchorB Vec2, length float64) Joint {
+	return Joint{Kind: DistanceJoint, A: a, B: b, AnchorA: anchorA, AnchorB: anchorB, Length: length}
+}
+
+func NewRevoluteJoint(a, b component.EntityID, anchorA, anchorB Vec2) Joint {
+	return Joint{Kind: RevoluteJoint, A: a, B: b, AnchorA: anchorA, AnchorB: anchorB}
+}
+
+func NewPrismaticJoint(a, b component.EntityID, anchorA, anchorB, axis Vec2, referenceAngle float64) Joint {
+	return Joint{Kind: PrismaticJoint, A: a, B: b, AnchorA: anchorA, AnchorB: anchorB, Axis: axis.Normalize(), ReferenceAngle: referenceAngle}
+}
+
+/***************************/
+/*         Solving         */
+
+//A joint between two bodies of a step
+type jointConstraint struct {
+	entity component.EntityID
+	joint  Joint
+	a, b   *solverBody
+	rA, rB Vec2
+	//The accumulated impulses, linear then angular
+	impulse Vec2
+	angular float64
+}
+
+func rotate(v Vec2, angle float64) Vec2 {
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	return Vec2{v[0]*cos - v[1]*sin, v[0]*sin + v[1]*cos}
+}
+
+//Returns the velocity of the point of the body at offset r
+func (b *solverBody) pointVelocity(r Vec2) Vec2 {
+	return b.velocity.Add(r.Perp().Scale(b.angularVelocity))
+}
+
+func (b *solverBody) applyImpulse(impulse, r Vec2) {
+	b.velocity = b.velocity.Add(impulse.Scale(b.invMass))
+	b.angularVelocity += b.invInertia * r.Cross(impulse)
+}
+
+func (c *jointConstraint) prepare() {
+	c.rA = rotate(c.joint.AnchorA, c.a.angle)
+	c.rB = rotate(c.joint.AnchorB, c.b.angle)
+	//Warm start with the impulses of the last step
+	leverA := c.rA
+	if c.joint.Kind == PrismaticJoint {
+		leverA = c.b.position.Add(c.rB).Sub(c.a.position)
+	}
+	c.a.applyImpulse(c.impulse.Neg(), leverA)
+	c.b.applyImpulse(c.impulse, c.rB)
+	c.a.angularVelocity -= c.a.invInertia * c.angular
+	c.b.angularVelocity += c.b.invInertia * c.angular
+}
+
+//Removes the relative velocity the joint does not allow. Drift is corrected
+//afterwards by solvePosition.
+func (c *jointConstraint) solve() {
+	a, b := c.a, c.b
+	separation := b.position.Add(c.rB).Sub(a.position.Add(c.rA))
+	relative := b.pointVelocity(c.rB).Sub(a.pointVelocity(c.rA))
+
+	switch c.joint.Kind {
+	case DistanceJoint:
+		length := separation.Length()
+		if length == 0 {
+			return
+		}
+		axis := separation.Scale(1 / length)
+		crossA, crossB := c.rA.Cross(axis), c.rB.Cross(axis)
+		mass := a.invMass + b.invMass + a.invInertia*crossA*crossA + b.invInertia*crossB*crossB
+		if mass == 0 {
+			return
+		}
+		lambda := -axis.Dot(relative) / mass
+		c.impulse = c.impulse.Add(axis.Scale(lambda))
+		a.applyImpulse(axis.Scale(-lambda), c.rA)
+		b.applyImpulse(axis.Scale(lambda), c.rB)
+
+	case RevoluteJoint:
+		//Solves both axes at once with the 2x2 effective mass matrix
+		k11 := a.invMass + b.invMass + a.invInertia*c.rA[1]*c.rA[1] + b.invInertia*c.rB[1]*c.rB[1]
+		k12 := -a.invInertia*c.rA[0]*c.rA[1] - b.invInertia*c.rB[0]*c.rB[1]
+		k22 := a.invMass + b.invMass + a.invInertia*c.rA[0]*c.rA[0] + b.invInertia*c.rB[0]*c.rB[0]
+		det := k11*k22 - k12*k12
+		if det == 0 {
+			return
+		}
+		rhs := relative.Neg()
+		lambda := Vec2{(k22*rhs[0] - k12*rhs[1]) / det, (k11*rhs[1] - k12*rhs[0]) / det}
+		c.impulse = c.impulse.Add(lambda)
+		a.applyImpulse(lambda.Neg(), c.rA)
+		b.applyImpulse(lambda, c.rB)
+
+	case PrismaticJoint:
+		if angularMass := a.invInertia + b.invInertia; angularMass > 0 {
+			lambda := -(b.angularVelocity - a.angularVelocity) / angularMass
+			c.angular += lambda
+			a.angularVelocity -= a.invInertia * lambda
+			b.angularVelocity += b.invInertia * lambda
+		}
+		//Only motion across the axis is stopped
+		normal := rotate(c.joint.Axis, a.angle).Normalize().Perp()
+		crossA, crossB := separation.Add(c.rA).Cross(normal), c.rB.Cross(normal)
+		mass := a.invMass + b.invMass + a.invInertia*crossA*crossA + b.invInertia*crossB*crossB
+		if mass == 0 {
+			return
+		}
+		//The anchor of A moves along with the axis as A turns
+		velocity := normal.Dot(b.velocity.Sub(a.velocity)) + b.angularVelocity*crossB - a.angularVelocity*crossA
+		lambda := -velocity / mass
+		c.impulse = c.impulse.Add(normal.Scale(lambda))
+		a.velocity = a.velocity.Sub(normal.Scale(lambda * a.invMass))
+		a.angularVelocity -= a.invInertia * lambda * crossA
+		b.velocity = b.velocity.Add(normal.Scale(lambda * b.invMass))
+		b.angularVelocity += b.invInertia * lambda * crossB
+	}
+}
+
+//Moves the bodies so the joint holds again, the velocity solver alone lets
+//them drift apart
+func (c *jointConstraint) solvePosition() {
+	a, b := c.a, c.b
+	rA, rB := rotate(c.joint.AnchorA, a.angle), rotate(c.joint.AnchorB, b.angle)
+	separation := b.position.Add(rB).Sub(a.position.Add(rA))
+	move := func(body *solverBody, impulse, r Vec2) {
+		body.position = body.position.Add(impulse.Scale(body.invMass))
+		body.angle += body.invInertia * r.Cross(impulse)
+	}
+
+	switch c.joint.Kind {
+	case DistanceJoint:
+		length := separation.Length()
+		if length == 0 {
+			return
+		}
+		axis := separation.Scale(1 / length)
+		crossA, crossB := rA.Cross(axis), rB.Cross(axis)
+		mass := a.invMass + b.invMass + a.invInertia*crossA*crossA + b.invInertia*crossB*crossB
+		if mass == 0 {
+			return
+		}
+		impulse := axis.Scale(-(length - c.joint.Length) / mass)
+		move(a, impulse.Neg(), rA)
+		move(b, impulse, rB)
+
+	case RevoluteJoint:
+		k11 := a.invMass + b.invMass + a.invInertia*rA[1]*rA[1] + b.invInertia*rB[1]*rB[1]
+		k12 := -a.invInertia*rA[0]*rA[1] - b.invInertia*rB[0]*rB[1]
+		k22 := a.invMass + b.invMass + a.invInertia*rA[0]*rA[0] + b.invInertia*rB[0]*rB[0]
+		det := k11*k22 - k12*k12
+		if det == 0 {
+			return
+		}
+		rhs := separation.Neg()
+		impulse := Vec2{(k22*rhs[0] - k12*rhs[1]) / det, (k11*rhs[1] - k12*rhs[0]) / det}
+		move(a, impulse.Neg(), rA)
+		move(b, impulse, rB)
+
+	case PrismaticJoint:
+		if angularMass := a.invInertia + b.invInertia; angularMass > 0 {
+			impulse := -(b.angle - a.angle - c.joint.ReferenceAngle) / angularMass
+			a.angle -= a.invInertia * impulse
+			b.angle += b.invInertia * impulse
+		}
+		rA, rB = rotate(c.joint.AnchorA, a.angle), rotate(c.joint.AnchorB, b.angle)
+		separation = b.position.Add(rB).Sub(a.position.Add(rA))
+		normal := rotate(c.joint.Axis, a.angle).Normalize().Perp()
+		crossA, crossB := separation.Add(rA).Cross(normal), rB.Cross(normal)
+		mass := a.invMass + b.invMass + a.invInertia*crossA*crossA + b.invInertia*crossB*crossB
+		if mass == 0 {
+			return
+		}
+		lambda := -normal.Dot(separation) / mass
+		a.position = a.position.Sub(normal.Scale(lambda * a.invMass))
+		a.angle -= a.invInertia * lambda * crossA
+		b.position = b.position.Add(normal.Scale(lambda * b.invMass))
+		b.angle += b.invInertia * lambda * crossB
+	}
+}
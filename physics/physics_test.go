@@ -0,0 +1,261 @@
+package physics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jevans40/Ruthenium/collision"
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+	"github.com/stretchr/testify/assert"
+)
+
+const testStep = time.Second / 60
+
+type testWorld struct {
+	d          world.Dispatcher
+	bodies     component.WriteStorage[RigidBody]
+	transforms component.WriteStorage[world.Transform]
+	colliders  component.WriteStorage[collision.Collider]
+	joints     component.WriteStorage[Joint]
+}
+
+func newTestWorld(t *testing.T) testWorld {
+	d := world.NewSimpleDispatcher()
+	d.SetFixedTimestep(testStep)
+	assert.NoError(t, AddPhysics(d, testStep, DefaultSettings()))
+	w := testWorld{d: d}
+	w.bodies, _ = component.GetWriteStorage[RigidBody](d.GetStorage(component.ReflectType[RigidBody]()))
+	w.transforms, _ = component.GetWriteStorage[world.Transform](d.GetStorage(component.ReflectType[world.Transform]()))
+	w.colliders, _ = component.GetWriteStorage[collision.Collider](d.GetStorage(component.ReflectType[collision.Collider]()))
+	w.joints, _ = component.GetWriteStorage[Joint](d.GetStorage(component.ReflectType[Joint]()))
+	return w
+}
+
+func (w testWorld) add(t *testing.T, e component.EntityID, x, y float64, body *RigidBody, collider *collision.Collider) {
+	assert.NoError(t, w.transforms.AddEntity(e, world.NewTransform().Translate(x, y)))
+	if body != nil {
+		assert.NoError(t, w.bodies.AddEntity(e, *body))
+	}
+	if collider != nil {
+		assert.NoError(t, w.colliders.AddEntity(e, *collider))
+	}
+}
+
+func (w testWorld) run(t *testing.T, ticks int) {
+	for i := 0; i < ticks; i++ {
+		assert.NoError(t, w.d.Maintain())
+	}
+}
+
+func (w testWorld) position(e component.EntityID) (Vec2, float64) {
+	return transformPlacement(w.transforms.MustGetComponent(e))
+}
+
+func TestRestingBox(t *testing.T) {
+	w := newTestWorld(t)
+	ground := collision.NewAABB(Vec2{}, Vec2{200, 10})
+	box := collision.NewAABB(Vec2{}, Vec2{10, 10})
+	body := NewRigidBody(Dynamic)
+	w.add(t, 1, 0, 100, nil, &ground)
+	w.add(t, 2, 0, 0, &body, &box)
+
+	w.run(t, 300)
+	position, angle := w.position(2)
+	assert.InDelta(t, 80, position[1], 1)
+	assert.InDelta(t, 0, position[0], 0.01)
+	assert.InDelta(t, 0, angle, 0.01)
+	rested := w.bodies.MustGetComponent(2)
+	assert.True(t, rested.Sleeping)
+	assert.Equal(t, Vec2{}, rested.Velocity)
+
+	//Sleeping bodies stay put until they are pushed
+	w.run(t, 10)
+	still, _ := w.position(2)
+	assert.Equal(t, position, still)
+	rested.ApplyImpulse(Vec2{0, -300}, Vec2{})
+	assert.NoError(t, w.bodies.Write(2, rested))
+	w.run(t, 1)
+	assert.False(t, w.bodies.MustGetComponent(2).Sleeping)
+	moved, _ := w.position(2)
+	assert.Less(t, moved[1], position[1])
+}
+
+func TestStack(t *testing.T) {
+	w := newTestWorld(t)
+	ground := collision.NewAABB(Vec2{}, Vec2{200, 10})
+	w.add(t, 1, 0, 100, nil, &ground)
+	box := collision.NewBox(Vec2{}, Vec2{10, 10}, 0)
+	for i := 0; i < 4; i++ {
+		body := NewRigidBody(Dynamic)
+		w.add(t, component.EntityID(2+i), 0, 79-float64(i)*20.5, &body, &box)
+	}
+
+	w.run(t, 240)
+	for i := 0; i < 4; i++ {
+		position, angle := w.position(component.EntityID(2 + i))
+		assert.InDelta(t, 80-float64(i)*20, position[1], 2, "box %d", i)
+		assert.InDelta(t, 0, position[0], 0.5, "box %d", i)
+		assert.InDelta(t, 0, angle, 0.05, "box %d", i)
+	}
+}
+
+func TestBounce(t *testing.T) {
+	w := newTestWorld(t)
+	ground := collision.NewAABB(Vec2{}, Vec2{200, 10})
+	ball := collision.NewCircle(Vec2{}, 5)
+	bouncy := NewRigidBody(Dynamic)
+	bouncy.Restitution = 0.8
+	dull := NewRigidBody(Dynamic)
+	w.add(t, 1, 0, 100, nil, &ground)
+	w.add(t, 2, -50, 0, &bouncy, &ball)
+	w.add(t, 3, 50, 0, &dull, &ball)
+
+	bounced := false
+	for i := 0; i < 40; i++ {
+		w.run(t, 1)
+		if w.bodies.MustGetComponent(2).Velocity[1] < -100 {
+			bounced = true
+		}
+		assert.Greater(t, w.bodies.MustGetComponent(3).Velocity[1], -50.0)
+	}
+	assert.True(t, bounced)
+}
+
+func TestForcesAndImpulses(t *testing.T) {
+	w := newTestWorld(t)
+	floating := NewRigidBody(Dynamic)
+	floating.GravityScale = 0
+	floating.ApplyImpulse(Vec2{10, 0}, Vec2{0, 1})
+	circle := collision.NewCircle(Vec2{}, 1)
+	w.add(t, 1, 0, 0, &floating, &circle)
+
+	kinematic := NewRigidBody(Kinematic)
+	kinematic.Velocity = Vec2{60, 0}
+	static := NewRigidBody(Static)
+	static.Velocity = Vec2{60, 0}
+	w.add(t, 2, 0, 0, &kinematic, nil)
+	w.add(t, 3, 0, 0, &static, nil)
+
+	heavy := NewRigidBody(Dynamic)
+	heavy.Mass, heavy.GravityScale, heavy.FixedRotation = 2, 0, true
+	heavy.ApplyForce(Vec2{120, 0}, Vec2{0, 5})
+	w.add(t, 4, 100, 0, &heavy, &circle)
+
+	w.run(t, 1)
+	body := w.bodies.MustGetComponent(1)
+	assert.InDelta(t, 10, body.Velocity[0], 1e-9)
+	//The inertia of a unit circle of mass 1 is 0.5
+	assert.InDelta(t, -20, body.AngularVelocity, 1e-9)
+	dt := testStep.Seconds()
+	assert.Equal(t, Vec2{}, body.Impulse)
+	assert.Equal(t, 0.0, body.AngularImpulse)
+	position, angle := w.position(1)
+	assert.InDelta(t, 10*dt, position[0], 1e-9)
+	assert.InDelta(t, -20*dt, angle, 1e-9)
+
+	position, _ = w.position(2)
+	assert.InDelta(t, 60*dt, position[0], 1e-9)
+	position, _ = w.position(3)
+	assert.Equal(t, 0.0, position[0])
+
+	heavyBody := w.bodies.MustGetComponent(4)
+	assert.InDelta(t, 60*dt, heavyBody.Velocity[0], 1e-9)
+	assert.Equal(t, 0.0, heavyBody.AngularVelocity)
+	assert.Equal(t, Vec2{}, heavyBody.Force)
+
+	//The kinematic body keeps going, the other body slows down with damping
+	damped := w.bodies.MustGetComponent(1)
+	damped.LinearDamping = 1
+	assert.NoError(t, w.bodies.Write(1, damped))
+	w.run(t, 59)
+	position, _ = w.position(2)
+	assert.InDelta(t, 3600*dt, position[0], 1e-9)
+	assert.Less(t, w.bodies.MustGetComponent(1).Velocity[0], 10*math.Exp(-0.9))
+}
+
+func TestJoints(t *testing.T) {
+	w := newTestWorld(t)
+	circle := collision.NewCircle(Vec2{}, 2)
+
+	//A pendulum hanging from entity 1, which has no body
+	bob := NewRigidBody(Dynamic)
+	w.add(t, 1, 0, 0, nil, nil)
+	w.add(t, 2, 50, 0, &bob, &circle)
+	assert.NoError(t, w.joints.AddEntity(10, NewDistanceJoint(1, 2, Vec2{}, Vec2{}, 50)))
+
+	//Two bodies pinned together at their edges, the first hangs from the world
+	first, second := NewRigidBody(Dynamic), NewRigidBody(Dynamic)
+	box := collision.NewAABB(Vec2{}, Vec2{5, 5})
+	w.add(t, 3, 200, 0, &first, &box)
+	w.add(t, 4, 210, 0, &second, &box)
+	assert.NoError(t, w.joints.AddEntity(11, NewRevoluteJoint(1, 3, Vec2{195, 0}, Vec2{-5, 0})))
+	assert.NoError(t, w.joints.AddEntity(12, NewRevoluteJoint(3, 4, Vec2{5, 0}, Vec2{-5, 0})))
+
+	//A slider on a horizontal rail
+	slider := NewRigidBody(Dynamic)
+	slider.ApplyImpulse(Vec2{30, -30}, Vec2{})
+	w.add(t, 5, -200, 0, &slider, &circle)
+	assert.NoError(t, w.joints.AddEntity(13, NewPrismaticJoint(1, 5, Vec2{-200, 0}, Vec2{}, Vec2{1, 0}, 0)))
+
+	swung := false
+	for i := 0; i < 120; i++ {
+		w.run(t, 1)
+		position, _ := w.position(2)
+		assert.InDelta(t, 50, position.Length(), 1)
+		swung = swung || position[1] > 49
+
+		firstPosition, firstAngle := w.position(3)
+		secondPosition, secondAngle := w.position(4)
+		pin := firstPosition.Add(rotate(Vec2{5, 0}, firstAngle))
+		assert.InDelta(t, 0, pin.Sub(secondPosition.Add(rotate(Vec2{-5, 0}, secondAngle))).Length(), 1)
+		hinge := firstPosition.Add(rotate(Vec2{-5, 0}, firstAngle))
+		assert.InDelta(t, 0, hinge.Sub(Vec2{195, 0}).Length(), 1)
+
+		position, angle := w.position(5)
+		assert.InDelta(t, 0, position[1], 1)
+		assert.InDelta(t, 0, angle, 0.01)
+	}
+	assert.True(t, swung)
+	position, _ := w.position(5)
+	assert.InDelta(t, -140, position[0], 1)
+}
+
+func TestDeterminism(t *testing.T) {
+	build := func() testWorld {
+		w := newTestWorld(t)
+		ground := collision.NewAABB(Vec2{}, Vec2{300, 10})
+		w.add(t, 1, 0, 200, nil, &ground)
+		shapes := []collision.Collider{
+			collision.NewCircle(Vec2{}, 8),
+			collision.NewBox(Vec2{}, Vec2{8, 6}, 0.3),
+			collision.NewCapsule(Vec2{-6, 0}, Vec2{6, 0}, 4),
+			collision.NewPolygon(Vec2{-8, 6}, Vec2{8, 6}, Vec2{0, -8}),
+		}
+		for i := 0; i < 24; i++ {
+			body := NewRigidBody(Dynamic)
+			body.Restitution = 0.2
+			w.add(t, component.EntityID(2+i), float64(i%6)*17-40, float64(i/6)*-25, &body, &shapes[i%len(shapes)])
+		}
+		return w
+	}
+	a, b := build(), build()
+	for i := 0; i < 200; i++ {
+		a.run(t, 1)
+		b.run(t, 1)
+	}
+	assert.Equal(t, world.StateHash(a.d), world.StateHash(b.d))
+	for i := 0; i < 24; i++ {
+		position, _ := a.position(component.EntityID(2 + i))
+		assert.Less(t, position[1], 200.0, "body %d fell through the ground", i)
+	}
+}
+
+func TestInvalidStep(t *testing.T) {
+	//A step of 0 would never advance, it is rejected before anything is added
+	d := world.NewSimpleDispatcher()
+	assert.Error(t, AddPhysics(d, 0, DefaultSettings()))
+	assert.Error(t, AddPhysics(d, -testStep, DefaultSettings()))
+	assert.Nil(t, d.GetStorage(component.ReflectType[RigidBody]()))
+}
@@ -0,0 +1,93 @@
+package physics
+
+import (
+	"time"
+
+	"github.com/jevans40/Ruthenium/collision"
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//Adds the RigidBody and Joint storages, the Settings resource and a physics
+//service that steps every step of time. The Transform and Collider storages are
+//added as well if the dispatcher does not have them yet, add the collision
+//service before this to get contact events too. Returns an error without adding
+//anything if step is not positive.
+func AddPhysics(d world.Dispatcher, step time.Duration, settings Settings) error {
+	service, err := NewPhysicsService(step)
+	if err != nil {
+		return err
+	}
+	if d.GetStorage(component.ReflectType[world.Transform]()) == nil {
+		if err := d.AddStorage(component.NewVectorStorage[world.Transform]()); err != nil {
+			return err
+		}
+	}
+	if d.GetStorage(component.ReflectType[collision.Collider]()) == nil {
+		if err := d.AddStorage(component.NewVectorStorage[collision.Collider]()); err != nil {
+			return err
+		}
+	}
+	for _, storage := range []component.ComponentStorage{
+		component.NewVectorStorage[RigidBody](),
+		component.NewVectorStorage[Joint](),
+		component.NewResourceStorage(settings),
+	} {
+		if err := d.AddStorage(storage); err != nil {
+			return err
+		}
+	}
+	return d.AddService(service)
+}
+
+//Creates the service that moves every RigidBody, resolves their contacts and
+//joints and writes their Transforms. It runs in the UpdateStage at most once a
+//tick and always advances by step, so with the dispatcher on a fixed timestep
+//of the same length it steps every tick and the same inputs always give the
+//same bodies. Returns an error if step is not positive.
+func NewPhysicsService(step time.Duration) (world.Service, error) {
+	rate, err := world.FixedStep(step)
+	if err != nil {
+		return nil, err
+	}
+	service := world.NewBaseService("physics")
+	service.SetStage(world.UpdateStage)
+	service.AddRequiredAccessComponent(world.NewComponentAccess[RigidBody](world.WriteAccess))
+	service.AddRequiredAccessComponent(world.NewComponentAccess[world.Transform](world.WriteAccess))
+	service.AddRequiredAccessComponent(world.NewComponentAccess[collision.Collider](world.ReadAccess))
+	service.AddRequiredAccessComponent(world.NewComponentAccess[Joint](world.ReadAccess))
+	service.AddRequiredAccessComponent(world.NewComponentAccess[Settings](world.ReadAccess))
+	service.AddRunCondition(rate)
+	s := newSolver()
+	service.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		bodies, err := world.GetWriteStorage[RigidBody](service)
+		if err != nil {
+			return err
+		}
+		transforms, err := world.GetWriteStorage[world.Transform](service)
+		if err != nil {
+			return err
+		}
+		colliders, err := world.GetReadStorage[collision.Collider](service)
+		if err != nil {
+			return err
+		}
+		joints, err := world.GetReadStorage[Joint](service)
+		if err != nil {
+			return err
+		}
+		settings, err := world.GetReadStorage[Settings](service)
+		if err != nil {
+			return err
+		}
+		data := stepData{
+			bodies:     bodies,
+			transforms: transforms,
+			colliders:  colliders,
+			joints:     joints,
+			settings:   settings.MustGetComponent(0),
+		}
+		return s.step(data, rate.Step().Seconds())
+	})
+	return service, nil
+}
@@ -0,0 +1,522 @@
+package physics
+
+import (
+	"math"
+	"sort"
+
+	"github.com/jevans40/Ruthenium/collision"
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/linmath"
+	"github.com/jevans40/Ruthenium/world"
+	log "github.com/sirupsen/logrus"
+)
+
+//A body during one step
+type solverBody struct {
+	entity component.EntityID
+	//The index in the sorted bodies, used for islands
+	index int
+	body  RigidBody
+	//False for colliders without a RigidBody and the world end of joints
+	hasBody      bool
+	hasTransform bool
+	transform    world.Transform
+
+	position            Vec2
+	angle               float64
+	velocity            Vec2
+	angularVelocity     float64
+	invMass, invInertia float64
+	sleeping            bool
+
+	collider    collision.Collider
+	shape       collision.Shape
+	hasCollider bool
+}
+
+func (b *solverBody) dynamic() bool {
+	return b.hasBody && b.body.Type == Dynamic
+}
+
+func (b *solverBody) awake() bool {
+	return b.dynamic() && !b.sleeping
+}
+
+//Awake dynamic bodies and moving kinematic bodies wake what they touch
+func (b *solverBody) active() bool {
+	if b.awake() {
+		return true
+	}
+	return b.hasBody && b.body.Type == Kinematic && (b.velocity != (Vec2{}) || b.angularVelocity != 0)
+}
+
+//One point of a contact
+type contactPoint struct {
+	rA, rB                        Vec2
+	depth                         float64
+	normalMass, tangentMass       float64
+	bias                          float64
+	normalImpulse, tangentImpulse float64
+}
+
+type contactConstraint struct {
+	a, b        *solverBody
+	normal      Vec2
+	friction    float64
+	restitution float64
+	points      []contactPoint
+}
+
+type pairKey struct {
+	a, b component.EntityID
+}
+
+func orderedPair(a, b component.EntityID) pairKey {
+	if b < a {
+		return pairKey{b, a}
+	}
+	return pairKey{a, b}
+}
+
+//Keeps the impulses of the last step to warm start the next one, which makes
+//stacks settle much faster
+type solver struct {
+	contactImpulses map[pairKey][][2]float64
+	jointImpulses   map[component.EntityID][3]float64
+}
+
+func newSolver() *solver {
+	return &solver{contactImpulses: map[pairKey][][2]float64{}, jointImpulses: map[component.EntityID][3]float64{}}
+}
+
+//The storages a step reads and writes
+type stepData struct {
+	bodies     component.WriteStorage[RigidBody]
+	transforms component.WriteStorage[world.Transform]
+	colliders  component.ReadOnlyStorage[collision.Collider]
+	joints     component.ReadOnlyStorage[Joint]
+	settings   Settings
+}
+
+//Advances every body by dt seconds. Everything is visited in entity order, so
+//the same storages always give the same result.
+func (s *solver) step(data stepData, dt float64) error {
+	settings := data.settings
+	bodies, lookup := gather(data)
+	contacts := s.findContacts(data, bodies)
+	joints := s.findJoints(data, lookup)
+	islands := wakeIslands(bodies, contacts, joints)
+
+	for _, b := range bodies {
+		if !b.awake() {
+			continue
+		}
+		gravity := settings.Gravity.Scale(b.body.GravityScale)
+		b.velocity = b.velocity.Add(gravity.Add(b.body.Force.Scale(b.invMass)).Scale(dt))
+		b.velocity = b.velocity.Add(b.body.Impulse.Scale(b.invMass))
+		b.angularVelocity += (b.body.Torque*dt + b.body.AngularImpulse) * b.invInertia
+		b.velocity = b.velocity.Scale(1 / (1 + dt*b.body.LinearDamping))
+		b.angularVelocity /= 1 + dt*b.body.AngularDamping
+	}
+
+	//Constraints between bodies that stayed asleep are left alone
+	awakeContacts := []*contactConstraint{}
+	for _, c := range contacts {
+		if c.a.awake() || c.b.awake() {
+			awakeContacts = append(awakeContacts, c)
+		}
+	}
+	awakeJoints := []*jointConstraint{}
+	for _, j := range joints {
+		if j.a.awake() || j.b.awake() {
+			awakeJoints = append(awakeJoints, j)
+		}
+	}
+
+	for _, c := range awakeContacts {
+		c.prepare(settings, dt)
+	}
+	for _, j := range awakeJoints {
+		j.prepare()
+	}
+	for i := 0; i < settings.Iterations; i++ {
+		for _, j := range awakeJoints {
+			j.solve()
+		}
+		for _, c := range awakeContacts {
+			c.solve()
+		}
+	}
+	s.saveImpulses(awakeContacts, awakeJoints)
+
+	for _, b := range bodies {
+		if b.awake() || (b.hasBody && b.body.Type == Kinematic) {
+			b.position = b.position.Add(b.velocity.Scale(dt))
+			b.angle += b.angularVelocity * dt
+		}
+	}
+	for i := 0; i < settings.PositionIterations; i++ {
+		for _, j := range awakeJoints {
+			j.solvePosition()
+		}
+	}
+	sleepIslands(bodies, islands, settings, dt)
+	return write(data, bodies)
+}
+
+//Returns a solver body for every RigidBody and Collider sorted by entity, and
+//the bodies by entity
+func gather(data stepData) ([]*solverBody, map[component.EntityID]*solverBody) {
+	lookup := map[component.EntityID]*solverBody{}
+	add := func(e component.EntityID) *solverBody {
+		if b, ok := lookup[e]; ok {
+			return b
+		}
+		b := placedBody(data, e)
+		lookup[e] = b
+		return b
+	}
+
+	for _, e := range data.bodies.GetEntities() {
+		b := add(e)
+		b.body, b.hasBody = data.bodies.MustGetComponent(e), true
+		b.velocity, b.angularVelocity = b.body.Velocity, b.body.AngularVelocity
+		b.sleeping = b.body.Sleeping && b.body.Type == Dynamic
+		if b.body.Type == Static {
+			b.velocity, b.angularVelocity = Vec2{}, 0
+		}
+	}
+	for _, e := range data.colliders.GetEntities() {
+		collider := data.colliders.MustGetComponent(e)
+		if collider.Sensor {
+			continue
+		}
+		b := add(e)
+		shape, err := collider.WorldShape(linmath.Mat3f[float64](b.transform))
+		if err != nil {
+			log.Warnf("Skipping collider of entity %v: %v", e, err)
+			continue
+		}
+		b.collider, b.shape, b.hasCollider = collider, shape, true
+	}
+
+	bodies := make([]*solverBody, 0, len(lookup))
+	for _, b := range lookup {
+		bodies = append(bodies, b)
+	}
+	sort.Slice(bodies, func(i, j int) bool { return bodies[i].entity < bodies[j].entity })
+	for i, b := range bodies {
+		b.index = i
+		if !b.dynamic() {
+			continue
+		}
+		mass := b.body.mass()
+		b.invMass = 1 / mass
+		inertia := b.body.Inertia
+		if inertia <= 0 && b.hasCollider {
+			//The shape around the center of mass with the scale of the transform
+			scaleX, scaleY := transformScale(b.transform)
+			local, err := b.collider.WorldShape(linmath.Mat3f[float64](world.NewTransform().Scale(scaleX, scaleY)))
+			if err == nil {
+				inertia = shapeInertia(mass, local)
+			}
+		}
+		if inertia > 0 && !b.body.FixedRotation {
+			b.invInertia = 1 / inertia
+		}
+	}
+	return bodies, lookup
+}
+
+//Returns an immovable body at the transform of the entity, or the origin
+func placedBody(data stepData, e component.EntityID) *solverBody {
+	b := &solverBody{entity: e, index: -1, transform: world.NewTransform()}
+	if transform, err := data.transforms.GetComponent(e); err == nil {
+		b.transform, b.hasTransform = transform, true
+	}
+	b.position, b.angle = transformPlacement(b.transform)
+	return b
+}
+
+func (s *solver) findContacts(data stepData, bodies []*solverBody) []*contactConstraint {
+	connected := map[pairKey]bool{}
+	for _, e := range data.joints.GetEntities() {
+		joint := data.joints.MustGetComponent(e)
+		if !joint.CollideConnected {
+			connected[orderedPair(joint.A, joint.B)] = true
+		}
+	}
+
+	colliding := []*solverBody{}
+	bounds := []collision.Bounds{}
+	for _, b := range bodies {
+		if b.hasCollider {
+			colliding = append(colliding, b)
+			bounds = append(bounds, b.shape.Bounds)
+		}
+	}
+	contacts := []*contactConstraint{}
+	for _, p := range collision.Overlapping(bounds) {
+		a, b := colliding[p[0]], colliding[p[1]]
+		//Something has to move and something has to be pushed
+		if !(a.dynamic() || b.dynamic()) || !(a.active() || b.active()) {
+			continue
+		}
+		key := pairKey{a.entity, b.entity}
+		if !a.collider.CanCollide(b.collider) || connected[key] {
+			continue
+		}
+		manifold, ok := collision.Collide(a.shape, b.shape)
+		if !ok {
+			continue
+		}
+		c := &contactConstraint{
+			a:           a,
+			b:           b,
+			normal:      manifold.Normal,
+			friction:    math.Sqrt(friction(a) * friction(b)),
+			restitution: math.Max(a.body.Restitution, b.body.Restitution),
+		}
+		cached := s.contactImpulses[key]
+		for i, point := range manifold.Points {
+			cp := contactPoint{rA: point.Sub(a.position), rB: point.Sub(b.position), depth: manifold.Depth}
+			if len(cached) == len(manifold.Points) {
+				cp.normalImpulse, cp.tangentImpulse = cached[i][0], cached[i][1]
+			}
+			c.points = append(c.points, cp)
+		}
+		contacts = append(contacts, c)
+	}
+	return contacts
+}
+
+//Colliders without a RigidBody have the default friction
+func friction(b *solverBody) float64 {
+	if !b.hasBody {
+		return NewRigidBody(Static).Friction
+	}
+	return b.body.Friction
+}
+
+func (s *solver) findJoints(data stepData, lookup map[component.EntityID]*solverBody) []*jointConstraint {
+	constraints := []*jointConstraint{}
+	for _, e := range data.joints.GetEntities() {
+		joint := data.joints.MustGetComponent(e)
+		end := func(entity component.EntityID) *solverBody {
+			if b, ok := lookup[entity]; ok {
+				return b
+			}
+			return placedBody(data, entity)
+		}
+		a, b := end(joint.A), end(joint.B)
+		if !a.dynamic() && !b.dynamic() {
+			continue
+		}
+		c := &jointConstraint{entity: e, joint: joint, a: a, b: b}
+		if cached, ok := s.jointImpulses[e]; ok {
+			c.impulse, c.angular = Vec2{cached[0], cached[1]}, cached[2]
+		}
+		constraints = append(constraints, c)
+	}
+	sort.Slice(constraints, func(i, j int) bool { return constraints[i].entity < constraints[j].entity })
+	return constraints
+}
+
+func (s *solver) saveImpulses(contacts []*contactConstraint, joints []*jointConstraint) {
+	s.contactImpulses = map[pairKey][][2]float64{}
+	for _, c := range contacts {
+		impulses := make([][2]float64, len(c.points))
+		for i, p := range c.points {
+			impulses[i] = [2]float64{p.normalImpulse, p.tangentImpulse}
+		}
+		s.contactImpulses[pairKey{c.a.entity, c.b.entity}] = impulses
+	}
+	s.jointImpulses = map[component.EntityID][3]float64{}
+	for _, j := range joints {
+		s.jointImpulses[j.entity] = [3]float64{j.impulse[0], j.impulse[1], j.angular}
+	}
+}
+
+//Writes the bodies back to their storages and clears the applied forces
+func write(data stepData, bodies []*solverBody) error {
+	for _, b := range bodies {
+		if !b.hasBody {
+			continue
+		}
+		body := b.body
+		body.Velocity, body.AngularVelocity = b.velocity, b.angularVelocity
+		body.Sleeping = b.sleeping
+		body.Force, body.Torque, body.Impulse, body.AngularImpulse = Vec2{}, 0, Vec2{}, 0
+		if err := data.bodies.Write(b.entity, body); err != nil {
+			return err
+		}
+		if body.Type == Static {
+			continue
+		}
+		transform := placeTransform(b.transform, b.position, b.angle)
+		if !b.hasTransform {
+			if err := data.transforms.AddEntity(b.entity, transform); err != nil {
+				return err
+			}
+		} else if transform != b.transform {
+			if err := data.transforms.Write(b.entity, transform); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/***************************/
+/*        Contacts         */
+
+func (c *contactConstraint) prepare(settings Settings, dt float64) {
+	a, b := c.a, c.b
+	tangent := c.normal.Perp()
+	for i := range c.points {
+		p := &c.points[i]
+		normalA, normalB := p.rA.Cross(c.normal), p.rB.Cross(c.normal)
+		p.normalMass = inverse(a.invMass + b.invMass + a.invInertia*normalA*normalA + b.invInertia*normalB*normalB)
+		tangentA, tangentB := p.rA.Cross(tangent), p.rB.Cross(tangent)
+		p.tangentMass = inverse(a.invMass + b.invMass + a.invInertia*tangentA*tangentA + b.invInertia*tangentB*tangentB)
+
+		//Push out the overlap over a few steps and bounce fast contacts
+		p.bias = settings.Correction / dt * math.Max(0, p.depth-settings.Slop)
+		closing := c.normal.Dot(b.pointVelocity(p.rB).Sub(a.pointVelocity(p.rA)))
+		if closing < -settings.RestitutionThreshold {
+			p.bias = math.Max(p.bias, -c.restitution*closing)
+		}
+
+		impulse := c.normal.Scale(p.normalImpulse).Add(tangent.Scale(p.tangentImpulse))
+		a.applyImpulse(impulse.Neg(), p.rA)
+		b.applyImpulse(impulse, p.rB)
+	}
+}
+
+func (c *contactConstraint) solve() {
+	a, b := c.a, c.b
+	tangent := c.normal.Perp()
+	for i := range c.points {
+		p := &c.points[i]
+
+		relative := b.pointVelocity(p.rB).Sub(a.pointVelocity(p.rA))
+		lambda := p.normalMass * (p.bias - c.normal.Dot(relative))
+		accumulated := math.Max(p.normalImpulse+lambda, 0)
+		lambda, p.normalImpulse = accumulated-p.normalImpulse, accumulated
+		a.applyImpulse(c.normal.Scale(-lambda), p.rA)
+		b.applyImpulse(c.normal.Scale(lambda), p.rB)
+
+		relative = b.pointVelocity(p.rB).Sub(a.pointVelocity(p.rA))
+		lambda = -p.tangentMass * tangent.Dot(relative)
+		limit := c.friction * p.normalImpulse
+		accumulated = math.Max(-limit, math.Min(p.tangentImpulse+lambda, limit))
+		lambda, p.tangentImpulse = accumulated-p.tangentImpulse, accumulated
+		a.applyImpulse(tangent.Scale(-lambda), p.rA)
+		b.applyImpulse(tangent.Scale(lambda), p.rB)
+	}
+}
+
+func inverse(x float64) float64 {
+	if x == 0 {
+		return 0
+	}
+	return 1 / x
+}
+
+/***************************/
+/*         Islands         */
+
+//Groups dynamic bodies that touch or are joined into islands and wakes every
+//island with an active body in it or touching it. Returns the island of each
+//body by index.
+func wakeIslands(bodies []*solverBody, contacts []*contactConstraint, joints []*jointConstraint) []int {
+	parent := make([]int, len(bodies))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	union := func(a, b *solverBody) {
+		if a.dynamic() && b.dynamic() && a.index >= 0 && b.index >= 0 {
+			rootA, rootB := find(a.index), find(b.index)
+			//The lower index is the root so the islands do not depend on the order of unions
+			if rootA < rootB {
+				parent[rootB] = rootA
+			} else {
+				parent[rootA] = rootB
+			}
+		}
+	}
+	for _, c := range contacts {
+		union(c.a, c.b)
+	}
+	for _, j := range joints {
+		union(j.a, j.b)
+	}
+
+	islands := make([]int, len(bodies))
+	awake := map[int]bool{}
+	for i, b := range bodies {
+		islands[i] = find(i)
+		if b.awake() {
+			awake[islands[i]] = true
+		}
+	}
+	//Moving kinematic bodies wake the islands they touch
+	wakeTouched := func(a, b *solverBody) {
+		if a.active() && !a.dynamic() && b.dynamic() && b.index >= 0 {
+			awake[islands[b.index]] = true
+		}
+	}
+	for _, c := range contacts {
+		wakeTouched(c.a, c.b)
+		wakeTouched(c.b, c.a)
+	}
+	for _, j := range joints {
+		wakeTouched(j.a, j.b)
+		wakeTouched(j.b, j.a)
+	}
+	for i, b := range bodies {
+		if b.sleeping && awake[islands[i]] {
+			b.sleeping = false
+			b.body.RestTime = 0
+		}
+	}
+	return islands
+}
+
+//Counts how long each awake body rested and puts islands to sleep once all of
+//their bodies rested long enough
+func sleepIslands(bodies []*solverBody, islands []int, settings Settings, dt float64) {
+	rested := map[int]float64{}
+	for i, b := range bodies {
+		if !b.awake() {
+			continue
+		}
+		moving := b.velocity.LengthSquared() > settings.SleepVelocity*settings.SleepVelocity ||
+			math.Abs(b.angularVelocity) > settings.SleepAngularVelocity
+		if b.body.CannotSleep || moving {
+			b.body.RestTime = 0
+		} else {
+			b.body.RestTime += dt
+		}
+		if least, ok := rested[islands[i]]; !ok || b.body.RestTime < least {
+			rested[islands[i]] = b.body.RestTime
+		}
+	}
+	if settings.SleepTime <= 0 {
+		return
+	}
+	for i, b := range bodies {
+		if b.awake() && rested[islands[i]] >= settings.SleepTime {
+			b.sleeping = true
+			b.velocity, b.angularVelocity = Vec2{}, 0
+		}
+	}
+}
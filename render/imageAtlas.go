@@ -1,12 +1,17 @@
 package render
 
 import (
+	"errors"
+	"fmt"
 	"image"
+	"image/draw"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
 
+	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/jevans40/Ruthenium/file"
 	"github.com/jevans40/Ruthenium/linmath"
 	log "github.com/sirupsen/logrus"
@@ -14,10 +19,16 @@ import (
 
 //TODO:: Add padding so mipmaps work
 
+//Returned when the images of an atlas do not fit on its pages
+var OutOfAtlasSpaceError = errors.New("out of atlas space")
+
 type ImageAtlas struct {
 	imageSize int32
 	images    map[string]*imageIndex
 	atlases   []image.Image
+
+	//The GL texture of every page, 0 if the page is not uploaded
+	textures []uint32
 }
 
 type atlasRec struct {
@@ -45,6 +56,7 @@ func ImageAtlasFactory(ImageSize int32, Images int32) ImageAtlas {
 	atlas := new(ImageAtlas)
 	atlas.images = make(map[string]*imageIndex)
 	atlas.atlases = make([]image.Image, Images)
+	atlas.textures = make([]uint32, Images)
 	for i := range atlas.atlases {
 		atlas.atlases[i] = image.NewRGBA(image.Rect(0, 0, int(ImageSize), int(ImageSize)))
 	}
@@ -53,25 +65,59 @@ func ImageAtlasFactory(ImageSize int32, Images int32) ImageAtlas {
 	return *atlas
 }
 
+//Like ReadImagesFromFolder but only logs errors, images that can not be
+//loaded show up as the missing texture
 func (i *ImageAtlas) AddImagesFromFolder(folderPath string) {
-	//TODO:: Add a check to make sure that the x and y are both less then the imagesize
+	if err := i.ReadImagesFromFolder(folderPath); err != nil {
+		log.WithError(err).Error("Could not load every atlas image")
+	}
+}
+
+//Adds every png in the folder and its subfolders, named by their path joined
+//to folderPath. Works like ReadImagesFromFS on os.DirFS(folderPath).
+func (i *ImageAtlas) ReadImagesFromFolder(folderPath string) error {
+	return i.readImages(os.DirFS(folderPath), ".", func(name string) string {
+		return filepath.Join(folderPath, filepath.FromSlash(name))
+	})
+}
+
+//Adds every png in dir of fsys and its subdirectories, named by their path in
+//fsys, so the images can come from the resource archive. Images that can not
+//be loaded are added as file.MissingTexture so the rest of the game keeps
+//working, the errors are logged and the first one is returned.
+func (i *ImageAtlas) ReadImagesFromFS(fsys fs.FS, dir string) error {
+	return i.readImages(fsys, dir, func(name string) string { return name })
+}
+
+func (i *ImageAtlas) readImages(fsys fs.FS, dir string, nameOf func(string) string) error {
 	var files []string
-	err := filepath.Walk(folderPath, func(path string, info os.FileInfo, err error) error {
-		matched, _ := regexp.MatchString(`.png$|.PNG$`, path)
-		if matched {
-			files = append(files, path)
+	err := fs.WalkDir(fsys, dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		matched, _ := regexp.MatchString(`.png$|.PNG$`, name)
+		if matched && !entry.IsDir() {
+			files = append(files, name)
 		}
 		return nil
 	})
 	if err != nil {
-		panic(err)
+		return err
 	}
 
+	var first error
 	for _, s := range files {
-		newimage := file.LoadImageFromFile(s)
-		newRect := linmath.NewPSRectangle(int32(newimage.Rect.Max.X)-int32(newimage.Rect.Min.X), int32(newimage.Rect.Max.Y)-int32(newimage.Rect.Min.Y), 0, 0)
-		i.images[s] = &imageIndex{atlasRec{newRect, -1}, newimage}
+		newimage, err := file.ReadImageFS(fsys, s)
+		if err != nil {
+			log.WithError(err).Error("Could not load atlas image, using the missing texture")
+			newimage = file.MissingTexture()
+			if first == nil {
+				first = err
+			}
+		}
+		i.AddImageFromImage(newimage, nameOf(s))
 	}
+	return first
 }
 
 func (i *ImageAtlas) AddImageFromImage(newImage image.Image, name string) {
@@ -82,10 +128,55 @@ func (i *ImageAtlas) AddImageFromImage(newImage image.Image, name string) {
 
 }
 
+//Panics if the images do not fit into the atlas, use Pack to handle the error
+//instead
 func (i *ImageAtlas) Init() {
+	if err := i.Pack(); err != nil {
+		log.Error("OUT OF TEXTURE UNIT MEMORY ENGINE CLOSING")
+		log.Panic(err)
+	}
+}
+
+//Packs every image onto the pages and draws them. Returns an error wrapping
+//OutOfAtlasSpaceError if they do not fit, the pages are left empty then.
+func (i *ImageAtlas) Pack() error {
+	names := []string{}
+	for s := range i.images {
+		names = append(names, s)
+	}
+	pages := []int{}
+	for page := range i.atlases {
+		pages = append(pages, page)
+	}
+	for _, name := range names {
+		size := i.images[name].boundingRect.GetSize()
+		if size.X() > i.imageSize || size.Y() > i.imageSize {
+			return fmt.Errorf("%s is larger than an atlas page: %w", name, OutOfAtlasSpaceError)
+		}
+	}
+	if !i.pack(names, pages) {
+		for _, img := range i.images {
+			img.boundingRect.atlasnum = -1
+		}
+		return fmt.Errorf("%d images on %d pages: %w", len(names), len(pages), OutOfAtlasSpaceError)
+	}
+
+	//Finally draw the allocated images to their respective atlases
+	for _, img := range i.images {
+		b := img.boundingRect
+		i.atlases[b.atlasnum] = file.DrawToImage(img.indexedImage, i.atlases[b.atlasnum], image.Point{int(b.GetPoint().X()), int(b.GetPoint().Y())})
+	}
+	return nil
+}
+
+//Packs the named images onto the given pages, returns false if they do not fit
+func (i *ImageAtlas) pack(names []string, pages []int) bool {
+	if len(names) == 0 {
+		return true
+	}
 	imageSizes := map[string]int{}
-	for s, l_image := range i.images {
-		imageSizes[s] = int(l_image.boundingRect.GetSize().Y())
+	for _, s := range names {
+		imageSizes[s] = int(i.images[s].boundingRect.GetSize().Y())
 	}
 
 	//This is to sort the map and give back a sorted list
@@ -99,7 +190,11 @@ func (i *ImageAtlas) Init() {
 		sortedSizes = append(sortedSizes, kv{k, v})
 	}
 
+	//Ties are sorted by name so packing the same images gives the same layout
 	sort.Slice(sortedSizes, func(i, j int) bool {
+		if sortedSizes[i].Value == sortedSizes[j].Value {
+			return sortedSizes[i].Key < sortedSizes[j].Key
+		}
 		return sortedSizes[i].Value > sortedSizes[j].Value
 	})
 
@@ -107,7 +202,7 @@ func (i *ImageAtlas) Init() {
 	var rows []atlasPoint
 	var rowheights []int
 	smallestY := sortedSizes[len(sortedSizes)-1].Value
-	for r := 0; r < len(i.atlases); r++ {
+	for _, r := range pages {
 		rows = append(rows, atlasPoint{linmath.NewPSPoint(0, int32(sortedSizes[0].Value)), r})
 		rowheights = append(rowheights, 0)
 	}
@@ -115,7 +210,7 @@ func (i *ImageAtlas) Init() {
 	for _, v := range sortedSizes {
 		allocated := false
 		currentImage := i.images[v.Key]
-		for atnum := range i.atlases {
+		for _, atnum := range pages {
 			for boxindex, box := range empty {
 				if currentImage.boundingRect.GetSize().X() <= box.GetSize().X() && currentImage.boundingRect.GetSize().Y() <= box.GetSize().Y() && atnum == box.atlasnum {
 					allocated = true
@@ -170,22 +265,181 @@ func (i *ImageAtlas) Init() {
 			}
 
 		}
-		if allocated {
+		if !allocated {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *ImageAtlas) getAtlas(index int) image.Image {
+	return i.atlases[index]
+}
+
+//Where an image was packed into the atlas, in pixels
+type AtlasRegion struct {
+	Page       int
+	X, Y, W, H int32
+}
+
+//Returns where the named image was packed, false if there is no such image or
+//the atlas was not packed yet
+func (i *ImageAtlas) GetRegion(name string) (AtlasRegion, bool) {
+	img, ok := i.images[name]
+	if !ok || img.boundingRect.atlasnum < 0 {
+		return AtlasRegion{}, false
+	}
+	point := img.boundingRect.GetPoint()
+	size := img.boundingRect.GetSize()
+	return AtlasRegion{Page: img.boundingRect.atlasnum, X: point.X(), Y: point.Y(), W: size.X(), H: size.Y()}, true
+}
+
+//Returns the width and height of a page in pixels
+func (i *ImageAtlas) GetPageSize() int32 {
+	return i.imageSize
+}
+
+//Returns the number of pages
+func (i *ImageAtlas) GetPageCount() int {
+	return len(i.atlases)
+}
+
+//Swaps the image stored under name for a new version of it, used to reload
+//changed files. The new image stays where the old one was if it fits there,
+//otherwise it is moved to free space on its page. Only if there is none the
+//page is packed again, the other pages never move. Returns the page that has to
+//be uploaded again, -1 if Init was not called yet, and the name of every image
+//whose region changed, so anything holding their texture coordinates can look
+//them up again with GetRegion.
+func (i *ImageAtlas) ReplaceImage(name string, newImage image.Image) (int, []string, error) {
+	entry, ok := i.images[name]
+	if !ok {
+		return -1, nil, fmt.Errorf("the atlas has no image named %s", name)
+	}
+	b := newImage.Bounds()
+	newSize := linmath.NewPSPoint(int32(b.Dx()), int32(b.Dy()))
+	oldSize := entry.boundingRect.GetSize()
+	oldPoint := entry.boundingRect.GetPoint()
+	page := entry.boundingRect.atlasnum
+	if page < 0 {
+		entry.boundingRect.SetSize(newSize)
+		entry.indexedImage = newImage
+		return -1, nil, nil
+	}
+	if newSize.X() > i.imageSize || newSize.Y() > i.imageSize {
+		return page, nil, fmt.Errorf("%s is larger than an atlas page: %w", name, OutOfAtlasSpaceError)
+	}
+
+	//Remember where everything was to report what moved, or to go back if the
+	//page overflows
+	names := []string{}
+	before := map[string]AtlasRegion{}
+	for n, img := range i.images {
+		if img.boundingRect.atlasnum == page {
+			names = append(names, n)
+			before[n], _ = i.GetRegion(n)
+		}
+	}
+	sort.Strings(names)
+
+	entry.boundingRect.SetSize(newSize)
+	if spot, ok := i.freeSpot(name, page, newSize); ok {
+		entry.boundingRect.SetPoint(spot)
+	} else if !i.pack(names, []int{page}) {
+		for _, n := range names {
+			r := before[n]
+			i.images[n].boundingRect.SetPoint(linmath.NewPSPoint(r.X, r.Y))
+			i.images[n].boundingRect.atlasnum = page
+		}
+		entry.boundingRect.SetSize(oldSize)
+		entry.boundingRect.SetPoint(oldPoint)
+		return page, nil, fmt.Errorf("%s does not fit on atlas page %d anymore: %w", name, page, OutOfAtlasSpaceError)
+	}
+	entry.indexedImage = newImage
+	i.redrawPage(page)
+
+	moved := []string{}
+	for _, n := range names {
+		if after, _ := i.GetRegion(n); after != before[n] {
+			moved = append(moved, n)
+		}
+	}
+	return page, moved, nil
+}
+
+//Finds a place on the page for an image of the given size that does not
+//overlap any other image, trying where the image already is first. Candidates
+//are the page edges and the right and bottom edges of the other images.
+func (i *ImageAtlas) freeSpot(name string, page int, size linmath.PSPoint) (linmath.PSPoint, bool) {
+	others := []AtlasRegion{}
+	xs := []int32{0}
+	ys := []int32{0}
+	for n, img := range i.images {
+		if n == name || img.boundingRect.atlasnum != page {
 			continue
-		} else {
-			log.Error("OUT OF TEXTURE UNIT MEMORY ENGINE CLOSING")
-			log.Panic("Out of TEXTURE UNIT MEMORY ENGINE CLOSING")
+		}
+		r, _ := i.GetRegion(n)
+		others = append(others, r)
+		xs = append(xs, r.X+r.W)
+		ys = append(ys, r.Y+r.H)
+	}
+	sort.Slice(xs, func(a, b int) bool { return xs[a] < xs[b] })
+	sort.Slice(ys, func(a, b int) bool { return ys[a] < ys[b] })
+	fits := func(x, y int32) bool {
+		if x+size.X() > i.imageSize || y+size.Y() > i.imageSize {
+			return false
+		}
+		for _, r := range others {
+			if x < r.X+r.W && r.X < x+size.X() && y < r.Y+r.H && r.Y < y+size.Y() {
+				return false
+			}
+		}
+		return true
+	}
+	current := i.images[name].boundingRect.GetPoint()
+	if fits(current.X(), current.Y()) {
+		return current, true
+	}
+	for _, y := range ys {
+		for _, x := range xs {
+			if fits(x, y) {
+				return linmath.NewPSPoint(x, y), true
+			}
 		}
 	}
+	return nil, false
+}
 
-	//Finally draw the allocated images to their respective atlases
+//Draws every image of the page onto a clear page
+func (i *ImageAtlas) redrawPage(page int) {
+	var atlas image.Image = image.NewRGBA(image.Rect(0, 0, int(i.imageSize), int(i.imageSize)))
 	for _, img := range i.images {
 		b := img.boundingRect
-		i.atlases[b.atlasnum] = file.DrawToImage(img.indexedImage, i.atlases[b.atlasnum], image.Point{int(b.GetPoint().X()), int(b.GetPoint().Y())})
+		if b.atlasnum == page {
+			atlas = file.DrawToImage(img.indexedImage, atlas, image.Point{int(b.GetPoint().X()), int(b.GetPoint().Y())})
+		}
 	}
+	i.atlases[page] = atlas
+}
 
+//Sets the GL texture UploadPage writes the page to
+func (i *ImageAtlas) SetPageTexture(page int, texture uint32) {
+	i.textures[page] = texture
 }
 
-func (i *ImageAtlas) getAtlas(index int) image.Image {
-	return i.atlases[index]
+//Uploads a page to its texture, does nothing if the page has no texture.
+//Must be called from the thread that owns the GL context.
+func (i *ImageAtlas) UploadPage(page int) {
+	texture := i.textures[page]
+	if texture == 0 {
+		return
+	}
+	rgba, ok := i.atlases[page].(*image.RGBA)
+	if !ok {
+		b := i.atlases[page].Bounds()
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), i.atlases[page], b.Min, draw.Src)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, texture)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(rgba.Rect.Dx()), int32(rgba.Rect.Dy()), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(rgba.Pix))
 }
@@ -1,7 +1,19 @@
 package render
 
 import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
 	"testing"
+	"testing/fstest"
+
+	"github.com/jevans40/Ruthenium/archive"
+	"github.com/jevans40/Ruthenium/file"
+	"github.com/stretchr/testify/assert"
 )
 
 //TODO:: More tests
@@ -28,3 +40,131 @@ func TestSpriteCreation(t *testing.T) {
 	//messages := map[string](chan int){}
 
 }
+
+func TestImageAtlasReplace(t *testing.T) {
+	rect := func(w, h int, c color.RGBA) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+		return img
+	}
+	square := func(size int, c color.RGBA) *image.RGBA {
+		return rect(size, size, c)
+	}
+	red := color.RGBA{255, 0, 0, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	at := func(atlas *ImageAtlas, name string) color.Color {
+		p := atlas.images[name].boundingRect.GetPoint()
+		return atlas.getAtlas(0).At(int(p.X()), int(p.Y()))
+	}
+
+	atlas := ImageAtlasFactory(16, 1)
+	atlas.AddImageFromImage(square(4, red), "a")
+	atlas.AddImageFromImage(square(4, green), "b")
+	atlas.Init()
+	assert.Equal(t, 1, atlas.GetPageCount())
+	assert.Equal(t, red, at(&atlas, "a"))
+	assert.Equal(t, green, at(&atlas, "b"))
+
+	//A smaller image is drawn in the old space
+	page, moved, err := atlas.ReplaceImage("a", square(2, blue))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, page)
+	assert.Equal(t, []string{"a"}, moved)
+	assert.Equal(t, blue, at(&atlas, "a"))
+	assert.Equal(t, green, at(&atlas, "b"))
+
+	//A larger image moves to free space, the other images stay where they are
+	b, _ := atlas.GetRegion("b")
+	_, moved, err = atlas.ReplaceImage("a", square(8, blue))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, moved)
+	after, _ := atlas.GetRegion("b")
+	assert.Equal(t, b, after)
+	assert.Equal(t, blue, at(&atlas, "a"))
+	assert.Equal(t, green, at(&atlas, "b"))
+	assert.Equal(t, int32(8), atlas.images["a"].boundingRect.GetSize().X())
+
+	//Images that do not fit keep the old one
+	_, _, err = atlas.ReplaceImage("a", square(15, red))
+	assert.Error(t, err)
+	assert.Equal(t, blue, at(&atlas, "a"))
+	assert.Equal(t, int32(8), atlas.images["a"].boundingRect.GetSize().X())
+	_, _, err = atlas.ReplaceImage("missing", square(2, red))
+	assert.Error(t, err)
+
+	//Without free space the page is packed again and every image that moved
+	//is reported
+	full := ImageAtlasFactory(16, 1)
+	full.AddImageFromImage(rect(5, 9, red), "a")
+	full.AddImageFromImage(rect(5, 9, green), "b")
+	full.AddImageFromImage(rect(4, 9, blue), "c")
+	full.Init()
+	a, _ := full.GetRegion("a")
+	page, moved, err = full.ReplaceImage("b", rect(6, 9, green))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, page)
+	assert.Equal(t, []string{"b", "c"}, moved)
+	after, _ = full.GetRegion("a")
+	assert.Equal(t, a, after)
+	c, _ := full.GetRegion("c")
+	assert.Equal(t, AtlasRegion{Page: 0, X: 11, Y: 0, W: 4, H: 9}, c)
+	assert.Equal(t, red, at(&full, "a"))
+	assert.Equal(t, green, at(&full, "b"))
+	assert.Equal(t, blue, at(&full, "c"))
+}
+
+func TestImageAtlasErrors(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "good.png"))
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(f, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	assert.NoError(t, f.Close())
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.png"), []byte("broken"), 0644))
+
+	//Broken images are replaced by the missing texture
+	atlas := ImageAtlasFactory(32, 1)
+	err = atlas.ReadImagesFromFolder(dir)
+	assert.ErrorIs(t, err, file.UnsupportedFormatError)
+	assert.Equal(t, file.MissingTexture(), atlas.images[filepath.Join(dir, "broken.png")].indexedImage)
+	assert.NoError(t, atlas.Pack())
+	assert.Error(t, atlas.ReadImagesFromFolder(filepath.Join(dir, "missing")))
+
+	small := ImageAtlasFactory(8, 1)
+	small.AddImageFromImage(image.NewRGBA(image.Rect(0, 0, 6, 6)), "a")
+	small.AddImageFromImage(image.NewRGBA(image.Rect(0, 0, 6, 6)), "b")
+	assert.ErrorIs(t, small.Pack(), OutOfAtlasSpaceError)
+	huge := ImageAtlasFactory(8, 1)
+	huge.AddImageFromImage(image.NewRGBA(image.Rect(0, 0, 9, 2)), "a")
+	assert.ErrorIs(t, huge.Pack(), OutOfAtlasSpaceError)
+}
+
+func TestImageAtlasFromArchive(t *testing.T) {
+	var encoded bytes.Buffer
+	red := color.RGBA{255, 0, 0, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(img, img.Bounds(), &image.Uniform{red}, image.Point{}, draw.Src)
+	assert.NoError(t, png.Encode(&encoded, img))
+	var packed bytes.Buffer
+	assert.NoError(t, archive.Pack(&packed, fstest.MapFS{
+		"image/a.png":         {Data: encoded.Bytes()},
+		"image/sprites/b.png": {Data: encoded.Bytes()},
+		"image/broken.png":    {Data: []byte("broken")},
+		"image/notes.txt":     {Data: []byte("not an image")},
+		"sound/c.png":         {Data: encoded.Bytes()},
+	}, nil))
+	res, err := archive.NewReader(bytes.NewReader(packed.Bytes()), int64(packed.Len()))
+	assert.NoError(t, err)
+
+	atlas := ImageAtlasFactory(64, 1)
+	assert.ErrorIs(t, atlas.ReadImagesFromFS(res, "image"), file.UnsupportedFormatError)
+	assert.Len(t, atlas.images, 3)
+	assert.Equal(t, file.MissingTexture(), atlas.images["image/broken.png"].indexedImage)
+	assert.NoError(t, atlas.Pack())
+	for _, name := range []string{"image/a.png", "image/sprites/b.png"} {
+		region, ok := atlas.GetRegion(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, red, atlas.getAtlas(0).At(int(region.X), int(region.Y)))
+	}
+	assert.Error(t, atlas.ReadImagesFromFS(res, "missing"))
+}
@@ -76,3 +76,17 @@ func NewProgram(vertexShaderSource, fragmentShaderSource string) (uint32, error)
 func CreateDefaultProgram() (uint32, error) {
 	return NewProgram(vertexShader, fragmentShader)
 }
+
+//ReloadProgram compiles a program to replace old, used when shader files change.
+//If compiling fails old is returned with the error and can still be used,
+//otherwise old is deleted.
+func ReloadProgram(old uint32, vertexShaderSource, fragmentShaderSource string) (uint32, error) {
+	program, err := NewProgram(vertexShaderSource, fragmentShaderSource)
+	if err != nil {
+		return old, err
+	}
+	if old != 0 {
+		gl.DeleteProgram(old)
+	}
+	return program, nil
+}
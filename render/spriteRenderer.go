@@ -7,6 +7,7 @@ import (
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/jevans40/Ruthenium/file"
 	"github.com/jevans40/Ruthenium/linmath"
+	log "github.com/sirupsen/logrus"
 )
 
 //TODO:: Documentation
@@ -21,6 +22,9 @@ type SpriteRenderer struct {
 	programObject       uint32
 	vert                []float32
 
+	//The texture sprites sample, bound to TEXTURE0 when rendering
+	texture uint32
+
 	//The order of elements should be 0,1,2,1,2,3
 	elem ElementBuffer
 
@@ -43,7 +47,11 @@ func SpriteRendererFactory( /*SourceAtlas ImageAtlas,*/ ) SpriteRenderer {
 
 	//This section is required, without it the game will crash.
 	//I don't know why
-	data := file.LoadImageFromFile("./res/image/God.png")
+	data, err := file.ReadImageFS(file.Resources(), "image/God.png")
+	if err != nil {
+		log.WithError(err).Error("Could not load the sprite texture, using the missing texture")
+		data = file.MissingTexture()
+	}
 	rect := data.Bounds()
 	rgba := image.NewRGBA(rect)
 	draw.Draw(rgba, rect, data, rect.Min, draw.Src)
@@ -76,7 +84,7 @@ func SpriteRendererFactory( /*SourceAtlas ImageAtlas,*/ ) SpriteRenderer {
 	var uniform map[string]map[uint32]int32 = make(map[string]map[uint32]int32)
 	//Make the sprite atlas
 
-	newRenderer := SpriteRenderer{vbo, vao, ebo, 0, int32(maxSprites), program, vert, elem, allocation, uniform, subs}
+	newRenderer := SpriteRenderer{vbo, vao, ebo, 0, int32(maxSprites), program, vert, texture, elem, allocation, uniform, subs}
 	newRenderer.init()
 	return newRenderer
 }
@@ -101,6 +109,8 @@ func (thisRenderer *SpriteRenderer) Render(width, height int32) {
 
 	orthomat := linmath.NewOrthoMat4f(float32(height), 0, 0, float32(width), 1, 0)
 	gl.UseProgram(thisRenderer.programObject)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, thisRenderer.texture)
 	gl.Uniform1i(thisRenderer.uniformlocations["texture1"+"\x00"][thisRenderer.programObject], 0)
 	loc := thisRenderer.uniformlocations["MVT"+"\x00"][thisRenderer.programObject]
 	mat := orthomat.ToFloats()
@@ -112,6 +122,37 @@ func (thisRenderer *SpriteRenderer) Render(width, height int32) {
 
 }
 
+//Makes the sprites sample the first page of the atlas instead of the default
+//texture. Every page gets a texture and is uploaded, so the atlas uploads its
+//pages again by itself when images are replaced. The atlas has to be packed.
+func (thisRenderer *SpriteRenderer) SetAtlas(atlas *ImageAtlas) {
+	for page := 0; page < atlas.GetPageCount(); page++ {
+		var texture uint32
+		gl.GenTextures(1, &texture)
+		gl.BindTexture(gl.TEXTURE_2D, texture)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+		atlas.SetPageTexture(page, texture)
+		atlas.UploadPage(page)
+		if page == 0 {
+			thisRenderer.texture = texture
+		}
+	}
+}
+
+//Replaces the program with one compiled from the given shader sources.
+//The current program is kept if they do not compile.
+func (thisRenderer *SpriteRenderer) ReloadProgram(vertexShaderSource, fragmentShaderSource string) error {
+	program, err := ReloadProgram(thisRenderer.programObject, vertexShaderSource, fragmentShaderSource)
+	if err != nil {
+		return err
+	}
+	thisRenderer.programObject = program
+	//The uniforms are looked up again on the next Render
+	thisRenderer.uniformlocations = make(map[string]map[uint32]int32)
+	return nil
+}
+
 func (thisRenderer *SpriteRenderer) init() {
 	thisRenderer.allocation = make([]bool, thisRenderer.maxSprites)
 	thisRenderer.vert = make([]float32, thisRenderer.maxSprites*28)
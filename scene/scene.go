@@ -0,0 +1,178 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jevans40/Ruthenium/component"
+	"gopkg.in/yaml.v3"
+)
+
+//A Scene lists the resources and entities of a level. Components and resources
+//are named by their registered name (see component.Register) and hold their
+//field values, fields that are left out keep the value they would otherwise have.
+//
+//	prefabs: [enemies.json]
+//	resources:
+//	  GameState: {Level: 2}
+//	entities:
+//	  - name: player
+//	    components:
+//	      Transform: [1, 0, 10, 0, 1, 5, 0, 0, 1]
+//	  - name: sword
+//	    parent: player
+//	    prefab: sword
+//	  - prefab: goblin
+//	    components:
+//	      Health: {Health: 20}
+type Scene struct {
+	//Prefab files used by the entities, relative to the scene file
+	Prefabs   []string               `json:"prefabs,omitempty" yaml:"prefabs,omitempty"`
+	Resources map[string]interface{} `json:"resources,omitempty" yaml:"resources,omitempty"`
+	Entities  []Entity               `json:"entities" yaml:"entities"`
+
+	//The directory of the file the scene was loaded from
+	dir string
+}
+
+//An entity of a scene
+type Entity struct {
+	//Names are optional, they are used to refer to entities as parents and to look up spawned IDs
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	//The prefab the entity is spawned from, its components override the prefabs
+	Prefab string `json:"prefab,omitempty" yaml:"prefab,omitempty"`
+
+	//The name of the parent entity in the same scene
+	Parent string `json:"parent,omitempty" yaml:"parent,omitempty"`
+
+	Components map[string]interface{} `json:"components,omitempty" yaml:"components,omitempty"`
+}
+
+type Format int
+
+const (
+	JSONFormat Format = iota
+	YAMLFormat
+)
+
+//Returns the format of a scene file by its extension
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSONFormat, nil
+	case ".yaml", ".yml":
+		return YAMLFormat, nil
+	}
+	return 0, fmt.Errorf("unknown scene format %s", filepath.Ext(path))
+}
+
+//Reads a scene, unknown fields are errors
+func Decode(r io.Reader, format Format) (*Scene, error) {
+	scene := &Scene{}
+	switch format {
+	case JSONFormat:
+		decoder := json.NewDecoder(r)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(scene); err != nil {
+			return nil, err
+		}
+	case YAMLFormat:
+		decoder := yaml.NewDecoder(r)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(scene); err != nil && err != io.EOF {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown scene format %d", format)
+	}
+	return scene, nil
+}
+
+//Writes the scene in the given format
+func (s *Scene) Encode(w io.Writer, format Format) error {
+	switch format {
+	case JSONFormat:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(s)
+	case YAMLFormat:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(s); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	return fmt.Errorf("unknown scene format %d", format)
+}
+
+//Reads the scene file at path, the format is picked by the extension
+func LoadFile(path string) (*Scene, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scene, err := Decode(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	scene.dir = filepath.Dir(path)
+	return scene, nil
+}
+
+//Writes the scene to the file at path, the format is picked by the extension
+func (s *Scene) SaveFile(path string) error {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.Encode(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+/***************************/
+/*    Component Values     */
+
+//Component values go through encoding/json in both formats, so fields are named
+//the same way in JSON and YAML files and json struct tags apply to both.
+
+//Converts a component to the plain values stored in a scene
+func toData(value component.Component) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+//Decodes the plain values of a scene on top of base
+func fromData(data interface{}, base component.Component) (component.Component, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return component.DecodeComponent(base, func(target interface{}) error {
+		return json.Unmarshal(encoded, target)
+	})
+}
@@ -0,0 +1,170 @@
+package scene
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+	"github.com/stretchr/testify/assert"
+)
+
+type testHealth struct {
+	Health int
+	Max    int
+}
+
+func (t testHealth) GetType() reflect.Type { return reflect.TypeOf(t) }
+func (t testHealth) IsComponent()          {}
+
+type testLevel struct {
+	Level int
+	Name  string
+}
+
+func (t testLevel) GetType() reflect.Type { return reflect.TypeOf(t) }
+func (t testLevel) IsComponent()          {}
+
+func init() {
+	component.MustRegister("SceneHealth", testHealth{Health: 10, Max: 10})
+	component.MustRegister("SceneLevel", testLevel{})
+}
+
+func newTestWorld() world.World {
+	w := world.NewBaseWorld(make(chan []float32, 100), nil)
+	w.RegisterStorage(component.NewDenseStorage[testHealth]())
+	w.RegisterStorage(component.NewResourceStorage(testLevel{Level: 1, Name: "start"}))
+	return w
+}
+
+func getComponent[T component.Component](w world.World, entity component.EntityID) (T, error) {
+	storage, _ := component.GetWriteStorage[T](w.GetDispatcher().GetStorage(component.ReflectType[T]()))
+	return storage.GetComponent(entity)
+}
+
+const testScene = `
+prefabs: [enemies.json]
+resources:
+  SceneLevel: {Level: 3}
+entities:
+  - name: sword
+    parent: player
+    components:
+      Transform: [1, 0, 2, 0, 1, 0, 0, 0, 1]
+  - name: player
+    components:
+      SceneHealth: {Health: 50}
+      Transform: [1, 0, 10, 0, 1, 5, 0, 0, 1]
+  - name: goblin
+    prefab: goblin
+    components:
+      SceneHealth: {Max: 30}
+`
+
+const testPrefabs = `{"prefabs": [{"name": "goblin", "components": {"SceneHealth": {"Health": 20, "Max": 20}}}]}`
+
+func TestSceneLoadAndSave(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "level.yaml"), []byte(testScene), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "enemies.json"), []byte(testPrefabs), 0644))
+
+	loaded, err := LoadFile(filepath.Join(dir, "level.yaml"))
+	assert.NoError(t, err)
+	w := newTestWorld()
+	instance, err := Spawn(w, loaded, nil)
+	assert.NoError(t, err)
+
+	//Resources are set right away, entities on the next tick
+	level, _ := getComponent[testLevel](w, 0)
+	assert.Equal(t, testLevel{3, "start"}, level)
+	assert.NoError(t, w.Maintain())
+
+	player, ok := instance.ID("player")
+	assert.True(t, ok)
+	sword, _ := instance.ID("sword")
+	goblin, _ := instance.ID("goblin")
+	assert.Equal(t, []component.EntityID{sword, player, goblin}, instance.IDs())
+
+	health, err := getComponent[testHealth](w, player)
+	assert.NoError(t, err)
+	assert.Equal(t, testHealth{50, 10}, health, "Left out fields should keep the registered default")
+	health, err = getComponent[testHealth](w, goblin)
+	assert.NoError(t, err)
+	assert.Equal(t, testHealth{20, 30}, health, "Left out fields should keep the prefabs value")
+	parent, err := getComponent[world.Parent](w, sword)
+	assert.NoError(t, err)
+	assert.Equal(t, player, parent.Entity)
+
+	//Saving and loading the world again gives the same entities
+	assert.NoError(t, w.Maintain())
+	captured, err := Capture(w)
+	assert.NoError(t, err)
+	for _, format := range []Format{JSONFormat, YAMLFormat} {
+		var buf bytes.Buffer
+		assert.NoError(t, captured.Encode(&buf, format))
+		decoded, err := Decode(&buf, format)
+		assert.NoError(t, err)
+
+		copied := newTestWorld()
+		copiedInstance, err := Spawn(copied, decoded, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, copied.Maintain())
+		assert.NoError(t, copied.Maintain())
+		ids := copiedInstance.IDs()
+		assert.Equal(t, 3, len(ids))
+
+		level, _ := getComponent[testLevel](copied, 0)
+		assert.Equal(t, testLevel{3, "start"}, level)
+		//Saved entities are named by their original ID
+		copiedIDs := map[component.EntityID]component.EntityID{}
+		for _, original := range instance.IDs() {
+			id, ok := copiedInstance.ID(strconv.Itoa(int(original)))
+			assert.True(t, ok)
+			copiedIDs[original] = id
+			originalHealth, originalErr := getComponent[testHealth](w, original)
+			copiedHealth, copiedErr := getComponent[testHealth](copied, id)
+			assert.Equal(t, originalErr == nil, copiedErr == nil)
+			assert.Equal(t, originalHealth, copiedHealth)
+			originalGlobal, _ := getComponent[world.GlobalTransform](w, original)
+			copiedGlobal, _ := getComponent[world.GlobalTransform](copied, id)
+			assert.Equal(t, originalGlobal, copiedGlobal)
+		}
+		copiedParent, err := getComponent[world.Parent](copied, copiedIDs[sword])
+		assert.NoError(t, err)
+		assert.Equal(t, copiedIDs[player], copiedParent.Entity)
+	}
+}
+
+func TestSceneErrors(t *testing.T) {
+	for _, broken := range []string{
+		"entities: [{components: {NotRegistered: {}}}]",
+		"entities: [{components: {SceneHealth: {Health: lots}}}]",
+		"entities: [{components: {Parent: {Entity: 1}}}]",
+		"entities: [{name: a, parent: b}, {name: b, parent: a}]",
+		"entities: [{name: a, parent: missing}]",
+		"entities: [{name: a}, {name: a}]",
+		"entities: [{prefab: missing}]",
+		"resources: {SceneHealth: {}}",
+		"resources: {SceneLevel: {Level: 5}}\nentities: [{components: {Sprite: {}}}]",
+	} {
+		decoded, err := Decode(strings.NewReader(broken), YAMLFormat)
+		assert.NoError(t, err, broken)
+		w := newTestWorld()
+		_, err = Spawn(w, decoded, nil)
+		assert.Error(t, err, broken)
+		level, _ := getComponent[testLevel](w, 0)
+		assert.Equal(t, 1, level.Level, "A failed spawn changed a resource")
+	}
+
+	_, err := Decode(strings.NewReader("entities: [{unknown: 1}]"), YAMLFormat)
+	assert.Error(t, err)
+	_, err = Decode(strings.NewReader(`{"entities": [{"unknown": 1}]}`), JSONFormat)
+	assert.Error(t, err)
+	_, err = FormatFromPath("level.txt")
+	assert.Error(t, err)
+}
@@ -0,0 +1,321 @@
+package scene
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/entity"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//The entities of a spawned scene
+type Instance struct {
+	names   map[string]int
+	results []func() component.EntityID
+	ids     []component.EntityID
+}
+
+//Returns the IDs of the scenes entities in scene order. The entities are created
+//during the next Maintain, this blocks until then.
+func (i *Instance) IDs() []component.EntityID {
+	for len(i.ids) < len(i.results) {
+		i.ids = append(i.ids, i.results[len(i.ids)]())
+	}
+	return i.ids
+}
+
+//Returns the ID of the named entity, blocks like IDs
+func (i *Instance) ID(name string) (component.EntityID, bool) {
+	index, ok := i.names[name]
+	if !ok {
+		return 0, false
+	}
+	return i.IDs()[index], true
+}
+
+//Spawns the scene into w. Resources are set immediately and the entities are
+//queued with Dispatcher.Spawn, so they are created during the next Maintain.
+//The referenced prefab files are loaded into prefabs, if it is nil a new
+//library is used. If an error is returned no resource is set and no entity is
+//queued, but the prefab files loaded before the error stay in prefabs.
+func Spawn(w world.World, s *Scene, prefabs *entity.PrefabLibrary) (*Instance, error) {
+	d := w.GetDispatcher()
+	if prefabs == nil {
+		prefabs = entity.NewPrefabLibrary(d)
+	}
+	for _, path := range s.Prefabs {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.dir, path)
+		}
+		if err := prefabs.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	//Resources are decoded on top of their current value
+	resources := map[component.ResourceValueStorage]component.Component{}
+	for _, name := range sortedKeys(s.Resources) {
+		storage, err := getStorage(d, name)
+		if err != nil {
+			return nil, fmt.Errorf("resource %s: %w", name, err)
+		}
+		resource, ok := storage.(component.ResourceValueStorage)
+		if !ok {
+			return nil, fmt.Errorf("resource %s is not stored as a resource", name)
+		}
+		value, err := fromData(s.Resources[name], resource.GetResource())
+		if err != nil {
+			return nil, fmt.Errorf("resource %s: %w", name, err)
+		}
+		resources[resource] = value
+	}
+
+	roots, instance, err := buildEntities(d, s, prefabs)
+	if err != nil {
+		return nil, err
+	}
+	for resource, value := range resources {
+		if err := resource.SetResource(value); err != nil {
+			return nil, err
+		}
+	}
+	for _, data := range roots {
+		d.Spawn(data)
+	}
+	return instance, nil
+}
+
+//Builds the creation data of every root entity with its children nested inside
+func buildEntities(d world.Dispatcher, s *Scene, prefabs *entity.PrefabLibrary) ([]world.EntityCreationData, *Instance, error) {
+	instance := &Instance{names: map[string]int{}, results: make([]func() component.EntityID, len(s.Entities))}
+	for i, v := range s.Entities {
+		if v.Name == "" {
+			continue
+		}
+		if _, ok := instance.names[v.Name]; ok {
+			return nil, nil, fmt.Errorf("entity name %s is used twice", v.Name)
+		}
+		instance.names[v.Name] = i
+	}
+	children := map[int][]int{}
+	var roots []int
+	for i, v := range s.Entities {
+		if v.Parent == "" {
+			roots = append(roots, i)
+			continue
+		}
+		parent, ok := instance.names[v.Parent]
+		if !ok {
+			return nil, nil, fmt.Errorf("entity %s has the unknown parent %s", describe(v, i), v.Parent)
+		}
+		children[parent] = append(children[parent], i)
+	}
+
+	built := 0
+	var build func(i int) (world.EntityCreationData, error)
+	build = func(i int) (world.EntityCreationData, error) {
+		built++
+		data, result, err := buildEntity(d, s.Entities[i], prefabs)
+		if err != nil {
+			return world.EntityCreationData{}, fmt.Errorf("entity %s: %w", describe(s.Entities[i], i), err)
+		}
+		instance.results[i] = result
+		for _, child := range children[i] {
+			childData, err := build(child)
+			if err != nil {
+				return world.EntityCreationData{}, err
+			}
+			data.Children = append(data.Children, childData)
+		}
+		return data, nil
+	}
+	var rootData []world.EntityCreationData
+	for _, i := range roots {
+		data, err := build(i)
+		if err != nil {
+			return nil, nil, err
+		}
+		rootData = append(rootData, data)
+	}
+	//Entities in a parent cycle are never reached from a root
+	if built != len(s.Entities) {
+		return nil, nil, fmt.Errorf("the parents of %d entities form a cycle", len(s.Entities)-built)
+	}
+	return rootData, instance, nil
+}
+
+func buildEntity(d world.Dispatcher, e Entity, prefabs *entity.PrefabLibrary) (world.EntityCreationData, func() component.EntityID, error) {
+	var inherited []component.Component
+	if e.Prefab != "" {
+		var err error
+		inherited, _, err = prefabs.Resolve(e.Prefab)
+		if err != nil {
+			return world.EntityCreationData{}, nil, err
+		}
+	}
+
+	var components []component.Component
+	for _, name := range sortedKeys(e.Components) {
+		componentType, ok := component.LookupType(name)
+		if !ok {
+			return world.EntityCreationData{}, nil, fmt.Errorf("component %s is not registered", name)
+		}
+		if componentType == component.ReflectType[world.Parent]() {
+			return world.EntityCreationData{}, nil, fmt.Errorf("use the parent field instead of a %s component", name)
+		}
+		base, err := component.NewByName(name)
+		if err != nil {
+			return world.EntityCreationData{}, nil, err
+		}
+		for _, v := range inherited {
+			if v.GetType() == componentType {
+				base = v
+			}
+		}
+		value, err := fromData(e.Components[name], base)
+		if err != nil {
+			return world.EntityCreationData{}, nil, fmt.Errorf("component %s: %w", name, err)
+		}
+		components = append(components, value)
+	}
+
+	if e.Prefab != "" {
+		data, spawned, err := prefabs.Build(e.Prefab, 1, components...)
+		if err != nil {
+			return world.EntityCreationData{}, nil, err
+		}
+		return data, func() component.EntityID { return spawned.IDs()[0] }, nil
+	}
+
+	var writeables []world.StorageWriteable
+	for _, c := range components {
+		storage := d.GetStorage(c.GetType())
+		if storage == nil {
+			return world.EntityCreationData{}, nil, fmt.Errorf("there is no storage for %s", c.GetType())
+		}
+		writeables = append(writeables, world.MakeComponentWriteable(c, storage))
+	}
+	created := make(chan component.EntityID, 1)
+	var id *component.EntityID
+	result := func() component.EntityID {
+		if id == nil {
+			received := <-created
+			id = &received
+		}
+		return *id
+	}
+	return world.EntityCreationData{NumEntities: 1, Components: writeables, CreatedEntitiesCallback: created}, result, nil
+}
+
+/***************************/
+/*         Saving          */
+
+//Captures the registered resources and components of every entity in w.
+//Entities are named by their ID and Parent components become parent fields.
+//Storages of unregistered types are skipped, as are unexported fields, which
+//get their default value back when the scene is loaded. Capture must not be
+//called while the world is running Maintain.
+func Capture(w world.World) (*Scene, error) {
+	d := w.GetDispatcher()
+	s := &Scene{Resources: map[string]interface{}{}}
+	entities := d.GetEntities()
+	living := map[component.EntityID]bool{}
+	for _, e := range entities {
+		living[e] = true
+	}
+
+	type namedStorage struct {
+		name    string
+		storage component.ValueStorage
+		exists  func(component.EntityID) bool
+	}
+	var storages []namedStorage
+	parentType := component.ReflectType[world.Parent]()
+	var parents component.ComponentStorage
+	for _, storage := range d.GetStorages() {
+		name, ok := component.LookupName(storage.GetType())
+		if !ok {
+			continue
+		}
+		if resource, ok := storage.(component.ResourceValueStorage); ok {
+			data, err := toData(resource.GetResource())
+			if err != nil {
+				return nil, fmt.Errorf("resource %s: %w", name, err)
+			}
+			s.Resources[name] = data
+			continue
+		}
+		if storage.GetType() == parentType {
+			parents = storage
+			continue
+		}
+		if values, ok := storage.(component.ValueStorage); ok {
+			storages = append(storages, namedStorage{name, values, storage.Exists})
+		}
+	}
+	sort.Slice(storages, func(i, j int) bool { return storages[i].name < storages[j].name })
+
+	for _, e := range entities {
+		saved := Entity{Name: strconv.Itoa(int(e)), Components: map[string]interface{}{}}
+		if parents != nil && parents.Exists(e) {
+			value, err := parents.(component.ValueStorage).GetValue(e)
+			if err != nil {
+				return nil, err
+			}
+			if parent := value.(world.Parent).Entity; living[parent] {
+				saved.Parent = strconv.Itoa(int(parent))
+			}
+		}
+		for _, storage := range storages {
+			if !storage.exists(e) {
+				continue
+			}
+			value, err := storage.storage.GetValue(e)
+			if err != nil {
+				return nil, err
+			}
+			data, err := toData(value)
+			if err != nil {
+				return nil, fmt.Errorf("entity %d component %s: %w", e, storage.name, err)
+			}
+			saved.Components[storage.name] = data
+		}
+		s.Entities = append(s.Entities, saved)
+	}
+	return s, nil
+}
+
+/***************************/
+/*        Helpers          */
+
+func getStorage(d world.Dispatcher, name string) (component.ComponentStorage, error) {
+	storageType, ok := component.LookupType(name)
+	if !ok {
+		return nil, fmt.Errorf("component %s is not registered", name)
+	}
+	storage := d.GetStorage(storageType)
+	if storage == nil {
+		return nil, fmt.Errorf("there is no storage for %s", storageType)
+	}
+	return storage, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//Names an entity in errors
+func describe(e Entity, index int) string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return fmt.Sprintf("#%d", index)
+}
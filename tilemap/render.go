@@ -0,0 +1,254 @@
+package tilemap
+
+import (
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/linmath"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//Adds the Tilemap and Object storages and the tilemap service. The Quads
+//storage and the Viewport resource are added as well if the dispatcher does not
+//have them yet.
+func AddTilemaps(d world.Dispatcher) error {
+	if err := d.AddStorage(component.NewVectorStorage[Tilemap]()); err != nil {
+		return err
+	}
+	if err := d.AddStorage(component.NewVectorStorage[Object]()); err != nil {
+		return err
+	}
+	if d.GetStorage(component.ReflectType[world.Quads]()) == nil {
+		if err := d.AddStorage(component.NewVectorStorage[world.Quads]()); err != nil {
+			return err
+		}
+	}
+	if d.GetStorage(component.ReflectType[world.Viewport]()) == nil {
+		if err := d.AddStorage(component.NewResourceStorage(world.Viewport{})); err != nil {
+			return err
+		}
+	}
+	return d.AddService(NewTilemapService())
+}
+
+//Identifies the vertices of a chunk. Chunks are never changed in place, so the
+//vertices stay valid as long as the chunk, the tilesets and the placement are
+//the same.
+type chunkKey struct {
+	chunk    *chunk
+	tilesets *tilesets
+	x, y, z  float64
+	//The number of tiles of the chunk that are inside the layer
+	columns, rows         int
+	tileWidth, tileHeight int
+	color                 [4]uint8
+}
+
+//Builds the Quads of tilemaps from their visible chunks
+type tilemapRenderer struct {
+	cache map[chunkKey][]float32
+	//The chunks each entity was last drawn with
+	drawn map[component.EntityID][]chunkKey
+}
+
+//Creates the service that draws every Tilemap into the Quads of its entity.
+//Only chunks that overlap the Viewport are drawn. The vertices of each chunk
+//are cached until the chunk is changed or removed, so a static map only costs
+//a copy of the visible vertices each tick. It runs in the PostUpdateStage.
+func NewTilemapService() world.Service {
+	service := world.NewBaseService("tilemap")
+	service.SetStage(world.PostUpdateStage)
+	service.AddRequiredAccessComponent(world.NewComponentAccess[Tilemap](world.ReadAccess))
+	service.AddRequiredAccessComponent(world.NewComponentAccess[world.Viewport](world.ReadAccess))
+	service.AddRequiredAccessComponent(world.NewComponentAccess[world.Quads](world.WriteAccess))
+	renderer := &tilemapRenderer{cache: map[chunkKey][]float32{}, drawn: map[component.EntityID][]chunkKey{}}
+	service.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		tilemaps, err := world.GetReadStorage[Tilemap](service)
+		if err != nil {
+			return err
+		}
+		quads, err := world.GetWriteStorage[world.Quads](service)
+		if err != nil {
+			return err
+		}
+		viewport := world.Viewport{}
+		if viewports, err := world.GetReadStorage[world.Viewport](service); err == nil {
+			viewport = viewports.MustGetComponent(0)
+		}
+		return renderer.run(tilemaps, viewport, quads)
+	})
+	return service
+}
+
+func (r *tilemapRenderer) run(tilemaps component.ReadOnlyStorage[Tilemap], viewport world.Viewport, quads component.WriteStorage[world.Quads]) error {
+	alive := map[chunkKey]bool{}
+	for _, e := range tilemaps.GetEntities() {
+		tilemap := tilemaps.MustGetComponent(e)
+		visible := r.visibleChunks(tilemap, viewport, alive)
+		if quads.Exists(e) && sameKeys(r.drawn[e], visible) {
+			continue
+		}
+		vertices := []float32{}
+		for _, key := range visible {
+			vertices = append(vertices, r.vertices(key)...)
+		}
+		r.drawn[e] = visible
+		if quads.Exists(e) {
+			if err := quads.Write(e, world.Quads{Vertices: vertices}); err != nil {
+				return err
+			}
+		} else if err := quads.AddEntity(e, world.Quads{Vertices: vertices}); err != nil {
+			return err
+		}
+	}
+
+	//Quads of maps that were removed are cleared, other services may still use
+	//the Quads of the entity
+	for e := range r.drawn {
+		if tilemaps.Exists(e) {
+			continue
+		}
+		delete(r.drawn, e)
+		if quads.Exists(e) {
+			if err := quads.Write(e, world.Quads{}); err != nil {
+				return err
+			}
+		}
+	}
+	for key := range r.cache {
+		if !alive[key] {
+			delete(r.cache, key)
+		}
+	}
+	return nil
+}
+
+//Returns the keys of the chunks to draw in order and marks every chunk of the
+//map in alive, so chunks that are only off screen stay cached
+func (r *tilemapRenderer) visibleChunks(tilemap Tilemap, viewport world.Viewport, alive map[chunkKey]bool) []chunkKey {
+	visible := []chunkKey{}
+	if tilemap.Hidden || tilemap.TileWidth <= 0 || tilemap.TileHeight <= 0 {
+		return visible
+	}
+	//Tiles of tilesets can be bigger than the grid, they grow up and right
+	overhangX, overhangY := 0, 0
+	for _, set := range tilemap.Tilesets() {
+		if over := set.TileWidth - tilemap.TileWidth; over > overhangX {
+			overhangX = over
+		}
+		if over := set.TileHeight - tilemap.TileHeight; over > overhangY {
+			overhangY = over
+		}
+	}
+	chunkWidth := float64(ChunkSize * tilemap.TileWidth)
+	chunkHeight := float64(ChunkSize * tilemap.TileHeight)
+	for _, layer := range tilemap.layers {
+		if layer.Hidden {
+			continue
+		}
+		columns := chunksFor(layer.width)
+		for i, c := range layer.chunks {
+			if c == nil {
+				continue
+			}
+			cx, cy := i%columns, i/columns
+			key := chunkKey{
+				chunk:      c,
+				tilesets:   tilemap.tilesets,
+				x:          tilemap.X + layer.OffsetX + float64(cx)*chunkWidth,
+				y:          tilemap.Y + layer.OffsetY + float64(cy)*chunkHeight,
+				z:          tilemap.Z + layer.Z,
+				columns:    minInt(ChunkSize, layer.width-cx*ChunkSize),
+				rows:       minInt(ChunkSize, layer.height-cy*ChunkSize),
+				tileWidth:  tilemap.TileWidth,
+				tileHeight: tilemap.TileHeight,
+				color:      layer.Color,
+			}
+			alive[key] = true
+			if viewport.Overlaps(key.x, key.y-float64(overhangY), chunkWidth+float64(overhangX), chunkHeight+float64(overhangY)) {
+				visible = append(visible, key)
+			}
+		}
+	}
+	return visible
+}
+
+//Returns the cached vertices of a chunk, building them if needed
+func (r *tilemapRenderer) vertices(key chunkKey) []float32 {
+	if vertices, ok := r.cache[key]; ok {
+		return vertices
+	}
+	var sets []Tileset
+	if key.tilesets != nil {
+		sets = key.tilesets.sets
+	}
+	vertices := []float32{}
+	for y := 0; y < key.rows; y++ {
+		for x := 0; x < key.columns; x++ {
+			gid := key.chunk[y*ChunkSize+x]
+			if gid&^FlipFlags == 0 {
+				continue
+			}
+			for _, set := range sets {
+				if set.Contains(gid) {
+					//Tiles sit on the bottom left corner of their cell like in Tiled
+					left := key.x + float64(x*key.tileWidth)
+					bottom := key.y + float64((y+1)*key.tileHeight)
+					vertices = appendTile(vertices, set, gid, left, bottom-float64(set.TileHeight), key.z, key.color)
+					break
+				}
+			}
+		}
+	}
+	r.cache[key] = vertices
+	return vertices
+}
+
+//Appends the quad of one tile with its top left corner at x, y
+func appendTile(vertices []float32, set Tileset, gid uint32, x, y, z float64, color [4]uint8) []float32 {
+	texX, texY, texW, texH := set.TexCoords(gid)
+	for i := 0; i < 4; i++ {
+		//(0,0),(1,0),(0,1),(1,1) like Renderables
+		cornerX, cornerY := float32(i%2), float32(i/2)
+		u, v := cornerX, cornerY
+		//Tiled flips the image diagonally first, then horizontally and
+		//vertically, so the texture coordinates are flipped the other way round
+		if gid&FlippedHorizontally != 0 {
+			u = 1 - u
+		}
+		if gid&FlippedVertically != 0 {
+			v = 1 - v
+		}
+		if gid&FlippedDiagonally != 0 {
+			u, v = v, u
+		}
+		vert := linmath.EmptyVertice()
+		vert.SetColor(color)
+		vert.SetMap(uint32(set.Region.Page))
+		vert.SetTexX(texX + texW*u)
+		vert.SetTexY(texY + texH*v)
+		vert.SetX(float32(x) + cornerX*float32(set.TileWidth))
+		vert.SetY(float32(y) + cornerY*float32(set.TileHeight))
+		vert.SetZ(float32(z))
+		floats := vert.ToFloats()
+		vertices = append(vertices, floats[:]...)
+	}
+	return vertices
+}
+
+func sameKeys(a, b []chunkKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,565 @@
+package tilemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/file"
+	"github.com/jevans40/Ruthenium/render"
+	"github.com/jevans40/Ruthenium/scene"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//The name of the tilemap entity in scenes made by TiledMap.Scene
+const MapEntityName = "tilemap"
+
+//Returned for Tiled features the importer does not handle
+var UnsupportedTiledError = errors.New("unsupported by the tiled importer")
+
+//A map made with the Tiled editor, read from a TMX or TMJ file. Group layers
+//are flattened into the layers they hold.
+type TiledMap struct {
+	Width, Height         int
+	TileWidth, TileHeight int
+	Properties            []Property
+	//The Image of each tileset is the slash separated path of its image file,
+	//relative to the file system the map was loaded from
+	Tilesets []Tileset
+	Layers   []TiledLayer
+	//The tileset images read by LoadTiled by their path
+	Images map[string]*image.RGBA
+}
+
+//A tile or object layer of a TiledMap
+type TiledLayer struct {
+	Name string
+	//True for object layers, which have Objects instead of Tiles
+	ObjectLayer      bool
+	OffsetX, OffsetY float64
+	Hidden           bool
+	Opacity          float64
+	Tint             [4]uint8
+	Properties       []Property
+	//The global tile IDs of a tile layer in rows, the size is the map size
+	Tiles   []uint32
+	Objects []TiledObject
+}
+
+//An object of an object layer
+type TiledObject struct {
+	ID    int
+	Name  string
+	Class string
+	//The position in pixels, the top left corner of shapes and the bottom left
+	//corner of tile objects
+	X, Y          float64
+	Width, Height float64
+	//Clockwise in degrees around X, Y
+	Rotation float64
+	//The tile of a tile object, 0 for shapes
+	GID        uint32
+	Hidden     bool
+	Shape      string
+	Points     [][2]float64
+	Properties []Property
+}
+
+//The shapes of objects
+const (
+	RectangleShape = "rectangle"
+	EllipseShape   = "ellipse"
+	PointShape     = "point"
+	PolygonShape   = "polygon"
+	PolylineShape  = "polyline"
+)
+
+//A custom property. Value is a string, int, float64 or bool, the members of
+//class properties are a map[string]interface{}.
+type Property struct {
+	Name string
+	//The Tiled type, string, int, float, bool, color, file, object or class
+	Type string
+	//The name of the custom type of class properties
+	PropertyType string
+	Value        interface{}
+}
+
+/***************************/
+/*         Loading         */
+
+//Reads a Tiled map from fsys, the format is picked by the extension: .tmx maps
+//are XML and .tmj or .json maps are JSON. External tilesets and the tileset
+//images are read relative to the map.
+func LoadTiled(fsys fs.FS, name string) (*TiledMap, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	dir := path.Dir(name)
+	readTileset := func(source string) (Tileset, error) {
+		tilesetPath := path.Join(dir, source)
+		data, err := fs.ReadFile(fsys, tilesetPath)
+		if err != nil {
+			return Tileset{}, err
+		}
+		var set Tileset
+		if strings.EqualFold(path.Ext(source), ".tsx") {
+			set, err = parseTSX(data)
+		} else {
+			set, err = parseTSJ(data)
+		}
+		if err != nil {
+			return Tileset{}, fmt.Errorf("%s: %w", tilesetPath, err)
+		}
+		//Images of external tilesets are relative to the tileset
+		if set.Image != "" {
+			set.Image = path.Join(path.Dir(source), set.Image)
+		}
+		return set, nil
+	}
+
+	var m *TiledMap
+	switch strings.ToLower(path.Ext(name)) {
+	case ".tmx":
+		m, err = parseTMX(data, readTileset)
+	case ".tmj", ".json":
+		m, err = parseTMJ(data, readTileset)
+	default:
+		return nil, fmt.Errorf("%s: unknown map format: %w", name, UnsupportedTiledError)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	m.Images = map[string]*image.RGBA{}
+	for i, set := range m.Tilesets {
+		m.Tilesets[i].Image = path.Join(dir, set.Image)
+		if _, ok := m.Images[m.Tilesets[i].Image]; ok {
+			continue
+		}
+		img, err := file.ReadImageFS(fsys, m.Tilesets[i].Image)
+		if err != nil {
+			return nil, err
+		}
+		m.Images[m.Tilesets[i].Image] = img
+	}
+	return m, nil
+}
+
+//Parses a map in Tiled's XML format. Maps with external tilesets have to be
+//read with LoadTiled.
+func ParseTMX(data []byte) (*TiledMap, error) {
+	return parseTMX(data, noExternalTilesets)
+}
+
+//Parses a map in Tiled's JSON format. Maps with external tilesets have to be
+//read with LoadTiled.
+func ParseTMJ(data []byte) (*TiledMap, error) {
+	return parseTMJ(data, noExternalTilesets)
+}
+
+func noExternalTilesets(source string) (Tileset, error) {
+	return Tileset{}, fmt.Errorf("external tileset %s needs LoadTiled", source)
+}
+
+//Adds the tileset images to the atlas, it has to be packed afterwards
+func (m *TiledMap) AddToAtlas(atlas *render.ImageAtlas) {
+	names := make([]string, 0, len(m.Images))
+	for name := range m.Images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		atlas.AddImageFromImage(m.Images[name], name)
+	}
+}
+
+/***************************/
+/*     Building scenes     */
+
+//Returns the tile layers as a Tilemap with its tilesets bound to the packed
+//atlas. Each layer is LayerDepth in front of the one before.
+func (m *TiledMap) Tilemap(atlas *render.ImageAtlas) (Tilemap, error) {
+	tilemap := NewTilemap(m.TileWidth, m.TileHeight)
+	tilemap.SetTilesets(m.Tilesets...)
+	if err := tilemap.Bind(atlas); err != nil {
+		return Tilemap{}, err
+	}
+	for _, l := range m.Layers {
+		if l.ObjectLayer {
+			continue
+		}
+		layer := NewLayer(l.Name, m.Width, m.Height)
+		layer.OffsetX, layer.OffsetY, layer.Hidden = l.OffsetX, l.OffsetY, l.Hidden
+		layer.Z = -float64(tilemap.LayerCount()) * LayerDepth
+		layer.Color = l.Tint
+		layer.Color[3] = uint8(math.Round(float64(l.Tint[3]) * clamp01(l.Opacity)))
+		if err := layer.SetTiles(l.Tiles); err != nil {
+			return Tilemap{}, err
+		}
+		tilemap.AppendLayer(layer)
+	}
+	return tilemap, nil
+}
+
+//Builds a scene with the map as the Tilemap of an entity named MapEntityName
+//and an entity for every object. Objects get an Object and a Transform
+//placing them in map pixels, tile objects also get a Renderable showing their
+//tile. Properties of the map go to the tilemap entity and properties of object
+//layers and objects go to the objects, see Components for how they become
+//components. Objects with a unique name keep it as their entity name.
+func (m *TiledMap) Scene(atlas *render.ImageAtlas) (*scene.Scene, error) {
+	tilemap, err := m.Tilemap(atlas)
+	if err != nil {
+		return nil, err
+	}
+	mapComponents, err := Components(m.Properties)
+	if err != nil {
+		return nil, fmt.Errorf("map properties: %w", err)
+	}
+	data, err := toSceneData(tilemap)
+	if err != nil {
+		return nil, err
+	}
+	mapComponents["Tilemap"] = data
+	s := &scene.Scene{Entities: []scene.Entity{{Name: MapEntityName, Components: mapComponents}}}
+
+	names := map[string]int{MapEntityName: 1}
+	for _, layer := range m.Layers {
+		for _, object := range layer.Objects {
+			names[object.Name]++
+		}
+	}
+	for _, layer := range m.Layers {
+		if !layer.ObjectLayer {
+			continue
+		}
+		for _, object := range layer.Objects {
+			//Object properties override the ones of their layer
+			properties := append(append([]Property{}, layer.Properties...), object.Properties...)
+			components, err := Components(properties)
+			if err != nil {
+				return nil, fmt.Errorf("object %d: %w", object.ID, err)
+			}
+			if err := m.addObjectComponents(components, layer, object, properties, &tilemap); err != nil {
+				return nil, fmt.Errorf("object %d: %w", object.ID, err)
+			}
+			entity := scene.Entity{Components: components}
+			if object.Name != "" && names[object.Name] == 1 {
+				entity.Name = object.Name
+			}
+			s.Entities = append(s.Entities, entity)
+		}
+	}
+	return s, nil
+}
+
+func (m *TiledMap) addObjectComponents(components map[string]interface{}, layer TiledLayer, object TiledObject, properties []Property, tilemap *Tilemap) error {
+	unmapped := map[string]interface{}{}
+	for _, p := range properties {
+		if !mapsToComponent(p) {
+			unmapped[p.Name] = p.Value
+		}
+	}
+	data, err := toSceneData(Object{
+		ID: object.ID, Name: object.Name, Class: object.Class, Width: object.Width, Height: object.Height,
+		Shape: object.Shape, Points: object.Points, Properties: unmapped,
+	})
+	if err != nil {
+		return err
+	}
+	components["TiledObject"] = data
+
+	x, y := object.X+layer.OffsetX, object.Y+layer.OffsetY
+	transform := world.NewTransform().Translate(x, y).Rotate(object.Rotation * math.Pi / 180)
+	if object.GID != 0 {
+		set, ok := tilemap.TilesetOf(object.GID)
+		if !ok {
+			return fmt.Errorf("tile %d has no tileset", object.GID&^FlipFlags)
+		}
+		//Renderables are centered on their position and tile objects sit on
+		//their bottom left corner
+		transform = transform.Translate(object.Width/2, -object.Height/2).Scale(object.Width, object.Height)
+		texX, texY, texW, texH := set.TexCoords(object.GID)
+		if object.GID&FlippedHorizontally != 0 {
+			texX, texW = texX+texW, -texW
+		}
+		if object.GID&FlippedVertically != 0 {
+			texY, texH = texY+texH, -texH
+		}
+		alpha := uint8(255)
+		if object.Hidden || layer.Hidden {
+			alpha = 0
+		}
+		renderable := world.NewRenderable()
+		renderable.TexX, renderable.TexY, renderable.TexW, renderable.TexH = texX, texY, texW, texH
+		renderable.TexM = float32(set.Region.Page)
+		renderable.Color = [4]uint8{255, 255, 255, alpha}
+		if components["Renderable"], err = mergeSceneData(renderable, components["Renderable"]); err != nil {
+			return err
+		}
+	}
+	components["Transform"], err = mergeSceneData(transform, components["Transform"])
+	return err
+}
+
+/***************************/
+/*       Properties        */
+
+//Turns properties into scene component data. A property maps to a component
+//if it is
+//
+//	a class property whose custom type is named like a registered component,
+//	its members are the fields of the component
+//	named Component.Field after a registered component, it sets that field
+//	named like a registered component and holds a JSON string, the whole
+//	component is decoded from it
+//
+//Later properties override the fields set by earlier ones. Other properties
+//are left out. Returns an error if a class property mapping to a component
+//does not hold its members or a JSON property can not be decoded.
+func Components(properties []Property) (map[string]interface{}, error) {
+	components := map[string]interface{}{}
+	fields := func(name string) map[string]interface{} {
+		existing, ok := components[name].(map[string]interface{})
+		if !ok {
+			existing = map[string]interface{}{}
+			components[name] = existing
+		}
+		return existing
+	}
+	for _, p := range properties {
+		if !mapsToComponent(p) {
+			continue
+		}
+		if p.Type == "class" {
+			members, ok := p.Value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("class property %s holds a %T instead of the members of %s", p.Name, p.Value, p.PropertyType)
+			}
+			target := fields(p.PropertyType)
+			for k, v := range members {
+				target[k] = v
+			}
+			continue
+		}
+		if name, field, ok := strings.Cut(p.Name, "."); ok {
+			fields(name)[field] = p.Value
+			continue
+		}
+		encoded, ok := p.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("property %s holds a %T instead of a JSON string", p.Name, p.Value)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(encoded), &value); err != nil {
+			return nil, fmt.Errorf("property %s: %w", p.Name, err)
+		}
+		components[p.Name] = value
+	}
+	return components, nil
+}
+
+func mapsToComponent(p Property) bool {
+	if p.Type == "class" {
+		_, ok := component.LookupType(p.PropertyType)
+		return ok
+	}
+	if name, _, ok := strings.Cut(p.Name, "."); ok {
+		_, registered := component.LookupType(name)
+		return registered
+	}
+	if _, ok := p.Value.(string); !ok {
+		return false
+	}
+	_, ok := component.LookupType(p.Name)
+	return ok
+}
+
+//Converts a value to the plain data scenes hold
+func toSceneData(value interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	err = json.Unmarshal(encoded, &data)
+	return data, err
+}
+
+//Converts value to scene data with the fields of override on top
+func mergeSceneData(value interface{}, override interface{}) (interface{}, error) {
+	data, err := toSceneData(value)
+	if err != nil || override == nil {
+		return data, err
+	}
+	fields, ok := data.(map[string]interface{})
+	overrides, isMap := override.(map[string]interface{})
+	if !ok || !isMap {
+		return override, nil
+	}
+	for k, v := range overrides {
+		fields[k] = v
+	}
+	return fields, nil
+}
+
+/***************************/
+/*     Object component    */
+
+//The component of entities made from Tiled objects, see TiledObject for the
+//fields. Properties holds the properties that did not become components.
+type Object struct {
+	ID            int
+	Name          string
+	Class         string
+	Width, Height float64
+	Shape         string
+	Points        [][2]float64
+	Properties    map[string]interface{}
+}
+
+func (o Object) GetType() reflect.Type { return reflect.TypeOf(o) }
+func (o Object) IsComponent()          {}
+
+func init() {
+	component.MustRegister("TiledObject", Object{})
+}
+
+/***************************/
+/*        Decoding         */
+
+//Decodes the tile data of a layer. encoding is "" or "csv" for plain numbers
+//and "base64" for little endian numbers, which can be zlib or gzip compressed.
+func decodeTiles(encoding, compression, data string, count int) ([]uint32, error) {
+	var tiles []uint32
+	switch encoding {
+	case "", "csv":
+		for _, field := range strings.Split(data, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			gid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			tiles = append(tiles, uint32(gid))
+		}
+	case "base64":
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+		if err != nil {
+			return nil, err
+		}
+		var reader io.Reader = bytes.NewReader(raw)
+		switch compression {
+		case "":
+		case "zlib":
+			if reader, err = zlib.NewReader(reader); err != nil {
+				return nil, err
+			}
+		case "gzip":
+			if reader, err = gzip.NewReader(reader); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s compression: %w", compression, UnsupportedTiledError)
+		}
+		if raw, err = io.ReadAll(reader); err != nil {
+			return nil, err
+		}
+		if len(raw)%4 != 0 {
+			return nil, errors.New("tile data is not a whole number of tiles")
+		}
+		tiles = make([]uint32, len(raw)/4)
+		for i := range tiles {
+			tiles[i] = binary.LittleEndian.Uint32(raw[i*4:])
+		}
+	default:
+		return nil, fmt.Errorf("%s encoding: %w", encoding, UnsupportedTiledError)
+	}
+	if len(tiles) != count {
+		return nil, fmt.Errorf("layer has %d tiles instead of %d", len(tiles), count)
+	}
+	return tiles, nil
+}
+
+//Converts a property value given as text, TMX stores every value that way
+func propertyValue(propertyType, value string) (interface{}, error) {
+	switch propertyType {
+	case "int", "object":
+		return strconv.Atoi(value)
+	case "float":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	}
+	return value, nil
+}
+
+//Parses Tileds #AARRGGBB and #RRGGBB colors into RGBA
+func parseColor(value string) ([4]uint8, error) {
+	value = strings.TrimPrefix(value, "#")
+	if len(value) == 6 {
+		value = "ff" + value
+	}
+	parsed, err := strconv.ParseUint(value, 16, 32)
+	if err != nil || len(value) != 8 {
+		return [4]uint8{}, fmt.Errorf("invalid color %q", value)
+	}
+	return [4]uint8{uint8(parsed >> 16), uint8(parsed >> 8), uint8(parsed), uint8(parsed >> 24)}, nil
+}
+
+func clamp01(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+//Checks the parts of a map the importer can not handle
+func checkMap(orientation string, infinite bool, sets []Tileset) error {
+	if orientation != "" && orientation != "orthogonal" {
+		return fmt.Errorf("%s maps: %w", orientation, UnsupportedTiledError)
+	}
+	if infinite {
+		return fmt.Errorf("infinite maps: %w", UnsupportedTiledError)
+	}
+	for _, set := range sets {
+		if set.Image == "" {
+			return fmt.Errorf("tileset %s has no single image: %w", set.Name, UnsupportedTiledError)
+		}
+	}
+	return nil
+}
+
+//Flattens a group layer into its children, offsets add up and visibility and
+//opacity are inherited
+func inherit(layers []TiledLayer, group TiledLayer) []TiledLayer {
+	for i := range layers {
+		layers[i].OffsetX += group.OffsetX
+		layers[i].OffsetY += group.OffsetY
+		layers[i].Hidden = layers[i].Hidden || group.Hidden
+		layers[i].Opacity *= group.Opacity
+	}
+	return layers
+}
@@ -0,0 +1,538 @@
+package tilemap
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//Reads the external tileset at source, which is relative to the map
+type tilesetReader func(source string) (Tileset, error)
+
+/***************************/
+/*           TMX           */
+
+type tmxProperty struct {
+	Name         string        `xml:"name,attr"`
+	Type         string        `xml:"type,attr"`
+	PropertyType string        `xml:"propertytype,attr"`
+	Value        *string       `xml:"value,attr"`
+	Text         string        `xml:",chardata"`
+	Properties   []tmxProperty `xml:"properties>property"`
+}
+
+type tmxTileset struct {
+	FirstGID   uint32 `xml:"firstgid,attr"`
+	Source     string `xml:"source,attr"`
+	Name       string `xml:"name,attr"`
+	TileWidth  int    `xml:"tilewidth,attr"`
+	TileHeight int    `xml:"tileheight,attr"`
+	Spacing    int    `xml:"spacing,attr"`
+	Margin     int    `xml:"margin,attr"`
+	TileCount  int    `xml:"tilecount,attr"`
+	Columns    int    `xml:"columns,attr"`
+	Image      struct {
+		Source string `xml:"source,attr"`
+	} `xml:"image"`
+}
+
+type tmxObject struct {
+	ID         int           `xml:"id,attr"`
+	Name       string        `xml:"name,attr"`
+	Type       string        `xml:"type,attr"`
+	Class      string        `xml:"class,attr"`
+	X          float64       `xml:"x,attr"`
+	Y          float64       `xml:"y,attr"`
+	Width      float64       `xml:"width,attr"`
+	Height     float64       `xml:"height,attr"`
+	Rotation   float64       `xml:"rotation,attr"`
+	GID        uint32        `xml:"gid,attr"`
+	Visible    *int          `xml:"visible,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+	Ellipse    *struct{}     `xml:"ellipse"`
+	Point      *struct{}     `xml:"point"`
+	Polygon    *tmxPoints    `xml:"polygon"`
+	Polyline   *tmxPoints    `xml:"polyline"`
+}
+
+type tmxPoints struct {
+	Points string `xml:"points,attr"`
+}
+
+//Tile layers, object layers and groups share this, the element name tells
+//them apart
+type tmxLayer struct {
+	XMLName    xml.Name
+	Name       string        `xml:"name,attr"`
+	OffsetX    float64       `xml:"offsetx,attr"`
+	OffsetY    float64       `xml:"offsety,attr"`
+	Opacity    *float64      `xml:"opacity,attr"`
+	Visible    *int          `xml:"visible,attr"`
+	TintColor  string        `xml:"tintcolor,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+	Data       *struct {
+		Encoding    string `xml:"encoding,attr"`
+		Compression string `xml:"compression,attr"`
+		Text        string `xml:",chardata"`
+		Tiles       []struct {
+			GID uint32 `xml:"gid,attr"`
+		} `xml:"tile"`
+	} `xml:"data"`
+	Objects []tmxObject `xml:"object"`
+	Layers  []tmxLayer  `xml:",any"`
+}
+
+type tmxMap struct {
+	Orientation string        `xml:"orientation,attr"`
+	Width       int           `xml:"width,attr"`
+	Height      int           `xml:"height,attr"`
+	TileWidth   int           `xml:"tilewidth,attr"`
+	TileHeight  int           `xml:"tileheight,attr"`
+	Infinite    int           `xml:"infinite,attr"`
+	Properties  []tmxProperty `xml:"properties>property"`
+	Tilesets    []tmxTileset  `xml:"tileset"`
+	Layers      []tmxLayer    `xml:",any"`
+}
+
+func parseTMX(data []byte, readTileset tilesetReader) (*TiledMap, error) {
+	var raw tmxMap
+	if err := xml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	m := &TiledMap{Width: raw.Width, Height: raw.Height, TileWidth: raw.TileWidth, TileHeight: raw.TileHeight}
+	var err error
+	if m.Properties, err = tmxProperties(raw.Properties); err != nil {
+		return nil, err
+	}
+	for _, set := range raw.Tilesets {
+		tileset := set.tileset()
+		if set.Source != "" {
+			if tileset, err = readTileset(set.Source); err != nil {
+				return nil, err
+			}
+		}
+		tileset.FirstGID = set.FirstGID
+		m.Tilesets = append(m.Tilesets, tileset)
+	}
+	if err := checkMap(raw.Orientation, raw.Infinite != 0, m.Tilesets); err != nil {
+		return nil, err
+	}
+	if m.Layers, err = tmxLayers(raw.Layers, m.Width*m.Height); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func parseTSX(data []byte) (Tileset, error) {
+	var raw tmxTileset
+	if err := xml.Unmarshal(data, &raw); err != nil {
+		return Tileset{}, err
+	}
+	return raw.tileset(), nil
+}
+
+func (t tmxTileset) tileset() Tileset {
+	return Tileset{
+		Name: t.Name, Count: t.TileCount, Columns: t.Columns,
+		TileWidth: t.TileWidth, TileHeight: t.TileHeight, Margin: t.Margin, Spacing: t.Spacing,
+		Image: t.Image.Source,
+	}
+}
+
+func tmxLayers(raw []tmxLayer, count int) ([]TiledLayer, error) {
+	layers := []TiledLayer{}
+	for _, l := range raw {
+		layer := TiledLayer{Name: l.Name, OffsetX: l.OffsetX, OffsetY: l.OffsetY, Opacity: 1, Tint: [4]uint8{255, 255, 255, 255}}
+		layer.Hidden = l.Visible != nil && *l.Visible == 0
+		if l.Opacity != nil {
+			layer.Opacity = *l.Opacity
+		}
+		if l.TintColor != "" {
+			var err error
+			if layer.Tint, err = parseColor(l.TintColor); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if layer.Properties, err = tmxProperties(l.Properties); err != nil {
+			return nil, fmt.Errorf("layer %s: %w", l.Name, err)
+		}
+
+		switch l.XMLName.Local {
+		case "layer":
+			if l.Data == nil {
+				return nil, fmt.Errorf("layer %s has no data", l.Name)
+			}
+			if l.Data.Encoding == "" && len(l.Data.Tiles) != 0 {
+				for _, tile := range l.Data.Tiles {
+					layer.Tiles = append(layer.Tiles, tile.GID)
+				}
+				if len(layer.Tiles) != count {
+					return nil, fmt.Errorf("layer %s has %d tiles instead of %d", l.Name, len(layer.Tiles), count)
+				}
+			} else if layer.Tiles, err = decodeTiles(l.Data.Encoding, l.Data.Compression, l.Data.Text, count); err != nil {
+				return nil, fmt.Errorf("layer %s: %w", l.Name, err)
+			}
+		case "objectgroup":
+			layer.ObjectLayer = true
+			for _, o := range l.Objects {
+				object, err := o.object()
+				if err != nil {
+					return nil, fmt.Errorf("layer %s: %w", l.Name, err)
+				}
+				layer.Objects = append(layer.Objects, object)
+			}
+		case "group":
+			children, err := tmxLayers(l.Layers, count)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, inherit(children, layer)...)
+			continue
+		default:
+			//Image layers and editor settings
+			continue
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+func (o tmxObject) object() (TiledObject, error) {
+	object := TiledObject{
+		ID: o.ID, Name: o.Name, Class: o.Class, X: o.X, Y: o.Y, Width: o.Width, Height: o.Height,
+		Rotation: o.Rotation, GID: o.GID, Hidden: o.Visible != nil && *o.Visible == 0, Shape: RectangleShape,
+	}
+	//Tiled before 1.9 called the class type
+	if object.Class == "" {
+		object.Class = o.Type
+	}
+	var err error
+	switch {
+	case o.Ellipse != nil:
+		object.Shape = EllipseShape
+	case o.Point != nil:
+		object.Shape = PointShape
+	case o.Polygon != nil:
+		object.Shape = PolygonShape
+		object.Points, err = parsePoints(o.Polygon.Points)
+	case o.Polyline != nil:
+		object.Shape = PolylineShape
+		object.Points, err = parsePoints(o.Polyline.Points)
+	}
+	if err != nil {
+		return TiledObject{}, fmt.Errorf("object %d: %w", o.ID, err)
+	}
+	if object.Properties, err = tmxProperties(o.Properties); err != nil {
+		return TiledObject{}, fmt.Errorf("object %d: %w", o.ID, err)
+	}
+	return object, nil
+}
+
+//Parses points written as "x1,y1 x2,y2"
+func parsePoints(points string) ([][2]float64, error) {
+	parsed := [][2]float64{}
+	for _, point := range strings.Fields(points) {
+		x, y, ok := strings.Cut(point, ",")
+		if !ok {
+			return nil, fmt.Errorf("invalid point %q", point)
+		}
+		px, err := strconv.ParseFloat(x, 64)
+		if err != nil {
+			return nil, err
+		}
+		py, err := strconv.ParseFloat(y, 64)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, [2]float64{px, py})
+	}
+	return parsed, nil
+}
+
+func tmxProperties(raw []tmxProperty) ([]Property, error) {
+	var properties []Property
+	for _, p := range raw {
+		property := Property{Name: p.Name, Type: p.Type, PropertyType: p.PropertyType}
+		if property.Type == "" {
+			property.Type = "string"
+		}
+		if p.Type == "class" {
+			members, err := tmxProperties(p.Properties)
+			if err != nil {
+				return nil, err
+			}
+			property.Value = propertyMap(members)
+		} else {
+			//Multi line strings are stored as text
+			value := p.Text
+			if p.Value != nil {
+				value = *p.Value
+			}
+			var err error
+			if property.Value, err = propertyValue(property.Type, value); err != nil {
+				return nil, fmt.Errorf("property %s: %w", p.Name, err)
+			}
+		}
+		properties = append(properties, property)
+	}
+	return properties, nil
+}
+
+func propertyMap(properties []Property) map[string]interface{} {
+	members := map[string]interface{}{}
+	for _, p := range properties {
+		members[p.Name] = p.Value
+	}
+	return members
+}
+
+/***************************/
+/*           TMJ           */
+
+type tmjProperty struct {
+	Name         string      `json:"name"`
+	Type         string      `json:"type"`
+	PropertyType string      `json:"propertytype"`
+	Value        interface{} `json:"value"`
+}
+
+type tmjTileset struct {
+	FirstGID   uint32 `json:"firstgid"`
+	Source     string `json:"source"`
+	Name       string `json:"name"`
+	TileWidth  int    `json:"tilewidth"`
+	TileHeight int    `json:"tileheight"`
+	Spacing    int    `json:"spacing"`
+	Margin     int    `json:"margin"`
+	TileCount  int    `json:"tilecount"`
+	Columns    int    `json:"columns"`
+	Image      string `json:"image"`
+}
+
+type tmjPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type tmjObject struct {
+	ID         int           `json:"id"`
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	Class      string        `json:"class"`
+	X          float64       `json:"x"`
+	Y          float64       `json:"y"`
+	Width      float64       `json:"width"`
+	Height     float64       `json:"height"`
+	Rotation   float64       `json:"rotation"`
+	GID        uint32        `json:"gid"`
+	Visible    *bool         `json:"visible"`
+	Ellipse    bool          `json:"ellipse"`
+	Point      bool          `json:"point"`
+	Polygon    []tmjPoint    `json:"polygon"`
+	Polyline   []tmjPoint    `json:"polyline"`
+	Properties []tmjProperty `json:"properties"`
+}
+
+type tmjLayer struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	OffsetX     float64         `json:"offsetx"`
+	OffsetY     float64         `json:"offsety"`
+	Opacity     *float64        `json:"opacity"`
+	Visible     *bool           `json:"visible"`
+	TintColor   string          `json:"tintcolor"`
+	Properties  []tmjProperty   `json:"properties"`
+	Encoding    string          `json:"encoding"`
+	Compression string          `json:"compression"`
+	Data        json.RawMessage `json:"data"`
+	Objects     []tmjObject     `json:"objects"`
+	Layers      []tmjLayer      `json:"layers"`
+}
+
+type tmjMap struct {
+	Orientation string        `json:"orientation"`
+	Width       int           `json:"width"`
+	Height      int           `json:"height"`
+	TileWidth   int           `json:"tilewidth"`
+	TileHeight  int           `json:"tileheight"`
+	Infinite    bool          `json:"infinite"`
+	Properties  []tmjProperty `json:"properties"`
+	Tilesets    []tmjTileset  `json:"tilesets"`
+	Layers      []tmjLayer    `json:"layers"`
+}
+
+func parseTMJ(data []byte, readTileset tilesetReader) (*TiledMap, error) {
+	var raw tmjMap
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	m := &TiledMap{Width: raw.Width, Height: raw.Height, TileWidth: raw.TileWidth, TileHeight: raw.TileHeight}
+	var err error
+	if m.Properties, err = tmjProperties(raw.Properties); err != nil {
+		return nil, err
+	}
+	for _, set := range raw.Tilesets {
+		tileset := set.tileset()
+		if set.Source != "" {
+			if tileset, err = readTileset(set.Source); err != nil {
+				return nil, err
+			}
+		}
+		tileset.FirstGID = set.FirstGID
+		m.Tilesets = append(m.Tilesets, tileset)
+	}
+	if err := checkMap(raw.Orientation, raw.Infinite, m.Tilesets); err != nil {
+		return nil, err
+	}
+	if m.Layers, err = tmjLayers(raw.Layers, m.Width*m.Height); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func parseTSJ(data []byte) (Tileset, error) {
+	var raw tmjTileset
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Tileset{}, err
+	}
+	return raw.tileset(), nil
+}
+
+func (t tmjTileset) tileset() Tileset {
+	return Tileset{
+		Name: t.Name, Count: t.TileCount, Columns: t.Columns,
+		TileWidth: t.TileWidth, TileHeight: t.TileHeight, Margin: t.Margin, Spacing: t.Spacing,
+		Image: t.Image,
+	}
+}
+
+func tmjLayers(raw []tmjLayer, count int) ([]TiledLayer, error) {
+	layers := []TiledLayer{}
+	for _, l := range raw {
+		layer := TiledLayer{Name: l.Name, OffsetX: l.OffsetX, OffsetY: l.OffsetY, Opacity: 1, Tint: [4]uint8{255, 255, 255, 255}}
+		layer.Hidden = l.Visible != nil && !*l.Visible
+		if l.Opacity != nil {
+			layer.Opacity = *l.Opacity
+		}
+		var err error
+		if l.TintColor != "" {
+			if layer.Tint, err = parseColor(l.TintColor); err != nil {
+				return nil, err
+			}
+		}
+		if layer.Properties, err = tmjProperties(l.Properties); err != nil {
+			return nil, fmt.Errorf("layer %s: %w", l.Name, err)
+		}
+
+		switch l.Type {
+		case "tilelayer":
+			if layer.Tiles, err = tmjTiles(l, count); err != nil {
+				return nil, fmt.Errorf("layer %s: %w", l.Name, err)
+			}
+		case "objectgroup":
+			layer.ObjectLayer = true
+			for _, o := range l.Objects {
+				object, err := o.object()
+				if err != nil {
+					return nil, fmt.Errorf("layer %s: %w", l.Name, err)
+				}
+				layer.Objects = append(layer.Objects, object)
+			}
+		case "group":
+			children, err := tmjLayers(l.Layers, count)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, inherit(children, layer)...)
+			continue
+		default:
+			continue
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+//Tile data is a list of IDs or a base64 string
+func tmjTiles(l tmjLayer, count int) ([]uint32, error) {
+	if l.Encoding == "base64" {
+		var data string
+		if err := json.Unmarshal(l.Data, &data); err != nil {
+			return nil, err
+		}
+		return decodeTiles(l.Encoding, l.Compression, data, count)
+	}
+	var tiles []uint32
+	if err := json.Unmarshal(l.Data, &tiles); err != nil {
+		return nil, err
+	}
+	if len(tiles) != count {
+		return nil, fmt.Errorf("layer has %d tiles instead of %d", len(tiles), count)
+	}
+	return tiles, nil
+}
+
+func (o tmjObject) object() (TiledObject, error) {
+	object := TiledObject{
+		ID: o.ID, Name: o.Name, Class: o.Class, X: o.X, Y: o.Y, Width: o.Width, Height: o.Height,
+		Rotation: o.Rotation, GID: o.GID, Hidden: o.Visible != nil && !*o.Visible, Shape: RectangleShape,
+	}
+	if object.Class == "" {
+		object.Class = o.Type
+	}
+	points := func(raw []tmjPoint) [][2]float64 {
+		converted := [][2]float64{}
+		for _, p := range raw {
+			converted = append(converted, [2]float64{p.X, p.Y})
+		}
+		return converted
+	}
+	switch {
+	case o.Ellipse:
+		object.Shape = EllipseShape
+	case o.Point:
+		object.Shape = PointShape
+	case o.Polygon != nil:
+		object.Shape = PolygonShape
+		object.Points = points(o.Polygon)
+	case o.Polyline != nil:
+		object.Shape = PolylineShape
+		object.Points = points(o.Polyline)
+	}
+	var err error
+	if object.Properties, err = tmjProperties(o.Properties); err != nil {
+		return TiledObject{}, fmt.Errorf("object %d: %w", o.ID, err)
+	}
+	return object, nil
+}
+
+func tmjProperties(raw []tmjProperty) ([]Property, error) {
+	var properties []Property
+	for _, p := range raw {
+		property := Property{Name: p.Name, Type: p.Type, PropertyType: p.PropertyType, Value: p.Value}
+		if property.Type == "" {
+			property.Type = "string"
+		}
+		switch value := p.Value.(type) {
+		case float64:
+			if property.Type == "int" || property.Type == "object" {
+				property.Value = int(value)
+			}
+		case map[string]interface{}:
+			if property.Type != "class" {
+				return nil, fmt.Errorf("property %s of type %s holds members", p.Name, p.Type)
+			}
+		case string, bool, nil:
+		default:
+			return nil, fmt.Errorf("property %s has an invalid value", p.Name)
+		}
+		if property.Type == "class" && property.Value == nil {
+			property.Value = map[string]interface{}{}
+		}
+		properties = append(properties, property)
+	}
+	return properties, nil
+}
@@ -0,0 +1,401 @@
+package tilemap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/render"
+)
+
+//Tiles are stored and drawn in square chunks of this many tiles per side
+const ChunkSize = 16
+
+//How much closer each layer is drawn than the one before it, see Layer.Z
+const LayerDepth = 1.0 / 1024
+
+//Global tile IDs use Tileds flags, the highest bits flip the tile and the rest
+//is the ID. 0 is an empty tile.
+const (
+	FlippedHorizontally uint32 = 0x80000000
+	FlippedVertically   uint32 = 0x40000000
+	FlippedDiagonally   uint32 = 0x20000000
+	//Hexagonal maps use this for 120 degree rotations, it is ignored
+	RotatedHexagonal120 uint32 = 0x10000000
+	FlipFlags                  = FlippedHorizontally | FlippedVertically | FlippedDiagonally | RotatedHexagonal120
+)
+
+//Returned for tiles outside of a layer and layers that do not exist
+var OutOfBoundsError = errors.New("out of bounds")
+
+//A grid of tiles in one image of the atlas. Global tile IDs from FirstGID to
+//FirstGID+Count-1 belong to it.
+type Tileset struct {
+	Name     string
+	FirstGID uint32
+	Count    int
+	Columns  int
+
+	TileWidth, TileHeight int
+	//The border around the tiles and the space between them in the image
+	Margin, Spacing int
+
+	//The name of the atlas image with the tiles
+	Image string
+	//Where Image was packed and the size of the atlas pages, set by Bind
+	Region   render.AtlasRegion
+	PageSize int32
+}
+
+//Returns true if the global tile ID belongs to the tileset
+func (t Tileset) Contains(gid uint32) bool {
+	gid &^= FlipFlags
+	return gid >= t.FirstGID && gid < t.FirstGID+uint32(t.Count)
+}
+
+//Returns the texture coordinates of a tile of the tileset in the atlas
+func (t Tileset) TexCoords(gid uint32) (x, y, w, h float32) {
+	index := int((gid &^ FlipFlags) - t.FirstGID)
+	columns := t.Columns
+	if columns <= 0 {
+		columns = 1
+	}
+	size := float32(t.PageSize)
+	if size == 0 {
+		return 0, 0, 0, 0
+	}
+	px := int(t.Region.X) + t.Margin + (index%columns)*(t.TileWidth+t.Spacing)
+	py := int(t.Region.Y) + t.Margin + (index/columns)*(t.TileHeight+t.Spacing)
+	return float32(px) / size, float32(py) / size, float32(t.TileWidth) / size, float32(t.TileHeight) / size
+}
+
+/***************************/
+/*          Layer          */
+
+type chunk [ChunkSize * ChunkSize]uint32
+
+//A grid of global tile IDs. Layers are values that share their tiles, changing
+//a tile copies the chunk holding it so other copies keep the old tile.
+type Layer struct {
+	Name string
+	//Moves the layer, in pixels
+	OffsetX, OffsetY float64
+	//Added to the Z of the tilemap. Layers added with AddLayer are LayerDepth
+	//closer than the one before, the depth test draws the smallest Z in front.
+	Z      float64
+	Hidden bool
+	//Tints every tile of the layer
+	Color [4]uint8
+
+	width, height int
+	//Chunks in rows, nil chunks are empty
+	chunks []*chunk
+}
+
+//Creates an empty layer of width by height tiles
+func NewLayer(name string, width, height int) Layer {
+	if width < 0 || height < 0 {
+		width, height = 0, 0
+	}
+	columns, rows := chunksFor(width), chunksFor(height)
+	return Layer{Name: name, Color: [4]uint8{255, 255, 255, 255}, width: width, height: height, chunks: make([]*chunk, columns*rows)}
+}
+
+func chunksFor(tiles int) int {
+	return (tiles + ChunkSize - 1) / ChunkSize
+}
+
+func (l Layer) Width() int  { return l.width }
+func (l Layer) Height() int { return l.height }
+
+//Returns the global tile ID at x, y, 0 if it is empty or outside of the layer
+func (l Layer) Tile(x, y int) uint32 {
+	if x < 0 || y < 0 || x >= l.width || y >= l.height {
+		return 0
+	}
+	c := l.chunks[(y/ChunkSize)*chunksFor(l.width)+x/ChunkSize]
+	if c == nil {
+		return 0
+	}
+	return c[(y%ChunkSize)*ChunkSize+x%ChunkSize]
+}
+
+//Sets the global tile ID at x, y. Only the changed chunk is copied, its
+//cached vertices are rebuilt the next time it is drawn.
+func (l *Layer) SetTile(x, y int, gid uint32) error {
+	if x < 0 || y < 0 || x >= l.width || y >= l.height {
+		return fmt.Errorf("tile %d, %d of layer %s: %w", x, y, l.Name, OutOfBoundsError)
+	}
+	index := (y/ChunkSize)*chunksFor(l.width) + x/ChunkSize
+	changed := &chunk{}
+	if l.chunks[index] != nil {
+		*changed = *l.chunks[index]
+	}
+	changed[(y%ChunkSize)*ChunkSize+x%ChunkSize] = gid
+	chunks := make([]*chunk, len(l.chunks))
+	copy(chunks, l.chunks)
+	chunks[index] = changed
+	l.chunks = chunks
+	return nil
+}
+
+//Replaces every tile of the layer, tiles holds the rows one after another
+func (l *Layer) SetTiles(tiles []uint32) error {
+	if len(tiles) != l.width*l.height {
+		return fmt.Errorf("layer %s has %d tiles, got %d", l.Name, l.width*l.height, len(tiles))
+	}
+	columns := chunksFor(l.width)
+	chunks := make([]*chunk, len(l.chunks))
+	for i, gid := range tiles {
+		if gid == 0 {
+			continue
+		}
+		x, y := i%l.width, i/l.width
+		index := (y/ChunkSize)*columns + x/ChunkSize
+		if chunks[index] == nil {
+			chunks[index] = &chunk{}
+		}
+		chunks[index][(y%ChunkSize)*ChunkSize+x%ChunkSize] = gid
+	}
+	l.chunks = chunks
+	return nil
+}
+
+//Returns every tile of the layer, the rows one after another
+func (l Layer) Tiles() []uint32 {
+	tiles := make([]uint32, l.width*l.height)
+	for y := 0; y < l.height; y++ {
+		for x := 0; x < l.width; x++ {
+			tiles[y*l.width+x] = l.Tile(x, y)
+		}
+	}
+	return tiles
+}
+
+/***************************/
+/*         Tilemap         */
+
+//Layered grids of tiles drawn by the tilemap service. The map is placed with
+//its top left corner at X, Y and tiles are TileWidth by TileHeight pixels.
+//Layers and tilesets are shared between copies of the map, so they are only
+//changed through its methods.
+type Tilemap struct {
+	X, Y, Z               float64
+	TileWidth, TileHeight int
+	Hidden                bool
+
+	layers   []Layer
+	tilesets *tilesets
+}
+
+//Replaced whenever a tileset changes, so the renderer can tell by the pointer
+type tilesets struct {
+	sets []Tileset
+}
+
+func (t Tilemap) GetType() reflect.Type { return reflect.TypeOf(t) }
+func (t Tilemap) IsComponent()          {}
+
+func init() {
+	component.MustRegister("Tilemap", Tilemap{})
+}
+
+//Creates a map without layers for tiles of the given size
+func NewTilemap(tileWidth, tileHeight int) Tilemap {
+	return Tilemap{TileWidth: tileWidth, TileHeight: tileHeight}
+}
+
+//Adds an empty layer on top of the others and returns its index
+func (t *Tilemap) AddLayer(name string, width, height int) int {
+	layer := NewLayer(name, width, height)
+	layer.Z = -float64(len(t.layers)) * LayerDepth
+	return t.AppendLayer(layer)
+}
+
+//Adds the layer as it is on top of the others and returns its index
+func (t *Tilemap) AppendLayer(layer Layer) int {
+	layers := make([]Layer, len(t.layers), len(t.layers)+1)
+	copy(layers, t.layers)
+	t.layers = append(layers, layer)
+	return len(t.layers) - 1
+}
+
+//Returns the number of layers
+func (t Tilemap) LayerCount() int {
+	return len(t.layers)
+}
+
+//Returns a copy of the layer at index
+func (t Tilemap) Layer(index int) (Layer, error) {
+	if index < 0 || index >= len(t.layers) {
+		return Layer{}, fmt.Errorf("layer %d: %w", index, OutOfBoundsError)
+	}
+	return t.layers[index], nil
+}
+
+//Returns the index of the first layer with the name
+func (t Tilemap) LayerIndex(name string) (int, bool) {
+	for i, layer := range t.layers {
+		if layer.Name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+//Replaces the layer at index
+func (t *Tilemap) SetLayer(index int, layer Layer) error {
+	if index < 0 || index >= len(t.layers) {
+		return fmt.Errorf("layer %d: %w", index, OutOfBoundsError)
+	}
+	layers := make([]Layer, len(t.layers))
+	copy(layers, t.layers)
+	layers[index] = layer
+	t.layers = layers
+	return nil
+}
+
+//Returns the global tile ID at x, y of a layer
+func (t Tilemap) Tile(layer, x, y int) uint32 {
+	if layer < 0 || layer >= len(t.layers) {
+		return 0
+	}
+	return t.layers[layer].Tile(x, y)
+}
+
+//Sets the global tile ID at x, y of a layer
+func (t *Tilemap) SetTile(layer, x, y int, gid uint32) error {
+	changed, err := t.Layer(layer)
+	if err != nil {
+		return err
+	}
+	if err := changed.SetTile(x, y, gid); err != nil {
+		return err
+	}
+	return t.SetLayer(layer, changed)
+}
+
+//Returns a copy of the tilesets
+func (t Tilemap) Tilesets() []Tileset {
+	if t.tilesets == nil {
+		return nil
+	}
+	return append([]Tileset{}, t.tilesets.sets...)
+}
+
+//Replaces the tilesets
+func (t *Tilemap) SetTilesets(sets ...Tileset) {
+	t.tilesets = &tilesets{sets: append([]Tileset{}, sets...)}
+}
+
+//Adds a tileset
+func (t *Tilemap) AddTileset(set Tileset) {
+	t.SetTilesets(append(t.Tilesets(), set)...)
+}
+
+//Returns the tileset a global tile ID belongs to
+func (t Tilemap) TilesetOf(gid uint32) (Tileset, bool) {
+	if t.tilesets == nil {
+		return Tileset{}, false
+	}
+	for _, set := range t.tilesets.sets {
+		if set.Contains(gid) {
+			return set, true
+		}
+	}
+	return Tileset{}, false
+}
+
+//Looks up where the image of every tileset was packed in the atlas. The atlas
+//has to be packed first.
+func (t *Tilemap) Bind(atlas *render.ImageAtlas) error {
+	sets := t.Tilesets()
+	for i := range sets {
+		region, ok := atlas.GetRegion(sets[i].Image)
+		if !ok {
+			return fmt.Errorf("the image %s of tileset %s is not in the atlas", sets[i].Image, sets[i].Name)
+		}
+		sets[i].Region = region
+		sets[i].PageSize = atlas.GetPageSize()
+	}
+	t.SetTilesets(sets...)
+	return nil
+}
+
+//Converts a position in world space to the tile it is on
+func (t Tilemap) TileAt(x, y float64) (int, int) {
+	if t.TileWidth <= 0 || t.TileHeight <= 0 {
+		return 0, 0
+	}
+	return floorDiv(x-t.X, float64(t.TileWidth)), floorDiv(y-t.Y, float64(t.TileHeight))
+}
+
+func floorDiv(a, b float64) int {
+	q := int(a / b)
+	if a < 0 && float64(q)*b != a {
+		q--
+	}
+	return q
+}
+
+/***************************/
+/*          JSON           */
+
+//Tilemaps are saved with the tiles of each layer as one list, so scenes can
+//hold them
+
+type layerData struct {
+	Name    string
+	OffsetX float64 `json:",omitempty"`
+	OffsetY float64 `json:",omitempty"`
+	Z       float64
+	Hidden  bool `json:",omitempty"`
+	Color   [4]uint8
+	Width   int
+	Height  int
+	Tiles   []uint32
+}
+
+type tilemapData struct {
+	X, Y, Z               float64
+	TileWidth, TileHeight int
+	Hidden                bool `json:",omitempty"`
+	Tilesets              []Tileset
+	Layers                []layerData
+}
+
+func (t Tilemap) MarshalJSON() ([]byte, error) {
+	data := tilemapData{X: t.X, Y: t.Y, Z: t.Z, TileWidth: t.TileWidth, TileHeight: t.TileHeight, Hidden: t.Hidden, Tilesets: t.Tilesets()}
+	for _, l := range t.layers {
+		data.Layers = append(data.Layers, layerData{l.Name, l.OffsetX, l.OffsetY, l.Z, l.Hidden, l.Color, l.width, l.height, l.Tiles()})
+	}
+	return json.Marshal(data)
+}
+
+//Fields that are left out keep their value, like other scene components
+func (t *Tilemap) UnmarshalJSON(encoded []byte) error {
+	data := tilemapData{X: t.X, Y: t.Y, Z: t.Z, TileWidth: t.TileWidth, TileHeight: t.TileHeight, Hidden: t.Hidden}
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return err
+	}
+	var layers []Layer
+	if data.Layers == nil {
+		layers = t.layers
+	}
+	for _, l := range data.Layers {
+		layer := NewLayer(l.Name, l.Width, l.Height)
+		layer.OffsetX, layer.OffsetY, layer.Z, layer.Hidden, layer.Color = l.OffsetX, l.OffsetY, l.Z, l.Hidden, l.Color
+		if err := layer.SetTiles(l.Tiles); err != nil {
+			return err
+		}
+		layers = append(layers, layer)
+	}
+	t.X, t.Y, t.Z, t.TileWidth, t.TileHeight, t.Hidden = data.X, data.Y, data.Z, data.TileWidth, data.TileHeight, data.Hidden
+	t.layers = layers
+	if data.Tilesets != nil {
+		t.SetTilesets(data.Tilesets...)
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+package tilemap
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/render"
+	"github.com/jevans40/Ruthenium/scene"
+	"github.com/jevans40/Ruthenium/world"
+	"github.com/stretchr/testify/assert"
+)
+
+type testHealth struct {
+	Health int
+	Max    int
+}
+
+func (t testHealth) GetType() reflect.Type { return reflect.TypeOf(t) }
+func (t testHealth) IsComponent()          {}
+
+func init() {
+	component.MustRegister("TilemapHealth", testHealth{Health: 1, Max: 1})
+}
+
+func TestTilemap(t *testing.T) {
+	tilemap := NewTilemap(8, 8)
+	ground := tilemap.AddLayer("ground", 40, 20)
+	top := tilemap.AddLayer("top", 40, 20)
+	assert.Equal(t, -LayerDepth, mustLayer(t, tilemap, top).Z)
+	assert.NoError(t, tilemap.SetTile(ground, 17, 3, 5))
+	assert.Equal(t, uint32(5), tilemap.Tile(ground, 17, 3))
+	assert.Equal(t, uint32(0), tilemap.Tile(top, 17, 3))
+	assert.ErrorIs(t, tilemap.SetTile(ground, 40, 0, 1), OutOfBoundsError)
+	assert.ErrorIs(t, tilemap.SetTile(5, 0, 0, 1), OutOfBoundsError)
+
+	//Copies keep their tiles and only share the chunks that did not change
+	snapshot := tilemap
+	assert.NoError(t, tilemap.SetTile(ground, 1, 1, 9))
+	assert.Equal(t, uint32(0), snapshot.Tile(ground, 1, 1))
+	assert.Equal(t, uint32(9), tilemap.Tile(ground, 1, 1))
+	assert.Same(t, mustLayer(t, snapshot, ground).chunks[1], mustLayer(t, tilemap, ground).chunks[1])
+	assert.NotSame(t, mustLayer(t, snapshot, ground).chunks[0], mustLayer(t, tilemap, ground).chunks[0])
+
+	index, ok := tilemap.LayerIndex("top")
+	assert.True(t, ok)
+	assert.Equal(t, top, index)
+	x, y := tilemap.TileAt(-1, 17)
+	assert.Equal(t, []int{-1, 2}, []int{x, y})
+
+	set := Tileset{Name: "tiles", FirstGID: 1, Count: 16, Columns: 4, TileWidth: 8, TileHeight: 8, Margin: 1, Spacing: 2, Image: "tiles"}
+	set.Region = render.AtlasRegion{Page: 1, X: 64, Y: 0, W: 40, H: 40}
+	set.PageSize = 256
+	tilemap.AddTileset(set)
+	texX, texY, texW, _ := set.TexCoords(6 | FlippedHorizontally)
+	assert.Equal(t, float32(64+1+10)/256, texX)
+	assert.Equal(t, float32(1+10)/256, texY)
+	assert.Equal(t, float32(8)/256, texW)
+	found, ok := tilemap.TilesetOf(16)
+	assert.True(t, ok)
+	assert.Equal(t, "tiles", found.Name)
+	_, ok = tilemap.TilesetOf(17)
+	assert.False(t, ok)
+
+	//Tilemaps go through JSON so scenes can hold them
+	encoded, err := json.Marshal(tilemap)
+	assert.NoError(t, err)
+	decoded := Tilemap{}
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, tilemap.Tilesets(), decoded.Tilesets())
+	assert.Equal(t, 2, decoded.LayerCount())
+	assert.Equal(t, mustLayer(t, tilemap, ground).Tiles(), mustLayer(t, decoded, ground).Tiles())
+	assert.Equal(t, uint32(9), decoded.Tile(ground, 1, 1))
+}
+
+func mustLayer(t *testing.T, tilemap Tilemap, index int) Layer {
+	layer, err := tilemap.Layer(index)
+	assert.NoError(t, err)
+	return layer
+}
+
+func TestTilemapRenderer(t *testing.T) {
+	tilemap := NewTilemap(8, 8)
+	tilemap.AddTileset(Tileset{Name: "tiles", FirstGID: 1, Count: 4, Columns: 2, TileWidth: 8, TileHeight: 8, PageSize: 16})
+	layer := tilemap.AddLayer("ground", 40, 40)
+	filled := NewLayer("ground", 40, 40)
+	tiles := make([]uint32, 40*40)
+	for i := range tiles {
+		tiles[i] = 1
+	}
+	assert.NoError(t, filled.SetTiles(tiles))
+	filled.Z = -1
+	assert.NoError(t, tilemap.SetLayer(layer, filled))
+
+	tilemaps := component.NewVectorStorage[Tilemap]()
+	tilemapWrite, _ := component.GetWriteStorage[Tilemap](tilemaps)
+	assert.NoError(t, tilemapWrite.AddEntity(3, tilemap))
+	quadStorage := component.NewVectorStorage[world.Quads]()
+	quads, _ := component.GetWriteStorage[world.Quads](quadStorage)
+	renderer := &tilemapRenderer{cache: map[chunkKey][]float32{}, drawn: map[component.EntityID][]chunkKey{}}
+	run := func(viewport world.Viewport) world.Quads {
+		read, _ := component.GetReadOnlyStorage[Tilemap](tilemaps)
+		assert.NoError(t, renderer.run(read, viewport, quads))
+		return quads.MustGetComponent(3)
+	}
+
+	//Everything is drawn without a viewport, the 40x40 layer has 3x3 chunks
+	assert.Equal(t, 40*40, run(world.Viewport{}).Count())
+	assert.Len(t, renderer.cache, 9)
+
+	//A viewport inside the first chunk only draws that chunk
+	drawn := run(world.Viewport{X: 10, Y: 10, W: 50, H: 50})
+	assert.Equal(t, ChunkSize*ChunkSize, drawn.Count())
+	//Vertices are x, y, z, texX, texY, color, map and the first tile sits at the origin
+	assert.Equal(t, []float32{0, 0, -1, 0, 0}, drawn.Vertices[:5])
+	assert.Equal(t, []float32{8, 8}, drawn.Vertices[21:23])
+	//Nothing is rebuilt or written when the same chunks are visible
+	cached := renderer.cache[renderer.drawn[3][0]]
+	assert.Equal(t, &cached[0], &run(world.Viewport{X: 12, Y: 12, W: 50, H: 50}).Vertices[0])
+
+	//Changing a tile only rebuilds its chunk, the old chunk leaves the cache
+	assert.NoError(t, tilemap.SetTile(layer, 39, 39, 0))
+	assert.NoError(t, tilemapWrite.Write(3, tilemap))
+	assert.Equal(t, 40*40-1, run(world.Viewport{}).Count())
+	assert.Len(t, renderer.cache, 9)
+	assert.Equal(t, &cached[0], &renderer.cache[renderer.drawn[3][0]][0])
+
+	tilemap.Hidden = true
+	assert.NoError(t, tilemapWrite.Write(3, tilemap))
+	assert.Equal(t, 0, run(world.Viewport{}).Count())
+	assert.NoError(t, tilemapWrite.DeleteEntityMultiple([]component.EntityID{3}))
+	assert.Equal(t, 0, run(world.Viewport{}).Count())
+	assert.Len(t, renderer.cache, 0)
+}
+
+func TestTileFlips(t *testing.T) {
+	set := Tileset{FirstGID: 1, Count: 1, Columns: 1, TileWidth: 1, TileHeight: 1, PageSize: 1}
+	texCoords := func(gid uint32) [][2]float32 {
+		vertices := appendTile(nil, set, gid, 0, 0, 0, [4]uint8{})
+		coords := [][2]float32{}
+		for i := 0; i < 4; i++ {
+			coords = append(coords, [2]float32{vertices[i*7+3], vertices[i*7+4]})
+		}
+		return coords
+	}
+	assert.Equal(t, [][2]float32{{0, 0}, {1, 0}, {0, 1}, {1, 1}}, texCoords(1))
+	assert.Equal(t, [][2]float32{{1, 0}, {0, 0}, {1, 1}, {0, 1}}, texCoords(1|FlippedHorizontally))
+	assert.Equal(t, [][2]float32{{0, 1}, {1, 1}, {0, 0}, {1, 0}}, texCoords(1|FlippedVertically))
+	//A diagonal and a horizontal flip turn the tile clockwise
+	assert.Equal(t, [][2]float32{{0, 1}, {0, 0}, {1, 1}, {1, 0}}, texCoords(1|FlippedDiagonally|FlippedHorizontally))
+}
+
+/***************************/
+/*         Tiled           */
+
+func encodeTiles(t *testing.T, tiles []uint32) string {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	assert.NoError(t, binary.Write(writer, binary.LittleEndian, tiles))
+	assert.NoError(t, writer.Close())
+	return base64.StdEncoding.EncodeToString(compressed.Bytes())
+}
+
+const testTSX = `<?xml version="1.0" encoding="UTF-8"?>
+<tileset version="1.10" name="terrain" tilewidth="8" tileheight="8" tilecount="4" columns="2">
+ <image source="terrain.png" width="16" height="16"/>
+</tileset>`
+
+const testTMX = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.10" orientation="orthogonal" renderorder="right-down" width="3" height="2" tilewidth="8" tileheight="8" infinite="0">
+ <properties>
+  <property name="TilemapHealth.Max" type="int" value="7"/>
+  <property name="music" value="cave.ogg"/>
+ </properties>
+ <tileset firstgid="1" source="tiles/terrain.tsx"/>
+ <layer id="1" name="ground" width="3" height="2">
+  <data encoding="csv">
+1,2,3,
+4,0,1
+</data>
+ </layer>
+ <group id="2" name="decoration" offsetx="4" opacity="0.5">
+  <layer id="3" name="details" width="3" height="2" tintcolor="#ff0000" offsety="2">
+   <data encoding="base64" compression="zlib">%s</data>
+  </layer>
+ </group>
+ <objectgroup id="4" name="actors">
+  <properties>
+   <property name="TilemapHealth" value="{&quot;Health&quot;: 3}"/>
+  </properties>
+  <object id="1" name="player" type="Hero" x="16" y="8" width="8" height="8" gid="2147483650">
+   <properties>
+    <property name="stats" type="class" propertytype="TilemapHealth">
+     <properties>
+      <property name="Max" type="int" value="10"/>
+     </properties>
+    </property>
+    <property name="speed" type="float" value="1.5"/>
+   </properties>
+  </object>
+  <object id="2" name="spawn" x="4" y="4">
+   <point/>
+  </object>
+  <object id="3" name="spawn" x="1" y="2" rotation="90">
+   <polygon points="0,0 4,0 4,4"/>
+  </object>
+ </objectgroup>
+</map>`
+
+const testTMJ = `{
+ "orientation": "orthogonal", "width": 3, "height": 2, "tilewidth": 8, "tileheight": 8, "infinite": false,
+ "properties": [{"name": "TilemapHealth.Max", "type": "int", "value": 7}, {"name": "music", "type": "string", "value": "cave.ogg"}],
+ "tilesets": [{"firstgid": 1, "source": "tiles/terrain.tsj"}],
+ "layers": [
+  {"type": "tilelayer", "name": "ground", "width": 3, "height": 2, "data": [1, 2, 3, 4, 0, 1]},
+  {"type": "group", "name": "decoration", "offsetx": 4, "opacity": 0.5, "layers": [
+   {"type": "tilelayer", "name": "details", "width": 3, "height": 2, "tintcolor": "#ff0000", "offsety": 2,
+    "encoding": "base64", "compression": "zlib", "data": "%s"}
+  ]},
+  {"type": "objectgroup", "name": "actors",
+   "properties": [{"name": "TilemapHealth", "type": "string", "value": "{\"Health\": 3}"}],
+   "objects": [
+    {"id": 1, "name": "player", "type": "Hero", "x": 16, "y": 8, "width": 8, "height": 8, "gid": 2147483650,
+     "properties": [
+      {"name": "stats", "type": "class", "propertytype": "TilemapHealth", "value": {"Max": 10}},
+      {"name": "speed", "type": "float", "value": 1.5}
+     ]},
+    {"id": 2, "name": "spawn", "x": 4, "y": 4, "point": true},
+    {"id": 3, "name": "spawn", "x": 1, "y": 2, "rotation": 90, "polygon": [{"x": 0, "y": 0}, {"x": 4, "y": 0}, {"x": 4, "y": 4}]}
+   ]}
+ ]
+}`
+
+const testTSJ = `{"name": "terrain", "tilewidth": 8, "tileheight": 8, "tilecount": 4, "columns": 2, "image": "terrain.png"}`
+
+func TestTiledImport(t *testing.T) {
+	var encoded bytes.Buffer
+	assert.NoError(t, png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 16, 16))))
+	details := encodeTiles(t, []uint32{0, 0, 4, 0, 0, 0})
+	fsys := fstest.MapFS{
+		"maps/cave.tmx":           {Data: []byte(fmt.Sprintf(testTMX, details))},
+		"maps/cave.tmj":           {Data: []byte(fmt.Sprintf(testTMJ, details))},
+		"maps/tiles/terrain.tsx":  {Data: []byte(testTSX)},
+		"maps/tiles/terrain.tsj":  {Data: []byte(testTSJ)},
+		"maps/tiles/terrain.png":  {Data: encoded.Bytes()},
+		"maps/broken.tmj":         {Data: []byte(`{"orientation": "isometric"}`)},
+		"maps/missingtileset.tmx": {Data: []byte(`<map><tileset firstgid="1" source="nope.tsx"/></map>`)},
+	}
+
+	for _, name := range []string{"maps/cave.tmx", "maps/cave.tmj"} {
+		m, err := LoadTiled(fsys, name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		assert.Equal(t, []string{"maps/tiles/terrain.png"}, keys(m.Images))
+		assert.Equal(t, "maps/tiles/terrain.png", m.Tilesets[0].Image)
+		assert.Len(t, m.Layers, 3)
+		assert.Equal(t, []uint32{1, 2, 3, 4, 0, 1}, m.Layers[0].Tiles)
+		assert.Equal(t, []uint32{0, 0, 4, 0, 0, 0}, m.Layers[1].Tiles)
+		assert.Equal(t, 4.0, m.Layers[1].OffsetX)
+		assert.Equal(t, 2.0, m.Layers[1].OffsetY)
+		assert.Equal(t, 0.5, m.Layers[1].Opacity)
+		objects := m.Layers[2].Objects
+		assert.Len(t, objects, 3)
+		assert.Equal(t, "Hero", objects[0].Class)
+		assert.Equal(t, 2|FlippedHorizontally, objects[0].GID)
+		assert.Equal(t, PointShape, objects[1].Shape)
+		assert.Equal(t, [][2]float64{{0, 0}, {4, 0}, {4, 4}}, objects[2].Points)
+
+		atlas := render.ImageAtlasFactory(64, 1)
+		m.AddToAtlas(&atlas)
+		assert.NoError(t, atlas.Pack())
+		tilemap, err := m.Tilemap(&atlas)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, tilemap.LayerCount())
+		detailLayer := mustLayer(t, tilemap, 1)
+		assert.Equal(t, [4]uint8{255, 0, 0, 128}, detailLayer.Color)
+		assert.Equal(t, -LayerDepth, detailLayer.Z)
+
+		s, err := m.Scene(&atlas)
+		assert.NoError(t, err)
+		assert.Len(t, s.Entities, 4)
+		w := world.NewBaseWorld(make(chan []float32, 10), nil)
+		assert.NoError(t, AddTilemaps(w.GetDispatcher()))
+		w.RegisterStorage(component.NewDenseStorage[testHealth]())
+		instance, err := scene.Spawn(w, s, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Maintain())
+
+		mapEntity, ok := instance.ID(MapEntityName)
+		assert.True(t, ok)
+		spawned, err := getComponent[Tilemap](w, mapEntity)
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(4), spawned.Tile(1, 2, 0))
+		assert.Equal(t, int32(64), spawned.Tilesets()[0].PageSize)
+		health, err := getComponent[testHealth](w, mapEntity)
+		assert.NoError(t, err)
+		assert.Equal(t, testHealth{Health: 1, Max: 7}, health)
+
+		player, ok := instance.ID("player")
+		assert.True(t, ok)
+		_, ok = instance.ID("spawn")
+		assert.False(t, ok, "duplicate names are dropped")
+		health, err = getComponent[testHealth](w, player)
+		assert.NoError(t, err)
+		assert.Equal(t, testHealth{Health: 3, Max: 10}, health)
+		object, err := getComponent[Object](w, player)
+		assert.NoError(t, err)
+		assert.Equal(t, "Hero", object.Class)
+		assert.Equal(t, map[string]interface{}{"speed": 1.5}, object.Properties)
+		//Tile objects are centered above their bottom left corner
+		transform, err := getComponent[world.Transform](w, player)
+		assert.NoError(t, err)
+		assert.Equal(t, world.NewTransform().Translate(20, 4).Scale(8, 8), transform)
+		renderable, err := getComponent[world.Renderable](w, player)
+		assert.NoError(t, err)
+		set := spawned.Tilesets()[0]
+		texX, _, texW, _ := set.TexCoords(2)
+		assert.Equal(t, texX+texW, renderable.TexX)
+		assert.Equal(t, -texW, renderable.TexW)
+
+		//The map is drawn into its Quads from the tick after it was spawned
+		assert.NoError(t, w.Maintain())
+		quads, err := getComponent[world.Quads](w, mapEntity)
+		assert.NoError(t, err)
+		assert.Equal(t, 6, quads.Count())
+	}
+
+	_, err := LoadTiled(fsys, "maps/broken.tmj")
+	assert.ErrorIs(t, err, UnsupportedTiledError)
+	_, err = LoadTiled(fsys, "maps/missingtileset.tmx")
+	assert.Error(t, err)
+	_, err = ParseTMX([]byte(`<map width="1" height="1"><layer name="a"><data encoding="base64" compression="zstd">AAAA</data></layer></map>`))
+	assert.ErrorIs(t, err, UnsupportedTiledError)
+	_, err = ParseTMJ([]byte(`{"width": 2, "height": 1, "layers": [{"type": "tilelayer", "name": "a", "data": [1]}]}`))
+	assert.Error(t, err)
+}
+
+func TestTiledComponents(t *testing.T) {
+	components, err := Components([]Property{
+		{Name: "transform", Type: "class", PropertyType: "Transform", Value: map[string]interface{}{"Order": 1.0}},
+		{Name: "Renderable.Z", Type: "float", Value: 2.0},
+		{Name: "Parent", Type: "string", Value: `{"Entity": 3}`},
+		{Name: "unrelated", Type: "bool", Value: true},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"Transform":  map[string]interface{}{"Order": 1.0},
+		"Renderable": map[string]interface{}{"Z": 2.0},
+		"Parent":     map[string]interface{}{"Entity": 3.0},
+	}, components)
+
+	//Class properties that do not hold their members are an error
+	for _, value := range []interface{}{true, 2.0, "text"} {
+		_, err = Components([]Property{{Name: "transform", Type: "class", PropertyType: "Transform", Value: value}})
+		assert.Error(t, err, value)
+	}
+	_, err = Components([]Property{{Name: "Parent", Type: "string", Value: "{"}})
+	assert.Error(t, err)
+}
+
+func keys(m map[string]*image.RGBA) []string {
+	result := []string{}
+	for k := range m {
+		result = append(result, k)
+	}
+	return result
+}
+
+func getComponent[T component.Component](w world.World, entity component.EntityID) (T, error) {
+	storage, _ := component.GetWriteStorage[T](w.GetDispatcher().GetStorage(component.ReflectType[T]()))
+	return storage.GetComponent(entity)
+}
@@ -0,0 +1,161 @@
+package tween
+
+import "math"
+
+//The shape of an easing curve
+type Curve int
+
+const (
+	LinearCurve Curve = iota
+	QuadCurve
+	CubicCurve
+	ElasticCurve
+	BounceCurve
+	BackCurve
+	//A CSS style cubic-bezier, the control points are in Easing.Bezier
+	BezierCurve
+)
+
+//Which end of the curve is eased
+type Mode int
+
+const (
+	In Mode = iota
+	Out
+	InOut
+)
+
+//Maps how far a step is through its duration to how far its value has moved.
+//The zero value moves at a constant speed.
+type Easing struct {
+	Curve Curve
+	Mode  Mode
+	//The x1, y1, x2, y2 control points of a BezierCurve, the curve starts at 0, 0
+	//and ends at 1, 1. The mode is ignored for beziers.
+	Bezier [4]float64
+}
+
+var (
+	Linear       = Easing{}
+	QuadIn       = Easing{Curve: QuadCurve, Mode: In}
+	QuadOut      = Easing{Curve: QuadCurve, Mode: Out}
+	QuadInOut    = Easing{Curve: QuadCurve, Mode: InOut}
+	CubicIn      = Easing{Curve: CubicCurve, Mode: In}
+	CubicOut     = Easing{Curve: CubicCurve, Mode: Out}
+	CubicInOut   = Easing{Curve: CubicCurve, Mode: InOut}
+	ElasticIn    = Easing{Curve: ElasticCurve, Mode: In}
+	ElasticOut   = Easing{Curve: ElasticCurve, Mode: Out}
+	ElasticInOut = Easing{Curve: ElasticCurve, Mode: InOut}
+	BounceIn     = Easing{Curve: BounceCurve, Mode: In}
+	BounceOut    = Easing{Curve: BounceCurve, Mode: Out}
+	BounceInOut  = Easing{Curve: BounceCurve, Mode: InOut}
+	BackIn       = Easing{Curve: BackCurve, Mode: In}
+	BackOut      = Easing{Curve: BackCurve, Mode: Out}
+	BackInOut    = Easing{Curve: BackCurve, Mode: InOut}
+)
+
+//Creates the easing CSS calls cubic-bezier(x1, y1, x2, y2). The x values are
+//clamped between 0 and 1 so the curve never goes back in time.
+func CubicBezier(x1, y1, x2, y2 float64) Easing {
+	return Easing{Curve: BezierCurve, Bezier: [4]float64{clamp(x1), y1, clamp(x2), y2}}
+}
+
+//Returns the eased value of t, t is clamped between 0 and 1. Every curve starts
+//at 0 and ends at 1, elastic and back curves go past them on the way.
+func (e Easing) Ease(t float64) float64 {
+	t = clamp(t)
+	if e.Curve == BezierCurve {
+		return bezier(e.Bezier, t)
+	}
+	in := easeIn(e.Curve)
+	switch e.Mode {
+	case Out:
+		return 1 - in(1-t)
+	case InOut:
+		if t < 0.5 {
+			return in(2*t) / 2
+		}
+		return 1 - in(2-2*t)/2
+	}
+	return in(t)
+}
+
+//Returns the in version of the curve, the others are built from it
+func easeIn(curve Curve) func(float64) float64 {
+	switch curve {
+	case QuadCurve:
+		return func(t float64) float64 { return t * t }
+	case CubicCurve:
+		return func(t float64) float64 { return t * t * t }
+	case ElasticCurve:
+		return func(t float64) float64 {
+			if t == 0 || t == 1 {
+				return t
+			}
+			return -math.Pow(2, 10*t-10) * math.Sin((10*t-10.75)*2*math.Pi/3)
+		}
+	case BounceCurve:
+		return func(t float64) float64 { return 1 - bounceOut(1-t) }
+	case BackCurve:
+		//The usual overshoot of about 10%
+		const overshoot = 1.70158
+		return func(t float64) float64 { return (overshoot+1)*t*t*t - overshoot*t*t }
+	}
+	return func(t float64) float64 { return t }
+}
+
+func bounceOut(t float64) float64 {
+	const n, d = 7.5625, 2.75
+	switch {
+	case t < 1/d:
+		return n * t * t
+	case t < 2/d:
+		t -= 1.5 / d
+		return n*t*t + 0.75
+	case t < 2.5/d:
+		t -= 2.25 / d
+		return n*t*t + 0.9375
+	}
+	t -= 2.625 / d
+	return n*t*t + 0.984375
+}
+
+//Finds the point of the curve at x = t and returns its y
+func bezier(points [4]float64, t float64) float64 {
+	x1, y1, x2, y2 := points[0], points[1], points[2], points[3]
+	//Each coordinate is a cubic in s with these coefficients
+	cx := 3 * x1
+	bx := 3*(x2-x1) - cx
+	ax := 1 - cx - bx
+	cy := 3 * y1
+	by := 3*(y2-y1) - cy
+	ay := 1 - cy - by
+	sampleX := func(s float64) float64 { return ((ax*s+bx)*s + cx) * s }
+
+	//Newton's method is fast when the slope is steep enough, bisection always works
+	s := t
+	for i := 0; i < 8; i++ {
+		slope := (3*ax*s+2*bx)*s + cx
+		if math.Abs(slope) < 1e-6 {
+			break
+		}
+		s -= (sampleX(s) - t) / slope
+	}
+	if s < 0 || s > 1 || math.Abs(sampleX(s)-t) > 1e-7 {
+		low, high := 0.0, 1.0
+		s = t
+		for i := 0; i < 64 && math.Abs(sampleX(s)-t) > 1e-9; i++ {
+			if sampleX(s) < t {
+				low = s
+			} else {
+				high = s
+			}
+			s = (low + high) / 2
+		}
+	}
+	return ((ay*s+by)*s + cy) * s
+}
+
+func clamp(t float64) float64 {
+	return math.Max(0, math.Min(1, t))
+}
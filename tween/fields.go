@@ -0,0 +1,207 @@
+package tween
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//Reads and writes one animatable field of a component as a list of floats,
+//a position is two values and a color four
+type Accessor[T component.Component] struct {
+	Get func(T) []float64
+	//Returns the component with the field set to values
+	Set func(T, []float64) T
+}
+
+//The fields of T that tweens can animate, by name. Pass it to AddTweening or
+//NewTweenService so tweens can reach T.
+type Fields[T component.Component] struct {
+	accessors map[string]Accessor[T]
+}
+
+//Creates an empty set of fields for T
+func NewFields[T component.Component]() Fields[T] {
+	return Fields[T]{}
+}
+
+//Returns a copy with the named field added, a field with the same name is
+//replaced
+func (f Fields[T]) With(field string, get func(T) []float64, set func(T, []float64) T) Fields[T] {
+	accessors := make(map[string]Accessor[T], len(f.accessors)+1)
+	for name, accessor := range f.accessors {
+		accessors[name] = accessor
+	}
+	accessors[field] = Accessor[T]{Get: get, Set: set}
+	return Fields[T]{accessors: accessors}
+}
+
+//Returns the accessor of the named field
+func (f Fields[T]) Field(field string) (Accessor[T], bool) {
+	accessor, ok := f.accessors[field]
+	return accessor, ok
+}
+
+//Returns the name steps use for T, its registered name or its type name if it
+//is not registered
+func (f Fields[T]) Component() string {
+	return componentName[T]()
+}
+
+func (f Fields[T]) access() world.ComponentAccess {
+	return world.NewComponentAccess[T](world.WriteAccess)
+}
+
+func (f Fields[T]) storage() (reflect.Type, component.ComponentStorage) {
+	return component.ReflectType[T](), component.NewVectorStorage[T]()
+}
+
+func (f Fields[T]) bind(service world.Service) (boundTarget, error) {
+	storage, err := world.GetWriteStorage[T](service)
+	if err != nil {
+		return nil, err
+	}
+	return boundFields[T]{f, storage}, nil
+}
+
+//A component type tweens can animate, made with NewFields
+type Target interface {
+	//The name steps use for the component
+	Component() string
+
+	access() world.ComponentAccess
+	//Returns the type of the component and an empty storage for it
+	storage() (reflect.Type, component.ComponentStorage)
+	bind(world.Service) (boundTarget, error)
+}
+
+//A Target with the storage of the running service
+type boundTarget interface {
+	//Returns false if the entity does not have the component
+	get(e component.EntityID, field string) ([]float64, bool, error)
+	set(e component.EntityID, field string, values []float64) error
+}
+
+type boundFields[T component.Component] struct {
+	fields  Fields[T]
+	storage component.WriteStorage[T]
+}
+
+func (b boundFields[T]) accessor(field string) (Accessor[T], error) {
+	accessor, ok := b.fields.Field(field)
+	if !ok {
+		return Accessor[T]{}, fmt.Errorf("component %s has no tweenable field %s", b.fields.Component(), field)
+	}
+	return accessor, nil
+}
+
+func (b boundFields[T]) get(e component.EntityID, field string) ([]float64, bool, error) {
+	accessor, err := b.accessor(field)
+	if err != nil {
+		return nil, false, err
+	}
+	value, err := b.storage.GetComponent(e)
+	if err != nil {
+		return nil, false, nil
+	}
+	return accessor.Get(value), true, nil
+}
+
+func (b boundFields[T]) set(e component.EntityID, field string, values []float64) error {
+	accessor, err := b.accessor(field)
+	if err != nil {
+		return err
+	}
+	value, err := b.storage.GetComponent(e)
+	if err != nil {
+		return err
+	}
+	return b.storage.Write(e, accessor.Set(value, values))
+}
+
+func componentName[T component.Component]() string {
+	componentType := component.ReflectType[T]()
+	if name, ok := component.LookupName(componentType); ok {
+		return name
+	}
+	return componentType.Name()
+}
+
+/***************************/
+/*    Built in fields      */
+
+//Returns the fields of a Transform, "position" and "scale" are two values and
+//"rotation" is one in radians. Setting one keeps the others and the skew.
+func TransformFields() Fields[world.Transform] {
+	return NewFields[world.Transform]().
+		With("position", func(t world.Transform) []float64 {
+			translation := t.Decompose().Translation
+			return []float64{translation[0], translation[1]}
+		}, func(t world.Transform, values []float64) world.Transform {
+			parts := t.Decompose()
+			parts.Translation[0], parts.Translation[1] = values[0], values[1]
+			return world.Transform(parts.Compose())
+		}).
+		With("rotation", func(t world.Transform) []float64 {
+			return []float64{t.Decompose().Rotation}
+		}, func(t world.Transform, values []float64) world.Transform {
+			parts := t.Decompose()
+			parts.Rotation = values[0]
+			return world.Transform(parts.Compose())
+		}).
+		With("scale", func(t world.Transform) []float64 {
+			scale := t.Decompose().Scale
+			return []float64{scale[0], scale[1]}
+		}, func(t world.Transform, values []float64) world.Transform {
+			parts := t.Decompose()
+			parts.Scale[0], parts.Scale[1] = values[0], values[1]
+			return world.Transform(parts.Compose())
+		})
+}
+
+//Returns the fields of a Renderable, "position" and "size" are two values, "z"
+//is one, "color" is red, green, blue and alpha from 0 to 255 and "alpha" is
+//just the alpha
+func RenderableFields() Fields[world.Renderable] {
+	return NewFields[world.Renderable]().
+		With("position", func(r world.Renderable) []float64 {
+			return []float64{r.X, r.Y}
+		}, func(r world.Renderable, values []float64) world.Renderable {
+			r.X, r.Y = values[0], values[1]
+			return r
+		}).
+		With("z", func(r world.Renderable) []float64 {
+			return []float64{r.Z}
+		}, func(r world.Renderable, values []float64) world.Renderable {
+			r.Z = values[0]
+			return r
+		}).
+		With("size", func(r world.Renderable) []float64 {
+			return []float64{r.W, r.H}
+		}, func(r world.Renderable, values []float64) world.Renderable {
+			r.W, r.H = values[0], values[1]
+			return r
+		}).
+		With("color", func(r world.Renderable) []float64 {
+			return []float64{float64(r.Color[0]), float64(r.Color[1]), float64(r.Color[2]), float64(r.Color[3])}
+		}, func(r world.Renderable, values []float64) world.Renderable {
+			for i := range r.Color {
+				r.Color[i] = toChannel(values[i])
+			}
+			return r
+		}).
+		With("alpha", func(r world.Renderable) []float64 {
+			return []float64{float64(r.Color[3])}
+		}, func(r world.Renderable, values []float64) world.Renderable {
+			r.Color[3] = toChannel(values[0])
+			return r
+		})
+}
+
+//Rounds a color value, easings that overshoot are clamped to the channel
+func toChannel(value float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(value))))
+}
@@ -0,0 +1,111 @@
+package tween
+
+import (
+	"sort"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+)
+
+//Sent when a tween finished its last play
+type Finished struct {
+	Tween  component.EntityID
+	Target component.EntityID
+}
+
+//Adds the Tween storage, Events[Finished] and the tween service animating the
+//given targets, along with a storage for each target the dispatcher does not
+//have yet. Without targets it animates TransformFields and RenderableFields.
+func AddTweening(d world.Dispatcher, targets ...Target) error {
+	if len(targets) == 0 {
+		targets = []Target{TransformFields(), RenderableFields()}
+	}
+	for _, target := range targets {
+		storageType, storage := target.storage()
+		if d.GetStorage(storageType) == nil {
+			if err := d.AddStorage(storage); err != nil {
+				return err
+			}
+		}
+	}
+	if err := d.AddStorage(component.NewVectorStorage[Tween]()); err != nil {
+		return err
+	}
+	if err := d.AddStorage(world.NewEvents[Finished]()); err != nil {
+		return err
+	}
+	return d.AddService(NewTweenService(targets...))
+}
+
+//Creates the service that advances every Tween by the tick delta and writes
+//the fields they animate through the WriteStorage of each target. It runs in
+//the UpdateStage. A later target for the same component replaces an earlier
+//one. A tween naming a component or field no target has, or with a negative
+//Speed, is left where it is, the others still advance and the first error is
+//returned.
+func NewTweenService(targets ...Target) world.Service {
+	service := world.NewBaseService("tween")
+	service.SetStage(world.UpdateStage)
+	service.AddRequiredAccessComponent(world.NewComponentAccess[world.TickInfo](world.ReadAccess))
+	service.AddRequiredAccessComponent(world.NewComponentAccess[Tween](world.WriteAccess))
+	service.AddRequiredAccessComponent(world.NewEventAccess[Finished](world.WriteAccess))
+	byName := map[string]Target{}
+	for _, target := range targets {
+		if _, ok := byName[target.Component()]; !ok {
+			service.AddRequiredAccessComponent(target.access())
+		}
+		byName[target.Component()] = target
+	}
+	service.SetRunFunction(func(_ chan world.EntityCreationData, deletion chan component.EntityID) error {
+		ticks, err := world.GetReadStorage[world.TickInfo](service)
+		if err != nil {
+			return err
+		}
+		tweens, err := world.GetWriteStorage[Tween](service)
+		if err != nil {
+			return err
+		}
+		events, err := world.GetEventWriter[Finished](service)
+		if err != nil {
+			return err
+		}
+		bound := make(map[string]boundTarget, len(byName))
+		for name, target := range byName {
+			if bound[name], err = target.bind(service); err != nil {
+				return err
+			}
+		}
+		delta := ticks.MustGetComponent(0).Delta
+		//Sorted so tweens on the same field always apply in the same order
+		entities := tweens.GetEntities()
+		sort.Slice(entities, func(i, j int) bool { return entities[i] < entities[j] })
+		var failed error
+		for _, e := range entities {
+			tween := tweens.MustGetComponent(e)
+			if tween.Paused || tween.Finished {
+				continue
+			}
+			finished, err := tween.advance(delta, bound)
+			//Written back even if a field could not be set, so the start values
+			//captured before it are kept
+			if err := tweens.Write(e, tween); err != nil {
+				return err
+			}
+			if err != nil {
+				if failed == nil {
+					failed = err
+				}
+				continue
+			}
+			if !finished {
+				continue
+			}
+			events.Send(Finished{Tween: e, Target: tween.Target})
+			if tween.Despawn {
+				deletion <- e
+			}
+		}
+		return failed
+	})
+	return service
+}
@@ -0,0 +1,298 @@
+package tween
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/jevans40/Ruthenium/component"
+)
+
+func init() {
+	component.MustRegister("Tween", Tween{})
+}
+
+/***************************/
+/*         Steps           */
+
+//What a Step does
+type StepKind int
+
+const (
+	//Moves a field from From to To over the duration
+	FieldStep StepKind = iota
+	//Waits for the duration
+	DelayStep
+	//Plays Steps one after the other
+	SequenceStep
+	//Plays Steps at the same time, it lasts as long as the longest one
+	ParallelStep
+)
+
+//One part of what a tween plays, steps nest into sequences and parallel groups
+type Step struct {
+	Kind StepKind
+	//The name of the component and its field, see Fields
+	Component string
+	Field     string
+	//The values the field starts at, nil starts from the value it has when the
+	//step starts
+	From     []float64
+	To       []float64
+	Duration time.Duration
+	Ease     Easing
+	//The children of sequences and parallel groups
+	Steps []Step
+}
+
+//Creates a step that moves the field of T from its current value to to
+func To[T component.Component](field string, duration time.Duration, ease Easing, to ...float64) Step {
+	return Step{Kind: FieldStep, Component: componentName[T](), Field: field, To: to, Duration: duration, Ease: ease}
+}
+
+//Creates a step that moves the field of T from from to to
+func FromTo[T component.Component](field string, duration time.Duration, ease Easing, from, to []float64) Step {
+	step := To[T](field, duration, ease, to...)
+	step.From = from
+	return step
+}
+
+func Delay(duration time.Duration) Step {
+	return Step{Kind: DelayStep, Duration: duration}
+}
+
+func Sequence(steps ...Step) Step {
+	return Step{Kind: SequenceStep, Steps: steps}
+}
+
+func Parallel(steps ...Step) Step {
+	return Step{Kind: ParallelStep, Steps: steps}
+}
+
+//Returns how long the step takes to play once
+func (s Step) Length() time.Duration {
+	var length time.Duration
+	switch s.Kind {
+	case SequenceStep:
+		for _, step := range s.Steps {
+			length += step.Length()
+		}
+	case ParallelStep:
+		for _, step := range s.Steps {
+			if stepLength := step.Length(); stepLength > length {
+				length = stepLength
+			}
+		}
+	default:
+		if s.Duration > 0 {
+			length = s.Duration
+		}
+	}
+	return length
+}
+
+//A field step and when it starts in its tween
+type leaf struct {
+	step  Step
+	start time.Duration
+}
+
+//Returns the field steps under s in the order they start, steps starting at
+//the same time keep their order in the tree
+func (s Step) leaves() []leaf {
+	var leaves []leaf
+	s.flatten(0, &leaves)
+	sort.SliceStable(leaves, func(i, j int) bool { return leaves[i].start < leaves[j].start })
+	return leaves
+}
+
+func (s Step) flatten(start time.Duration, leaves *[]leaf) {
+	switch s.Kind {
+	case FieldStep:
+		*leaves = append(*leaves, leaf{s, start})
+	case SequenceStep:
+		for _, step := range s.Steps {
+			step.flatten(start, leaves)
+			start += step.Length()
+		}
+	case ParallelStep:
+		for _, step := range s.Steps {
+			step.flatten(start, leaves)
+		}
+	}
+}
+
+/***************************/
+/*         Tween           */
+
+//Repeat value that plays a tween until it is removed
+const RepeatForever = -1
+
+//Plays Step on the components of Target. A tween entity can animate itself or
+//any other entity, targets without the component a step animates are skipped.
+type Tween struct {
+	Target component.EntityID
+	Step   Step
+	//How many more times the tween plays after the first, RepeatForever never
+	//stops
+	Repeat int
+	//Plays every other repeat backwards
+	Yoyo bool
+	//Scales the time the tween advances by, 0 plays it at normal speed. A
+	//negative speed is an error, the tween does not advance then.
+	Speed  float64
+	Paused bool
+	//Deletes the tween entity once it finished
+	Despawn bool
+	//How far into the current play the tween is
+	Elapsed time.Duration
+	//How many plays finished
+	Plays int
+	//Set once every play finished, the fields stay at their end values
+	Finished bool
+
+	//The start values of each field step once it started, by leaf. Never
+	//changed in place since read storages share it.
+	from [][]float64
+}
+
+func (t Tween) GetType() reflect.Type { return reflect.TypeOf(t) }
+func (t Tween) IsComponent()          {}
+
+//Creates a tween that plays the steps in sequence on target
+func NewTween(target component.EntityID, steps ...Step) Tween {
+	return Tween{Target: target, Step: Sequence(steps...)}
+}
+
+//Moves the tween delta further and writes the fields it animates. Returns true
+//if the tween finished during this call. Every step is checked first, so
+//neither the tween nor any field is changed if an error is returned.
+func (t *Tween) advance(delta time.Duration, targets map[string]boundTarget) (bool, error) {
+	if t.Paused || t.Finished {
+		return false, nil
+	}
+	if t.Speed < 0 {
+		return false, fmt.Errorf("tween speed must not be negative, got %v", t.Speed)
+	}
+	leaves := t.Step.leaves()
+	if err := t.check(leaves, targets); err != nil {
+		return false, err
+	}
+	if t.Speed > 0 {
+		delta = time.Duration(float64(delta) * t.Speed)
+	}
+	length := t.Step.Length()
+	t.Elapsed += delta
+	if length > 0 && t.Elapsed < length {
+		return false, t.evaluate(t.Elapsed, length, leaves, targets)
+	}
+
+	//Finish every play the delta went past, each one ends on its last values
+	for {
+		if err := t.evaluate(length, length, leaves, targets); err != nil {
+			return false, err
+		}
+		t.Plays++
+		if length <= 0 || (t.Repeat != RepeatForever && t.Plays > t.Repeat) {
+			t.Elapsed = length
+			t.Finished = true
+			return true, nil
+		}
+		t.Elapsed -= length
+		if t.Elapsed < length {
+			return false, t.evaluate(t.Elapsed, length, leaves, targets)
+		}
+	}
+}
+
+//Writes every field at elapsed into the current play. Steps that have not
+//started yet but did in an earlier play are set back to their start, latest
+//first, then the ones that started are played in order so each one starts from
+//where the steps before it left the field.
+func (t *Tween) evaluate(elapsed, length time.Duration, leaves []leaf, targets map[string]boundTarget) error {
+	if t.Yoyo && t.Plays%2 == 1 {
+		elapsed = length - elapsed
+	}
+	if len(t.from) != len(leaves) {
+		t.from = make([][]float64, len(leaves))
+	}
+	for i := len(leaves) - 1; i >= 0; i-- {
+		if leaves[i].start > elapsed && t.from[i] != nil {
+			if err := t.apply(i, leaves[i], 0, targets); err != nil {
+				return err
+			}
+		}
+	}
+	for i, l := range leaves {
+		if l.start > elapsed {
+			break
+		}
+		progress := 1.0
+		if l.step.Duration > 0 {
+			progress = float64(elapsed-l.start) / float64(l.step.Duration)
+		}
+		if err := t.apply(i, l, progress, targets); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Returns an error if a leaf names a component or field without a target or its
+//values do not match the width of the field
+func (t *Tween) check(leaves []leaf, targets map[string]boundTarget) error {
+	for i, l := range leaves {
+		target, ok := targets[l.step.Component]
+		if !ok {
+			return fmt.Errorf("component %s has no tweenable fields", l.step.Component)
+		}
+		current, exists, err := target.get(t.Target, l.step.Field)
+		if err != nil || !exists {
+			return err
+		}
+		from := l.step.From
+		if i < len(t.from) && t.from[i] != nil {
+			from = t.from[i]
+		}
+		if from == nil {
+			from = current
+		}
+		if len(from) != len(current) || len(l.step.To) != len(current) {
+			return fmt.Errorf("field %s of %s has %d values, the step goes from %d to %d values", l.step.Field, l.step.Component, len(current), len(from), len(l.step.To))
+		}
+	}
+	return nil
+}
+
+//Sets the field of a leaf progress of the way to its end
+func (t *Tween) apply(i int, l leaf, progress float64, targets map[string]boundTarget) error {
+	target, ok := targets[l.step.Component]
+	if !ok {
+		return fmt.Errorf("component %s has no tweenable fields", l.step.Component)
+	}
+	current, exists, err := target.get(t.Target, l.step.Field)
+	if err != nil || !exists {
+		return err
+	}
+	if t.from[i] == nil {
+		from := l.step.From
+		if from == nil {
+			from = current
+		}
+		captured := make([][]float64, len(t.from))
+		copy(captured, t.from)
+		captured[i] = append([]float64{}, from...)
+		t.from = captured
+	}
+	from, to := t.from[i], l.step.To
+	if len(from) != len(current) || len(to) != len(current) {
+		return fmt.Errorf("field %s of %s has %d values, the step goes from %d to %d values", l.step.Field, l.step.Component, len(current), len(from), len(to))
+	}
+	eased := l.step.Ease.Ease(progress)
+	values := make([]float64, len(to))
+	for j := range values {
+		values[j] = from[j] + (to[j]-from[j])*eased
+	}
+	return target.set(t.Target, l.step.Field, values)
+}
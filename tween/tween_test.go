@@ -0,0 +1,261 @@
+package tween
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/world"
+	"github.com/stretchr/testify/assert"
+)
+
+const testStep = time.Second / 10
+
+type testHealth struct {
+	Value float64
+}
+
+func (h testHealth) GetType() reflect.Type { return reflect.TypeOf(h) }
+func (h testHealth) IsComponent()          {}
+
+var healthFields = NewFields[testHealth]().With("value", func(h testHealth) []float64 {
+	return []float64{h.Value}
+}, func(h testHealth, values []float64) testHealth {
+	h.Value = values[0]
+	return h
+})
+
+func newTestDispatcher(t *testing.T, targets ...Target) (world.Dispatcher, component.WriteStorage[Tween]) {
+	d := world.NewSimpleDispatcher()
+	d.SetFixedTimestep(testStep)
+	assert.NoError(t, AddTweening(d, targets...))
+	tweens, _ := component.GetWriteStorage[Tween](d.GetStorage(component.ReflectType[Tween]()))
+	return d, tweens
+}
+
+func getWriteStorage[T component.Component](d world.Dispatcher) component.WriteStorage[T] {
+	storage, _ := component.GetWriteStorage[T](d.GetStorage(component.ReflectType[T]()))
+	return storage
+}
+
+func TestEasing(t *testing.T) {
+	easings := []Easing{Linear, QuadIn, QuadOut, QuadInOut, CubicIn, CubicOut, CubicInOut, ElasticIn, ElasticOut,
+		ElasticInOut, BounceIn, BounceOut, BounceInOut, BackIn, BackOut, BackInOut, CubicBezier(0.25, 0.1, 0.25, 1)}
+	for _, easing := range easings {
+		assert.InDelta(t, 0, easing.Ease(0), 1e-9, "%+v", easing)
+		assert.InDelta(t, 1, easing.Ease(1), 1e-9, "%+v", easing)
+		//Progress outside the step is clamped
+		assert.InDelta(t, 1, easing.Ease(2), 1e-9, "%+v", easing)
+	}
+	assert.Equal(t, 0.25, QuadIn.Ease(0.5))
+	assert.Equal(t, 0.75, QuadOut.Ease(0.5))
+	assert.Equal(t, 0.5, QuadInOut.Ease(0.5))
+	assert.Equal(t, 0.125, CubicIn.Ease(0.5))
+	previous := 0.0
+	for i := 1; i <= 100; i++ {
+		value := QuadInOut.Ease(float64(i) / 100)
+		assert.Greater(t, value, previous)
+		previous = value
+	}
+
+	//Back pulls away first and elastic overshoots
+	assert.Less(t, BackIn.Ease(0.2), 0.0)
+	assert.Greater(t, BackOut.Ease(0.8), 1.0)
+	assert.Greater(t, ElasticOut.Ease(0.1), 1.0)
+	assert.InDelta(t, 0.75, BounceOut.Ease(1.5/2.75), 1e-9)
+
+	//The straight bezier is linear and CSS ease is about 0.8 half way
+	for _, x := range []float64{0.1, 0.3, 0.5, 0.9} {
+		assert.InDelta(t, x, CubicBezier(0, 0, 1, 1).Ease(x), 1e-6)
+	}
+	assert.InDelta(t, 0.8024, CubicBezier(0.25, 0.1, 0.25, 1).Ease(0.5), 1e-3)
+	assert.InDelta(t, 0.5, CubicBezier(0.42, 0, 0.58, 1).Ease(0.5), 1e-6)
+}
+
+func TestSteps(t *testing.T) {
+	step := Sequence(
+		To[world.Renderable]("position", 200*time.Millisecond, Linear, 1, 1),
+		Delay(100*time.Millisecond),
+		Parallel(
+			To[world.Renderable]("alpha", 300*time.Millisecond, Linear, 0),
+			Sequence(Delay(100*time.Millisecond), To[world.Transform]("scale", 50*time.Millisecond, Linear, 2, 2)),
+		),
+	)
+	assert.Equal(t, 600*time.Millisecond, step.Length())
+	leaves := step.leaves()
+	assert.Len(t, leaves, 3)
+	assert.Equal(t, []time.Duration{0, 300 * time.Millisecond, 400 * time.Millisecond},
+		[]time.Duration{leaves[0].start, leaves[1].start, leaves[2].start})
+	assert.Equal(t, "Renderable", leaves[0].step.Component)
+	assert.Equal(t, "Transform", leaves[2].step.Component)
+	assert.Equal(t, "testHealth", To[testHealth]("value", 0, Linear, 1).Component)
+	assert.Equal(t, []float64{0}, FromTo[testHealth]("value", 0, Linear, []float64{0}, []float64{1}).From)
+}
+
+func TestTweenService(t *testing.T) {
+	d, tweens := newTestDispatcher(t)
+	renderables := getWriteStorage[world.Renderable](d)
+	transforms := getWriteStorage[world.Transform](d)
+	assert.NoError(t, renderables.AddEntity(1, world.Renderable{W: 8, H: 8, Color: [4]uint8{255, 255, 255, 255}}))
+	assert.NoError(t, transforms.AddEntity(1, world.NewTransform().Rotate(1)))
+	assert.NoError(t, tweens.AddEntity(10, NewTween(1,
+		To[world.Renderable]("position", 200*time.Millisecond, Linear, 20, 10),
+		Delay(100*time.Millisecond),
+		Parallel(
+			To[world.Renderable]("alpha", 200*time.Millisecond, Linear, 55),
+			To[world.Transform]("scale", 100*time.Millisecond, QuadIn, 3, 2),
+		),
+		To[world.Renderable]("position", 100*time.Millisecond, Linear, 0, 0),
+	)))
+
+	var finished []Finished
+	reader := world.NewBaseService("reader")
+	reader.SetStage(world.RenderStage)
+	reader.AddRequiredAccessComponent(world.NewEventAccess[Finished](world.ReadAccess))
+	reader.SetRunFunction(func(chan world.EntityCreationData, chan component.EntityID) error {
+		events, _ := world.GetEventReader[Finished](reader)
+		finished = append(finished, events.Read()...)
+		return nil
+	})
+	assert.NoError(t, d.AddService(reader))
+
+	position := func() [2]float64 {
+		r := renderables.MustGetComponent(1)
+		return [2]float64{r.X, r.Y}
+	}
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, [2]float64{10, 5}, position())
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, [2]float64{20, 10}, position())
+
+	//The delay leaves everything where it is
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, [2]float64{20, 10}, position())
+	assert.Equal(t, uint8(255), renderables.MustGetComponent(1).Color[3])
+
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, uint8(155), renderables.MustGetComponent(1).Color[3])
+	parts := transforms.MustGetComponent(1).Decompose()
+	assert.InDelta(t, 3, parts.Scale[0], 1e-9)
+	assert.InDelta(t, 2, parts.Scale[1], 1e-9)
+	//Other fields of the transform are kept
+	assert.InDelta(t, 1, parts.Rotation, 1e-9)
+
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, uint8(55), renderables.MustGetComponent(1).Color[3])
+	assert.False(t, tweens.MustGetComponent(10).Finished)
+
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, [2]float64{0, 0}, position())
+	assert.Equal(t, float64(8), renderables.MustGetComponent(1).W)
+	assert.True(t, tweens.MustGetComponent(10).Finished)
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, []Finished{{Tween: 10, Target: 1}}, finished)
+
+	//Finished tweens stay where they ended
+	assert.NoError(t, renderables.Write(1, world.Renderable{X: 5}))
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, [2]float64{5, 0}, position())
+	assert.Len(t, finished, 1)
+}
+
+func TestYoyoAndRepeat(t *testing.T) {
+	d, tweens := newTestDispatcher(t, healthFields)
+	healths := getWriteStorage[testHealth](d)
+	assert.NoError(t, healths.AddEntity(1, testHealth{}))
+	assert.NoError(t, healths.AddEntity(2, testHealth{}))
+	yoyo := NewTween(1, FromTo[testHealth]("value", 200*time.Millisecond, Linear, []float64{0}, []float64{100}))
+	yoyo.Repeat = 2
+	yoyo.Yoyo = true
+	assert.NoError(t, tweens.AddEntity(10, yoyo))
+	//Each repeat starts again from the value the first play started from
+	repeat := NewTween(2, To[testHealth]("value", 100*time.Millisecond, Linear, 10), To[testHealth]("value", 100*time.Millisecond, Linear, 30))
+	repeat.Repeat = RepeatForever
+	assert.NoError(t, tweens.AddEntity(11, repeat))
+
+	var yoyoValues, repeatValues []float64
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, d.Maintain())
+		yoyoValues = append(yoyoValues, healths.MustGetComponent(1).Value)
+		repeatValues = append(repeatValues, healths.MustGetComponent(2).Value)
+	}
+	assert.Equal(t, []float64{50, 100, 50, 0, 50, 100}, yoyoValues)
+	assert.True(t, tweens.MustGetComponent(10).Finished)
+	assert.Equal(t, 3, tweens.MustGetComponent(10).Plays)
+	assert.Equal(t, []float64{10, 0, 10, 0, 10, 0}, repeatValues)
+	assert.False(t, tweens.MustGetComponent(11).Finished)
+	assert.Equal(t, 3, tweens.MustGetComponent(11).Plays)
+}
+
+func TestTweenControls(t *testing.T) {
+	d, tweens := newTestDispatcher(t, healthFields)
+	healths := getWriteStorage[testHealth](d)
+	for e := component.EntityID(1); e <= 3; e++ {
+		assert.NoError(t, healths.AddEntity(e, testHealth{}))
+	}
+	step := To[testHealth]("value", 400*time.Millisecond, Linear, 100)
+	fast := NewTween(1, step)
+	fast.Speed = 2
+	paused := NewTween(2, step)
+	paused.Paused = true
+	assert.NoError(t, tweens.AddEntity(10, fast))
+	assert.NoError(t, tweens.AddEntity(11, paused))
+	assert.NoError(t, tweens.AddEntity(12, NewTween(3, Delay(100*time.Millisecond), step)))
+	//Targets without the component are skipped
+	assert.NoError(t, tweens.AddEntity(13, NewTween(4, step)))
+
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, float64(50), healths.MustGetComponent(1).Value)
+	assert.Equal(t, float64(0), healths.MustGetComponent(2).Value)
+	assert.Equal(t, float64(0), healths.MustGetComponent(3).Value)
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, float64(25), healths.MustGetComponent(3).Value)
+
+	//Bad steps return an error and leave the fields alone
+	targets := map[string]boundTarget{"testHealth": boundFields[testHealth]{healthFields, healths}}
+	for _, bad := range []Step{
+		To[testHealth]("missing", testStep, Linear, 1),
+		To[testHealth]("value", testStep, Linear, 1, 2),
+		To[world.Renderable]("alpha", testStep, Linear, 1),
+	} {
+		tween := NewTween(1, bad)
+		_, err := tween.advance(testStep, targets)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, float64(100), healths.MustGetComponent(1).Value)
+
+	//A bad step after a good one leaves the good one alone too, so the tween
+	//starts from the same values once it is fixed
+	partial := NewTween(1, Parallel(To[testHealth]("value", testStep, Linear, 0), To[testHealth]("missing", testStep, Linear, 1)))
+	_, err := partial.advance(testStep/2, targets)
+	assert.Error(t, err)
+	assert.Equal(t, float64(100), healths.MustGetComponent(1).Value)
+	assert.Equal(t, time.Duration(0), partial.Elapsed)
+	assert.Nil(t, partial.from)
+
+	backwards := NewTween(1, step)
+	backwards.Speed = -1
+	_, err = backwards.advance(testStep, targets)
+	assert.Error(t, err)
+	assert.Equal(t, float64(100), healths.MustGetComponent(1).Value)
+	assert.Equal(t, time.Duration(0), backwards.Elapsed)
+}
+
+func TestDespawn(t *testing.T) {
+	d, tweens := newTestDispatcher(t, healthFields)
+	healths := getWriteStorage[testHealth](d)
+	assert.NoError(t, healths.AddEntity(100, testHealth{Value: 10}))
+	tween := NewTween(100, To[testHealth]("value", 200*time.Millisecond, CubicOut, 0))
+	tween.Despawn = true
+	d.Spawn(world.EntityCreationData{NumEntities: 1, Components: []world.StorageWriteable{world.MakeWriteableStorage(tween, tweens)}})
+
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, []component.EntityID{0}, d.GetEntities())
+	assert.NoError(t, d.Maintain())
+	assert.InDelta(t, 1.25, healths.MustGetComponent(100).Value, 1e-9)
+	assert.NoError(t, d.Maintain())
+	assert.Equal(t, float64(0), healths.MustGetComponent(100).Value)
+	assert.Empty(t, d.GetEntities())
+	assert.Equal(t, 0, tweens.GetSize())
+}
@@ -4,12 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/jevans40/Ruthenium/component"
 	"github.com/jevans40/Ruthenium/constants"
-	"github.com/jevans40/Ruthenium/ruthutil"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -21,6 +21,9 @@ type Dispatcher interface {
 
 	//This method will both maintain all updates queued for storages
 	//It will run all services currently on this dispatcher for one step
+	//Entities requested by services are created and deleted after every service
+	//finished, sorted by the services position in the schedule and then by the
+	//order each service sent them in, so entity IDs do not depend on timing.
 	Maintain() error
 
 	//Adds a service to the list of managed services.
@@ -50,6 +53,44 @@ type Dispatcher interface {
 
 	//Stops all managed and internal services.
 	StopServices() error
+
+	//Returns the tracer used to record the timeline of a tick.
+	//Tracing is disabled until Tracer.Capture is called.
+	GetTracer() *Tracer
+
+	//Returns the lifecycle hooks, they are run at the end of every Maintain
+	GetHooks() *LifecycleHooks
+
+	//Returns the storage with the given type or nil if it does not exist
+	GetStorage(storageType reflect.Type) component.ComponentStorage
+
+	//Returns every storage in the order they were added
+	GetStorages() []component.ComponentStorage
+
+	//Returns the IDs of all living entities in ascending order
+	GetEntities() []component.EntityID
+
+	//Queues entities to be created during the next Maintain, for code that runs
+	//outside of a service such as level loading. Services should use their
+	//EntityCreation channel instead.
+	Spawn(data EntityCreationData)
+
+	//Makes every tick advance TickInfo by step instead of the measured time since
+	//the last tick, so a run only depends on the number of ticks. 0 goes back to
+	//measuring time.
+	SetFixedTimestep(step time.Duration)
+
+	//Returns the fixed timestep or 0 if ticks measure time
+	GetFixedTimestep() time.Duration
+
+	//In deterministic mode the services of a batch run one after another in
+	//schedule order instead of at the same time, so anything they share outside
+	//of storages also sees the same order on every run, and Maintain fails
+	//unless a fixed timestep is set. Entity creation and deletion requests are
+	//always applied in schedule order, see Maintain.
+	SetDeterministic(deterministic bool)
+
+	IsDeterministic() bool
 }
 
 var _ Dispatcher = &simpleDispatcher{}
@@ -70,13 +111,22 @@ type simpleDispatcher struct {
 	toDelete         []component.EntityID
 
 	//Channels
-	errorChannel    chan error
-	entityCreations chan EntityCreationData
-	entityDeletions chan component.EntityID
+	errorChannel chan error
 
 	//Mutex
-	entityWrite     sync.Mutex
-	entityProcessed sync.WaitGroup
+	entityWrite sync.Mutex
+
+	tracer     *Tracer
+	hooks      *LifecycleHooks
+	membership *membershipIndex
+
+	spawnLock sync.Mutex
+	spawns    []EntityCreationData
+
+	tickInfo      component.WriteStorage[TickInfo]
+	lastTick      time.Time
+	fixedStep     time.Duration
+	deterministic bool
 
 	t1    time.Time
 	t2    time.Time
@@ -85,15 +135,21 @@ type simpleDispatcher struct {
 }
 
 func NewSimpleDispatcher() Dispatcher {
-	return &simpleDispatcher{entities: make(map[component.EntityID]component.Entity),
-		errorChannel:    make(chan error, 100*constants.RACECHANNELSIZETEST),
-		entityCreations: make(chan EntityCreationData, 100*constants.RACECHANNELSIZETEST),
-		entityDeletions: make(chan component.EntityID, 100*constants.RACECHANNELSIZETEST),
-		running:         false,
-		t1:              time.UnixMilli(0),
-		t2:              time.UnixMilli(0),
-		t3:              time.UnixMilli(0),
-		dbgnm:           0}
+	tickStorage := component.NewResourceStorage(TickInfo{})
+	tickInfo, _ := component.GetWriteStorage[TickInfo](tickStorage)
+	d := &simpleDispatcher{entities: make(map[component.EntityID]component.Entity),
+		errorChannel: make(chan error, 100*constants.RACECHANNELSIZETEST),
+		running:      false,
+		tracer:       NewTracer(),
+		hooks:        NewLifecycleHooks(),
+		membership:   newMembershipIndex(),
+		t1:           time.UnixMilli(0),
+		t2:           time.UnixMilli(0),
+		t3:           time.UnixMilli(0),
+		tickInfo:     tickInfo,
+		dbgnm:        0}
+	d.AddStorage(tickStorage)
+	return d
 }
 
 func (d *simpleDispatcher) Maintain() error {
@@ -101,101 +157,87 @@ func (d *simpleDispatcher) Maintain() error {
 	if !d.running {
 		d.StartServices()
 	}
-
-	d.entityProcessed.Add(2)
-	if ruthutil.IsChannelClosed(d.entityCreations) {
-		d.entityCreations = make(chan EntityCreationData, 100*constants.RACECHANNELSIZETEST)
+	if d.deterministic && d.fixedStep <= 0 {
+		return errors.New("deterministic mode needs a fixed timestep")
 	}
+	d.tracer.NameLane(traceDispatcherLane, "dispatcher")
+	d.tracer.Begin(traceDispatcherLane, "tick", "dispatcher")
 
-	if ruthutil.IsChannelClosed(d.entityDeletions) {
-		d.entityDeletions = make(chan component.EntityID, 100*constants.RACECHANNELSIZETEST)
-	}
+	//Every service gets its own request channels, see requestQueue
+	creations := &requestQueue[EntityCreationData]{}
+	deletions := &requestQueue[component.EntityID]{}
 
-	go d.startEntityCreationService()
-	go d.startEntityDeletionService()
+	//Advance the tick clock before any service can read it
+	d.advanceTick()
 
 	//GetService Requirements and start them
-
-	var comChannels []chan updateSignal
-	var resReq [][]ComponentAccess
-	var servReq [][]string
-	var servicesNames []string
-
-	for _, v := range d.services {
-		servicesNames = append(servicesNames, v.GetName())
-		comChannels = append(comChannels, v.GetChannel())
-		resReq = append(resReq, v.GetStorages())
-		servReq = append(servReq, v.GetServices())
-	}
-
-	newTree := greedyAllocationTree{allocated: make(map[string]bool)}
-	err := newTree.AddStystems(servicesNames, resReq, servReq)
+	serviceOrder, err := buildSchedule(d.services)
 	if err != nil {
 		return err
 	}
-	serviceOrder := newTree.GetSystemTree()
 
 	time1 := time.Now()
-	//fmt.Println(serviceOrder)
-	for _, batch := range serviceOrder {
-		for i, s := range d.services {
-			time2 := time.Now()
-			for _, c := range batch {
-				if s.GetName() == c {
-					var toUpdate []component.ComponentStorage
-					for _, k := range resReq[i] {
-						for _, j := range d.storages {
-							if k.DataType == j.GetType() {
-								toUpdate = append(toUpdate, j)
-							}
-						}
+	for batchNum, batch := range serviceOrder {
+		batchName := fmt.Sprintf("batch %d", batchNum)
+		d.tracer.Begin(traceDispatcherLane, batchName, "batch")
+		time2 := time.Now()
+		//Conditions are checked before any service in the batch starts,
+		//so they always see the writes of every earlier batch.
+		var toRun []int
+		for _, i := range batch {
+			if d.shouldRun(d.services[i]) {
+				toRun = append(toRun, i)
+			}
+		}
+		for _, i := range toRun {
+			s := d.services[i]
+			var toUpdate []component.ComponentStorage
+			for _, k := range s.GetStorages() {
+				for _, j := range d.storages {
+					if k.DataType == j.GetType() {
+						toUpdate = append(toUpdate, j)
 					}
-					s.UpdateStoragePointers(toUpdate)
-					go s.StartService(d.errorChannel, updateSignal{d.entityCreations, d.entityDeletions})
-					//fmt.Printf("sent for service %s \n", s.GetName())
 				}
-
 			}
-			d.t2 = d.t2.Add(time.Since(time2))
+			s.UpdateStoragePointers(toUpdate)
+			d.tracer.NameLane(traceServiceLane+i, s.GetName())
+			go s.StartService(d.errorChannel, updateSignal{creations.open(), deletions.open(), d.tracer, traceServiceLane + i})
+			if d.deterministic {
+				d.waitForServices(1)
+			}
 		}
+		d.t2 = d.t2.Add(time.Since(time2))
 		time3 := time.Now()
-		for i := 0; i < len(batch); i++ {
-			//fmt.Println(len(batch))
-			//fmt.Println(i)
-			err, ok := <-d.errorChannel
-			//log.Error(err)
-			if !ok {
-				panic("error channel closed unexpectedly")
-			}
-			if err != nil {
-				//log.Error(err)
-			}
+		if !d.deterministic {
+			d.waitForServices(len(toRun))
 		}
 		d.t3 = d.t3.Add(time.Since(time3))
+		d.tracer.End(traceDispatcherLane, batchName, "batch")
 	}
 	d.t1 = d.t1.Add(time.Since(time1))
 
-	close(d.entityCreations)
-	close(d.entityDeletions)
-	d.entityProcessed.Wait()
-
-	//TODO: Optimization: So this should be reformatted to create a smarter deletion process. This is a time consuming part of the update loop,
-	//But this is the first thing I thought of.
-	//var toRemove []component.EntityID
-	//for i, entity := range d.entities {
-	//	if entity.Deleted {
-
-	//		for _, storage := range d.storages {
-	//			storage.DeleteEntity(entity.EntityNum)
-	//		}
-	//		toRemove = append(toRemove, i)
-	//	}
-	//}
+	d.createRequestedEntities(creations.close())
+	d.deleteRequestedEntities(deletions.close())
 
+	d.despawnDescendants()
+	d.despawnEntities(d.toDelete)
 	for _, i := range d.toDelete {
 		delete(d.entities, i)
 	}
 	d.toDelete = []component.EntityID{}
+
+	d.tracer.Begin(traceDispatcherLane, "lifecycle hooks", "dispatcher")
+	d.hooks.flush()
+	d.tracer.End(traceDispatcherLane, "lifecycle hooks", "dispatcher")
+
+	//Events sent this tick stay readable for one more tick
+	for _, storage := range d.storages {
+		if events, ok := storage.(eventBuffer); ok {
+			events.swapBuffers()
+		}
+	}
+	d.tracer.End(traceDispatcherLane, "tick", "dispatcher")
+	traceErr := d.tracer.endTick()
 	if d.dbgnm%100 == 99 {
 		fmt.Printf("Dispatcher T1: %d, T2: %d, T3: %d\n", d.t1.UnixMilli()/100, d.t2.UnixMilli()/100, d.t3.UnixMilli()/100)
 		d.t1 = time.UnixMilli(0)
@@ -203,7 +245,7 @@ func (d *simpleDispatcher) Maintain() error {
 		d.t3 = time.UnixMilli(0)
 	}
 	d.dbgnm++
-	return nil
+	return traceErr
 }
 
 func (d *simpleDispatcher) AddService(newService Service) error {
@@ -226,6 +268,10 @@ func (d *simpleDispatcher) AddStorage(newStorage component.ComponentStorage) err
 		}
 	}
 	d.storages = append(d.storages, newStorage)
+	if observable, ok := newStorage.(component.ObservableStorage); ok {
+		d.membership.addStorage(newStorage)
+		observable.AddObserver(d.membership)
+	}
 	return nil
 }
 
@@ -243,6 +289,10 @@ func (d *simpleDispatcher) RemoveStorage(thisType reflect.Type) error {
 	for i, s := range d.storages {
 		if s.GetType() == thisType {
 			d.storages = append(d.storages[:i], d.storages[i+1:]...)
+			if observable, ok := s.(component.ObservableStorage); ok {
+				observable.RemoveObserver(d.membership)
+				d.membership.removeStorage(thisType)
+			}
 			return nil
 		}
 	}
@@ -266,6 +316,110 @@ func (d *simpleDispatcher) StartServices() error {
 	return nil
 }
 
+//Updates the TickInfo resource for the tick about to run
+func (d *simpleDispatcher) advanceTick() {
+	now := time.Now()
+	info := d.tickInfo.MustGetComponent(0)
+	first := d.lastTick.IsZero()
+	if !first {
+		info.Tick++
+	}
+	switch {
+	case d.fixedStep > 0:
+		info.Delta = d.fixedStep
+	case first:
+		info.Delta = 0
+	default:
+		info.Delta = now.Sub(d.lastTick)
+	}
+	info.Elapsed += info.Delta
+	d.lastTick = now
+	d.tickInfo.Write(0, info)
+}
+
+//Returns true if the service is awake and all of its run conditions pass
+func (d *simpleDispatcher) shouldRun(s Service) bool {
+	if s.IsAsleep() {
+		return false
+	}
+	ctx := ConditionContext{Tick: d.tickInfo.MustGetComponent(0), storages: d.storages}
+	for _, c := range s.GetRunConditions() {
+		if !c.ShouldRun(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *simpleDispatcher) SetFixedTimestep(step time.Duration) {
+	d.fixedStep = step
+}
+
+func (d *simpleDispatcher) GetFixedTimestep() time.Duration {
+	return d.fixedStep
+}
+
+func (d *simpleDispatcher) SetDeterministic(deterministic bool) {
+	d.deterministic = deterministic
+}
+
+func (d *simpleDispatcher) IsDeterministic() bool {
+	return d.deterministic
+}
+
+//Waits until count started services have finished
+func (d *simpleDispatcher) waitForServices(count int) {
+	for i := 0; i < count; i++ {
+		err, ok := <-d.errorChannel
+		if !ok {
+			panic("error channel closed unexpectedly")
+		}
+		if err != nil {
+			//log.Error(err)
+		}
+	}
+}
+
+func (d *simpleDispatcher) GetTracer() *Tracer {
+	return d.tracer
+}
+
+func (d *simpleDispatcher) GetHooks() *LifecycleHooks {
+	return d.hooks
+}
+
+func (d *simpleDispatcher) GetStorages() []component.ComponentStorage {
+	return append([]component.ComponentStorage{}, d.storages...)
+}
+
+func (d *simpleDispatcher) GetEntities() []component.EntityID {
+	d.entityWrite.Lock()
+	defer d.entityWrite.Unlock()
+	entities := make([]component.EntityID, 0, len(d.entities))
+	for k, v := range d.entities {
+		if !v.Deleted {
+			entities = append(entities, k)
+		}
+	}
+	sort.Slice(entities, func(i, j int) bool { return entities[i] < entities[j] })
+	return entities
+}
+
+func (d *simpleDispatcher) Spawn(data EntityCreationData) {
+	d.spawnLock.Lock()
+	defer d.spawnLock.Unlock()
+	d.spawns = append(d.spawns, data)
+}
+
+func (d *simpleDispatcher) GetStorage(storageType reflect.Type) component.ComponentStorage {
+	for _, v := range d.storages {
+		if v.GetType() == storageType {
+			return v
+		}
+	}
+	return nil
+}
+
 func (d *simpleDispatcher) StopServices() error {
 	if d.running {
 		return errors.New("services already stopped")
@@ -277,68 +431,146 @@ func (d *simpleDispatcher) StopServices() error {
 	return nil
 }
 
-//Start this function in a seperate goroutine to handle entity deletion/creation requests.
+//Every service that runs gets its own creation and deletion channel, so requests
+//are applied sorted by (schedule index, submission order) no matter how the
+//service goroutines interleaved. Channels are opened in schedule order and
+//drained while the services run, so a service never blocks on a full channel.
+type requestQueue[T any] struct {
+	wg       sync.WaitGroup
+	channels []chan T
+	requests []*[]T
+}
+
+//Returns the channel of the next service in the schedule
+func (q *requestQueue[T]) open() chan T {
+	channel := make(chan T, 100*constants.RACECHANNELSIZETEST)
+	requests := &[]T{}
+	q.channels = append(q.channels, channel)
+	q.requests = append(q.requests, requests)
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		for request := range channel {
+			*requests = append(*requests, request)
+		}
+	}()
+	return channel
+}
+
+//Closes every channel and returns the requests ordered by the schedule index of
+//the service that sent them, then by the order they were sent in
+func (q *requestQueue[T]) close() []T {
+	for _, channel := range q.channels {
+		close(channel)
+	}
+	q.wg.Wait()
+	var ordered []T
+	for _, requests := range q.requests {
+		ordered = append(ordered, *requests...)
+	}
+	return ordered
+}
+
+//Creates the entities requested during the tick once every service finished.
 //Will set a writeEntity mutex lock.
-func (d *simpleDispatcher) startEntityCreationService() {
-	var toAdd []int
-	var toAddComp [][]StorageWriteable
-	var channels []chan component.EntityID
-	for {
-		ent, err := ruthutil.WaitChannel(d.entityCreations)
-		if err != nil {
-			break
+func (d *simpleDispatcher) createRequestedEntities(requested []EntityCreationData) {
+	//Entities queued with Spawn are created before the ones requested by services
+	d.spawnLock.Lock()
+	toCreate := d.spawns
+	d.spawns = nil
+	d.spawnLock.Unlock()
+	toCreate = append(toCreate, requested...)
+	d.tracer.NameLane(traceCreationLane, "entity creation")
+	d.tracer.Begin(traceCreationLane, "create entities", "entities")
+	d.entityWrite.Lock()
+	for _, v := range toCreate {
+		if v.NumEntities > 0 {
+			d.createEntities(v, nil)
 		}
-		if ent.NumEntities < 0 {
+	}
+	d.entityWrite.Unlock()
+	d.tracer.End(traceCreationLane, "create entities", "entities")
+}
+
+//Removes the components of all despawned entities. The membership index groups
+//them by storage so each storage they are in gets one DeleteEntityMultiple call.
+func (d *simpleDispatcher) despawnEntities(entities []component.EntityID) {
+	if len(entities) == 0 {
+		return
+	}
+	d.tracer.Begin(traceDispatcherLane, "despawn entities", "entities")
+	grouped := d.membership.groupByStorage(entities)
+	for _, storage := range d.storages {
+		toDelete, ok := grouped[storage.GetType()]
+		if !ok {
 			continue
 		}
-		toAdd = append(toAdd, ent.NumEntities)
-		toAddComp = append(toAddComp, ent.Components)
-		channels = append(channels, ent.CreatedEntitiesCallback)
+		err := storage.DeleteEntityMultiple(toDelete)
+		if err != nil {
+			log.Errorf("failed to despawn entities from %s: %s", storage.GetType(), err)
+		}
 	}
-	d.entityWrite.Lock()
-	for i, v := range channels {
-		for j := 0; j < toAdd[i]; j++ {
-			newID := component.EntityID(d.entityNum)
-			d.entities[newID] = component.Entity{newID, false}
-			for _, k := range toAddComp[i] {
-				k.AddComponentWithEntityID(newID)
-			}
+	d.tracer.End(traceDispatcherLane, "despawn entities", "entities")
+}
+
+//Creates the requested entities and their children, must hold the entityWrite lock
+func (d *simpleDispatcher) createEntities(data EntityCreationData, parent *component.EntityID) {
+	for j := 0; j < data.NumEntities; j++ {
+		newID := component.EntityID(d.entityNum)
+		d.entityNum++
+		d.entities[newID] = component.Entity{EntityNum: newID, Deleted: false}
+		d.hooks.entityCreated(newID)
+		for _, k := range data.Components {
+			k.AddComponentWithEntityID(newID)
+		}
+		if parent != nil {
+			d.setParent(newID, *parent)
+		}
+		if data.CreatedEntitiesCallback != nil {
 			select {
 
-			case v <- newID:
+			case data.CreatedEntitiesCallback <- newID:
 
 			default:
 				log.Info("attempted to send an entity to a full channel")
 			}
-			d.entityNum++
+		}
+		for _, child := range data.Children {
+			d.createEntities(child, &newID)
 		}
 	}
-	d.entityWrite.Unlock()
-	d.entityProcessed.Done()
 }
 
-//TODO: Add a lazy Componnent Addition/Deletion Service
+func (d *simpleDispatcher) setParent(entity component.EntityID, parent component.EntityID) {
+	storage := d.GetStorage(component.ReflectType[Parent]())
+	if storage == nil {
+		log.WithFields(log.Fields{"entity": entity}).Error("created a child entity without a Parent storage")
+		return
+	}
+	if err := storage.AddComponent(entity, Parent{Entity: parent}); err != nil {
+		log.WithFields(log.Fields{"entity": entity}).Error(err)
+	}
+}
 
-func (d *simpleDispatcher) startEntityDeletionService() {
-	var toDelete []component.EntityID
-	for {
-		delete, err := ruthutil.WaitChannel(d.entityDeletions)
-		if err != nil {
-			break
-		}
+//TODO: Add a lazy Componnent Addition/Deletion Service
 
-		if delete < 0 {
-			continue
-		}
-		toDelete = append(toDelete, delete)
-	}
+//Marks the entities requested during the tick as deleted, they are despawned at
+//the end of Maintain. Will set a writeEntity mutex lock.
+func (d *simpleDispatcher) deleteRequestedEntities(toDelete []component.EntityID) {
+	d.tracer.NameLane(traceDeletionLane, "entity deletion")
+	d.tracer.Begin(traceDeletionLane, "delete entities", "entities")
 	d.entityWrite.Lock()
 	for _, v := range toDelete {
-		d.entities[v] = component.Entity{d.entities[v].EntityNum, true}
+		//Skip entities that never existed or were already despawned this tick
+		if entity, ok := d.entities[v]; v < 0 || !ok || entity.Deleted {
+			continue
+		}
+		d.entities[v] = component.Entity{EntityNum: v, Deleted: true}
 		d.toDelete = append(d.toDelete, v)
+		d.hooks.entityDespawned(v)
 	}
 	d.entityWrite.Unlock()
-	d.entityProcessed.Done()
+	d.tracer.End(traceDeletionLane, "delete entities", "entities")
 }
 
 /***************************/
@@ -355,14 +587,14 @@ func (b *branchLevel) AddLevel() {
 }
 
 func (b *branchLevel) AddSystem(system string, res []ComponentAccess, req []string) bool {
+	//Required systems may have been pushed down to a later level, so this
+	//system has to be placed below all of them, not just this level's.
 	for _, s := range req {
-		for _, k := range b.AllocatedSystems {
-			if s == k {
-				if b.NextLevel == nil {
-					b.NextLevel = &branchLevel{}
-				}
-				return b.NextLevel.AddSystem(system, res, req)
+		if b.allocatedAtOrBelow(s) {
+			if b.NextLevel == nil {
+				b.NextLevel = &branchLevel{}
 			}
+			return b.NextLevel.AddSystem(system, res, req)
 		}
 	}
 	for _, r := range res {
@@ -405,6 +637,17 @@ func (b *branchLevel) AddSystem(system string, res []ComponentAccess, req []stri
 	return true
 }
 
+func (b *branchLevel) allocatedAtOrBelow(system string) bool {
+	for level := b; level != nil; level = level.NextLevel {
+		for _, k := range level.AllocatedSystems {
+			if system == k {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (b *branchLevel) GetSystemTree(tree [][]string) [][]string {
 	tree = append(tree, b.AllocatedSystems)
 	if b.NextLevel != nil {
@@ -0,0 +1,205 @@
+package world
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/jevans40/Ruthenium/component"
+)
+
+var _ component.ComponentStorage = &Events[int]{}
+
+//Events is a typed message channel between services. It is registered with
+//the dispatcher like any other storage and services declare it in their access
+//list with NewEventAccess, writers need WriteAccess and readers need ReadAccess.
+//
+//Events are double buffered, every event is kept for the tick it was sent in
+//and the tick after. A reader that runs after a writer sees that writers events
+//in the same tick, a reader that runs before it sees them on the next tick.
+//Each reading service has its own cursor so it never sees an event twice.
+type Events[T any] struct {
+	lock sync.RWMutex
+
+	previous      []T
+	current       []T
+	previousStart uint64
+	currentStart  uint64
+
+	//The sequence number of the next event each reader has not seen yet
+	readers map[string]uint64
+}
+
+//Creates a new event storage for events of type T
+func NewEvents[T any]() component.ComponentStorage {
+	return &Events[T]{readers: make(map[string]uint64)}
+}
+
+//Returns a ComponentAccess to Events[T] to add to a services access list
+func NewEventAccess[T any](access AccessType) ComponentAccess {
+	return ComponentAccess{DataType: component.ReflectType[Events[T]](), Access: access}
+}
+
+//Sends one event, it is visible to readers until the end of the next tick
+func (e *Events[T]) Send(event T) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.current = append(e.current, event)
+}
+
+//Sends all events in order
+func (e *Events[T]) SendBatch(events []T) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.current = append(e.current, events...)
+}
+
+//Returns all events the named reader has not seen yet, oldest first
+func (e *Events[T]) read(reader string) []T {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.readers == nil {
+		e.readers = make(map[string]uint64)
+	}
+	cursor, ok := e.readers[reader]
+	if !ok || cursor < e.previousStart {
+		cursor = e.previousStart
+	}
+	var toReturn []T
+	if cursor < e.currentStart {
+		toReturn = append(toReturn, e.previous[cursor-e.previousStart:]...)
+		cursor = e.currentStart
+	}
+	toReturn = append(toReturn, e.current[cursor-e.currentStart:]...)
+	e.readers[reader] = e.currentStart + uint64(len(e.current))
+	return toReturn
+}
+
+//Drops the events of the previous tick and starts a new buffer for the next one.
+//This is called by the dispatcher at the end of every tick.
+func (e *Events[T]) swapBuffers() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.previousStart = e.currentStart
+	e.currentStart += uint64(len(e.current))
+	e.previous, e.current = e.current, e.previous[:0]
+}
+
+//Implemented by every Events[T] so the dispatcher can swap their buffers
+type eventBuffer interface {
+	swapBuffers()
+}
+
+/***************************/
+/*    Storage Methods      */
+
+//Returns the type of Events[T]
+func (e *Events[T]) GetType() reflect.Type {
+	return reflect.TypeOf(e).Elem()
+}
+
+//Returns false, events are not associated with entities
+func (e *Events[T]) Exists(component.EntityID) bool {
+	return false
+}
+
+//Returns a mask of false, events are not associated with entities
+func (e *Events[T]) ExistsMultiple(entities []component.EntityID) []bool {
+	return make([]bool, len(entities))
+}
+
+//Returns no entities, events are not associated with entities
+func (e *Events[T]) GetEntities() []component.EntityID {
+	return []component.EntityID{}
+}
+
+//Returns the number of buffered events
+func (e *Events[T]) GetSize() int {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return len(e.previous) + len(e.current)
+}
+
+//Returns NotEntityStorage error
+func (e *Events[T]) AddBlankComponent(component.EntityID) error {
+	return component.NotEntityStorageError
+}
+
+//Returns NotEntityStorage error
+func (e *Events[T]) AddBlankComponentMultiple([]component.EntityID) error {
+	return component.NotEntityStorageError
+}
+
+//Returns NotEntityStorage error
+func (e *Events[T]) AddComponent(component.EntityID, component.Component) error {
+	return component.NotEntityStorageError
+}
+
+//Returns NotEntityStorage error
+func (e *Events[T]) DeleteEntity(component.EntityID) error {
+	return component.NotEntityStorageError
+}
+
+//Returns NotEntityStorage error
+func (e *Events[T]) DeleteEntityMultiple([]component.EntityID) error {
+	return component.NotEntityStorageError
+}
+
+/***************************/
+/*  Readers and Writers    */
+
+type EventWriter[T any] interface {
+	//Sends one event
+	Send(event T)
+
+	//Sends all events in order
+	SendBatch(events []T)
+}
+
+type EventReader[T any] interface {
+	//Returns every event this reader has not seen yet, oldest first
+	Read() []T
+}
+
+type eventReader[T any] struct {
+	events *Events[T]
+	name   string
+}
+
+func (r eventReader[T]) Read() []T {
+	return r.events.read(r.name)
+}
+
+func getEvents[T any](this Service, expected AccessType) (*Events[T], error) {
+	storage, access := this.GetStorage(component.ReflectType[Events[T]]())
+	if storage == nil {
+		return nil, errors.New("event storage is not found in this service")
+	}
+	if access != expected {
+		return nil, errors.New("event accessType does not match")
+	}
+	events, ok := storage.(*Events[T])
+	if !ok {
+		return nil, errors.New("type mismatch for given storage and event type")
+	}
+	return events, nil
+}
+
+//Returns a writer for events of type T, the service needs WriteAccess to Events[T]
+func GetEventWriter[T any](this Service) (EventWriter[T], error) {
+	events, err := getEvents[T](this, WriteAccess)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+//Returns a reader for events of type T, the service needs ReadAccess to Events[T].
+//The readers cursor is kept per service name.
+func GetEventReader[T any](this Service) (EventReader[T], error) {
+	events, err := getEvents[T](this, ReadAccess)
+	if err != nil {
+		return nil, err
+	}
+	return eventReader[T]{events: events, name: this.GetName()}, nil
+}
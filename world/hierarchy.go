@@ -0,0 +1,259 @@
+package world
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/jevans40/Ruthenium/component"
+	"github.com/jevans40/Ruthenium/linmath"
+)
+
+//Attaches an entity to a parent entity. The entities Transform is then relative
+//to the parents GlobalTransform and it is despawned together with its parent.
+//Parent is the only side of the relationship that should be written, Children
+//is rebuilt from it by the hierarchy service.
+type Parent struct {
+	Entity component.EntityID
+}
+
+func (p Parent) GetType() reflect.Type { return reflect.TypeOf(p) }
+func (p Parent) IsComponent()          {}
+
+//The children of an entity sorted by ID. Maintained by the hierarchy service,
+//any changes made to it directly are overwritten on the next tick.
+type Children struct {
+	Entities []component.EntityID
+}
+
+func (c Children) GetType() reflect.Type { return reflect.TypeOf(c) }
+func (c Children) IsComponent()          {}
+
+//The world space transform of an entity, the product of the Transforms of the
+//entity and all of its ancestors. Written by the transform propagation service
+//for every entity with a Transform.
+type GlobalTransform linmath.Mat3f[float64]
+
+func (g GlobalTransform) GetType() reflect.Type { return reflect.TypeOf(g) }
+func (g GlobalTransform) IsComponent()          {}
+
+//Transforms the point x, y into world space
+func (g GlobalTransform) Apply(x, y float64) (float64, float64) {
+	p := linmath.Mat3f[float64](g).TransformPoint(linmath.Vec2[float64]{x, y})
+	return p[0], p[1]
+}
+
+//Adds the Transform, Parent, Children and GlobalTransform storages along with the
+//hierarchy and transform propagation services to the dispatcher. Both services
+//run in the PostUpdateStage so they see every change made during the update.
+//A Transform storage that was already added is reused.
+func AddHierarchy(d Dispatcher) error {
+	if d.GetStorage(component.ReflectType[Transform]()) == nil {
+		if err := d.AddStorage(component.NewVectorStorage[Transform]()); err != nil {
+			return err
+		}
+	}
+	for _, storage := range []component.ComponentStorage{
+		component.NewVectorStorage[Parent](),
+		component.NewVectorStorage[Children](),
+		component.NewVectorStorage[GlobalTransform](),
+	} {
+		if err := d.AddStorage(storage); err != nil {
+			return err
+		}
+	}
+	if err := d.AddService(NewHierarchyService()); err != nil {
+		return err
+	}
+	return d.AddService(NewTransformPropagationService())
+}
+
+/***************************/
+/*    Hierarchy Service    */
+
+//Creates the service that rebuilds Children from Parent every tick
+func NewHierarchyService() Service {
+	service := NewBaseService("hierarchy")
+	service.SetStage(PostUpdateStage)
+	service.AddRequiredAccessComponent(NewComponentAccess[Parent](ReadAccess))
+	service.AddRequiredAccessComponent(NewComponentAccess[Children](WriteAccess))
+	service.SetRunFunction(func(chan EntityCreationData, chan component.EntityID) error {
+		parents, err := GetReadStorage[Parent](service)
+		if err != nil {
+			return err
+		}
+		children, err := GetWriteStorage[Children](service)
+		if err != nil {
+			return err
+		}
+		return updateChildren(parents, children)
+	})
+	return service
+}
+
+func updateChildren(parents component.ReadOnlyStorage[Parent], children component.WriteStorage[Children]) error {
+	wanted := map[component.EntityID][]component.EntityID{}
+	for _, e := range parents.GetEntities() {
+		parent := parents.MustGetComponent(e)
+		if parent.Entity == e {
+			continue
+		}
+		wanted[parent.Entity] = append(wanted[parent.Entity], e)
+	}
+
+	var stale []component.EntityID
+	for _, e := range children.GetEntities() {
+		if _, ok := wanted[e]; !ok {
+			stale = append(stale, e)
+		}
+	}
+	if len(stale) != 0 {
+		if err := children.DeleteEntityMultiple(stale); err != nil {
+			return err
+		}
+	}
+
+	for parent, entities := range wanted {
+		sort.Slice(entities, func(i, j int) bool { return entities[i] < entities[j] })
+		current, err := children.GetComponent(parent)
+		if err != nil {
+			if err := children.AddEntity(parent, Children{Entities: entities}); err != nil {
+				return err
+			}
+			continue
+		}
+		if !sameEntities(current.Entities, entities) {
+			if err := children.Write(parent, Children{Entities: entities}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sameEntities(a, b []component.EntityID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/***************************/
+/* Transform Propagation   */
+
+//Creates the service that computes GlobalTransform from the local Transforms.
+//Parents are always computed before their children, entities in the hierarchy
+//without a Transform count as the identity. Parent cycles are broken by treating
+//the entity that closes the cycle as a root.
+func NewTransformPropagationService() Service {
+	service := NewBaseService("transform propagation")
+	service.SetStage(PostUpdateStage)
+	service.AddRequiredAccessComponent(NewComponentAccess[Transform](ReadAccess))
+	service.AddRequiredAccessComponent(NewComponentAccess[Parent](ReadAccess))
+	service.AddRequiredAccessComponent(NewComponentAccess[GlobalTransform](WriteAccess))
+	service.SetRunFunction(func(chan EntityCreationData, chan component.EntityID) error {
+		transforms, err := GetReadStorage[Transform](service)
+		if err != nil {
+			return err
+		}
+		parents, err := GetReadStorage[Parent](service)
+		if err != nil {
+			return err
+		}
+		globals, err := GetWriteStorage[GlobalTransform](service)
+		if err != nil {
+			return err
+		}
+		return propagateTransforms(transforms, parents, globals)
+	})
+	return service
+}
+
+func propagateTransforms(transforms component.ReadOnlyStorage[Transform], parents component.ReadOnlyStorage[Parent], globals component.WriteStorage[GlobalTransform]) error {
+	computed := map[component.EntityID]GlobalTransform{}
+	visiting := map[component.EntityID]bool{}
+	var compute func(e component.EntityID) GlobalTransform
+	compute = func(e component.EntityID) GlobalTransform {
+		if global, ok := computed[e]; ok {
+			return global
+		}
+		local := linmath.Identity[float64]()
+		if transform, err := transforms.GetComponent(e); err == nil {
+			local = linmath.Mat3f[float64](transform)
+		}
+		global := GlobalTransform(local)
+		visiting[e] = true
+		if parent, err := parents.GetComponent(e); err == nil && !visiting[parent.Entity] {
+			global = GlobalTransform(linmath.Mat3f[float64](compute(parent.Entity)).MatMul(local))
+		}
+		visiting[e] = false
+		computed[e] = global
+		return global
+	}
+
+	var stale []component.EntityID
+	for _, e := range globals.GetEntities() {
+		if !transforms.Exists(e) {
+			stale = append(stale, e)
+		}
+	}
+	if len(stale) != 0 {
+		if err := globals.DeleteEntityMultiple(stale); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range transforms.GetEntities() {
+		global := compute(e)
+		var err error
+		if globals.Exists(e) {
+			err = globals.Write(e, global)
+		} else {
+			err = globals.AddEntity(e, global)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/***************************/
+/*  Despawn Descendants    */
+
+//Adds every living descendant of the despawned entities to the despawn list.
+//Called by the dispatcher once all deletion requests of a tick are processed.
+func (d *simpleDispatcher) despawnDescendants() {
+	storage := d.GetStorage(component.ReflectType[Parent]())
+	if storage == nil || len(d.toDelete) == 0 {
+		return
+	}
+	parents, err := component.GetWriteStorage[Parent](storage)
+	if err != nil || parents.GetSize() == 0 {
+		return
+	}
+	childrenOf := map[component.EntityID][]component.EntityID{}
+	for _, e := range parents.GetEntities() {
+		parent := parents.MustGetComponent(e)
+		childrenOf[parent.Entity] = append(childrenOf[parent.Entity], e)
+	}
+
+	d.entityWrite.Lock()
+	defer d.entityWrite.Unlock()
+	for i := 0; i < len(d.toDelete); i++ {
+		children := childrenOf[d.toDelete[i]]
+		sort.Slice(children, func(a, b int) bool { return children[a] < children[b] })
+		for _, child := range children {
+			if entity, ok := d.entities[child]; !ok || entity.Deleted {
+				continue
+			}
+			d.entities[child] = component.Entity{EntityNum: child, Deleted: true}
+			d.toDelete = append(d.toDelete, child)
+			d.hooks.entityDespawned(child)
+		}
+	}
+}
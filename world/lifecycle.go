@@ -0,0 +1,222 @@
+package world
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/jevans40/Ruthenium/component"
+)
+
+//LifecycleHooks keeps the callbacks that run when entities are created or
+//despawned and when components are added or removed.
+//
+//Hooks never run while a storage or the entity map is being modified, they are
+//queued and run by the dispatcher at the end of Maintain once every service has
+//finished and all entity creations and deletions are processed. At that point
+//nothing else touches the storages, so hooks may read and write them directly.
+//Hooks run in the order their changes happened, changes made by hooks queue
+//more hooks which are run before Maintain returns.
+type LifecycleHooks struct {
+	lock      sync.Mutex
+	queued    []func()
+	created   []func(component.EntityID)
+	despawned []func(component.EntityID)
+}
+
+func NewLifecycleHooks() *LifecycleHooks {
+	return &LifecycleHooks{}
+}
+
+//Adds a callback that is called for every newly created entity.
+//It runs before the component hooks of the entities initial components.
+func (h *LifecycleHooks) OnEntityCreated(callback func(entity component.EntityID)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.created = append(h.created, callback)
+}
+
+//Adds a callback that is called for every despawned entity
+func (h *LifecycleHooks) OnEntityDespawned(callback func(entity component.EntityID)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.despawned = append(h.despawned, callback)
+}
+
+//Queues a function to run when the hooks are next flushed
+func (h *LifecycleHooks) queue(hook func()) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.queued = append(h.queued, hook)
+}
+
+func (h *LifecycleHooks) entityCreated(entity component.EntityID) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, v := range h.created {
+		callback := v
+		h.queued = append(h.queued, func() { callback(entity) })
+	}
+}
+
+func (h *LifecycleHooks) entityDespawned(entity component.EntityID) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, v := range h.despawned {
+		callback := v
+		h.queued = append(h.queued, func() { callback(entity) })
+	}
+}
+
+//Runs every queued hook, including ones queued while flushing
+func (h *LifecycleHooks) flush() {
+	for {
+		h.lock.Lock()
+		toRun := h.queued
+		h.queued = nil
+		h.lock.Unlock()
+		if len(toRun) == 0 {
+			return
+		}
+		for _, v := range toRun {
+			v()
+		}
+	}
+}
+
+/***************************/
+/*     Component Hooks     */
+
+var _ component.Observer = &componentHook[component.BaseComponent]{}
+
+//Observes a storage of T and queues the typed callbacks on the hooks
+type componentHook[T component.Component] struct {
+	hooks   *LifecycleHooks
+	added   func(component.EntityID, T)
+	removed func(component.EntityID, T)
+}
+
+func (c *componentHook[T]) ComponentAdded(storageType reflect.Type, entity component.EntityID, value component.Component) {
+	if c.added == nil {
+		return
+	}
+	if typed, ok := value.(T); ok {
+		c.hooks.queue(func() { c.added(entity, typed) })
+	}
+}
+
+func (c *componentHook[T]) ComponentRemoved(storageType reflect.Type, entity component.EntityID, value component.Component) {
+	if c.removed == nil {
+		return
+	}
+	if typed, ok := value.(T); ok {
+		c.hooks.queue(func() { c.removed(entity, typed) })
+	}
+}
+
+func getObservable[T component.Component](d Dispatcher) (component.ObservableStorage, error) {
+	storage := d.GetStorage(component.ReflectType[T]())
+	if storage == nil {
+		return nil, errors.New("storage not found in this Dispatcher")
+	}
+	observable, ok := storage.(component.ObservableStorage)
+	if !ok {
+		return nil, errors.New("storage does not support observers")
+	}
+	return observable, nil
+}
+
+//Calls callback with the entity and its component whenever a T is added.
+//The storage of T must already be added to the dispatcher.
+func OnComponentAdded[T component.Component](d Dispatcher, callback func(entity component.EntityID, value T)) error {
+	observable, err := getObservable[T](d)
+	if err != nil {
+		return err
+	}
+	observable.AddObserver(&componentHook[T]{hooks: d.GetHooks(), added: callback})
+	return nil
+}
+
+//Calls callback with the entity and the removed component whenever a T is removed.
+//The storage of T must already be added to the dispatcher.
+func OnComponentRemoved[T component.Component](d Dispatcher, callback func(entity component.EntityID, value T)) error {
+	observable, err := getObservable[T](d)
+	if err != nil {
+		return err
+	}
+	observable.AddObserver(&componentHook[T]{hooks: d.GetHooks(), removed: callback})
+	return nil
+}
+
+/***************************/
+/*    Lifecycle Events     */
+
+//Sent when an entity is created, requires AddEntityEvents
+type EntityCreated struct {
+	Entity component.EntityID
+}
+
+//Sent when an entity is despawned, requires AddEntityEvents
+type EntityDespawned struct {
+	Entity component.EntityID
+}
+
+//Sent when a component is added to an entity, requires AddComponentEvents[T]
+type ComponentAdded[T component.Component] struct {
+	Entity    component.EntityID
+	Component T
+}
+
+//Sent with the removed value when a component is removed, requires AddComponentEvents[T]
+type ComponentRemoved[T component.Component] struct {
+	Entity    component.EntityID
+	Component T
+}
+
+//Adds Events[EntityCreated] and Events[EntityDespawned] to the dispatcher so
+//services can react to entities with GetEventReader. Events are sent at the end
+//of the tick the change happened in and can be read during the next tick.
+func AddEntityEvents(d Dispatcher) error {
+	created := NewEvents[EntityCreated]().(*Events[EntityCreated])
+	despawned := NewEvents[EntityDespawned]().(*Events[EntityDespawned])
+	if err := d.AddStorage(created); err != nil {
+		return err
+	}
+	if err := d.AddStorage(despawned); err != nil {
+		return err
+	}
+	d.GetHooks().OnEntityCreated(func(entity component.EntityID) {
+		created.Send(EntityCreated{Entity: entity})
+	})
+	d.GetHooks().OnEntityDespawned(func(entity component.EntityID) {
+		despawned.Send(EntityDespawned{Entity: entity})
+	})
+	return nil
+}
+
+//Adds Events[ComponentAdded[T]] and Events[ComponentRemoved[T]] to the dispatcher.
+//The storage of T must already be added to the dispatcher.
+func AddComponentEvents[T component.Component](d Dispatcher) error {
+	observable, err := getObservable[T](d)
+	if err != nil {
+		return err
+	}
+	added := NewEvents[ComponentAdded[T]]().(*Events[ComponentAdded[T]])
+	removed := NewEvents[ComponentRemoved[T]]().(*Events[ComponentRemoved[T]])
+	if err := d.AddStorage(added); err != nil {
+		return err
+	}
+	if err := d.AddStorage(removed); err != nil {
+		return err
+	}
+	observable.AddObserver(&componentHook[T]{
+		hooks: d.GetHooks(),
+		added: func(entity component.EntityID, value T) {
+			added.Send(ComponentAdded[T]{Entity: entity, Component: value})
+		},
+		removed: func(entity component.EntityID, value T) {
+			removed.Send(ComponentRemoved[T]{Entity: entity, Component: value})
+		},
+	})
+	return nil
+}
@@ -0,0 +1,103 @@
+package world
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/jevans40/Ruthenium/component"
+)
+
+var _ component.Observer = &membershipIndex{}
+
+//The membership index tracks which storages hold a component for each entity,
+//so despawning an entity only touches the storages it is actually in.
+//The dispatcher adds it as an observer to every observable storage, storages
+//that are not observable (resources, events) do not hold entities.
+type membershipIndex struct {
+	lock    sync.Mutex
+	members map[component.EntityID][]reflect.Type
+}
+
+func newMembershipIndex() *membershipIndex {
+	return &membershipIndex{members: make(map[component.EntityID][]reflect.Type)}
+}
+
+func (m *membershipIndex) ComponentAdded(storageType reflect.Type, entity component.EntityID, value component.Component) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.add(storageType, entity)
+}
+
+func (m *membershipIndex) ComponentRemoved(storageType reflect.Type, entity component.EntityID, value component.Component) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	types := m.members[entity]
+	for i, v := range types {
+		if v == storageType {
+			types = append(types[:i], types[i+1:]...)
+			break
+		}
+	}
+	if len(types) == 0 {
+		delete(m.members, entity)
+	} else {
+		m.members[entity] = types
+	}
+}
+
+//Must hold the lock
+func (m *membershipIndex) add(storageType reflect.Type, entity component.EntityID) {
+	for _, v := range m.members[entity] {
+		if v == storageType {
+			return
+		}
+	}
+	m.members[entity] = append(m.members[entity], storageType)
+}
+
+//Indexes every entity already in a storage when it is added to the dispatcher
+func (m *membershipIndex) addStorage(storage component.ComponentStorage) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	storageType := storage.GetType()
+	for _, e := range storage.GetEntities() {
+		m.add(storageType, e)
+	}
+}
+
+//Forgets a storage that was removed from the dispatcher
+func (m *membershipIndex) removeStorage(storageType reflect.Type) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for entity := range m.members {
+		for i, v := range m.members[entity] {
+			if v == storageType {
+				m.members[entity] = append(m.members[entity][:i], m.members[entity][i+1:]...)
+				break
+			}
+		}
+		if len(m.members[entity]) == 0 {
+			delete(m.members, entity)
+		}
+	}
+}
+
+//Groups the entities by the storages they are in
+func (m *membershipIndex) groupByStorage(entities []component.EntityID) map[reflect.Type][]component.EntityID {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	grouped := make(map[reflect.Type][]component.EntityID)
+	for _, e := range entities {
+		for _, t := range m.members[e] {
+			grouped[t] = append(grouped[t], e)
+		}
+	}
+	return grouped
+}
+
+//Returns the storage types the entity has a component in
+func (m *membershipIndex) storagesOf(entity component.EntityID) []reflect.Type {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]reflect.Type{}, m.members[entity]...)
+}
@@ -0,0 +1,51 @@
+package world
+
+import "reflect"
+
+//The number of floats one quad takes in the render channel, 4 vertices of 7
+const QuadFloats = 28
+
+//Quads that are already in the vertex layout of the render channel, they are
+//drawn as they are after the Renderables. Services that draw a lot of quads at
+//once, like the tilemap renderer, write them here instead of keeping a
+//Renderable for each quad. The vertices are in world space.
+type Quads struct {
+	Vertices []float32
+}
+
+func (q Quads) GetType() reflect.Type { return reflect.TypeOf(q) }
+func (q Quads) IsComponent()          {}
+
+//Returns the number of quads
+func (q Quads) Count() int {
+	return len(q.Vertices) / QuadFloats
+}
+
+//The part of the world that ends up on screen, in world units. Services use it
+//to skip work for things that can not be seen. A viewport without a size
+//counts as showing everything.
+type Viewport struct {
+	X, Y float64
+	W, H float64
+}
+
+func (v Viewport) GetType() reflect.Type { return reflect.TypeOf(v) }
+func (v Viewport) IsComponent()          {}
+
+//Returns true if the viewport has no size and so shows everything
+func (v Viewport) Unbounded() bool {
+	return v.W <= 0 || v.H <= 0
+}
+
+//Returns true if the rectangle overlaps the viewport
+func (v Viewport) Overlaps(x, y, w, h float64) bool {
+	if v.Unbounded() {
+		return true
+	}
+	return x < v.X+v.W && x+w > v.X && y < v.Y+v.H && y+h > v.Y
+}
+
+//Returns the area the viewport shows, only meaningful if it is not unbounded
+func (v Viewport) Bounds() Bounds {
+	return Bounds{v.X, v.Y, v.X + v.W, v.Y + v.H}
+}
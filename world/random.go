@@ -0,0 +1,28 @@
+package world
+
+import (
+	"math/rand"
+	"reflect"
+)
+
+//A seeded random number generator resource. Services that need randomness should
+//use it instead of the global math/rand functions, so a run can be reproduced
+//from its seed. Drawing a number changes its state, so services have to take
+//WriteAccess to it even if they only read numbers, which also keeps the order of
+//draws the same between runs.
+type Random struct {
+	*rand.Rand
+	seed int64
+}
+
+func (r Random) GetType() reflect.Type { return reflect.TypeOf(r) }
+func (r Random) IsComponent()          {}
+
+func NewRandom(seed int64) Random {
+	return Random{Rand: rand.New(rand.NewSource(seed)), seed: seed}
+}
+
+//Returns the seed the generator was created with
+func (r Random) GetSeed() int64 {
+	return r.seed
+}
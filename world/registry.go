@@ -0,0 +1,12 @@
+package world
+
+import "github.com/jevans40/Ruthenium/component"
+
+//Registers the components of this package so they can be used in data files.
+//Children and GlobalTransform are computed every tick, so they are left out.
+func init() {
+	component.MustRegister("Renderable", NewRenderable())
+	component.MustRegister("Transform", NewTransform())
+	component.MustRegister("Parent", Parent{})
+	component.MustRegister("Sprite", Sprite{})
+}
@@ -3,6 +3,7 @@ package world
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
@@ -11,7 +12,16 @@ import (
 )
 
 //TODO:: Documentation
-//TODO:: Tests
+
+//How many Renderables the render service drew last frame and how many it skipped
+//because they were outside of the Viewport. Prebuilt Quads are not counted.
+type RenderStats struct {
+	Visible int
+	Culled  int
+}
+
+func (r RenderStats) GetType() reflect.Type { return reflect.TypeOf(r) }
+func (r RenderStats) IsComponent()          {}
 
 type renderService struct {
 	BaseService
@@ -23,16 +33,48 @@ type renderService struct {
 	dbgnm      int
 }
 
+//Creates the service that sends the vertices of every visible Renderable and all
+//Quads down renderChan each frame. Renderables outside of the Viewport resource
+//are skipped, using the SpatialIndex resource to find the visible ones if the
+//dispatcher has one, so Renderables need to be in the index to be drawn while
+//it is not empty. The Viewport, SpatialIndex and RenderStats resources are
+//all optional, without a Viewport everything is drawn.
 func NewRenderService(renderChan chan []float32) Service {
 	newRender := &renderService{t4: time.UnixMilli(0), t1: time.UnixMilli(0), t2: time.UnixMicro(0), t3: time.UnixMicro(0)}
 	newRender.renderChan = renderChan
 	newRender.Name = "renderer"
+	newRender.SetStage(RenderStage)
 	newRender.SetRunFunction(newRender.RenderRun)
 	newRender.AddRequiredAccessComponent(NewComponentAccess[Renderable](ReadAccess))
+	newRender.AddRequiredAccessComponent(NewComponentAccess[GlobalTransform](ReadAccess))
+	newRender.AddRequiredAccessComponent(NewComponentAccess[Quads](ReadAccess))
+	newRender.AddRequiredAccessComponent(NewComponentAccess[Viewport](ReadAccess))
+	newRender.AddRequiredAccessComponent(NewComponentAccess[SpatialIndex](ReadAccess))
+	newRender.AddRequiredAccessComponent(NewComponentAccess[RenderStats](WriteAccess))
 
 	return newRender
 }
 
+//Creates the service that sets the Viewport resource to the area of the window
+//every frame, before the renderer culls. The renderer draws one world unit per
+//pixel from the origin, so the viewport starts at 0, 0 and is as large as the
+//window. NewBaseWorld adds it for the window it is given, worlds built by hand
+//have to add it or set the Viewport themselves to get culling.
+func NewViewportService(size func() (width, height int)) Service {
+	service := NewBaseService("viewport")
+	service.SetStage(PostUpdateStage)
+	service.AddRequiredAccessComponent(NewComponentAccess[Viewport](WriteAccess))
+	service.SetRunFunction(func(chan EntityCreationData, chan component.EntityID) error {
+		viewports, err := GetWriteStorage[Viewport](service)
+		if err != nil {
+			return err
+		}
+		width, height := size()
+		return viewports.Write(0, Viewport{W: float64(width), H: float64(height)})
+	})
+	return service
+}
+
 func (r *renderService) RenderRun(EntityCreation chan EntityCreationData, EntityDeletion chan component.EntityID) error {
 	RenderableRead, err1 := GetReadStorage[Renderable](r)
 
@@ -41,8 +83,23 @@ func (r *renderService) RenderRun(EntityCreation chan EntityCreationData, Entity
 	}
 
 	Entities := RenderableRead.GetEntities()
+	total := len(Entities)
 
-	RenderVec := make([]float32, len(Entities)*28)
+	viewport := Viewport{}
+	if ViewportRead, err := GetReadStorage[Viewport](r); err == nil {
+		viewport = ViewportRead.MustGetComponent(0)
+	}
+	indexed := false
+	if !viewport.Unbounded() {
+		if IndexRead, err := GetReadStorage[SpatialIndex](r); err == nil {
+			if index := IndexRead.MustGetComponent(0); index.Len() != 0 {
+				Entities = visibleEntities(index, viewport, RenderableRead)
+				indexed = true
+			}
+		}
+	}
+
+	RenderVec := make([]float32, len(Entities)*QuadFloats)
 	time3 := time.Now()
 	Renderables, err1 := RenderableRead.GetComponentMultiple(Entities)
 	r.t3 = r.t3.Add(time.Since(time3))
@@ -50,16 +107,35 @@ func (r *renderService) RenderRun(EntityCreation chan EntityCreationData, Entity
 		return err1
 	}
 
+	//Renderables of entities with a GlobalTransform are drawn in world space
+	Globals := make([]*GlobalTransform, len(Entities))
+	if GlobalRead, err := GetReadStorage[GlobalTransform](r); err == nil && GlobalRead.GetSize() != 0 {
+		for i, exists := range GlobalRead.ExistsMultiple(Entities) {
+			if exists {
+				global := GlobalRead.MustGetComponent(Entities[i])
+				Globals[i] = &global
+			}
+		}
+	}
+
+	if !viewport.Unbounded() && !indexed {
+		Renderables, Globals = cullRenderables(viewport, Renderables, Globals)
+		RenderVec = RenderVec[:len(Renderables)*QuadFloats]
+	}
+	if StatsWrite, err := GetWriteStorage[RenderStats](r); err == nil {
+		StatsWrite.Write(0, RenderStats{Visible: len(Renderables), Culled: total - len(Renderables)})
+	}
+
 	time4 := time.Now()
-	if len(Entities) != 0 {
+	if len(Renderables) != 0 {
 		var WorkerWait sync.WaitGroup
 		WorkerWait.Add(6)
 		for i := 0; i < 6; i++ {
-			batchSize := len(Entities) / 6
+			batchSize := len(Renderables) / 6
 			if i == 5 {
-				go calculateVerticesWorker(i, len(Entities)-5*batchSize, Renderables[i*batchSize:], RenderVec[i*batchSize*28:], &WorkerWait)
+				go calculateVerticesWorker(i, len(Renderables)-5*batchSize, Renderables[i*batchSize:], Globals[i*batchSize:], RenderVec[i*batchSize*28:], &WorkerWait)
 			} else {
-				go calculateVerticesWorker(i, batchSize, Renderables[i*batchSize:(i+1)*batchSize], RenderVec[i*batchSize*28:batchSize*28*(i+1)], &WorkerWait)
+				go calculateVerticesWorker(i, batchSize, Renderables[i*batchSize:(i+1)*batchSize], Globals[i*batchSize:(i+1)*batchSize], RenderVec[i*batchSize*28:batchSize*28*(i+1)], &WorkerWait)
 			}
 		}
 		//fmt.Println("Wait")
@@ -67,6 +143,13 @@ func (r *renderService) RenderRun(EntityCreation chan EntityCreationData, Entity
 	}
 	r.t4 = r.t4.Add(time.Since(time4))
 
+	//Prebuilt quads are drawn after the Renderables
+	if QuadsRead, err := GetReadStorage[Quads](r); err == nil {
+		for _, e := range QuadsRead.GetEntities() {
+			RenderVec = append(RenderVec, QuadsRead.MustGetComponent(e).Vertices...)
+		}
+	}
+
 	time1 := time.Now()
 	select {
 	case r.renderChan <- RenderVec:
@@ -86,7 +169,33 @@ func (r *renderService) RenderRun(EntityCreation chan EntityCreationData, Entity
 
 }
 
-func calculateVerticesWorker(dbg int, num int, Renderables []*Renderable, RenderVec []float32, wait *sync.WaitGroup) {
+//Returns the entities with a Renderable the index has inside the viewport
+func visibleEntities(index SpatialIndex, viewport Viewport, renderables component.ReadOnlyStorage[Renderable]) []component.EntityID {
+	candidates := index.Region(viewport.Bounds())
+	visible := candidates[:0]
+	for i, exists := range renderables.ExistsMultiple(candidates) {
+		if exists {
+			visible = append(visible, candidates[i])
+		}
+	}
+	return visible
+}
+
+//Drops the renderables that are outside of the viewport, keeping globals lined
+//up with them
+func cullRenderables(viewport Viewport, renderables []*Renderable, globals []*GlobalTransform) ([]*Renderable, []*GlobalTransform) {
+	area := viewport.Bounds()
+	visible := 0
+	for i, renderable := range renderables {
+		if area.Overlaps(renderable.WorldBounds(globals[i])) {
+			renderables[visible], globals[visible] = renderable, globals[i]
+			visible++
+		}
+	}
+	return renderables[:visible], globals[:visible]
+}
+
+func calculateVerticesWorker(dbg int, num int, Renderables []*Renderable, Globals []*GlobalTransform, RenderVec []float32, wait *sync.WaitGroup) {
 	//TODO:: This should connect to renderer and submit to it directly.
 	//No need to be calculating vertices for an already updated frame
 
@@ -94,13 +203,14 @@ func calculateVerticesWorker(dbg int, num int, Renderables []*Renderable, Render
 	defer wait.Done()
 	for i := 0; i < num; i++ {
 		//fmt.Printf("%d Out of %d\n", dbg*num+i, num*4)
-		calculateVertices(Renderables[i], RenderVec[i*28:i*28+28])
+		calculateVertices(Renderables[i], Globals[i], RenderVec[i*28:i*28+28])
 	}
 	//fmt.Println("Done")
 }
 
 //These never actually
-func calculateVertices(renderable *Renderable, vector []float32) {
+//If global is not nil the vertices are transformed into world space with it
+func calculateVertices(renderable *Renderable, global *GlobalTransform, vector []float32) {
 
 	for i := 0; i < 4; i++ {
 		vert := linmath.EmptyVertice()
@@ -110,8 +220,13 @@ func calculateVertices(renderable *Renderable, vector []float32) {
 		vert.SetTexY(renderable.TexY + renderable.TexH*float32(int32((i)/2)%2))
 		//(0,0),(1,0),(0,1)(1,1)
 		//(-1,-1),(1,-1),(-1,1),(1,1)
-		vert.SetX(float32(renderable.X + renderable.verts[i*2]))
-		vert.SetY(float32(renderable.Y + renderable.verts[i*2+1]))
+		x := renderable.X + renderable.verts[i*2]
+		y := renderable.Y + renderable.verts[i*2+1]
+		if global != nil {
+			x, y = global.Apply(x, y)
+		}
+		vert.SetX(float32(x))
+		vert.SetY(float32(y))
 		vert.SetZ(float32(renderable.Z))
 		//log.WithFields(log.Fields{"Vertnum": i, "X": vert[i].GetX(), "Y": vert[i].GetY(), "Z": vert[i].GetZ(), "TexX": vert[i].GetTexX(), "TexY": vert[i].GetTexY(), "Color": vert[i].GetColor()}).Trace()
 		floats := vert.ToFloats()
@@ -0,0 +1,265 @@
+package world
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/jevans40/Ruthenium/component"
+)
+
+//Stages split a tick into ordered phases. Every service in a stage runs after
+//every service in the stages before it, so services only need AddRequiredService
+//for ordering within their own stage. Services default to the UpdateStage.
+type Stage int
+
+const (
+	PreUpdateStage  Stage = -1
+	UpdateStage     Stage = 0
+	PostUpdateStage Stage = 1
+	RenderStage     Stage = 2
+)
+
+func (s Stage) String() string {
+	switch s {
+	case PreUpdateStage:
+		return "PreUpdate"
+	case UpdateStage:
+		return "Update"
+	case PostUpdateStage:
+		return "PostUpdate"
+	case RenderStage:
+		return "Render"
+	}
+	return fmt.Sprintf("Stage(%d)", int(s))
+}
+
+/***************************/
+/*        Tick Info        */
+
+//A resource that is updated by the dispatcher at the start of every tick.
+//Tick counts up from 0, Delta is the time since the last tick started, or the
+//fixed timestep if the dispatcher has one, and Elapsed is the sum of all deltas.
+type TickInfo struct {
+	Tick    uint64
+	Delta   time.Duration
+	Elapsed time.Duration
+}
+
+func (t TickInfo) GetType() reflect.Type { return reflect.TypeOf(t) }
+func (t TickInfo) IsComponent()          {}
+
+/***************************/
+/*     Run Conditions      */
+
+//Passed to run conditions when the dispatcher decides which services run.
+//Storages may be read but must not be written, conditions are evaluated
+//before each batch is started so they see writes from earlier batches.
+type ConditionContext struct {
+	Tick     TickInfo
+	storages []component.ComponentStorage
+}
+
+//Returns the storage of the given type, or nil if it is not registered
+func (c ConditionContext) GetStorage(storageType reflect.Type) component.ComponentStorage {
+	for _, v := range c.storages {
+		if v.GetType() == storageType {
+			return v
+		}
+	}
+	return nil
+}
+
+//A RunCondition decides each tick whether its service should run.
+//A service only runs when all of its conditions pass.
+type RunCondition interface {
+	ShouldRun(ctx ConditionContext) bool
+}
+
+//Allows a plain function to be used as a RunCondition
+type RunConditionFunc func(ctx ConditionContext) bool
+
+func (f RunConditionFunc) ShouldRun(ctx ConditionContext) bool { return f(ctx) }
+
+//Runs the service on every nth tick, starting with the first
+func EveryNTicks(n uint64) RunCondition {
+	if n == 0 {
+		n = 1
+	}
+	return RunConditionFunc(func(ctx ConditionContext) bool {
+		return ctx.Tick.Tick%n == 0
+	})
+}
+
+//Runs the service at a fixed rate, independent of how often the world ticks.
+//Time is accumulated from TickInfo.Delta and the service runs at most once per
+//tick, if the world ticks slower than the rate the backlog is dropped.
+type FixedRateCondition struct {
+	step        time.Duration
+	accumulated time.Duration
+}
+
+//Runs the service hz times a second. Returns an error if hz is not positive or
+//so large that a step is shorter than a nanosecond.
+func FixedRate(hz float64) (*FixedRateCondition, error) {
+	if !(hz > 0) {
+		return nil, fmt.Errorf("fixed rate must be positive, got %v", hz)
+	}
+	step := time.Duration(float64(time.Second) / hz)
+	if step <= 0 {
+		return nil, fmt.Errorf("fixed rate %v is too high, a step has to be at least a nanosecond", hz)
+	}
+	return &FixedRateCondition{step: step}, nil
+}
+
+//Runs the service once every step of time, like FixedRate. Returns an error if
+//step is not positive.
+func FixedStep(step time.Duration) (*FixedRateCondition, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("fixed step must be positive, got %v", step)
+	}
+	return &FixedRateCondition{step: step}, nil
+}
+
+//Returns the fixed amount of time that passes between two runs.
+//Services should use this instead of TickInfo.Delta.
+func (f *FixedRateCondition) Step() time.Duration {
+	return f.step
+}
+
+func (f *FixedRateCondition) ShouldRun(ctx ConditionContext) bool {
+	f.accumulated += ctx.Tick.Delta
+	if f.accumulated < f.step {
+		return false
+	}
+	f.accumulated -= f.step
+	if f.accumulated > f.step {
+		f.accumulated = f.accumulated % f.step
+	}
+	return true
+}
+
+//Runs the service only when the resource of type T passes the check.
+//Does not run if the resource is not registered.
+func ResourceMatches[T component.Component](check func(T) bool) RunCondition {
+	return RunConditionFunc(func(ctx ConditionContext) bool {
+		storage := ctx.GetStorage(component.ReflectType[T]())
+		if storage == nil {
+			return false
+		}
+		read, err := component.GetReadOnlyStorage[T](storage)
+		if err != nil {
+			return false
+		}
+		resource, err := read.GetComponent(0)
+		if err != nil {
+			return false
+		}
+		return check(resource)
+	})
+}
+
+//Runs the service only when the resource of type T is equal to value,
+//useful for state machines such as a game state resource.
+func ResourceEquals[T interface {
+	component.Component
+	comparable
+}](value T) RunCondition {
+	return ResourceMatches[T](func(resource T) bool { return resource == value })
+}
+
+//Runs the service only when at least one entity has a component in every one
+//of the given storage types.
+func QueryNotEmpty(storageTypes ...reflect.Type) RunCondition {
+	return RunConditionFunc(func(ctx ConditionContext) bool {
+		var toJoin []component.Joinable
+		for _, t := range storageTypes {
+			storage := ctx.GetStorage(t)
+			if storage == nil || storage.GetSize() == 0 {
+				return false
+			}
+			toJoin = append(toJoin, storage)
+		}
+		return len(toJoin) == 0 || len(component.Join(toJoin...)) != 0
+	})
+}
+
+//Runs the service only when at least one entity has a component of type T
+func HasEntities[T component.Component]() RunCondition {
+	return QueryNotEmpty(component.ReflectType[T]())
+}
+
+/***************************/
+/*        Schedule         */
+
+//Builds the batches of service indexes to run this tick. Stages are allocated
+//in order and each stage gets its own allocation tree, so a batch never mixes stages.
+func buildSchedule(services []Service) ([][]int, error) {
+	stageOf := map[string]Stage{}
+	var stages []Stage
+	for _, s := range services {
+		stageOf[s.GetName()] = s.GetStage()
+		found := false
+		for _, v := range stages {
+			if v == s.GetStage() {
+				found = true
+			}
+		}
+		if !found {
+			stages = append(stages, s.GetStage())
+		}
+	}
+	for i := 1; i < len(stages); i++ {
+		for j := i; j > 0 && stages[j] < stages[j-1]; j-- {
+			stages[j], stages[j-1] = stages[j-1], stages[j]
+		}
+	}
+
+	var schedule [][]int
+	for _, stage := range stages {
+		var names []string
+		var indexes []int
+		var resReq [][]ComponentAccess
+		var servReq [][]string
+		for i, s := range services {
+			if s.GetStage() != stage {
+				continue
+			}
+			//Requirements in earlier stages are always satisfied
+			var required []string
+			for _, r := range s.GetServices() {
+				requiredStage, ok := stageOf[r]
+				if ok && requiredStage > stage {
+					return nil, fmt.Errorf("service %s in stage %s requires service %s from the later stage %s", s.GetName(), stage, r, requiredStage)
+				}
+				if !ok || requiredStage == stage {
+					required = append(required, r)
+				}
+			}
+			names = append(names, s.GetName())
+			indexes = append(indexes, i)
+			resReq = append(resReq, s.GetStorages())
+			servReq = append(servReq, required)
+		}
+
+		newTree := greedyAllocationTree{allocated: make(map[string]bool)}
+		err := newTree.AddStystems(names, resReq, servReq)
+		if err != nil {
+			return nil, err
+		}
+		for _, batch := range newTree.GetSystemTree() {
+			var indexBatch []int
+			for _, name := range batch {
+				for i, n := range names {
+					if n == name {
+						indexBatch = append(indexBatch, indexes[i])
+					}
+				}
+			}
+			if len(indexBatch) != 0 {
+				schedule = append(schedule, indexBatch)
+			}
+		}
+	}
+	return schedule, nil
+}
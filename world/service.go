@@ -45,10 +45,31 @@ func (c *ComponentWriteDate[T]) AddComponentWithEntityID(ID component.EntityID)
 	c.storage.AddEntity(ID, c.component)
 }
 
+//Same as MakeWriteableStorage for components whose type is only known at runtime,
+//such as ones decoded from a data file. Value must be of the storages type.
+func MakeComponentWriteable(value component.Component, storage component.ComponentStorage) StorageWriteable {
+	return &componentValue{value, storage}
+}
+
+type componentValue struct {
+	value   component.Component
+	storage component.ComponentStorage
+}
+
+func (c *componentValue) AddComponentWithEntityID(ID component.EntityID) {
+	if err := c.storage.AddComponent(ID, c.value); err != nil {
+		log.WithFields(log.Fields{"entity": ID, "component": c.storage.GetType()}).Error(err)
+	}
+}
+
+//Requests NumEntities entities with Components. Children are created for every
+//one of those entities, they are given a Parent component pointing at it, so the
+//hierarchy storages have to be added (see AddHierarchy) to use them.
 type EntityCreationData struct {
 	NumEntities             int
 	Components              []StorageWriteable
 	CreatedEntitiesCallback chan component.EntityID
+	Children                []EntityCreationData
 }
 
 //TODO:
@@ -58,9 +79,12 @@ type EntityCreationData struct {
 //         		  channel buffer is too small to fit all the requested entities
 //				  Form (NumEntities to make, Channel to receive entity ID's from later)
 //EntityDeletion: signals on this channel will tell the dispatcher to lazily delete requested entities
+//Tracer: records the service run if a trace capture is running, may be nil
 type updateSignal struct {
 	EntityCreation chan EntityCreationData
 	EntityDeletion chan component.EntityID
+	Tracer         *Tracer
+	traceLane      int
 }
 
 type ComponentAccess struct {
@@ -102,6 +126,19 @@ type Service interface {
 	//Sets the thread to sleep for sleepTime iterations
 	SetSleepTime(sleepTime int)
 
+	//Adds a condition that is checked by the dispatcher every tick.
+	//The service only runs when it is awake and all of its conditions pass.
+	AddRunCondition(condition RunCondition)
+
+	//Returns the run conditions of this service
+	GetRunConditions() []RunCondition
+
+	//Sets the stage this service is scheduled in, defaults to UpdateStage
+	SetStage(stage Stage)
+
+	//Returns the stage this service is scheduled in
+	GetStage() Stage
+
 	//The function to overload, service code should be written here
 	//This should be a method that your service implements
 	//It will run once per update
@@ -138,6 +175,8 @@ type BaseService struct {
 	requiredData         []ComponentAccess
 	dataPointers         []component.ComponentStorage
 	requiredServices     []string
+	runConditions        []RunCondition
+	stage                Stage
 	sleepTime            int
 	communicationChannel chan updateSignal
 
@@ -167,7 +206,9 @@ func (s *BaseService) StartService(Callback chan error, update updateSignal) {
 	//fmt.Printf("got a signal for service %s\n", s.Name)
 	s.SleepLock.Lock()
 	s.StorageLock.Lock()
+	update.Tracer.Begin(update.traceLane, s.Name, "service")
 	err := s.runFunc(update.EntityCreation, update.EntityDeletion)
+	update.Tracer.End(update.traceLane, s.Name, "service")
 	Callback <- err
 	s.SleepLock.Unlock()
 	s.StorageLock.Unlock()
@@ -214,22 +255,24 @@ func (s *BaseService) UpdateStoragePointers(data []component.ComponentStorage) e
 	s.StorageLock.Lock()
 	defer s.StorageLock.Unlock()
 	//O(n^2) but all elements should be VERY small (<16) so its okay
+	//Missing storages are left nil so services can treat them as optional, the
+	//rest are still updated
+	var err error
 	for i, v := range s.requiredData {
 		tofind := v.DataType
-		found := false
+		s.dataPointers[i] = nil
 		for _, t := range data {
 			//fmt.Println(&t)
 			if t.GetType() == tofind {
 				s.dataPointers[i] = t
-				found = true
 				break
 			}
 		}
-		if !found {
-			return fmt.Errorf("missing Required Datatype %s", v.DataType)
+		if s.dataPointers[i] == nil && err == nil {
+			err = fmt.Errorf("missing Required Datatype %s", v.DataType)
 		}
 	}
-	return nil
+	return err
 }
 
 //Mutex locked
@@ -254,6 +297,22 @@ func (s *BaseService) SetSleepTime(sleepTime int) {
 	s.sleepTime = sleepTime
 }
 
+func (s *BaseService) AddRunCondition(condition RunCondition) {
+	s.runConditions = append(s.runConditions, condition)
+}
+
+func (s *BaseService) GetRunConditions() []RunCondition {
+	return s.runConditions
+}
+
+func (s *BaseService) SetStage(stage Stage) {
+	s.stage = stage
+}
+
+func (s *BaseService) GetStage() Stage {
+	return s.stage
+}
+
 func (s *BaseService) AddRequiredAccessComponent(newComp ComponentAccess) error {
 	s.StorageLock.Lock()
 	defer s.StorageLock.Unlock()
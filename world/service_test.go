@@ -1,9 +1,14 @@
 package world
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/jevans40/Ruthenium/component"
 	"github.com/stretchr/testify/assert"
@@ -87,8 +92,6 @@ func TestThisService(t *testing.T) {
 	entCreat := make(chan EntityCreationData)
 	entDel := make(chan component.EntityID)
 
-	go myservice.StartService(call)
-
 	//Test storage updates
 	err = myservice.UpdateStoragePointers([]component.ComponentStorage{healthStorage})
 	assert.Error(t, err, "UpdateStoragePointers passed for an invalid configuration")
@@ -107,14 +110,14 @@ func TestThisService(t *testing.T) {
 	close(toSend)
 	toSend = myservice.GetChannel()
 
-	go myservice.StartService(call)
+	go myservice.StartService(call, updateSignal{EntityCreation: entCreat, EntityDeletion: entDel})
 
 	myservice.AddRequiredService("service1")
 	myservice.AddRequiredService("service2")
 
 	assert.Equal(t, []string{"service1", "service2"}, myservice.GetServices())
 
-	toSend <- updateSignal{entCreat, entDel}
+	toSend <- updateSignal{EntityCreation: entCreat, EntityDeletion: entDel}
 	err = <-call
 	close(toSend)
 	assert.NoError(t, err, "Error received from running service")
@@ -210,7 +213,7 @@ func TestAllocationTree(t *testing.T) {
 }
 
 func Run2(EntityCreation chan EntityCreationData, EntityDeletion chan component.EntityID) (err error) {
-	EntityCreation <- EntityCreationData{10, []StorageWriteable{}, make(chan component.EntityID, 10)}
+	EntityCreation <- EntityCreationData{NumEntities: 10, Components: []StorageWriteable{}, CreatedEntitiesCallback: make(chan component.EntityID, 10)}
 	return err
 }
 
@@ -303,3 +306,717 @@ func TestDispatcher(t *testing.T) {
 	t.Log("Maintained")
 
 }
+
+func TestTracerCapture(t *testing.T) {
+	testingDispatcher := NewSimpleDispatcher()
+	myservice1 := NewBaseService("a")
+	myservice1.AddRequiredAccessComponent(NewComponentAccess[comp1](WriteAccess))
+	myservice2 := NewBaseService("b")
+	myservice2.AddRequiredAccessComponent(NewComponentAccess[comp1](ReadAccess))
+	myservice2.SetRunFunction(Run2)
+	testingDispatcher.AddService(myservice1)
+	testingDispatcher.AddService(myservice2)
+	testingDispatcher.AddStorage(component.NewDenseStorage[comp1]())
+
+	assert.NoError(t, testingDispatcher.Maintain(), "Maintain failed without a running trace")
+
+	var output bytes.Buffer
+	assert.NoError(t, testingDispatcher.GetTracer().Capture(2, &output), "Failed to start trace capture")
+	assert.Error(t, testingDispatcher.GetTracer().Capture(2, &output), "Started a second capture while one was running")
+
+	assert.NoError(t, testingDispatcher.Maintain())
+	assert.Equal(t, 0, output.Len(), "Trace was written before the requested ticks finished")
+	assert.NoError(t, testingDispatcher.Maintain())
+	assert.False(t, testingDispatcher.GetTracer().IsEnabled(), "Tracer is still enabled after the capture finished")
+
+	var trace struct {
+		TraceEvents []TraceEvent `json:"traceEvents"`
+	}
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &trace), "Trace output is not valid JSON")
+
+	counts := map[string]int{}
+	for _, event := range trace.TraceEvents {
+		counts[event.Name+event.Ph]++
+	}
+	assert.Equal(t, 2, counts["tickB"])
+	assert.Equal(t, 2, counts["tickE"])
+	assert.Equal(t, 2, counts["aB"])
+	assert.Equal(t, 2, counts["bE"])
+	assert.Equal(t, 2, counts["create entitiesB"])
+	assert.Equal(t, 2, counts["delete entitiesE"])
+	assert.Equal(t, 2, counts["batch 1B"])
+
+	output.Reset()
+	assert.NoError(t, testingDispatcher.Maintain())
+	assert.Equal(t, 0, output.Len(), "Tracer recorded after the capture finished")
+}
+
+type testGameState struct {
+	Paused bool
+}
+
+func (t testGameState) GetType() reflect.Type { return reflect.TypeOf(t) }
+func (t testGameState) IsComponent()          {}
+
+func TestRunConditionsAndStages(t *testing.T) {
+	var order []string
+	var orderLock sync.Mutex
+	recordRun := func(name string) func(chan EntityCreationData, chan component.EntityID) error {
+		return func(chan EntityCreationData, chan component.EntityID) error {
+			orderLock.Lock()
+			defer orderLock.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+	countRuns := func(name string) int {
+		count := 0
+		for _, v := range order {
+			if v == name {
+				count++
+			}
+		}
+		return count
+	}
+
+	testingDispatcher := NewSimpleDispatcher()
+	testingDispatcher.AddStorage(component.NewResourceStorage(testGameState{}))
+	testingDispatcher.AddStorage(component.NewDenseStorage[comp1]())
+
+	//Added in reverse order, stages should still order them
+	render := NewBaseService("render")
+	render.SetStage(RenderStage)
+	render.SetRunFunction(recordRun("render"))
+	post := NewBaseService("post")
+	post.SetStage(PostUpdateStage)
+	post.SetRunFunction(recordRun("post"))
+	update := NewBaseService("update")
+	update.SetRunFunction(recordRun("update"))
+	pre := NewBaseService("pre")
+	pre.SetStage(PreUpdateStage)
+	pre.SetRunFunction(recordRun("pre"))
+
+	everyOther := NewBaseService("everyOther")
+	everyOther.AddRunCondition(EveryNTicks(2))
+	everyOther.SetRunFunction(recordRun("everyOther"))
+	unpaused := NewBaseService("unpaused")
+	unpaused.AddRunCondition(ResourceEquals(testGameState{Paused: false}))
+	unpaused.SetRunFunction(recordRun("unpaused"))
+	query := NewBaseService("query")
+	query.AddRunCondition(HasEntities[comp1]())
+	query.SetRunFunction(recordRun("query"))
+	sleepy := NewBaseService("sleepy")
+	sleepy.SetSleepTime(-1)
+	sleepy.SetRunFunction(recordRun("sleepy"))
+	fixed := NewBaseService("fixed")
+	rate, err := FixedRate(1)
+	assert.NoError(t, err)
+	fixed.AddRunCondition(rate)
+	fixed.SetRunFunction(recordRun("fixed"))
+
+	for _, s := range []Service{render, post, update, pre, everyOther, unpaused, query, sleepy, fixed} {
+		assert.NoError(t, testingDispatcher.AddService(s))
+	}
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, testingDispatcher.Maintain())
+	}
+	var staged []string
+	for _, v := range order {
+		if v == "pre" || v == "update" || v == "post" || v == "render" {
+			staged = append(staged, v)
+		}
+	}
+	assert.Equal(t, []string{"pre", "update", "post", "render"}, staged[:4], "Stages did not run in order")
+	assert.Equal(t, 4, countRuns("update"))
+	assert.Equal(t, 2, countRuns("everyOther"), "EveryNTicks(2) did not run every other tick")
+	assert.Equal(t, 4, countRuns("unpaused"))
+	assert.Equal(t, 0, countRuns("query"), "Query condition ran without any entities")
+	assert.Equal(t, 0, countRuns("sleepy"), "Sleeping service was run")
+	assert.Equal(t, 0, countRuns("fixed"), "Fixed rate service ran before its step elapsed")
+
+	//A service may not require a service from a later stage
+	early := NewBaseService("early")
+	early.SetStage(PreUpdateStage)
+	early.AddRequiredService("render")
+	testingDispatcher.AddService(early)
+	assert.Error(t, testingDispatcher.Maintain(), "Requiring a later stage did not fail")
+	testingDispatcher.RemoveService("early")
+}
+
+func TestFixedRateCondition(t *testing.T) {
+	condition, err := FixedRate(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 100*time.Millisecond, condition.Step())
+	runs := 0
+	for i := 0; i < 10; i++ {
+		if condition.ShouldRun(ConditionContext{Tick: TickInfo{Tick: uint64(i), Delta: 50 * time.Millisecond}}) {
+			runs++
+		}
+	}
+	assert.Equal(t, 5, runs, "Fixed rate condition did not run at its rate")
+
+	//Rates without a usable step are rejected instead of dividing by zero
+	for _, hz := range []float64{0, -1, math.NaN(), math.Inf(1), 2e9} {
+		_, err := FixedRate(hz)
+		assert.Error(t, err, "FixedRate(%v) did not fail", hz)
+	}
+	_, err = FixedStep(0)
+	assert.Error(t, err, "FixedStep(0) did not fail")
+	_, err = FixedStep(-time.Second)
+	assert.Error(t, err, "FixedStep with a negative step did not fail")
+}
+
+type testDamageEvent struct {
+	Entity component.EntityID
+	Amount int
+}
+
+func TestEvents(t *testing.T) {
+	testingDispatcher := NewSimpleDispatcher()
+	testingDispatcher.AddStorage(NewEvents[testDamageEvent]())
+
+	tick := 0
+	writer := NewBaseService("writer")
+	writer.AddRequiredAccessComponent(NewEventAccess[testDamageEvent](WriteAccess))
+	writer.SetRunFunction(func(chan EntityCreationData, chan component.EntityID) error {
+		events, err := GetEventWriter[testDamageEvent](writer)
+		if err != nil {
+			return err
+		}
+		events.Send(testDamageEvent{component.EntityID(tick), 1})
+		events.SendBatch([]testDamageEvent{{component.EntityID(tick), 2}, {component.EntityID(tick), 3}})
+		return nil
+	})
+
+	var afterRead, beforeRead [][]testDamageEvent
+	newReader := func(name string, read *[][]testDamageEvent) Service {
+		reader := NewBaseService(name)
+		reader.AddRequiredAccessComponent(NewEventAccess[testDamageEvent](ReadAccess))
+		reader.SetRunFunction(func(chan EntityCreationData, chan component.EntityID) error {
+			events, err := GetEventReader[testDamageEvent](reader)
+			if err != nil {
+				return err
+			}
+			*read = append(*read, events.Read())
+			return nil
+		})
+		return reader
+	}
+	before := newReader("before", &beforeRead)
+	after := newReader("after", &afterRead)
+	after.AddRequiredService("writer")
+	writer.AddRequiredService("before")
+
+	testingDispatcher.AddService(after)
+	testingDispatcher.AddService(writer)
+	testingDispatcher.AddService(before)
+
+	for tick = 0; tick < 3; tick++ {
+		assert.NoError(t, testingDispatcher.Maintain())
+	}
+
+	//Readers after the writer see the events in the same tick
+	assert.Equal(t, 3, len(afterRead))
+	for i, read := range afterRead {
+		assert.Equal(t, []testDamageEvent{{component.EntityID(i), 1}, {component.EntityID(i), 2}, {component.EntityID(i), 3}}, read)
+	}
+
+	//Readers before the writer see them on the next tick
+	assert.Equal(t, 3, len(beforeRead))
+	assert.Equal(t, 0, len(beforeRead[0]))
+	for i, read := range beforeRead[1:] {
+		assert.Equal(t, []testDamageEvent{{component.EntityID(i), 1}, {component.EntityID(i), 2}, {component.EntityID(i), 3}}, read)
+	}
+
+	//Events are dropped after the tick following the one they were sent in
+	events := testingDispatcher.(*simpleDispatcher).storages[1].(*Events[testDamageEvent])
+	assert.Equal(t, 3, events.GetSize())
+	events.swapBuffers()
+	assert.Equal(t, 0, events.GetSize())
+
+	//Writing without write access fails
+	_, err := GetEventWriter[testDamageEvent](before)
+	assert.Error(t, err, "Got an event writer with read access")
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	testingDispatcher := NewSimpleDispatcher()
+	healthStorage := component.NewDenseStorage[TestComponentHealth]()
+	testingDispatcher.AddStorage(healthStorage)
+	assert.NoError(t, AddEntityEvents(testingDispatcher))
+	assert.NoError(t, AddComponentEvents[TestComponentHealth](testingDispatcher))
+	assert.Error(t, AddComponentEvents[TestComponentPosition](testingDispatcher), "Observed a storage that was never added")
+
+	var order []string
+	testingDispatcher.GetHooks().OnEntityCreated(func(entity component.EntityID) {
+		order = append(order, fmt.Sprintf("created %d", entity))
+	})
+	testingDispatcher.GetHooks().OnEntityDespawned(func(entity component.EntityID) {
+		order = append(order, fmt.Sprintf("despawned %d", entity))
+	})
+	assert.NoError(t, OnComponentAdded(testingDispatcher, func(entity component.EntityID, value TestComponentHealth) {
+		order = append(order, fmt.Sprintf("added %d %d", entity, value.Health))
+	}))
+	assert.NoError(t, OnComponentRemoved(testingDispatcher, func(entity component.EntityID, value TestComponentHealth) {
+		order = append(order, fmt.Sprintf("removed %d %d", entity, value.Health))
+	}))
+
+	healthWrite, _ := component.GetWriteStorage[TestComponentHealth](healthStorage)
+	tick := 0
+	spawner := NewBaseService("spawner")
+	spawner.SetRunFunction(func(creation chan EntityCreationData, deletion chan component.EntityID) error {
+		switch tick {
+		case 0:
+			creation <- EntityCreationData{NumEntities: 2, Components: []StorageWriteable{MakeWriteableStorage(TestComponentHealth{10}, healthWrite)}, CreatedEntitiesCallback: make(chan component.EntityID, 2)}
+		case 1:
+			deletion <- 0
+			deletion <- 0
+			deletion <- 42
+		}
+		return nil
+	})
+	var created []EntityCreated
+	var despawned []EntityDespawned
+	var added []ComponentAdded[TestComponentHealth]
+	listener := NewBaseService("listener")
+	listener.AddRequiredAccessComponent(NewEventAccess[EntityCreated](ReadAccess))
+	listener.AddRequiredAccessComponent(NewEventAccess[EntityDespawned](ReadAccess))
+	listener.AddRequiredAccessComponent(NewEventAccess[ComponentAdded[TestComponentHealth]](ReadAccess))
+	listener.SetRunFunction(func(chan EntityCreationData, chan component.EntityID) error {
+		createdReader, _ := GetEventReader[EntityCreated](listener)
+		despawnedReader, _ := GetEventReader[EntityDespawned](listener)
+		addedReader, _ := GetEventReader[ComponentAdded[TestComponentHealth]](listener)
+		created = append(created, createdReader.Read()...)
+		despawned = append(despawned, despawnedReader.Read()...)
+		added = append(added, addedReader.Read()...)
+		return nil
+	})
+	testingDispatcher.AddService(spawner)
+	testingDispatcher.AddService(listener)
+
+	//Hooks run at the end of the tick, events can be read on the next one
+	assert.NoError(t, testingDispatcher.Maintain())
+	assert.Equal(t, []string{"created 0", "added 0 10", "created 1", "added 1 10"}, order)
+	assert.Equal(t, 0, len(created))
+
+	//Duplicate and unknown deletions are ignored
+	tick++
+	order = nil
+	assert.NoError(t, testingDispatcher.Maintain())
+	assert.Equal(t, []string{"despawned 0", "removed 0 10"}, order)
+	assert.Equal(t, []EntityCreated{{0}, {1}}, created)
+	assert.Equal(t, []ComponentAdded[TestComponentHealth]{{0, TestComponentHealth{10}}, {1, TestComponentHealth{10}}}, added)
+
+	//Removing a component calls the removal hooks with the removed value
+	tick++
+	order = nil
+	healthWrite.Write(1, TestComponentHealth{3})
+	assert.NoError(t, healthStorage.DeleteEntityMultiple([]component.EntityID{1}))
+	assert.NoError(t, testingDispatcher.Maintain())
+	assert.Equal(t, []string{"removed 1 3"}, order)
+	assert.Equal(t, []EntityDespawned{{0}}, despawned)
+	removed := testingDispatcher.GetStorage(component.ReflectType[Events[ComponentRemoved[TestComponentHealth]]]()).(*Events[ComponentRemoved[TestComponentHealth]])
+	assert.Equal(t, []ComponentRemoved[TestComponentHealth]{{1, TestComponentHealth{3}}}, removed.read("test"))
+}
+
+type testComponentTag struct {
+	Name string
+}
+
+func (t testComponentTag) GetType() reflect.Type { return reflect.TypeOf(t) }
+func (t testComponentTag) IsComponent()          {}
+
+func TestDespawnRemovesComponents(t *testing.T) {
+	testingDispatcher := NewSimpleDispatcher()
+	healthStorage := component.NewDenseStorage[TestComponentHealth]()
+	positionStorage := component.NewVectorStorage[TestComponentPosition]()
+	tagStorage := component.NewDenseStorage[testComponentTag]()
+	healthWrite, _ := component.GetWriteStorage[TestComponentHealth](healthStorage)
+	positionWrite, _ := component.GetWriteStorage[TestComponentPosition](positionStorage)
+	tagWrite, _ := component.GetWriteStorage[testComponentTag](tagStorage)
+
+	//Components added before the storage is registered are indexed too
+	tagWrite.AddEntity(100, testComponentTag{"preexisting"})
+	testingDispatcher.AddStorage(healthStorage)
+	testingDispatcher.AddStorage(positionStorage)
+	testingDispatcher.AddStorage(tagStorage)
+
+	var removed []component.EntityID
+	assert.NoError(t, OnComponentRemoved(testingDispatcher, func(entity component.EntityID, value TestComponentPosition) {
+		removed = append(removed, entity)
+	}))
+
+	tick := 0
+	all := make(chan component.EntityID, 4)
+	tagged := make(chan component.EntityID, 2)
+	var toDespawn []component.EntityID
+	spawner := NewBaseService("spawner")
+	spawner.SetRunFunction(func(creation chan EntityCreationData, deletion chan component.EntityID) error {
+		if tick == 0 {
+			creation <- EntityCreationData{NumEntities: 4, Components: []StorageWriteable{
+				MakeWriteableStorage(TestComponentHealth{10}, healthWrite),
+				MakeWriteableStorage(TestComponentPosition{1, 2, 3}, positionWrite),
+			}, CreatedEntitiesCallback: all}
+			creation <- EntityCreationData{NumEntities: 2, Components: []StorageWriteable{
+				MakeWriteableStorage(TestComponentHealth{5}, healthWrite),
+				MakeWriteableStorage(testComponentTag{"tagged"}, tagWrite),
+			}, CreatedEntitiesCallback: tagged}
+		}
+		for _, e := range toDespawn {
+			deletion <- e
+		}
+		return nil
+	})
+	testingDispatcher.AddService(spawner)
+
+	assert.NoError(t, testingDispatcher.Maintain())
+	var spawned []component.EntityID
+	for i := 0; i < 4; i++ {
+		spawned = append(spawned, <-all)
+	}
+	for i := 0; i < 2; i++ {
+		spawned = append(spawned, <-tagged)
+	}
+	assert.Equal(t, 6, healthStorage.GetSize())
+	assert.Equal(t, 4, positionStorage.GetSize())
+	assert.Equal(t, 3, tagStorage.GetSize())
+
+	//Despawn one entity with position and one with a tag
+	tick++
+	toDespawn = []component.EntityID{spawned[1], spawned[4]}
+	assert.NoError(t, testingDispatcher.Maintain())
+	assert.Equal(t, 4, healthStorage.GetSize())
+	assert.Equal(t, 3, positionStorage.GetSize())
+	assert.Equal(t, 2, tagStorage.GetSize())
+	assert.False(t, healthStorage.Exists(spawned[1]))
+	assert.False(t, positionStorage.Exists(spawned[1]))
+	assert.False(t, healthStorage.Exists(spawned[4]))
+	assert.False(t, tagStorage.Exists(spawned[4]))
+	assert.True(t, positionStorage.Exists(spawned[0]))
+	assert.True(t, tagStorage.Exists(spawned[5]))
+	assert.Equal(t, []component.EntityID{spawned[1]}, removed)
+
+	//The remaining components are untouched
+	health, _ := healthWrite.GetComponent(spawned[5])
+	assert.Equal(t, TestComponentHealth{5}, health)
+	position, _ := positionWrite.GetComponent(spawned[3])
+	assert.Equal(t, TestComponentPosition{1, 2, 3}, position)
+
+	//Despawned entities are removed from the membership index
+	membership := testingDispatcher.(*simpleDispatcher).membership
+	assert.Empty(t, membership.storagesOf(spawned[1]))
+	assert.Empty(t, membership.storagesOf(spawned[4]))
+	assert.ElementsMatch(t, []reflect.Type{healthStorage.GetType(), positionStorage.GetType()}, membership.storagesOf(spawned[0]))
+	assert.Equal(t, []reflect.Type{tagStorage.GetType()}, membership.storagesOf(100))
+
+	//Despawning everything empties every storage
+	tick++
+	toDespawn = append(append([]component.EntityID{}, spawned...), 100)
+	testingDispatcher.(*simpleDispatcher).entities[100] = component.Entity{EntityNum: 100}
+	assert.NoError(t, testingDispatcher.Maintain())
+	assert.Equal(t, 0, healthStorage.GetSize())
+	assert.Equal(t, 0, positionStorage.GetSize())
+	assert.Equal(t, 0, tagStorage.GetSize())
+	assert.Empty(t, membership.members)
+	assert.Equal(t, 4, len(removed))
+}
+
+func TestHierarchy(t *testing.T) {
+	testingDispatcher := NewSimpleDispatcher()
+	assert.NoError(t, AddHierarchy(testingDispatcher))
+	assert.NoError(t, AddEntityEvents(testingDispatcher))
+	getWrite := func(storageType reflect.Type) component.ComponentStorage {
+		return testingDispatcher.GetStorage(storageType)
+	}
+	transforms, _ := component.GetWriteStorage[Transform](getWrite(component.ReflectType[Transform]()))
+	parents, _ := component.GetWriteStorage[Parent](getWrite(component.ReflectType[Parent]()))
+	children, _ := component.GetWriteStorage[Children](getWrite(component.ReflectType[Children]()))
+	globals, _ := component.GetWriteStorage[GlobalTransform](getWrite(component.ReflectType[GlobalTransform]()))
+
+	var toDespawn []component.EntityID
+	created := make(chan component.EntityID, 4)
+	tick := 0
+	spawner := NewBaseService("spawner")
+	spawner.SetRunFunction(func(creation chan EntityCreationData, deletion chan component.EntityID) error {
+		if tick == 0 {
+			creation <- EntityCreationData{NumEntities: 4, Components: []StorageWriteable{MakeWriteableStorage(NewTransform().Translate(1, 0), transforms)}, CreatedEntitiesCallback: created}
+		}
+		for _, e := range toDespawn {
+			deletion <- e
+		}
+		return nil
+	})
+	testingDispatcher.AddService(spawner)
+	assert.NoError(t, testingDispatcher.Maintain())
+	root, child, grandchild, other := <-created, <-created, <-created, <-created
+
+	//Attach child and other to root and grandchild to child
+	tick++
+	transforms.Write(root, NewTransform().Translate(10, 5))
+	parents.AddEntity(grandchild, Parent{child})
+	parents.AddEntity(other, Parent{root})
+	parents.AddEntity(child, Parent{root})
+	assert.NoError(t, testingDispatcher.Maintain())
+
+	rootChildren, err := children.GetComponent(root)
+	assert.NoError(t, err)
+	assert.Equal(t, []component.EntityID{child, other}, rootChildren.Entities)
+	childChildren, err := children.GetComponent(child)
+	assert.NoError(t, err)
+	assert.Equal(t, []component.EntityID{grandchild}, childChildren.Entities)
+
+	x, y := globals.MustGetComponent(grandchild).Apply(0, 0)
+	assert.InDelta(t, 12, x, 1e-9)
+	assert.InDelta(t, 5, y, 1e-9)
+	x, y = globals.MustGetComponent(root).Apply(0, 0)
+	assert.InDelta(t, 10, x, 1e-9)
+
+	//Detaching moves the entity back to world space
+	tick++
+	parents.DeleteEntity(other)
+	assert.NoError(t, testingDispatcher.Maintain())
+	rootChildren, _ = children.GetComponent(root)
+	assert.Equal(t, []component.EntityID{child}, rootChildren.Entities)
+	x, _ = globals.MustGetComponent(other).Apply(0, 0)
+	assert.InDelta(t, 1, x, 1e-9)
+
+	//Despawning the root despawns all of its descendants
+	tick++
+	toDespawn = []component.EntityID{root}
+	assert.NoError(t, testingDispatcher.Maintain())
+	toDespawn = nil
+	assert.Equal(t, []component.EntityID{other}, transforms.GetEntities())
+	assert.Equal(t, 0, parents.GetSize())
+	assert.Equal(t, 0, children.GetSize())
+	assert.Equal(t, []component.EntityID{other}, globals.GetEntities())
+	despawned := testingDispatcher.GetStorage(component.ReflectType[Events[EntityDespawned]]()).(*Events[EntityDespawned])
+	assert.Equal(t, []EntityDespawned{{root}, {child}, {grandchild}}, despawned.read("test"))
+}
+
+func TestDeterministicCreation(t *testing.T) {
+	build := func() (Dispatcher, component.WriteStorage[TestComponentHealth]) {
+		d := NewSimpleDispatcher()
+		d.SetFixedTimestep(time.Second / 30)
+		healthStorage := component.NewDenseStorage[TestComponentHealth]()
+		d.AddStorage(healthStorage)
+		d.AddStorage(component.NewResourceStorage(NewRandom(7)))
+		healthWrite, _ := component.GetWriteStorage[TestComponentHealth](healthStorage)
+		//The spawners share no storages so they run at the same time
+		for i := 0; i < 4; i++ {
+			base := i * 100
+			spawner := NewBaseService(fmt.Sprintf("spawner %d", i))
+			spawner.SetRunFunction(func(creation chan EntityCreationData, deletion chan component.EntityID) error {
+				for j := 0; j < 5; j++ {
+					creation <- EntityCreationData{NumEntities: 1, Components: []StorageWriteable{MakeWriteableStorage(TestComponentHealth{base + j}, healthWrite)}}
+				}
+				return nil
+			})
+			d.AddService(spawner)
+		}
+		return d, healthWrite
+	}
+
+	d, healthWrite := build()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, d.Maintain())
+	}
+	info, _ := component.GetWriteStorage[TickInfo](d.GetStorage(component.ReflectType[TickInfo]()))
+	assert.Equal(t, TickInfo{Tick: 2, Delta: time.Second / 30, Elapsed: 3 * (time.Second / 30)}, info.MustGetComponent(0))
+
+	//Entities are created in schedule order, then in the order they were sent
+	for i := 0; i < 20; i++ {
+		health, err := healthWrite.GetComponent(component.EntityID(i))
+		assert.NoError(t, err)
+		assert.Equal(t, (i/5)*100+i%5, health.Health)
+	}
+
+	other, _ := build()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, other.Maintain())
+	}
+	assert.Equal(t, StateHash(d), StateHash(other))
+	healthWrite.Write(3, TestComponentHealth{-1})
+	assert.NotEqual(t, StateHash(d), StateHash(other))
+}
+
+func TestDeterministicMode(t *testing.T) {
+	d := NewSimpleDispatcher()
+	d.SetDeterministic(true)
+	assert.True(t, d.IsDeterministic())
+	assert.Error(t, d.Maintain())
+
+	d.SetFixedTimestep(time.Second / 60)
+	healthStorage := component.NewDenseStorage[TestComponentHealth]()
+	d.AddStorage(healthStorage)
+	d.AddStorage(component.NewResourceStorage(NewRandom(7)))
+	//The services share no storages, so only deterministic mode keeps them in order
+	var lock sync.Mutex
+	order := []int{}
+	for i := 0; i < 8; i++ {
+		i := i
+		s := NewBaseService(fmt.Sprintf("ordered %d", i))
+		s.SetRunFunction(func(creation chan EntityCreationData, deletion chan component.EntityID) error {
+			lock.Lock()
+			order = append(order, i)
+			lock.Unlock()
+			return nil
+		})
+		d.AddService(s)
+	}
+	for tick := 0; tick < 5; tick++ {
+		order = order[:0]
+		assert.NoError(t, d.Maintain())
+		assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7}, order)
+	}
+
+	//The storage hashes show which storage changed
+	healthWrite, _ := component.GetWriteStorage[TestComponentHealth](healthStorage)
+	d.Spawn(EntityCreationData{NumEntities: 1, Components: []StorageWriteable{MakeWriteableStorage(TestComponentHealth{5}, healthWrite)}})
+	assert.NoError(t, d.Maintain())
+	entities := d.GetEntities()
+	assert.Len(t, entities, 1)
+	before := StorageHashes(d)
+	healthWrite.Write(entities[0], TestComponentHealth{6})
+	after := StorageHashes(d)
+	assert.Equal(t, len(before), len(after))
+	changed := []reflect.Type{}
+	for i := range before {
+		if before[i].Hash != after[i].Hash {
+			changed = append(changed, after[i].Type)
+		}
+	}
+	assert.Equal(t, []reflect.Type{component.ReflectType[TestComponentHealth]()}, changed)
+}
+
+func TestSpatialIndex(t *testing.T) {
+	index := NewSpatialIndex(10)
+	index.Insert(1, PointBounds(5, 5))
+	index.Insert(2, Bounds{12, 12, 18, 18})
+	index.Insert(3, PointBounds(-25, 5))
+	index.Insert(4, Bounds{-1000, -1000, 1000, -990})
+	index.Insert(5, PointBounds(100, 100))
+	assert.Equal(t, 5, index.Len())
+
+	assert.Equal(t, []component.EntityID{1, 2}, index.Region(Bounds{0, 0, 15, 15}))
+	assert.Equal(t, []component.EntityID{4}, index.Region(Bounds{500, -995, 501, -994}))
+	assert.Equal(t, []component.EntityID{1, 3}, index.Radius(-10, 5, 15))
+	assert.Equal(t, []component.EntityID{2, 1, 3}, index.Nearest(15, 15, 3))
+	assert.Equal(t, []component.EntityID{5, 2, 1, 3, 4}, index.Nearest(90, 90, 10))
+
+	hits := index.Raycast(-40, 5, 1, 0, 0)
+	assert.Equal(t, []RayHit{{3, 15}, {1, 45}}, hits)
+	assert.Equal(t, []RayHit{{3, 15}}, index.Raycast(-40, 5, 2, 0, 30))
+	hits = index.Raycast(0, 0, 1, 1, 0)
+	assert.Equal(t, 3, len(hits))
+	assert.Equal(t, []component.EntityID{1, 2, 5}, []component.EntityID{hits[0].Entity, hits[1].Entity, hits[2].Entity})
+	assert.InDelta(t, 12*math.Sqrt2, hits[1].Distance, 1e-9)
+	assert.Equal(t, []RayHit{{4, 0}}, index.Raycast(0, -995, 0, -1, 0))
+
+	//Moving and removing entities updates every query
+	index.Insert(1, PointBounds(95, 95))
+	index.Remove(3)
+	index.Remove(4)
+	assert.Equal(t, []component.EntityID{2}, index.Region(Bounds{-50, -50, 50, 50}))
+	assert.Equal(t, []component.EntityID{1, 5}, index.Radius(100, 100, 10))
+	assert.Empty(t, index.Raycast(-40, 5, 1, 0, 0))
+	_, ok := index.Bounds(3)
+	assert.False(t, ok)
+	assert.Equal(t, 3, index.Len())
+}
+
+func TestSpatialIndexService(t *testing.T) {
+	testingDispatcher := NewSimpleDispatcher()
+	assert.NoError(t, AddHierarchy(testingDispatcher))
+	assert.NoError(t, AddSpatialIndex(testingDispatcher, 16))
+	getWrite := func(storageType reflect.Type) component.ComponentStorage {
+		return testingDispatcher.GetStorage(storageType)
+	}
+	transforms, _ := component.GetWriteStorage[Transform](getWrite(component.ReflectType[Transform]()))
+	parents, _ := component.GetWriteStorage[Parent](getWrite(component.ReflectType[Parent]()))
+	renderables, _ := component.GetWriteStorage[Renderable](getWrite(component.ReflectType[Renderable]()))
+	indexes, _ := component.GetReadOnlyStorage[SpatialIndex](getWrite(component.ReflectType[SpatialIndex]()))
+
+	//A sprite 10 wide at 100, 0 and a point entity following it as a child
+	assert.NoError(t, transforms.AddEntity(1, NewTransform().Translate(100, 0)))
+	assert.NoError(t, renderables.AddEntity(1, NewRenderable().Scale(10, 10)))
+	assert.NoError(t, transforms.AddEntity(2, NewTransform().Translate(0, 20)))
+	assert.NoError(t, parents.AddEntity(2, Parent{1}))
+	assert.NoError(t, renderables.AddEntity(3, NewRenderable().Translate(-50, -50)))
+	assert.NoError(t, testingDispatcher.Maintain())
+
+	index := indexes.MustGetComponent(0)
+	assert.Equal(t, 3, index.Len())
+	bounds, ok := index.Bounds(1)
+	assert.True(t, ok)
+	assert.InDelta(t, 95, bounds.MinX, 1e-9)
+	assert.InDelta(t, 105, bounds.MaxX, 1e-9)
+	assert.Equal(t, []component.EntityID{1, 2}, index.Radius(100, 10, 10))
+	assert.Equal(t, []component.EntityID{3}, index.Nearest(-40, -40, 1))
+
+	//Moving the parent moves the child and despawned entities leave the index
+	assert.NoError(t, transforms.Write(1, NewTransform().Translate(-100, 0)))
+	renderables.DeleteEntity(3)
+	assert.NoError(t, testingDispatcher.Maintain())
+	index = indexes.MustGetComponent(0)
+	assert.Equal(t, []component.EntityID{1, 2}, index.Region(Bounds{-110, -10, -90, 30}))
+	assert.Empty(t, index.Region(Bounds{90, -10, 110, 30}))
+	assert.Equal(t, 2, index.Len())
+}
+
+func TestRenderCulling(t *testing.T) {
+	testingDispatcher := NewSimpleDispatcher()
+	renderChan := make(chan []float32, 1)
+	assert.NoError(t, AddHierarchy(testingDispatcher))
+	assert.NoError(t, testingDispatcher.AddStorage(component.NewVectorStorage[Renderable]()))
+	assert.NoError(t, testingDispatcher.AddStorage(component.NewVectorStorage[Quads]()))
+	assert.NoError(t, testingDispatcher.AddStorage(component.NewResourceStorage(Viewport{})))
+	assert.NoError(t, testingDispatcher.AddStorage(component.NewResourceStorage(RenderStats{})))
+	assert.NoError(t, testingDispatcher.AddService(NewRenderService(renderChan)))
+	getWrite := func(storageType reflect.Type) component.ComponentStorage {
+		return testingDispatcher.GetStorage(storageType)
+	}
+	renderables, _ := component.GetWriteStorage[Renderable](getWrite(component.ReflectType[Renderable]()))
+	transforms, _ := component.GetWriteStorage[Transform](getWrite(component.ReflectType[Transform]()))
+	viewports, _ := component.GetWriteStorage[Viewport](getWrite(component.ReflectType[Viewport]()))
+	//Read only storages are copies, so the stats are read again every frame
+	stats := func() RenderStats {
+		storage, _ := component.GetReadOnlyStorage[RenderStats](getWrite(component.ReflectType[RenderStats]()))
+		return storage.MustGetComponent(0)
+	}
+	render := func() int {
+		assert.NoError(t, testingDispatcher.Maintain())
+		return len(<-renderChan) / QuadFloats
+	}
+
+	for i, x := range []float64{0, 100, 1000, -60} {
+		assert.NoError(t, renderables.AddEntity(component.EntityID(i), NewRenderable().Scale(20, 20).TranslateX(x)))
+	}
+	//Entity 3 is only on screen once its transform moves it there
+	assert.NoError(t, transforms.AddEntity(3, NewTransform().Translate(-1000, 0)))
+
+	//Without a viewport everything is drawn
+	assert.Equal(t, 4, render())
+	assert.Equal(t, RenderStats{Visible: 4}, stats())
+
+	assert.NoError(t, viewports.Write(0, Viewport{X: -50, Y: -50, W: 200, H: 100}))
+	assert.Equal(t, 2, render())
+	assert.Equal(t, RenderStats{Visible: 2, Culled: 2}, stats())
+
+	//The spatial index gives the same result and follows transforms
+	assert.NoError(t, AddSpatialIndex(testingDispatcher, 32))
+	assert.Equal(t, 2, render())
+	assert.Equal(t, RenderStats{Visible: 2, Culled: 2}, stats())
+	assert.NoError(t, transforms.Write(3, NewTransform().Translate(80, 0)))
+	assert.Equal(t, 3, render())
+	assert.Equal(t, RenderStats{Visible: 3, Culled: 1}, stats())
+
+	//The viewport service follows the window size
+	width := 10
+	assert.NoError(t, testingDispatcher.AddService(NewViewportService(func() (int, int) { return width, 50 })))
+	assert.Equal(t, 2, render())
+	assert.Equal(t, RenderStats{Visible: 2, Culled: 2}, stats())
+	width = 200
+	assert.Equal(t, 3, render())
+	assert.Equal(t, RenderStats{Visible: 3, Culled: 1}, stats())
+}
@@ -0,0 +1,562 @@
+package world
+
+import (
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/jevans40/Ruthenium/component"
+)
+
+//An axis aligned box in world units. A point is a box with no size.
+type Bounds struct {
+	MinX, MinY float64
+	MaxX, MaxY float64
+}
+
+func PointBounds(x, y float64) Bounds {
+	return Bounds{x, y, x, y}
+}
+
+//Returns true if the boxes overlap or touch
+func (b Bounds) Overlaps(o Bounds) bool {
+	return b.MinX <= o.MaxX && o.MinX <= b.MaxX && b.MinY <= o.MaxY && o.MinY <= b.MaxY
+}
+
+func (b Bounds) Contains(x, y float64) bool {
+	return x >= b.MinX && x <= b.MaxX && y >= b.MinY && y <= b.MaxY
+}
+
+//Returns the squared distance from the point to the closest point of the box,
+//0 if the point is inside
+func (b Bounds) DistanceSquared(x, y float64) float64 {
+	dx := math.Max(0, math.Max(b.MinX-x, x-b.MaxX))
+	dy := math.Max(0, math.Max(b.MinY-y, y-b.MaxY))
+	return dx*dx + dy*dy
+}
+
+//Returns the distance along the ray where it enters the box and true if it hits
+//it. The direction has to have a length of 1, rays starting inside the box hit
+//it at 0.
+func (b Bounds) Raycast(originX, originY, directionX, directionY float64) (float64, bool) {
+	enter, exit := 0.0, math.Inf(1)
+	for _, axis := range [2][4]float64{{originX, directionX, b.MinX, b.MaxX}, {originY, directionY, b.MinY, b.MaxY}} {
+		origin, direction, min, max := axis[0], axis[1], axis[2], axis[3]
+		if direction == 0 {
+			if origin < min || origin > max {
+				return 0, false
+			}
+			continue
+		}
+		near, far := (min-origin)/direction, (max-origin)/direction
+		if near > far {
+			near, far = far, near
+		}
+		enter, exit = math.Max(enter, near), math.Min(exit, far)
+		if enter > exit {
+			return 0, false
+		}
+	}
+	return enter, true
+}
+
+//Returns the box the renderable covers on screen, global may be nil like in the
+//render service
+func (r Renderable) WorldBounds(global *GlobalTransform) Bounds {
+	bounds := Bounds{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for i := 0; i < 4; i++ {
+		x, y := r.X+r.verts[i*2], r.Y+r.verts[i*2+1]
+		if global != nil {
+			x, y = global.Apply(x, y)
+		}
+		bounds.MinX, bounds.MaxX = math.Min(bounds.MinX, x), math.Max(bounds.MaxX, x)
+		bounds.MinY, bounds.MaxY = math.Min(bounds.MinY, y), math.Max(bounds.MaxY, y)
+	}
+	return bounds
+}
+
+/***************************/
+/*      Spatial Index      */
+
+//Entities covering more cells than this are kept in a list that every query
+//checks instead of in the cells
+const maxSpatialCells = 64
+
+type spatialCell struct {
+	x, y int
+}
+
+type spatialGrid struct {
+	cellSize float64
+	bounds   map[component.EntityID]Bounds
+	cells    map[spatialCell][]component.EntityID
+	large    map[component.EntityID]bool
+	//Every cell that was ever used is inside these, so searches know when to stop
+	minCell, maxCell spatialCell
+}
+
+//A resource that finds entities by where they are. It is a uniform grid, every
+//entity is in each cell its bounds touch. Copies share the same grid, the
+//spatial index service keeps the one in the dispatcher up to date and other
+//services read it with GetReadStorage. Results are sorted so they do not depend
+//on the order entities were added in.
+type SpatialIndex struct {
+	grid *spatialGrid
+}
+
+func (s SpatialIndex) GetType() reflect.Type { return reflect.TypeOf(s) }
+func (s SpatialIndex) IsComponent()          {}
+
+//Creates an empty index with square cells of the given size. Cells should be
+//about as big as the things in them, anything at or below 0 counts as 64.
+func NewSpatialIndex(cellSize float64) SpatialIndex {
+	if cellSize <= 0 {
+		cellSize = 64
+	}
+	return SpatialIndex{grid: &spatialGrid{
+		cellSize: cellSize,
+		bounds:   map[component.EntityID]Bounds{},
+		cells:    map[spatialCell][]component.EntityID{},
+		large:    map[component.EntityID]bool{},
+	}}
+}
+
+//Returns the number of entities in the index
+func (s SpatialIndex) Len() int {
+	if s.grid == nil {
+		return 0
+	}
+	return len(s.grid.bounds)
+}
+
+func (s SpatialIndex) Bounds(e component.EntityID) (Bounds, bool) {
+	if s.grid == nil {
+		return Bounds{}, false
+	}
+	bounds, ok := s.grid.bounds[e]
+	return bounds, ok
+}
+
+//Adds the entity or moves it if it is already in the index
+func (s SpatialIndex) Insert(e component.EntityID, bounds Bounds) {
+	g := s.grid
+	if old, ok := g.bounds[e]; ok {
+		if old == bounds {
+			return
+		}
+		s.Remove(e)
+	}
+	g.bounds[e] = bounds
+	min, max := g.cellOf(bounds.MinX, bounds.MinY), g.cellOf(bounds.MaxX, bounds.MaxY)
+	if (max.x-min.x+1)*(max.y-min.y+1) > maxSpatialCells {
+		g.large[e] = true
+		return
+	}
+	if len(g.cells) == 0 {
+		g.minCell, g.maxCell = min, max
+	}
+	g.minCell = spatialCell{minInt(g.minCell.x, min.x), minInt(g.minCell.y, min.y)}
+	g.maxCell = spatialCell{maxInt(g.maxCell.x, max.x), maxInt(g.maxCell.y, max.y)}
+	for x := min.x; x <= max.x; x++ {
+		for y := min.y; y <= max.y; y++ {
+			cell := spatialCell{x, y}
+			g.cells[cell] = append(g.cells[cell], e)
+		}
+	}
+}
+
+func (s SpatialIndex) Remove(e component.EntityID) {
+	g := s.grid
+	bounds, ok := g.bounds[e]
+	if !ok {
+		return
+	}
+	delete(g.bounds, e)
+	if g.large[e] {
+		delete(g.large, e)
+		return
+	}
+	min, max := g.cellOf(bounds.MinX, bounds.MinY), g.cellOf(bounds.MaxX, bounds.MaxY)
+	for x := min.x; x <= max.x; x++ {
+		for y := min.y; y <= max.y; y++ {
+			cell := spatialCell{x, y}
+			entities := g.cells[cell]
+			for i, other := range entities {
+				if other == e {
+					entities = append(entities[:i:i], entities[i+1:]...)
+					break
+				}
+			}
+			if len(entities) == 0 {
+				delete(g.cells, cell)
+			} else {
+				g.cells[cell] = entities
+			}
+		}
+	}
+}
+
+func (g *spatialGrid) cellOf(x, y float64) spatialCell {
+	return spatialCell{int(math.Floor(x / g.cellSize)), int(math.Floor(y / g.cellSize))}
+}
+
+//Calls visit with every entity in the cells that touch the box and every large
+//entity, entities can be visited more than once
+func (g *spatialGrid) visit(bounds Bounds, visit func(e component.EntityID)) {
+	for e := range g.large {
+		visit(e)
+	}
+	min, max := g.cellOf(bounds.MinX, bounds.MinY), g.cellOf(bounds.MaxX, bounds.MaxY)
+	min = spatialCell{maxInt(min.x, g.minCell.x), maxInt(min.y, g.minCell.y)}
+	max = spatialCell{minInt(max.x, g.maxCell.x), minInt(max.y, g.maxCell.y)}
+	if (max.x-min.x+1)*(max.y-min.y+1) > len(g.cells) {
+		//Cheaper to look at the cells that exist
+		for cell, entities := range g.cells {
+			if cell.x >= min.x && cell.x <= max.x && cell.y >= min.y && cell.y <= max.y {
+				for _, e := range entities {
+					visit(e)
+				}
+			}
+		}
+		return
+	}
+	for x := min.x; x <= max.x; x++ {
+		for y := min.y; y <= max.y; y++ {
+			for _, e := range g.cells[spatialCell{x, y}] {
+				visit(e)
+			}
+		}
+	}
+}
+
+func sortedEntities(set map[component.EntityID]bool) []component.EntityID {
+	entities := make([]component.EntityID, 0, len(set))
+	for e := range set {
+		entities = append(entities, e)
+	}
+	sort.Slice(entities, func(i, j int) bool { return entities[i] < entities[j] })
+	return entities
+}
+
+//Returns the entities whose bounds overlap the region
+func (s SpatialIndex) Region(region Bounds) []component.EntityID {
+	found := map[component.EntityID]bool{}
+	if s.grid != nil {
+		s.grid.visit(region, func(e component.EntityID) {
+			if !found[e] && s.grid.bounds[e].Overlaps(region) {
+				found[e] = true
+			}
+		})
+	}
+	return sortedEntities(found)
+}
+
+//Returns the entities whose bounds are at most radius away from the point
+func (s SpatialIndex) Radius(x, y, radius float64) []component.EntityID {
+	found := map[component.EntityID]bool{}
+	if s.grid != nil {
+		region := Bounds{x - radius, y - radius, x + radius, y + radius}
+		s.grid.visit(region, func(e component.EntityID) {
+			if !found[e] && s.grid.bounds[e].DistanceSquared(x, y) <= radius*radius {
+				found[e] = true
+			}
+		})
+	}
+	return sortedEntities(found)
+}
+
+//Returns up to n entities whose bounds are closest to the point, closest first.
+//Entities at the same distance are sorted by id.
+func (s SpatialIndex) Nearest(x, y float64, n int) []component.EntityID {
+	if s.grid == nil || n <= 0 || s.Len() == 0 {
+		return []component.EntityID{}
+	}
+	g := s.grid
+	type candidate struct {
+		e        component.EntityID
+		distance float64
+	}
+	seen := map[component.EntityID]bool{}
+	candidates := []candidate{}
+	add := func(e component.EntityID) {
+		if !seen[e] {
+			seen[e] = true
+			candidates = append(candidates, candidate{e, g.bounds[e].DistanceSquared(x, y)})
+		}
+	}
+	byDistance := func() {
+		sort.Slice(candidates, func(i, j int) bool {
+			if candidates[i].distance != candidates[j].distance {
+				return candidates[i].distance < candidates[j].distance
+			}
+			return candidates[i].e < candidates[j].e
+		})
+	}
+
+	for e := range g.large {
+		add(e)
+	}
+	//Search rings of cells around the point. Entities that were not found by
+	//ring r are at least r cells away.
+	center := g.cellOf(x, y)
+	last := maxInt(maxInt(absInt(center.x-g.minCell.x), absInt(center.x-g.maxCell.x)),
+		maxInt(absInt(center.y-g.minCell.y), absInt(center.y-g.maxCell.y)))
+	for ring := 0; ring <= last; ring++ {
+		for cx := center.x - ring; cx <= center.x+ring; cx++ {
+			for cy := center.y - ring; cy <= center.y+ring; cy++ {
+				if absInt(cx-center.x) != ring && absInt(cy-center.y) != ring {
+					continue
+				}
+				for _, e := range g.cells[spatialCell{cx, cy}] {
+					add(e)
+				}
+			}
+		}
+		if len(candidates) >= n {
+			byDistance()
+			reach := float64(ring) * g.cellSize
+			if candidates[n-1].distance <= reach*reach {
+				break
+			}
+		}
+	}
+	byDistance()
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	nearest := make([]component.EntityID, len(candidates))
+	for i, c := range candidates {
+		nearest[i] = c.e
+	}
+	return nearest
+}
+
+//An entity hit by a ray
+type RayHit struct {
+	Entity component.EntityID
+	//Where the ray enters the bounds of the entity
+	Distance float64
+}
+
+//Returns every entity whose bounds the ray hits within maxDistance, closest
+//first. The direction does not need a length of 1, a maxDistance at or below 0
+//has no limit.
+func (s SpatialIndex) Raycast(originX, originY, directionX, directionY, maxDistance float64) []RayHit {
+	hits := []RayHit{}
+	length := math.Hypot(directionX, directionY)
+	if s.grid == nil || length == 0 {
+		return hits
+	}
+	g := s.grid
+	directionX, directionY = directionX/length, directionY/length
+	if maxDistance <= 0 {
+		maxDistance = math.Inf(1)
+	}
+	tested := map[component.EntityID]bool{}
+	test := func(e component.EntityID) {
+		if tested[e] {
+			return
+		}
+		tested[e] = true
+		if distance, ok := g.bounds[e].Raycast(originX, originY, directionX, directionY); ok && distance <= maxDistance {
+			hits = append(hits, RayHit{e, distance})
+		}
+	}
+	for e := range g.large {
+		test(e)
+	}
+
+	//Walk the cells along the ray inside the used part of the grid
+	used := Bounds{
+		float64(g.minCell.x) * g.cellSize, float64(g.minCell.y) * g.cellSize,
+		float64(g.maxCell.x+1) * g.cellSize, float64(g.maxCell.y+1) * g.cellSize,
+	}
+	enter, ok := used.Raycast(originX, originY, directionX, directionY)
+	if ok && len(g.cells) != 0 && enter <= maxDistance {
+		//Start a little inside so the first cell is the one the ray enters
+		x, y := originX+directionX*enter, originY+directionY*enter
+		cell := g.cellOf(x+directionX*1e-9, y+directionY*1e-9)
+		stepX, stepY := 1, 1
+		if directionX < 0 {
+			stepX = -1
+		}
+		if directionY < 0 {
+			stepY = -1
+		}
+		//The distance along the ray to the next cell border on each axis
+		border := func(position, direction float64, cell, step int) float64 {
+			if direction == 0 {
+				return math.Inf(1)
+			}
+			next := float64(cell) * g.cellSize
+			if step > 0 {
+				next += g.cellSize
+			}
+			return (next - position) / direction
+		}
+		nextX, nextY := enter+border(x, directionX, cell.x, stepX), enter+border(y, directionY, cell.y, stepY)
+		deltaX, deltaY := math.Abs(g.cellSize/directionX), math.Abs(g.cellSize/directionY)
+		for cell.x >= g.minCell.x && cell.x <= g.maxCell.x && cell.y >= g.minCell.y && cell.y <= g.maxCell.y {
+			for _, e := range g.cells[cell] {
+				test(e)
+			}
+			if nextX < nextY {
+				if nextX > maxDistance {
+					break
+				}
+				cell.x += stepX
+				nextX += deltaX
+			} else {
+				if nextY > maxDistance {
+					break
+				}
+				cell.y += stepY
+				nextY += deltaY
+			}
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Distance != hits[j].Distance {
+			return hits[i].Distance < hits[j].Distance
+		}
+		return hits[i].Entity < hits[j].Entity
+	})
+	return hits
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+/***************************/
+/*  Spatial Index Service  */
+
+//Adds a SpatialIndex resource with the given cell size and the service that
+//keeps it up to date, along with Renderable and Transform storages if the
+//dispatcher does not have them yet. When the dispatcher has a GlobalTransform
+//storage the index uses global positions, so AddHierarchy has to be called
+//first for children to be placed with their parents.
+func AddSpatialIndex(d Dispatcher, cellSize float64) error {
+	if d.GetStorage(component.ReflectType[Renderable]()) == nil {
+		if err := d.AddStorage(component.NewVectorStorage[Renderable]()); err != nil {
+			return err
+		}
+	}
+	if d.GetStorage(component.ReflectType[Transform]()) == nil {
+		if err := d.AddStorage(component.NewVectorStorage[Transform]()); err != nil {
+			return err
+		}
+	}
+	if err := d.AddStorage(component.NewResourceStorage(NewSpatialIndex(cellSize))); err != nil {
+		return err
+	}
+	hierarchy := d.GetStorage(component.ReflectType[GlobalTransform]()) != nil
+	return d.AddService(NewSpatialIndexService(hierarchy))
+}
+
+//Creates the service that moves every entity in the SpatialIndex to where it is
+//this tick. Entities with a Renderable are indexed with the box they are drawn
+//in, other entities with a Transform with the point at its origin. It runs in
+//the PostUpdateStage, with hierarchy set it also reads GlobalTransform and runs
+//after transform propagation.
+func NewSpatialIndexService(hierarchy bool) Service {
+	service := NewBaseService("spatial index")
+	service.SetStage(PostUpdateStage)
+	service.AddRequiredAccessComponent(NewComponentAccess[Renderable](ReadAccess))
+	service.AddRequiredAccessComponent(NewComponentAccess[Transform](ReadAccess))
+	service.AddRequiredAccessComponent(NewComponentAccess[SpatialIndex](WriteAccess))
+	if hierarchy {
+		service.AddRequiredAccessComponent(NewComponentAccess[GlobalTransform](ReadAccess))
+		service.AddRequiredService("transform propagation")
+	}
+	service.SetRunFunction(func(chan EntityCreationData, chan component.EntityID) error {
+		renderables, err := GetReadStorage[Renderable](service)
+		if err != nil {
+			return err
+		}
+		transforms, err := GetReadStorage[Transform](service)
+		if err != nil {
+			return err
+		}
+		indexes, err := GetWriteStorage[SpatialIndex](service)
+		if err != nil {
+			return err
+		}
+		var globals component.ReadOnlyStorage[GlobalTransform]
+		if hierarchy {
+			if globals, err = GetReadStorage[GlobalTransform](service); err != nil {
+				return err
+			}
+		}
+		index := indexes.MustGetComponent(0)
+		if index.grid == nil {
+			index = NewSpatialIndex(0)
+		}
+		updateSpatialIndex(index, renderables, transforms, globals)
+		return indexes.Write(0, index)
+	})
+	return service
+}
+
+func updateSpatialIndex(index SpatialIndex, renderables component.ReadOnlyStorage[Renderable], transforms component.ReadOnlyStorage[Transform], globals component.ReadOnlyStorage[GlobalTransform]) {
+	global := func(e component.EntityID) *GlobalTransform {
+		if globals == nil {
+			return nil
+		}
+		if g, err := globals.GetComponent(e); err == nil {
+			return &g
+		}
+		return nil
+	}
+
+	current := map[component.EntityID]bool{}
+	for _, e := range renderables.GetEntities() {
+		current[e] = true
+		index.Insert(e, renderables.MustGetComponent(e).WorldBounds(global(e)))
+	}
+	for _, e := range transforms.GetEntities() {
+		if current[e] {
+			continue
+		}
+		current[e] = true
+		x, y := 0.0, 0.0
+		if g := global(e); g != nil {
+			x, y = g.Apply(0, 0)
+		} else {
+			x, y = transformOrigin(transforms.MustGetComponent(e))
+		}
+		index.Insert(e, PointBounds(x, y))
+	}
+
+	var removed []component.EntityID
+	for e := range index.grid.bounds {
+		if !current[e] {
+			removed = append(removed, e)
+		}
+	}
+	for _, e := range removed {
+		index.Remove(e)
+	}
+}
+
+func transformOrigin(t Transform) (float64, float64) {
+	return t[2], t[5]
+}
@@ -165,44 +165,38 @@ func (t Transform) GetType() reflect.Type { return reflect.TypeOf(t) }
 func (t Transform) IsComponent()          {}
 
 func (t Transform) Translate(XCoord, YCoord float64) Transform {
-	newMat := linmath.Identity[float64]()
-	newMat[2] = XCoord
-	newMat[5] = YCoord
-	t = Transform((linmath.Mat3f[float64](t).MatMul((linmath.Mat3f[float64](newMat)))))
-	return t
+	return t.apply(linmath.Translation2D(XCoord, YCoord))
 }
 
 func (t Transform) Reflect() Transform {
-	newMat := linmath.Identity[float64]()
-	newMat[0] = -1
-	t = Transform((linmath.Mat3f[float64](t).MatMul((linmath.Mat3f[float64](newMat)))))
-	return t
+	return t.apply(linmath.Scaling2D(-1.0, 1))
 }
 
 func (t Transform) Scale(XScale, YScale float64) Transform {
-	newMat := linmath.Identity[float64]()
-	newMat[0] = XScale
-	newMat[4] = YScale
-	t = Transform((linmath.Mat3f[float64](t).MatMul((linmath.Mat3f[float64](newMat)))))
-	return t
+	return t.apply(linmath.Scaling2D(XScale, YScale))
 }
 
 func (t Transform) Rotate(θ float64) Transform {
-	newMat := linmath.Identity[float64]()
-	newMat[0] = math.Cos(θ)
-	newMat[1] = (-1) * math.Sin(θ)
-	newMat[3] = math.Sin(θ)
-	newMat[4] = math.Cos(θ)
-	t = Transform((linmath.Mat3f[float64](t).MatMul((linmath.Mat3f[float64](newMat)))))
-	return t
+	return t.apply(linmath.Rotation2D(θ))
 }
 
 func (t Transform) Shear(XShear, YShear float64) Transform {
-	newMat := linmath.Identity[float64]()
-	newMat[1] = XShear
-	newMat[3] = YShear
-	t = Transform((linmath.Mat3f[float64](t).MatMul((linmath.Mat3f[float64](newMat)))))
-	return t
+	return t.apply(linmath.Shear2D(XShear, YShear))
+}
+
+//Applies m before the rest of the transform
+func (t Transform) apply(m linmath.Mat3f[float64]) Transform {
+	return Transform(linmath.Mat3f[float64](t).MatMul(m))
+}
+
+//Returns the transform that undoes this one
+func (t Transform) Inverse() Transform {
+	return Transform(linmath.Mat3f[float64](t).Inverse())
+}
+
+//Splits the transform into its translation, rotation, scale and skew
+func (t Transform) Decompose() linmath.Affine2D[float64] {
+	return linmath.Decompose2D(linmath.Mat3f[float64](t))
 }
 
 func NewTransform() Transform {
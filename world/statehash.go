@@ -0,0 +1,65 @@
+package world
+
+import (
+	"hash/fnv"
+	"reflect"
+	"sort"
+
+	"github.com/jevans40/Ruthenium/component"
+)
+
+//The hash of a single storage, see StorageHashes
+type StorageHash struct {
+	Type reflect.Type
+	Hash uint64
+}
+
+//Returns a hash of the living entities and the value of every resource and
+//component, see component.HashValue. Two worlds that ran the same ticks from the
+//same state have the same hash if they use a fixed timestep, since TickInfo is
+//included. Storages that do not implement ValueStorage or ResourceValueStorage,
+//like Events, are skipped. Must not be called while the world is running Maintain.
+func StateHash(d Dispatcher) uint64 {
+	h := fnv.New64a()
+	component.HashValue(h, d.GetEntities())
+	for _, storage := range StorageHashes(d) {
+		h.Write([]byte(storage.Type.String()))
+		component.HashValue(h, storage.Hash)
+	}
+	return h.Sum64()
+}
+
+//Returns the hash of every hashed storage sorted by type name. Comparing them
+//between two worlds whose StateHash differs shows which storages diverged.
+func StorageHashes(d Dispatcher) []StorageHash {
+	entities := d.GetEntities()
+	storages := d.GetStorages()
+	sort.Slice(storages, func(i, j int) bool {
+		return storages[i].GetType().String() < storages[j].GetType().String()
+	})
+	hashes := []StorageHash{}
+	for _, storage := range storages {
+		h := fnv.New64a()
+		switch typed := storage.(type) {
+		case component.ResourceValueStorage:
+			component.HashValue(h, typed.GetResource())
+		case component.ValueStorage:
+			//Entities are sorted so the storage order does not matter
+			for _, e := range entities {
+				if !storage.Exists(e) {
+					continue
+				}
+				value, err := typed.GetValue(e)
+				if err != nil {
+					continue
+				}
+				component.HashValue(h, e)
+				component.HashValue(h, value)
+			}
+		default:
+			continue
+		}
+		hashes = append(hashes, StorageHash{Type: storage.GetType(), Hash: h.Sum64()})
+	}
+	return hashes
+}
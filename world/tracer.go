@@ -0,0 +1,163 @@
+package world
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//Trace lanes used by the dispatcher, services are given lanes starting at traceServiceLane
+const (
+	traceDispatcherLane = iota
+	traceCreationLane
+	traceDeletionLane
+	traceServiceLane
+)
+
+//A single event in the Chrome trace_event format.
+//See https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type TraceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   float64                `json:"ts"`
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+//The Tracer records a timeline of dispatcher ticks that can be opened in
+//Perfetto or chrome://tracing. It is disabled until Capture is called, it then
+//records the requested number of ticks, writes the trace and disables itself.
+//All methods are safe to call from multiple goroutines.
+type Tracer struct {
+	enabled int32
+
+	lock      sync.Mutex
+	remaining int
+	output    io.Writer
+	start     time.Time
+	events    []TraceEvent
+	lanes     map[int]string
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{lanes: make(map[int]string)}
+}
+
+//Starts recording for the next ticks calls to Maintain, once they have run the
+//trace is written to output. Returns an error if a capture is already running.
+func (t *Tracer) Capture(ticks int, output io.Writer) error {
+	if ticks <= 0 {
+		return errors.New("trace capture requires at least one tick")
+	}
+	if output == nil {
+		return errors.New("trace capture requires an output")
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.IsEnabled() {
+		return errors.New("trace capture already running")
+	}
+	t.remaining = ticks
+	t.output = output
+	t.start = time.Now()
+	t.events = nil
+	t.lanes = make(map[int]string)
+	atomic.StoreInt32(&t.enabled, 1)
+	return nil
+}
+
+//Returns true while a capture is running
+func (t *Tracer) IsEnabled() bool {
+	return t != nil && atomic.LoadInt32(&t.enabled) == 1
+}
+
+//Records the start of a duration event on the given lane
+func (t *Tracer) Begin(lane int, name string, category string) {
+	t.record(lane, name, category, "B")
+}
+
+//Records the end of a duration event on the given lane
+func (t *Tracer) End(lane int, name string, category string) {
+	t.record(lane, name, category, "E")
+}
+
+//Names a lane, this is shown as the thread name in the trace viewer
+func (t *Tracer) NameLane(lane int, name string) {
+	if !t.IsEnabled() {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.lanes[lane] = name
+}
+
+func (t *Tracer) record(lane int, name string, category string, phase string) {
+	if !t.IsEnabled() {
+		return
+	}
+	event := TraceEvent{
+		Name: name,
+		Cat:  category,
+		Ph:   phase,
+		Pid:  1,
+		Tid:  lane,
+		Args: map[string]interface{}{"goroutine": goroutineID()},
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	event.Ts = float64(time.Since(t.start).Nanoseconds()) / 1000
+	t.events = append(t.events, event)
+}
+
+//Called by the dispatcher at the end of every tick. Once the requested number of
+//ticks has been recorded the trace is written and the tracer is disabled.
+func (t *Tracer) endTick() error {
+	if !t.IsEnabled() {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.remaining--
+	if t.remaining > 0 {
+		return nil
+	}
+	atomic.StoreInt32(&t.enabled, 0)
+	err := t.writeTrace(t.output)
+	t.events = nil
+	t.output = nil
+	return err
+}
+
+//Writes all recorded events as a trace_event JSON object, must hold the lock
+func (t *Tracer) writeTrace(output io.Writer) error {
+	events := make([]TraceEvent, 0, len(t.events)+len(t.lanes))
+	for lane, name := range t.lanes {
+		events = append(events, TraceEvent{Name: "thread_name", Ph: "M", Pid: 1, Tid: lane, Args: map[string]interface{}{"name": name}})
+	}
+	events = append(events, t.events...)
+	return json.NewEncoder(output).Encode(struct {
+		TraceEvents     []TraceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
+
+//Go does not expose goroutine ids, so this is parsed from the stack header.
+//It is slow, but only called while a capture is running.
+func goroutineID() int {
+	var buf [64]byte
+	header := buf[:runtime.Stack(buf[:], false)]
+	header = bytes.TrimPrefix(header, []byte("goroutine "))
+	if i := bytes.IndexByte(header, ' '); i >= 0 {
+		header = header[:i]
+	}
+	id, _ := strconv.Atoi(string(header))
+	return id
+}
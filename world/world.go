@@ -1,7 +1,9 @@
 package world
 
 import (
+	"io"
 	"reflect"
+	"time"
 
 	"github.com/jevans40/Ruthenium/component"
 	"github.com/jevans40/Ruthenium/render"
@@ -18,6 +20,17 @@ type World interface {
 	RegisterService(s Service)
 	RegisterStorage(s component.ComponentStorage)
 	Maintain() error
+
+	//Records a Chrome trace_event timeline of the next ticks calls to Maintain
+	//and writes it to output once they have finished.
+	TraceTicks(ticks int, output io.Writer) error
+
+	//Returns the dispatcher that runs this world
+	GetDispatcher() Dispatcher
+
+	//Returns a hash of all entities, resources and component data, see StateHash.
+	//Lockstep peers and replays compare it to find out if they diverged.
+	Checksum() uint64
 }
 
 type BaseWorld struct {
@@ -49,7 +62,16 @@ func NewBaseWorld(renderChannel chan []float32, window *render.GoWindow) World {
 	newWorld.dispatcher.AddService(renderService)
 
 	newWorld.dispatcher.AddStorage(RenderableStorage)
+	newWorld.dispatcher.AddStorage(component.NewVectorStorage[Quads]())
+	newWorld.dispatcher.AddStorage(component.NewResourceStorage(Viewport{}))
+	newWorld.dispatcher.AddStorage(component.NewResourceStorage(RenderStats{}))
 	newWorld.dispatcher.AddStorage(WindowResource)
+	newWorld.dispatcher.AddStorage(component.NewResourceStorage(NewRandom(time.Now().UnixNano())))
+	AddHierarchy(newWorld.dispatcher)
+	//Without a window there is nothing to size the viewport to, everything is drawn
+	if window != nil {
+		newWorld.dispatcher.AddService(NewViewportService(window.GetSize))
+	}
 	return &newWorld
 }
 
@@ -84,3 +106,15 @@ func (b *BaseWorld) RegisterStorage(s component.ComponentStorage) {
 func (b *BaseWorld) Maintain() error {
 	return b.dispatcher.Maintain()
 }
+
+func (b *BaseWorld) GetDispatcher() Dispatcher {
+	return b.dispatcher
+}
+
+func (b *BaseWorld) Checksum() uint64 {
+	return StateHash(b.dispatcher)
+}
+
+func (b *BaseWorld) TraceTicks(ticks int, output io.Writer) error {
+	return b.dispatcher.GetTracer().Capture(ticks, output)
+}